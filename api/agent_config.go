@@ -0,0 +1,519 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxAgentConfigVersions  = 2000
+	maxAgentConfigRollouts  = 4000
+	defaultAgentConfigWait  = 30
+	maxAgentConfigWaitSec   = 120
+	agentConfigScopeAgent   = "agent"
+	agentConfigScopeSite    = "site"
+	agentConfigScopeDefault = "global"
+)
+
+var (
+	ErrAgentConfigScope        = errors.New("invalid_config_scope")
+	ErrAgentConfigNotFound     = errors.New("config_version_not_found")
+	ErrAgentConfigStale        = errors.New("stale_config_version")
+	ErrAgentConfigState        = errors.New("invalid_rollout_state")
+	ErrAgentConfigMissingAgent = errors.New("missing_agent_id")
+)
+
+type AgentPollTarget struct {
+	Address  string `json:"address"`
+	DeviceID string `json:"device_id,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Protocol string `json:"protocol,omitempty"` // icmp | snmp | http | tcp
+	Port     int    `json:"port,omitempty"`
+}
+
+type AgentConfigSpec struct {
+	PollTargets        []AgentPollTarget            `json:"poll_targets,omitempty"`
+	ProbeIntervalSec   int                          `json:"probe_interval_sec,omitempty"`
+	SNMPCredentialRefs []string                     `json:"snmp_credential_refs,omitempty"`
+	GovernorHints      []TelemetryClassGovernorRule `json:"governor_hints,omitempty"`
+}
+
+type AgentConfigVersion struct {
+	Version        int             `json:"version"`
+	Scope          string          `json:"scope"` // agent | site | global
+	ScopeID        string          `json:"scope_id,omitempty"`
+	ETag           string          `json:"etag"`
+	Spec           AgentConfigSpec `json:"spec"`
+	CreatedAt      string          `json:"created_at"`
+	CreatedBy      string          `json:"created_by,omitempty"`
+	Note           string          `json:"note,omitempty"`
+	RolledBackFrom int             `json:"rolled_back_from,omitempty"`
+}
+
+type AgentConfigRollout struct {
+	AgentID   string `json:"agent_id"`
+	Scope     string `json:"scope"`
+	ScopeID   string `json:"scope_id,omitempty"`
+	Version   int    `json:"version"`
+	ETag      string `json:"etag"`
+	State     string `json:"state"` // pending | applied | failed
+	Error     string `json:"error,omitempty"`
+	UpdatedAt string `json:"updated_at"`
+	AppliedAt string `json:"applied_at,omitempty"`
+}
+
+type AgentConfigPublishRequest struct {
+	Scope   string          `json:"scope"`
+	ScopeID string          `json:"scope_id,omitempty"`
+	Spec    AgentConfigSpec `json:"spec"`
+	Actor   string          `json:"actor,omitempty"`
+	Note    string          `json:"note,omitempty"`
+}
+
+type AgentConfigRollbackRequest struct {
+	Scope   string `json:"scope"`
+	ScopeID string `json:"scope_id,omitempty"`
+	Version int    `json:"version"`
+	Actor   string `json:"actor,omitempty"`
+}
+
+type AgentConfigStatusRequest struct {
+	Version int    `json:"version"`
+	ETag    string `json:"etag,omitempty"`
+	State   string `json:"state"`
+	Error   string `json:"error,omitempty"`
+}
+
+type AgentConfigResponse struct {
+	AgentID  string             `json:"agent_id"`
+	Found    bool               `json:"found"`
+	Config   AgentConfigVersion `json:"config"`
+	Rollout  AgentConfigRollout `json:"rollout"`
+	WaitedMs int64              `json:"waited_ms"`
+	Stub     bool               `json:"stub"`
+}
+
+type AgentConfigVersionsResponse struct {
+	LastUpdated int64                `json:"last_updated"`
+	Count       int                  `json:"count"`
+	Versions    []AgentConfigVersion `json:"versions"`
+	Truncated   bool                 `json:"truncated"`
+	Limit       int                  `json:"limit"`
+	Stub        bool                 `json:"stub"`
+}
+
+type AgentConfigRolloutsResponse struct {
+	LastUpdated int64                `json:"last_updated"`
+	Count       int                  `json:"count"`
+	Rollouts    []AgentConfigRollout `json:"rollouts"`
+	Pending     int                  `json:"pending"`
+	Applied     int                  `json:"applied"`
+	Failed      int                  `json:"failed"`
+	Stub        bool                 `json:"stub"`
+}
+
+func normalizeAgentConfigScope(scope, scopeID string) (string, string, bool) {
+	scopeID = strings.TrimSpace(scopeID)
+	switch strings.ToLower(strings.TrimSpace(scope)) {
+	case agentConfigScopeAgent:
+		return agentConfigScopeAgent, scopeID, scopeID != ""
+	case agentConfigScopeSite:
+		return agentConfigScopeSite, scopeID, scopeID != ""
+	case "", agentConfigScopeDefault:
+		return agentConfigScopeDefault, "", true
+	default:
+		return "", "", false
+	}
+}
+
+func normalizeAgentConfigRolloutState(raw string) string {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "pending":
+		return "pending"
+	case "applied", "ok", "success":
+		return "applied"
+	case "failed", "error":
+		return "failed"
+	default:
+		return ""
+	}
+}
+
+func normalizeAgentConfigSpec(spec AgentConfigSpec) AgentConfigSpec {
+	out := AgentConfigSpec{
+		ProbeIntervalSec: spec.ProbeIntervalSec,
+	}
+	if out.ProbeIntervalSec < 0 {
+		out.ProbeIntervalSec = 0
+	}
+	for _, target := range spec.PollTargets {
+		target.Address = strings.TrimSpace(target.Address)
+		if target.Address == "" {
+			continue
+		}
+		target.DeviceID = strings.TrimSpace(target.DeviceID)
+		target.Role = strings.ToLower(strings.TrimSpace(target.Role))
+		target.Protocol = strings.ToLower(strings.TrimSpace(target.Protocol))
+		if target.Port < 0 || target.Port > 65535 {
+			target.Port = 0
+		}
+		out.PollTargets = append(out.PollTargets, target)
+	}
+	for _, ref := range spec.SNMPCredentialRefs {
+		out.SNMPCredentialRefs = appendUnique(out.SNMPCredentialRefs, ref)
+	}
+	if len(spec.GovernorHints) > 0 {
+		out.GovernorHints = normalizeTelemetryGovernorRules(spec.GovernorHints)
+	}
+	return out
+}
+
+func agentConfigETag(scope, scopeID string, version int, spec AgentConfigSpec) string {
+	body, _ := json.Marshal(spec)
+	sum := sha1.Sum([]byte(scope + "|" + scopeID + "|" + strconv.Itoa(version) + "|" + string(body)))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func cloneAgentConfigSpec(in AgentConfigSpec) AgentConfigSpec {
+	out := in
+	out.PollTargets = append([]AgentPollTarget(nil), in.PollTargets...)
+	out.SNMPCredentialRefs = append([]string(nil), in.SNMPCredentialRefs...)
+	out.GovernorHints = nil
+	for _, rule := range in.GovernorHints {
+		rule.Roles = append([]string(nil), rule.Roles...)
+		out.GovernorHints = append(out.GovernorHints, rule)
+	}
+	return out
+}
+
+func cloneAgentConfigVersion(in AgentConfigVersion) AgentConfigVersion {
+	out := in
+	out.Spec = cloneAgentConfigSpec(in.Spec)
+	return out
+}
+
+// AgentConfigChanged returns a channel that is closed the next time any
+// agent config version is published or rolled back.
+func (s *Store) AgentConfigChanged() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.agentConfigSignal == nil {
+		s.agentConfigSignal = make(chan struct{})
+	}
+	return s.agentConfigSignal
+}
+
+func (s *Store) notifyAgentConfigChangedLocked() {
+	if s.agentConfigSignal != nil {
+		close(s.agentConfigSignal)
+	}
+	s.agentConfigSignal = make(chan struct{})
+}
+
+func (s *Store) latestAgentConfigLocked(scope, scopeID string) (AgentConfigVersion, bool) {
+	for i := len(s.AgentConfigVersions) - 1; i >= 0; i-- {
+		item := s.AgentConfigVersions[i]
+		if item.Scope == scope && item.ScopeID == scopeID {
+			return item, true
+		}
+	}
+	return AgentConfigVersion{}, false
+}
+
+func (s *Store) appendAgentConfigVersionLocked(scope, scopeID string, spec AgentConfigSpec, actor, note string, rolledBackFrom int) AgentConfigVersion {
+	next := 1
+	if latest, ok := s.latestAgentConfigLocked(scope, scopeID); ok {
+		next = latest.Version + 1
+	}
+	version := AgentConfigVersion{
+		Version:        next,
+		Scope:          scope,
+		ScopeID:        scopeID,
+		ETag:           agentConfigETag(scope, scopeID, next, spec),
+		Spec:           spec,
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+		CreatedBy:      strings.TrimSpace(actor),
+		Note:           strings.TrimSpace(note),
+		RolledBackFrom: rolledBackFrom,
+	}
+	s.AgentConfigVersions = append(s.AgentConfigVersions, version)
+	if len(s.AgentConfigVersions) > maxAgentConfigVersions {
+		s.AgentConfigVersions = append([]AgentConfigVersion(nil), s.AgentConfigVersions[len(s.AgentConfigVersions)-maxAgentConfigVersions:]...)
+	}
+	s.markAgentConfigRolloutsPendingLocked()
+	s.notifyAgentConfigChangedLocked()
+	return cloneAgentConfigVersion(version)
+}
+
+func (s *Store) PublishAgentConfig(req AgentConfigPublishRequest) (AgentConfigVersion, error) {
+	scope, scopeID, ok := normalizeAgentConfigScope(req.Scope, req.ScopeID)
+	if !ok {
+		return AgentConfigVersion{}, ErrAgentConfigScope
+	}
+	spec := normalizeAgentConfigSpec(req.Spec)
+
+	s.mu.Lock()
+	version := s.appendAgentConfigVersionLocked(scope, scopeID, spec, req.Actor, req.Note, 0)
+	s.mu.Unlock()
+
+	s.save()
+	return version, nil
+}
+
+func (s *Store) RollbackAgentConfig(req AgentConfigRollbackRequest) (AgentConfigVersion, error) {
+	scope, scopeID, ok := normalizeAgentConfigScope(req.Scope, req.ScopeID)
+	if !ok {
+		return AgentConfigVersion{}, ErrAgentConfigScope
+	}
+
+	s.mu.Lock()
+	var target *AgentConfigVersion
+	for i := range s.AgentConfigVersions {
+		item := s.AgentConfigVersions[i]
+		if item.Scope == scope && item.ScopeID == scopeID && item.Version == req.Version {
+			target = &s.AgentConfigVersions[i]
+			break
+		}
+	}
+	if target == nil {
+		s.mu.Unlock()
+		return AgentConfigVersion{}, ErrAgentConfigNotFound
+	}
+	note := "Rollback to version " + strconv.Itoa(target.Version) + "."
+	version := s.appendAgentConfigVersionLocked(scope, scopeID, cloneAgentConfigSpec(target.Spec), req.Actor, note, target.Version)
+	s.mu.Unlock()
+
+	s.save()
+	return version, nil
+}
+
+func (s *Store) ListAgentConfigVersions(limit int, scope, scopeID string) ([]AgentConfigVersion, bool, int) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	scopeFilter := strings.ToLower(strings.TrimSpace(scope))
+	scopeIDFilter := strings.TrimSpace(scopeID)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]AgentConfigVersion, 0, min(limit, len(s.AgentConfigVersions)))
+	total := 0
+	for i := len(s.AgentConfigVersions) - 1; i >= 0; i-- {
+		item := s.AgentConfigVersions[i]
+		if scopeFilter != "" && item.Scope != scopeFilter {
+			continue
+		}
+		if scopeIDFilter != "" && item.ScopeID != scopeIDFilter {
+			continue
+		}
+		total++
+		if len(out) >= limit {
+			continue
+		}
+		out = append(out, cloneAgentConfigVersion(item))
+	}
+	return out, total > len(out), limit
+}
+
+// resolveAgentConfigLocked picks the most specific config for an agent:
+// agent scope first, then the agent's site, then the global default.
+func (s *Store) resolveAgentConfigLocked(agentID string) (AgentConfigVersion, bool) {
+	if version, ok := s.latestAgentConfigLocked(agentConfigScopeAgent, agentID); ok {
+		return version, true
+	}
+	for _, agent := range s.Agents {
+		if agent.ID != agentID || strings.TrimSpace(agent.SiteID) == "" {
+			continue
+		}
+		if version, ok := s.latestAgentConfigLocked(agentConfigScopeSite, strings.TrimSpace(agent.SiteID)); ok {
+			return version, true
+		}
+		break
+	}
+	return s.latestAgentConfigLocked(agentConfigScopeDefault, "")
+}
+
+func (s *Store) findAgentConfigRolloutLocked(agentID string) int {
+	for i := range s.AgentConfigRollouts {
+		if s.AgentConfigRollouts[i].AgentID == agentID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) markAgentConfigRolloutsPendingLocked() {
+	nowISO := time.Now().UTC().Format(time.RFC3339)
+	for _, agent := range s.Agents {
+		version, ok := s.resolveAgentConfigLocked(agent.ID)
+		if !ok {
+			continue
+		}
+		idx := s.findAgentConfigRolloutLocked(agent.ID)
+		if idx >= 0 && s.AgentConfigRollouts[idx].ETag == version.ETag {
+			continue
+		}
+		rollout := AgentConfigRollout{
+			AgentID:   agent.ID,
+			Scope:     version.Scope,
+			ScopeID:   version.ScopeID,
+			Version:   version.Version,
+			ETag:      version.ETag,
+			State:     "pending",
+			UpdatedAt: nowISO,
+		}
+		if idx >= 0 {
+			s.AgentConfigRollouts[idx] = rollout
+			continue
+		}
+		s.AgentConfigRollouts = append(s.AgentConfigRollouts, rollout)
+	}
+	if len(s.AgentConfigRollouts) > maxAgentConfigRollouts {
+		s.AgentConfigRollouts = append([]AgentConfigRollout(nil), s.AgentConfigRollouts[len(s.AgentConfigRollouts)-maxAgentConfigRollouts:]...)
+	}
+}
+
+// ResolveAgentConfig returns the desired config for an agent and records a
+// pending rollout the first time a given version is handed out.
+func (s *Store) ResolveAgentConfig(agentID string) (AgentConfigVersion, AgentConfigRollout, bool) {
+	agentID = strings.TrimSpace(agentID)
+	if agentID == "" {
+		return AgentConfigVersion{}, AgentConfigRollout{}, false
+	}
+
+	s.mu.Lock()
+	version, ok := s.resolveAgentConfigLocked(agentID)
+	if !ok {
+		s.mu.Unlock()
+		return AgentConfigVersion{}, AgentConfigRollout{}, false
+	}
+	changed := false
+	idx := s.findAgentConfigRolloutLocked(agentID)
+	if idx < 0 || s.AgentConfigRollouts[idx].ETag != version.ETag {
+		rollout := AgentConfigRollout{
+			AgentID:   agentID,
+			Scope:     version.Scope,
+			ScopeID:   version.ScopeID,
+			Version:   version.Version,
+			ETag:      version.ETag,
+			State:     "pending",
+			UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		if idx < 0 {
+			s.AgentConfigRollouts = append(s.AgentConfigRollouts, rollout)
+			idx = len(s.AgentConfigRollouts) - 1
+		} else {
+			s.AgentConfigRollouts[idx] = rollout
+		}
+		changed = true
+	}
+	rollout := s.AgentConfigRollouts[idx]
+	out := cloneAgentConfigVersion(version)
+	s.mu.Unlock()
+
+	if changed {
+		s.save()
+	}
+	return out, rollout, true
+}
+
+func (s *Store) ReportAgentConfigStatus(agentID string, req AgentConfigStatusRequest) (AgentConfigRollout, error) {
+	agentID = strings.TrimSpace(agentID)
+	if agentID == "" {
+		return AgentConfigRollout{}, ErrAgentConfigMissingAgent
+	}
+	state := normalizeAgentConfigRolloutState(req.State)
+	if state == "" {
+		return AgentConfigRollout{}, ErrAgentConfigState
+	}
+
+	s.mu.Lock()
+	idx := s.findAgentConfigRolloutLocked(agentID)
+	var rollout AgentConfigRollout
+	if idx >= 0 {
+		rollout = s.AgentConfigRollouts[idx]
+	} else {
+		version, ok := s.resolveAgentConfigLocked(agentID)
+		if !ok {
+			s.mu.Unlock()
+			return AgentConfigRollout{}, ErrAgentConfigNotFound
+		}
+		rollout = AgentConfigRollout{
+			AgentID: agentID,
+			Scope:   version.Scope,
+			ScopeID: version.ScopeID,
+			Version: version.Version,
+			ETag:    version.ETag,
+		}
+	}
+	etag := strings.TrimSpace(req.ETag)
+	if (req.Version > 0 && req.Version != rollout.Version) || (etag != "" && etag != rollout.ETag) {
+		// Status for a superseded version; keep the current rollout pending
+		// and record nothing for an agent that has no rollout yet.
+		s.mu.Unlock()
+		return rollout, ErrAgentConfigStale
+	}
+	nowISO := time.Now().UTC().Format(time.RFC3339)
+	rollout.State = state
+	rollout.UpdatedAt = nowISO
+	rollout.Error = ""
+	switch state {
+	case "applied":
+		rollout.AppliedAt = nowISO
+	case "failed":
+		rollout.Error = strings.TrimSpace(req.Error)
+	}
+	if idx >= 0 {
+		s.AgentConfigRollouts[idx] = rollout
+	} else {
+		s.AgentConfigRollouts = append(s.AgentConfigRollouts, rollout)
+	}
+	s.mu.Unlock()
+
+	s.save()
+	return rollout, nil
+}
+
+func (s *Store) ListAgentConfigRollouts(agentID, state string) AgentConfigRolloutsResponse {
+	agentFilter := strings.TrimSpace(agentID)
+	stateFilter := normalizeAgentConfigRolloutState(state)
+
+	s.mu.RLock()
+	rollouts := append([]AgentConfigRollout(nil), s.AgentConfigRollouts...)
+	s.mu.RUnlock()
+
+	resp := AgentConfigRolloutsResponse{
+		LastUpdated: time.Now().UnixMilli(),
+		Rollouts:    make([]AgentConfigRollout, 0, len(rollouts)),
+		Stub:        true,
+	}
+	for _, item := range rollouts {
+		if agentFilter != "" && item.AgentID != agentFilter {
+			continue
+		}
+		if stateFilter != "" && item.State != stateFilter {
+			continue
+		}
+		switch item.State {
+		case "pending":
+			resp.Pending++
+		case "applied":
+			resp.Applied++
+		case "failed":
+			resp.Failed++
+		}
+		resp.Rollouts = append(resp.Rollouts, item)
+	}
+	sort.SliceStable(resp.Rollouts, func(i, j int) bool {
+		return resp.Rollouts[i].AgentID < resp.Rollouts[j].AgentID
+	})
+	resp.Count = len(resp.Rollouts)
+	return resp
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgentConfigResolvesMostSpecificScopeAndTracksRollout(t *testing.T) {
+	s := LoadStore("")
+	s.RegisterAgent(AgentRegisterRequest{ID: "agent-a", SiteID: "site-1"})
+	s.RegisterAgent(AgentRegisterRequest{ID: "agent-b", SiteID: "site-2"})
+
+	global, err := s.PublishAgentConfig(AgentConfigPublishRequest{
+		Scope: "global",
+		Spec:  AgentConfigSpec{ProbeIntervalSec: 60},
+	})
+	if err != nil {
+		t.Fatalf("publish global config: %v", err)
+	}
+	site, err := s.PublishAgentConfig(AgentConfigPublishRequest{
+		Scope:   "site",
+		ScopeID: "site-1",
+		Spec: AgentConfigSpec{
+			ProbeIntervalSec:   15,
+			PollTargets:        []AgentPollTarget{{Address: " 10.0.0.1 ", Protocol: "ICMP"}, {Address: ""}},
+			SNMPCredentialRefs: []string{"vault:snmp/site-1", "vault:snmp/site-1"},
+		},
+		Actor: "noc",
+	})
+	if err != nil {
+		t.Fatalf("publish site config: %v", err)
+	}
+	if site.Version != 1 || global.Version != 1 {
+		t.Fatalf("expected per-scope version numbering, got site=%d global=%d", site.Version, global.Version)
+	}
+	if len(site.Spec.PollTargets) != 1 || site.Spec.PollTargets[0].Address != "10.0.0.1" || site.Spec.PollTargets[0].Protocol != "icmp" {
+		t.Fatalf("expected normalized poll targets, got %#v", site.Spec.PollTargets)
+	}
+	if len(site.Spec.SNMPCredentialRefs) != 1 {
+		t.Fatalf("expected deduped credential refs, got %#v", site.Spec.SNMPCredentialRefs)
+	}
+
+	cfgA, rolloutA, ok := s.ResolveAgentConfig("agent-a")
+	if !ok || cfgA.Scope != "site" || cfgA.ETag != site.ETag {
+		t.Fatalf("expected agent-a to resolve site config, got %#v ok=%t", cfgA, ok)
+	}
+	if rolloutA.State != "pending" {
+		t.Fatalf("expected pending rollout for agent-a, got %#v", rolloutA)
+	}
+	cfgB, _, ok := s.ResolveAgentConfig("agent-b")
+	if !ok || cfgB.Scope != "global" {
+		t.Fatalf("expected agent-b to fall back to global config, got %#v", cfgB)
+	}
+
+	if _, err := s.ReportAgentConfigStatus("agent-a", AgentConfigStatusRequest{Version: cfgA.Version, ETag: cfgA.ETag, State: "applied"}); err != nil {
+		t.Fatalf("report applied: %v", err)
+	}
+	if _, err := s.ReportAgentConfigStatus("agent-b", AgentConfigStatusRequest{Version: cfgB.Version, State: "failed", Error: "snmp ref missing"}); err != nil {
+		t.Fatalf("report failed: %v", err)
+	}
+	rollouts := s.ListAgentConfigRollouts("", "")
+	if rollouts.Applied != 1 || rollouts.Failed != 1 || rollouts.Pending != 0 {
+		t.Fatalf("unexpected rollout counts applied=%d failed=%d pending=%d", rollouts.Applied, rollouts.Failed, rollouts.Pending)
+	}
+
+	override, err := s.PublishAgentConfig(AgentConfigPublishRequest{
+		Scope:   "agent",
+		ScopeID: "agent-a",
+		Spec:    AgentConfigSpec{ProbeIntervalSec: 5},
+	})
+	if err != nil {
+		t.Fatalf("publish agent override: %v", err)
+	}
+	pending := s.ListAgentConfigRollouts("agent-a", "pending")
+	if pending.Count != 1 || pending.Rollouts[0].ETag != override.ETag {
+		t.Fatalf("expected agent-a rollout reset to pending for override, got %#v", pending.Rollouts)
+	}
+	if _, err := s.ReportAgentConfigStatus("agent-a", AgentConfigStatusRequest{ETag: site.ETag, State: "applied"}); err != ErrAgentConfigStale {
+		t.Fatalf("expected stale status to be rejected, got err=%v", err)
+	}
+
+	if _, err := s.PublishAgentConfig(AgentConfigPublishRequest{Scope: "site"}); err != ErrAgentConfigScope {
+		t.Fatalf("expected scope validation error, got %v", err)
+	}
+}
+
+func TestAgentConfigRollbackCreatesNewVersionAndSignalsWaiters(t *testing.T) {
+	s := LoadStore("")
+	s.RegisterAgent(AgentRegisterRequest{ID: "agent-r", SiteID: "site-r"})
+
+	v1, err := s.PublishAgentConfig(AgentConfigPublishRequest{Scope: "agent", ScopeID: "agent-r", Spec: AgentConfigSpec{ProbeIntervalSec: 30}})
+	if err != nil {
+		t.Fatalf("publish v1: %v", err)
+	}
+	v2, err := s.PublishAgentConfig(AgentConfigPublishRequest{Scope: "agent", ScopeID: "agent-r", Spec: AgentConfigSpec{ProbeIntervalSec: 1}})
+	if err != nil {
+		t.Fatalf("publish v2: %v", err)
+	}
+	if v1.ETag == v2.ETag {
+		t.Fatalf("expected distinct etags per version")
+	}
+
+	changed := s.AgentConfigChanged()
+	v3, err := s.RollbackAgentConfig(AgentConfigRollbackRequest{Scope: "agent", ScopeID: "agent-r", Version: 1, Actor: "noc"})
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected rollback to signal config waiters")
+	}
+	if v3.Version != 3 || v3.RolledBackFrom != 1 || v3.Spec.ProbeIntervalSec != 30 {
+		t.Fatalf("unexpected rollback version: %#v", v3)
+	}
+	if v3.ETag == v1.ETag {
+		t.Fatalf("expected rollback to produce a fresh etag so agents re-fetch")
+	}
+
+	resolved, _, ok := s.ResolveAgentConfig("agent-r")
+	if !ok || resolved.Version != 3 {
+		t.Fatalf("expected agent to resolve rollback version, got %#v", resolved)
+	}
+
+	versions, truncated, _ := s.ListAgentConfigVersions(10, "agent", "agent-r")
+	if len(versions) != 3 || truncated || versions[0].Version != 3 {
+		t.Fatalf("expected newest-first version history, got %#v", versions)
+	}
+
+	if _, err := s.RollbackAgentConfig(AgentConfigRollbackRequest{Scope: "agent", ScopeID: "agent-r", Version: 9}); err != ErrAgentConfigNotFound {
+		t.Fatalf("expected missing version error, got %v", err)
+	}
+}
+
+func TestAgentConfigStatusSeparatesMissingAndStale(t *testing.T) {
+	s := LoadStore("")
+	if _, err := s.ReportAgentConfigStatus("agent-x", AgentConfigStatusRequest{State: "applied"}); err != ErrAgentConfigNotFound {
+		t.Fatalf("expected missing config error, got err=%v", err)
+	}
+	global, err := s.PublishAgentConfig(AgentConfigPublishRequest{Scope: "global", Spec: AgentConfigSpec{ProbeIntervalSec: 60}})
+	if err != nil {
+		t.Fatalf("publish global config: %v", err)
+	}
+	if _, err := s.ReportAgentConfigStatus("agent-x", AgentConfigStatusRequest{Version: global.Version + 1, State: "applied"}); err != ErrAgentConfigStale {
+		t.Fatalf("expected stale version error, got err=%v", err)
+	}
+	if rollouts := s.ListAgentConfigRollouts("agent-x", ""); rollouts.Count != 0 {
+		t.Fatalf("expected rejected status to record no rollout, got %#v", rollouts.Rollouts)
+	}
+	rollout, err := s.ReportAgentConfigStatus("agent-x", AgentConfigStatusRequest{Version: global.Version, State: "applied"})
+	if err != nil || rollout.State != "applied" || rollout.ETag != global.ETag {
+		t.Fatalf("expected applied rollout, got err=%v rollout=%#v", err, rollout)
+	}
+	if rollouts := s.ListAgentConfigRollouts("agent-x", "applied"); rollouts.Count != 1 {
+		t.Fatalf("expected one applied rollout, got %#v", rollouts.Rollouts)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxAgentIngestGapRanges = 256
+	maxAgentIngestBatch     = 1000
+	maxAgentRetiredEpochs   = 64
+)
+
+var (
+	ErrAgentIngestMissingAgent = errors.New("missing_agent_id")
+	ErrAgentIngestMissingSeq   = errors.New("missing_seq")
+	ErrAgentIngestMissingID    = errors.New("missing_device_id")
+)
+
+type AgentSeqRange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// AgentIngestCursor tracks which sequence numbers an agent has delivered.
+// Everything at or below HighWaterSeq has been accepted except the seqs
+// listed in Gaps, which the agent may still resend. Seqs are scoped to the
+// agent's Epoch (a boot or buffer ID); a new epoch starts a fresh sequence.
+// Epochs the agent moved away from are kept in RetiredEpochs so a late or
+// replayed batch from one of them cannot be applied a second time.
+type AgentIngestCursor struct {
+	AgentID        string          `json:"agent_id"`
+	Epoch          string          `json:"epoch,omitempty"`
+	EpochResets    int64           `json:"epoch_resets,omitempty"`
+	RetiredEpochs  []string        `json:"retired_epochs,omitempty"`
+	StaleEpochSeqs int64           `json:"stale_epoch_seqs,omitempty"`
+	HighWaterSeq   int64           `json:"high_water_seq"`
+	Gaps           []AgentSeqRange `json:"gaps,omitempty"`
+	AcceptedCount  int64           `json:"accepted_count"`
+	DuplicateCount int64           `json:"duplicate_count"`
+	GapFillCount   int64           `json:"gap_fill_count"`
+	AbandonedSeqs  int64           `json:"abandoned_seqs"`
+	LastAcceptedAt string          `json:"last_accepted_at,omitempty"`
+	LastSeenAt     string          `json:"last_seen_at,omitempty"`
+}
+
+type TelemetryIngestAck struct {
+	AgentID        string          `json:"agent_id"`
+	Epoch          string          `json:"epoch,omitempty"`
+	Seq            int64           `json:"seq"`
+	Status         string          `json:"status"` // accepted | duplicate | gap_filled | stale_epoch
+	DurableFrom    int64           `json:"durable_from"`
+	DurableThrough int64           `json:"durable_through"`
+	HighWaterSeq   int64           `json:"high_water_seq"`
+	Gaps           []AgentSeqRange `json:"gaps,omitempty"`
+}
+
+type AgentIngestBatchRequest struct {
+	Epoch   string                   `json:"epoch,omitempty"`
+	Samples []TelemetryIngestRequest `json:"samples"`
+}
+
+type AgentIngestBatchItem struct {
+	Seq      int64     `json:"seq"`
+	DeviceID string    `json:"device_id,omitempty"`
+	Status   string    `json:"status"` // accepted | duplicate | gap_filled | stale_epoch | rejected
+	Error    string    `json:"error,omitempty"`
+	Incident *Incident `json:"incident,omitempty"`
+}
+
+type AgentIngestBatchResponse struct {
+	AgentID    string                 `json:"agent_id"`
+	Accepted   int                    `json:"accepted"`
+	Duplicates int                    `json:"duplicates"`
+	Rejected   int                    `json:"rejected"`
+	Items      []AgentIngestBatchItem `json:"items"`
+	Ack        TelemetryIngestAck     `json:"ack"`
+	Stub       bool                   `json:"stub"`
+}
+
+type AgentIngestCursorsResponse struct {
+	LastUpdated int64               `json:"last_updated"`
+	Count       int                 `json:"count"`
+	Cursors     []AgentIngestCursor `json:"cursors"`
+	Stub        bool                `json:"stub"`
+}
+
+// IngestAgentTelemetry accepts a sequenced sample at most once per agent.
+// Duplicates are acknowledged without being applied so agents can drop
+// them from their local buffer.
+func (s *Store) IngestAgentTelemetry(req TelemetryIngestRequest) (Device, *Incident, TelemetryIngestAck, error) {
+	agentID := strings.TrimSpace(req.AgentID)
+	if agentID == "" {
+		return Device{}, nil, TelemetryIngestAck{}, ErrAgentIngestMissingAgent
+	}
+	if req.Seq <= 0 {
+		return Device{}, nil, TelemetryIngestAck{}, ErrAgentIngestMissingSeq
+	}
+	if strings.TrimSpace(req.DeviceID) == "" {
+		return Device{}, nil, TelemetryIngestAck{}, ErrAgentIngestMissingID
+	}
+	req.AgentID = agentID
+	req.Epoch = strings.TrimSpace(req.Epoch)
+	nowISO := time.Now().UTC().Format(time.RFC3339)
+
+	// The seq is claimed before the sample is applied so concurrent retries
+	// of the same sample cannot both pass the duplicate check.
+	s.mu.Lock()
+	status := s.claimAgentSeqLocked(agentID, req.Epoch, req.Seq, nowISO)
+	if !agentAckApplied(status) {
+		// Only counters changed; they are persisted with the next save
+		// rather than rewriting the store for every resent sample.
+		s.recordAgentDuplicateLocked(req)
+		ack := s.agentIngestAckLocked(agentID, req.Seq, status)
+		s.mu.Unlock()
+		return Device{}, nil, ack, nil
+	}
+	s.mu.Unlock()
+
+	device, incident, _, _ := s.IngestTelemetryWithDecision(req)
+
+	s.mu.RLock()
+	ack := s.agentIngestAckLocked(agentID, req.Seq, status)
+	s.mu.RUnlock()
+	return device, incident, ack, nil
+}
+
+// IngestAgentTelemetryBatch applies a resent buffer in sequence order.
+// Samples without an epoch take the batch epoch.
+func (s *Store) IngestAgentTelemetryBatch(agentID, epoch string, samples []TelemetryIngestRequest) (AgentIngestBatchResponse, error) {
+	agentID = strings.TrimSpace(agentID)
+	if agentID == "" {
+		return AgentIngestBatchResponse{}, ErrAgentIngestMissingAgent
+	}
+	if len(samples) > maxAgentIngestBatch {
+		samples = samples[:maxAgentIngestBatch]
+	}
+	ordered := append([]TelemetryIngestRequest(nil), samples...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Seq < ordered[j].Seq })
+
+	resp := AgentIngestBatchResponse{AgentID: agentID, Items: make([]AgentIngestBatchItem, 0, len(ordered)), Stub: true}
+	for _, sample := range ordered {
+		sample.AgentID = agentID
+		sample.Epoch = firstNonEmpty(sample.Epoch, epoch)
+		item := AgentIngestBatchItem{Seq: sample.Seq, DeviceID: strings.TrimSpace(sample.DeviceID)}
+		_, incident, ack, err := s.IngestAgentTelemetry(sample)
+		if err != nil {
+			item.Status = "rejected"
+			item.Error = err.Error()
+			resp.Rejected++
+		} else {
+			item.Status = ack.Status
+			item.Incident = incident
+			if !agentAckApplied(ack.Status) {
+				resp.Duplicates++
+			} else {
+				resp.Accepted++
+			}
+		}
+		resp.Items = append(resp.Items, item)
+	}
+
+	s.mu.RLock()
+	resp.Ack = s.agentIngestAckLocked(agentID, 0, "")
+	s.mu.RUnlock()
+	return resp, nil
+}
+
+func (s *Store) GetAgentIngestCursor(agentID string) (AgentIngestCursor, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cursor, ok := s.AgentIngestCursors[strings.TrimSpace(agentID)]
+	if !ok {
+		return AgentIngestCursor{}, false
+	}
+	return cloneAgentIngestCursor(cursor), true
+}
+
+func (s *Store) ListAgentIngestCursors() []AgentIngestCursor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]AgentIngestCursor, 0, len(s.AgentIngestCursors))
+	for _, cursor := range s.AgentIngestCursors {
+		out = append(out, cloneAgentIngestCursor(cursor))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AgentID < out[j].AgentID })
+	return out
+}
+
+func (s *Store) claimAgentSeqLocked(agentID, epoch string, seq int64, nowISO string) string {
+	if s.AgentIngestCursors == nil {
+		s.AgentIngestCursors = map[string]AgentIngestCursor{}
+	}
+	cursor := s.AgentIngestCursors[agentID]
+	cursor.AgentID = agentID
+	cursor.LastSeenAt = nowISO
+	if epoch != "" && containsString(cursor.RetiredEpochs, epoch) {
+		// A late or replayed sample from a buffer the agent already left
+		// behind: its seqs were accepted or abandoned at the switch.
+		cursor.StaleEpochSeqs++
+		s.AgentIngestCursors[agentID] = cursor
+		return "stale_epoch"
+	}
+	if epoch != "" && epoch != cursor.Epoch {
+		// The agent restarted with a new buffer: its seqs start over, and
+		// gaps from the old epoch can never be backfilled. A cursor without
+		// an epoch just adopts the first one it sees.
+		if cursor.Epoch != "" {
+			for _, gap := range cursor.Gaps {
+				cursor.AbandonedSeqs += gap.To - gap.From + 1
+			}
+			cursor.HighWaterSeq = 0
+			cursor.Gaps = nil
+			cursor.EpochResets++
+			cursor.RetiredEpochs = append(cursor.RetiredEpochs, cursor.Epoch)
+			if len(cursor.RetiredEpochs) > maxAgentRetiredEpochs {
+				cursor.RetiredEpochs = append([]string(nil), cursor.RetiredEpochs[len(cursor.RetiredEpochs)-maxAgentRetiredEpochs:]...)
+			}
+		}
+		cursor.Epoch = epoch
+	}
+
+	status := "accepted"
+	switch {
+	case seq > cursor.HighWaterSeq:
+		if seq > cursor.HighWaterSeq+1 {
+			cursor.Gaps = append(cursor.Gaps, AgentSeqRange{From: cursor.HighWaterSeq + 1, To: seq - 1})
+		}
+		cursor.HighWaterSeq = seq
+	default:
+		gapIdx := -1
+		for i, gap := range cursor.Gaps {
+			if seq >= gap.From && seq <= gap.To {
+				gapIdx = i
+				break
+			}
+		}
+		if gapIdx < 0 {
+			cursor.DuplicateCount++
+			s.AgentIngestCursors[agentID] = cursor
+			return "duplicate"
+		}
+		cursor.Gaps = splitAgentSeqGap(cursor.Gaps, gapIdx, seq)
+		cursor.GapFillCount++
+		status = "gap_filled"
+	}
+
+	if len(cursor.Gaps) > maxAgentIngestGapRanges {
+		// Oldest gaps are given up on; the agent can no longer backfill them.
+		for _, gap := range cursor.Gaps[:len(cursor.Gaps)-maxAgentIngestGapRanges] {
+			cursor.AbandonedSeqs += gap.To - gap.From + 1
+		}
+		cursor.Gaps = append([]AgentSeqRange(nil), cursor.Gaps[len(cursor.Gaps)-maxAgentIngestGapRanges:]...)
+	}
+	cursor.AcceptedCount++
+	cursor.LastAcceptedAt = nowISO
+	s.AgentIngestCursors[agentID] = cursor
+	return status
+}
+
+// agentAckApplied reports whether a claimed seq should be applied; the
+// other statuses are acknowledged so the agent drops the sample.
+func agentAckApplied(status string) bool {
+	return status == "accepted" || status == "gap_filled"
+}
+
+func splitAgentSeqGap(gaps []AgentSeqRange, idx int, seq int64) []AgentSeqRange {
+	gap := gaps[idx]
+	out := make([]AgentSeqRange, 0, len(gaps)+1)
+	out = append(out, gaps[:idx]...)
+	if seq > gap.From {
+		out = append(out, AgentSeqRange{From: gap.From, To: seq - 1})
+	}
+	if seq < gap.To {
+		out = append(out, AgentSeqRange{From: seq + 1, To: gap.To})
+	}
+	return append(out, gaps[idx+1:]...)
+}
+
+func (s *Store) recordAgentDuplicateLocked(req TelemetryIngestRequest) {
+	if s.TelemetryQualityBySource == nil {
+		s.TelemetryQualityBySource = map[string]TelemetrySourceQualityStats{}
+	}
+	key := strings.TrimSpace(req.Source)
+	if key == "" {
+		key = defaultDeviceSourceName
+	}
+	stats := s.TelemetryQualityBySource[key]
+	stats.Source = key
+	stats.DuplicateSamples++
+	stats.UpdatedAtMs = time.Now().UnixMilli()
+	s.TelemetryQualityBySource[key] = stats
+}
+
+// agentIngestAckLocked reports the contiguous durable range: every seq from
+// DurableFrom through DurableThrough is stored and need not be resent.
+func (s *Store) agentIngestAckLocked(agentID string, seq int64, status string) TelemetryIngestAck {
+	cursor := s.AgentIngestCursors[agentID]
+	ack := TelemetryIngestAck{
+		AgentID:        agentID,
+		Epoch:          cursor.Epoch,
+		Seq:            seq,
+		Status:         status,
+		HighWaterSeq:   cursor.HighWaterSeq,
+		DurableThrough: cursor.HighWaterSeq,
+		Gaps:           append([]AgentSeqRange(nil), cursor.Gaps...),
+	}
+	if cursor.HighWaterSeq > 0 {
+		ack.DurableFrom = 1
+	}
+	if len(cursor.Gaps) > 0 {
+		ack.DurableThrough = cursor.Gaps[0].From - 1
+	}
+	return ack
+}
+
+func cloneAgentIngestCursor(in AgentIngestCursor) AgentIngestCursor {
+	out := in
+	out.Gaps = append([]AgentSeqRange(nil), in.Gaps...)
+	out.RetiredEpochs = append([]string(nil), in.RetiredEpochs...)
+	return out
+}
+
+func cloneAgentIngestCursors(in map[string]AgentIngestCursor) map[string]AgentIngestCursor {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string]AgentIngestCursor, len(in))
+	for agentID, cursor := range in {
+		out[agentID] = cloneAgentIngestCursor(cursor)
+	}
+	return out
+}
@@ -0,0 +1,145 @@
+package main
+
+import "testing"
+
+func TestAgentIngestRejectsDuplicatesWithoutReopeningIncidents(t *testing.T) {
+	s := LoadStore("")
+	s.mu.Lock()
+	s.Devices = nil
+	s.Incidents = nil
+	s.mu.Unlock()
+
+	offline := false
+	online := true
+	_, incident, ack, err := s.IngestAgentTelemetry(TelemetryIngestRequest{
+		Source: "agent_seq_test", AgentID: "agent-s", Seq: 1, DeviceID: "seq-node", Online: &offline,
+	})
+	if err != nil || incident == nil || ack.Status != "accepted" {
+		t.Fatalf("expected offline incident on first sample, ack=%#v err=%v", ack, err)
+	}
+	if _, _, ack, err = s.IngestAgentTelemetry(TelemetryIngestRequest{
+		Source: "agent_seq_test", AgentID: "agent-s", Seq: 2, DeviceID: "seq-node", Online: &online,
+	}); err != nil || ack.DurableThrough != 2 {
+		t.Fatalf("expected durable through 2, ack=%#v err=%v", ack, err)
+	}
+
+	// A retry of the buffered offline sample must not reopen the incident.
+	_, reopened, ack, err := s.IngestAgentTelemetry(TelemetryIngestRequest{
+		Source: "agent_seq_test", AgentID: "agent-s", Seq: 1, DeviceID: "seq-node", Online: &offline,
+	})
+	if err != nil || ack.Status != "duplicate" || reopened != nil {
+		t.Fatalf("expected duplicate ack without incident, ack=%#v incident=%v err=%v", ack, reopened, err)
+	}
+	s.mu.RLock()
+	openCount := 0
+	for _, inc := range s.Incidents {
+		if inc.DeviceID == "seq-node" && inc.Resolved == nil {
+			openCount++
+		}
+	}
+	stats := s.TelemetryQualityBySource["agent_seq_test"]
+	s.mu.RUnlock()
+	if openCount != 0 {
+		t.Fatalf("expected no open incidents after duplicate replay, got=%d", openCount)
+	}
+	if stats.AcceptedSamples != 2 || stats.DuplicateSamples != 1 {
+		t.Fatalf("expected 2 accepted and 1 duplicate sample, got=%#v", stats)
+	}
+
+	if _, _, _, err := s.IngestAgentTelemetry(TelemetryIngestRequest{AgentID: "agent-s", DeviceID: "seq-node"}); err != ErrAgentIngestMissingSeq {
+		t.Fatalf("expected missing seq error, got=%v", err)
+	}
+}
+
+func TestAgentIngestReportsAndFillsGaps(t *testing.T) {
+	s := LoadStore("")
+	online := true
+	sample := func(seq int64) TelemetryIngestRequest {
+		return TelemetryIngestRequest{Source: "agent_gap_test", AgentID: "agent-g", Seq: seq, DeviceID: "gap-node", Online: &online}
+	}
+
+	for _, seq := range []int64{1, 2, 6} {
+		if _, _, _, err := s.IngestAgentTelemetry(sample(seq)); err != nil {
+			t.Fatalf("ingest seq=%d: %v", seq, err)
+		}
+	}
+	cursor, ok := s.GetAgentIngestCursor("agent-g")
+	if !ok || cursor.HighWaterSeq != 6 || len(cursor.Gaps) != 1 || cursor.Gaps[0] != (AgentSeqRange{From: 3, To: 5}) {
+		t.Fatalf("expected gap 3-5 below high water 6, got=%#v", cursor)
+	}
+
+	_, _, ack, err := s.IngestAgentTelemetry(sample(4))
+	if err != nil || ack.Status != "gap_filled" {
+		t.Fatalf("expected gap fill, ack=%#v err=%v", ack, err)
+	}
+	if len(ack.Gaps) != 2 || ack.DurableThrough != 2 {
+		t.Fatalf("expected split gaps and durable through 2, got=%#v", ack)
+	}
+
+	batch, err := s.IngestAgentTelemetryBatch("agent-g", "", []TelemetryIngestRequest{sample(5), sample(3), sample(4), sample(7)})
+	if err != nil {
+		t.Fatalf("batch ingest: %v", err)
+	}
+	if batch.Accepted != 3 || batch.Duplicates != 1 {
+		t.Fatalf("expected 3 accepted and 1 duplicate, got=%#v", batch)
+	}
+	if batch.Items[0].Seq != 3 || batch.Ack.DurableThrough != 7 || len(batch.Ack.Gaps) != 0 {
+		t.Fatalf("expected ordered batch with contiguous durable range, got=%#v", batch)
+	}
+}
+
+func TestAgentIngestNewEpochRestartsSequence(t *testing.T) {
+	s := LoadStore("")
+	online := true
+	sample := func(epoch string, seq int64) TelemetryIngestRequest {
+		return TelemetryIngestRequest{Source: "agent_epoch_test", AgentID: "agent-e", Epoch: epoch, Seq: seq, DeviceID: "epoch-node", Online: &online}
+	}
+	for _, seq := range []int64{1, 2, 3, 5} {
+		if _, _, ack, err := s.IngestAgentTelemetry(sample("boot-1", seq)); err != nil || ack.Status != "accepted" {
+			t.Fatalf("seq=%d: expected accepted, got ack=%#v err=%v", seq, ack, err)
+		}
+	}
+	if _, _, ack, _ := s.IngestAgentTelemetry(sample("boot-1", 2)); ack.Status != "duplicate" {
+		t.Fatalf("expected resend within the epoch to be a duplicate, got=%#v", ack)
+	}
+
+	// The agent lost its buffer and restarted: seq 1 of the new epoch is new data.
+	_, _, ack, err := s.IngestAgentTelemetry(sample("boot-2", 1))
+	if err != nil || ack.Status != "accepted" || ack.Epoch != "boot-2" || ack.HighWaterSeq != 1 || len(ack.Gaps) != 0 {
+		t.Fatalf("expected new epoch to restart the sequence, got ack=%#v err=%v", ack, err)
+	}
+	cursor, ok := s.GetAgentIngestCursor("agent-e")
+	if !ok || cursor.EpochResets != 1 || cursor.AbandonedSeqs != 1 || cursor.AcceptedCount != 5 || cursor.DuplicateCount != 1 {
+		t.Fatalf("unexpected cursor after epoch change: %#v", cursor)
+	}
+}
+
+func TestAgentIngestRejectsSeqsFromRetiredEpoch(t *testing.T) {
+	s := LoadStore("")
+	online := true
+	sample := func(epoch string, seq int64) TelemetryIngestRequest {
+		return TelemetryIngestRequest{Source: "agent_epoch_test", AgentID: "agent-r", Epoch: epoch, Seq: seq, DeviceID: "replay-node", Online: &online}
+	}
+	for _, seq := range []int64{1, 2, 3} {
+		if _, _, ack, _ := s.IngestAgentTelemetry(sample("A", seq)); ack.Status != "accepted" {
+			t.Fatalf("A:%d: expected accepted, got=%#v", seq, ack)
+		}
+	}
+	if _, _, ack, _ := s.IngestAgentTelemetry(sample("B", 1)); ack.Status != "accepted" {
+		t.Fatalf("B:1: expected accepted, got=%#v", ack)
+	}
+
+	// A late batch from the previous epoch must not be applied again or
+	// switch the cursor back.
+	resp, err := s.IngestAgentTelemetryBatch("agent-r", "A", []TelemetryIngestRequest{sample("", 2), sample("", 4)})
+	if err != nil || resp.Accepted != 0 || resp.Duplicates != 2 || resp.Items[0].Status != "stale_epoch" || resp.Ack.Epoch != "B" {
+		t.Fatalf("expected the old epoch to be refused, resp=%#v err=%v", resp, err)
+	}
+	if _, _, ack, _ := s.IngestAgentTelemetry(sample("B", 2)); ack.Status != "accepted" || ack.HighWaterSeq != 2 {
+		t.Fatalf("expected the current epoch to continue, got=%#v", ack)
+	}
+	cursor, _ := s.GetAgentIngestCursor("agent-r")
+	if cursor.AcceptedCount != 5 || cursor.StaleEpochSeqs != 2 || cursor.EpochResets != 1 || len(cursor.RetiredEpochs) != 1 {
+		t.Fatalf("unexpected cursor after replay: %#v", cursor)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	alertmanagerSource = "alertmanager"
+	grafanaSource      = "grafana"
+)
+
+var ErrAlertWebhookVersion = errors.New("unsupported_webhook_version")
+
+// AlertWebhookPayload covers the Alertmanager v4 webhook body, which Grafana
+// unified alerting also sends, plus the top-level fields of Grafana legacy
+// dashboard alerts.
+type AlertWebhookPayload struct {
+	Version      string              `json:"version"`
+	Status       string              `json:"status"`
+	Receiver     string              `json:"receiver"`
+	ExternalURL  string              `json:"externalURL"`
+	CommonLabels map[string]string   `json:"commonLabels"`
+	Alerts       []AlertWebhookAlert `json:"alerts"`
+
+	Title    string            `json:"title"`
+	State    string            `json:"state"`
+	Message  string            `json:"message"`
+	RuleID   int64             `json:"ruleId"`
+	RuleName string            `json:"ruleName"`
+	RuleURL  string            `json:"ruleUrl"`
+	Tags     map[string]string `json:"tags"`
+	OrgID    int64             `json:"orgId"`
+}
+
+type AlertWebhookAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     string            `json:"startsAt"`
+	EndsAt       string            `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+	DashboardURL string            `json:"dashboardURL"`
+	PanelURL     string            `json:"panelURL"`
+}
+
+// WebhookAlert is one alert after label mapping, ready to open or resolve an
+// incident keyed by source and fingerprint.
+type WebhookAlert struct {
+	Fingerprint string `json:"fingerprint"`
+	Firing      bool   `json:"firing"`
+	Device      string `json:"device,omitempty"`
+	SiteID      string `json:"site_id,omitempty"`
+	Severity    string `json:"severity"`
+	Name        string `json:"name,omitempty"`
+	Message     string `json:"message,omitempty"`
+	URL         string `json:"url,omitempty"`
+	StartedAtMs int64  `json:"started_at_ms,omitempty"`
+	EndedAtMs   int64  `json:"ended_at_ms,omitempty"`
+}
+
+type AlertWebhookResult struct {
+	Source   string   `json:"source"`
+	Received int      `json:"received"`
+	Opened   []string `json:"opened,omitempty"`
+	Updated  []string `json:"updated,omitempty"`
+	Resolved []string `json:"resolved,omitempty"`
+	Ignored  int      `json:"ignored"`
+	Skipped  int      `json:"skipped"`
+}
+
+// AlertLabelMapping names the labels that identify the device, site and
+// severity of an alert. The first label present wins.
+type AlertLabelMapping struct {
+	DeviceLabels  []string `json:"device_labels"`
+	SiteLabels    []string `json:"site_labels"`
+	SeverityLabel string   `json:"severity_label"`
+}
+
+func NewAlertLabelMapping(deviceLabels, siteLabels []string, severityLabel string) AlertLabelMapping {
+	mapping := AlertLabelMapping{
+		DeviceLabels:  trimLabelKeys(deviceLabels),
+		SiteLabels:    trimLabelKeys(siteLabels),
+		SeverityLabel: firstNonEmpty(strings.TrimSpace(severityLabel), "severity"),
+	}
+	if len(mapping.DeviceLabels) == 0 {
+		mapping.DeviceLabels = []string{"device_id", "device", "instance", "host", "hostname"}
+	}
+	if len(mapping.SiteLabels) == 0 {
+		mapping.SiteLabels = []string{"site_id", "site"}
+	}
+	return mapping
+}
+
+func trimLabelKeys(keys []string) []string {
+	out := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+// Normalize maps a webhook body onto WebhookAlerts. Alerts that name neither
+// a device nor a site cannot be placed on the wall and are counted as
+// skipped.
+func (m AlertLabelMapping) Normalize(payload AlertWebhookPayload) ([]WebhookAlert, int) {
+	if len(payload.Alerts) == 0 && (payload.RuleID != 0 || payload.RuleName != "") {
+		return m.normalizeGrafanaLegacy(payload)
+	}
+	alerts := make([]WebhookAlert, 0, len(payload.Alerts))
+	skipped := 0
+	for _, raw := range payload.Alerts {
+		labels := map[string]string{}
+		for k, v := range payload.CommonLabels {
+			labels[k] = v
+		}
+		for k, v := range raw.Labels {
+			labels[k] = v
+		}
+		alert := m.mapLabels(labels)
+		if alert.Device == "" && alert.SiteID == "" {
+			skipped++
+			continue
+		}
+		status := firstNonEmpty(strings.ToLower(strings.TrimSpace(raw.Status)), strings.ToLower(strings.TrimSpace(payload.Status)))
+		alert.Firing = status != "resolved"
+		alert.Fingerprint = firstNonEmpty(strings.TrimSpace(raw.Fingerprint), labelFingerprint(raw.Labels))
+		alert.Message = firstNonEmpty(strings.TrimSpace(raw.Annotations["summary"]), strings.TrimSpace(raw.Annotations["description"]), strings.TrimSpace(raw.Annotations["message"]), alert.Name)
+		alert.URL = firstNonEmpty(strings.TrimSpace(raw.GeneratorURL), strings.TrimSpace(raw.PanelURL), strings.TrimSpace(raw.DashboardURL), strings.TrimSpace(payload.ExternalURL))
+		alert.StartedAtMs = parseAlertTimeMs(raw.StartsAt)
+		if !alert.Firing {
+			alert.EndedAtMs = parseAlertTimeMs(raw.EndsAt)
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, skipped
+}
+
+// normalizeGrafanaLegacy maps the single-rule body of Grafana dashboard
+// alerts; the rule ID stands in for the fingerprint.
+func (m AlertLabelMapping) normalizeGrafanaLegacy(payload AlertWebhookPayload) ([]WebhookAlert, int) {
+	alert := m.mapLabels(payload.Tags)
+	if alert.Device == "" && alert.SiteID == "" {
+		return nil, 1
+	}
+	state := strings.ToLower(strings.TrimSpace(payload.State))
+	if state == "paused" || state == "pending" {
+		return nil, 1
+	}
+	alert.Firing = state != "ok"
+	alert.Fingerprint = "rule-" + strconv.FormatInt(payload.OrgID, 10) + "-" + strconv.FormatInt(payload.RuleID, 10)
+	alert.Name = firstNonEmpty(alert.Name, strings.TrimSpace(payload.RuleName))
+	alert.Message = firstNonEmpty(strings.TrimSpace(payload.Message), strings.TrimSpace(payload.Title), alert.Name)
+	alert.URL = strings.TrimSpace(payload.RuleURL)
+	return []WebhookAlert{alert}, 0
+}
+
+func (m AlertLabelMapping) mapLabels(labels map[string]string) WebhookAlert {
+	alert := WebhookAlert{
+		Name:     strings.TrimSpace(labels["alertname"]),
+		Severity: normalizeAlertSeverity(labels[m.SeverityLabel]),
+	}
+	for _, key := range m.DeviceLabels {
+		if value := strings.TrimSpace(labels[key]); value != "" {
+			alert.Device = alertTargetHost(value)
+			break
+		}
+	}
+	for _, key := range m.SiteLabels {
+		if value := strings.TrimSpace(labels[key]); value != "" {
+			alert.SiteID = value
+			break
+		}
+	}
+	return alert
+}
+
+// alertTargetHost strips the scheme, path and port Prometheus keeps in
+// instance labels ("10.0.0.1:9100", "https://edge-1/health").
+func alertTargetHost(value string) string {
+	if strings.Contains(value, "://") {
+		if parsed, err := url.Parse(value); err == nil && parsed.Hostname() != "" {
+			return parsed.Hostname()
+		}
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil && host != "" {
+		return host
+	}
+	return value
+}
+
+func normalizeAlertSeverity(raw string) string {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "critical", "page", "disaster", "emergency":
+		return "critical"
+	case "high", "major", "error":
+		return "high"
+	case "info", "informational", "low", "none":
+		return "info"
+	default:
+		return "warning"
+	}
+}
+
+// labelFingerprint hashes the sorted label set for senders that omit the
+// fingerprint field (Alertmanager before 0.19).
+func labelFingerprint(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k + "=" + labels[k] + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// parseAlertTimeMs reads RFC 3339 alert times; the zero time Grafana sends
+// for open alerts reads as unset.
+func parseAlertTimeMs(raw string) int64 {
+	ts, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(raw))
+	if err != nil || ts.Year() <= 1 {
+		return 0
+	}
+	return ts.UnixMilli()
+}
+
+// ApplyWebhookAlerts opens an incident for each newly firing fingerprint,
+// refreshes ones already open and resolves them when the sender reports the
+// alert resolved. Unlike problem polling, a webhook only carries changes, so
+// fingerprints absent from the body are left alone.
+func (s *Store) ApplyWebhookAlerts(source string, alerts []WebhookAlert, nowMs int64) AlertWebhookResult {
+	source = strings.TrimSpace(source)
+	result := AlertWebhookResult{Source: source, Received: len(alerts)}
+	if source == "" || len(alerts) == 0 {
+		return result
+	}
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+	nowISO := time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	open := map[string]int{}
+	for i := range s.Incidents {
+		inc := s.Incidents[i]
+		if inc.Source == source && inc.ExternalID != "" && inc.Resolved == nil {
+			open[inc.ExternalID] = i
+		}
+	}
+	for _, alert := range alerts {
+		fingerprint := strings.TrimSpace(alert.Fingerprint)
+		if fingerprint == "" {
+			result.Ignored++
+			continue
+		}
+		idx, known := open[fingerprint]
+		if !alert.Firing {
+			if !known {
+				result.Ignored++
+				continue
+			}
+			resolvedAt := nowISO
+			if alert.EndedAtMs > 0 {
+				resolvedAt = time.UnixMilli(alert.EndedAtMs).UTC().Format(time.RFC3339)
+			}
+			s.Incidents[idx].Resolved = &resolvedAt
+			s.appendIncidentTimelineEntryLocked(idx, "resolved", "", "Alert resolved in "+source+".", nowISO)
+			s.setLastTimelineURLLocked(idx, alert.URL)
+			delete(open, fingerprint)
+			result.Resolved = append(result.Resolved, s.Incidents[idx].ID)
+			continue
+		}
+		message := firstNonEmpty(strings.TrimSpace(alert.Message), fingerprint)
+		if known {
+			s.Incidents[idx].Severity = alert.Severity
+			s.Incidents[idx].Message = message
+			result.Updated = append(result.Updated, s.Incidents[idx].ID)
+			continue
+		}
+		deviceID, siteID := s.resolveAlertDeviceLocked(alert.Device)
+		started := nowISO
+		if alert.StartedAtMs > 0 {
+			started = time.UnixMilli(alert.StartedAtMs).UTC().Format(time.RFC3339)
+		}
+		s.Incidents = append(s.Incidents, Incident{
+			ID:         "inc-" + randomID(),
+			DeviceID:   deviceID,
+			SiteID:     firstNonEmpty(strings.TrimSpace(alert.SiteID), siteID),
+			Type:       source + "_alert",
+			Severity:   firstNonEmpty(alert.Severity, "warning"),
+			Started:    started,
+			Message:    message,
+			Source:     source,
+			ExternalID: fingerprint,
+		})
+		idx = len(s.Incidents) - 1
+		s.appendIncidentTimelineEntryLocked(idx, "opened", "", "Alert firing in "+source+": "+firstNonEmpty(alert.Name, message), nowISO)
+		s.setLastTimelineURLLocked(idx, alert.URL)
+		open[fingerprint] = idx
+		result.Opened = append(result.Opened, s.Incidents[idx].ID)
+	}
+	s.mu.Unlock()
+
+	if len(result.Opened) > 0 || len(result.Updated) > 0 || len(result.Resolved) > 0 {
+		s.save()
+	}
+	return result
+}
+
+func (s *Store) setLastTimelineURLLocked(incidentIndex int, link string) {
+	link = strings.TrimSpace(link)
+	if link == "" || incidentIndex < 0 || incidentIndex >= len(s.Incidents) {
+		return
+	}
+	timeline := s.Incidents[incidentIndex].CommandTimeline
+	if len(timeline) > 0 {
+		timeline[len(timeline)-1].URL = link
+	}
+}
+
+// resolveAlertDeviceLocked maps a label value onto a known device by ID,
+// identity name, hostname or primary IP. Unknown values are kept as the
+// device ID so the incident still names what the alert named.
+func (s *Store) resolveAlertDeviceLocked(value string) (string, string) {
+	if deviceID, siteID, ok := s.resolveKnownDeviceLocked(value); ok {
+		return deviceID, siteID
+	}
+	return strings.TrimSpace(value), ""
+}
+
+// resolveKnownDeviceLocked is resolveAlertDeviceLocked without the
+// fallback: ok is false when no device matches.
+func (s *Store) resolveKnownDeviceLocked(value string) (string, string, bool) {
+	token := normalizeKeyToken(value)
+	if token == "" {
+		return "", "", false
+	}
+	for _, device := range s.Devices {
+		if normalizeKeyToken(device.ID) == token {
+			return device.ID, device.SiteID, true
+		}
+	}
+	for _, identity := range s.DeviceIdentities {
+		if identity.RetiredAt != "" || identity.PrimaryDeviceID == "" {
+			continue
+		}
+		if normalizeKeyToken(identity.Name) == token || normalizeKeyToken(identity.Hostname) == token || normalizeKeyToken(identity.PrimaryIP) == token {
+			return identity.PrimaryDeviceID, identity.SiteID, true
+		}
+	}
+	for _, device := range s.Devices {
+		if normalizeKeyToken(device.Name) == token {
+			return device.ID, device.SiteID, true
+		}
+	}
+	return "", "", false
+}
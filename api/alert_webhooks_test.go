@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAlertmanagerWebhookOpensAndResolvesByFingerprint(t *testing.T) {
+	store := LoadStore("")
+	online := true
+	store.IngestTelemetry(TelemetryIngestRequest{Source: "uisp", DeviceID: "dev-edge-1", Device: "edge-1", SiteID: "tower-3", Online: &online})
+
+	mapping := NewAlertLabelMapping([]string{"target", "instance"}, nil, "")
+	var firing AlertWebhookPayload
+	if err := json.Unmarshal([]byte(`{
+		"version":"4","status":"firing","receiver":"nocwall",
+		"commonLabels":{"job":"blackbox"},
+		"alerts":[
+			{"status":"firing","fingerprint":"a1b2","labels":{"alertname":"ProbeFailed","instance":"edge-1:9115","severity":"critical"},
+			 "annotations":{"summary":"ICMP probe failing"},"startsAt":"2026-01-01T00:00:00Z","endsAt":"0001-01-01T00:00:00Z",
+			 "generatorURL":"http://prometheus:9090/graph?g0.expr=probe_success"},
+			{"status":"firing","labels":{"alertname":"SiteUplinkSaturated","site":"tower-9"},"annotations":{"description":"Uplink above 90%"}},
+			{"status":"firing","labels":{"alertname":"Watchdog"}}
+		]}`), &firing); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	alerts, skipped := mapping.Normalize(firing)
+	if len(alerts) != 2 || skipped != 1 {
+		t.Fatalf("expected watchdog alert without device or site to be skipped, alerts=%#v skipped=%d", alerts, skipped)
+	}
+	if alerts[1].Fingerprint == "" {
+		t.Fatalf("expected label fingerprint when the sender omits one")
+	}
+
+	result := store.ApplyWebhookAlerts(alertmanagerSource, alerts, 0)
+	if len(result.Opened) != 2 {
+		t.Fatalf("expected two incidents, got=%#v", result)
+	}
+	// Alertmanager repeats firing alerts every repeat_interval.
+	if again := store.ApplyWebhookAlerts(alertmanagerSource, alerts, 0); len(again.Opened) != 0 || len(again.Updated) != 2 {
+		t.Fatalf("expected repeat notification to update, got=%#v", again)
+	}
+
+	probe := findWebhookIncident(t, store, "a1b2")
+	if probe.DeviceID != "dev-edge-1" || probe.SiteID != "tower-3" || probe.Severity != "critical" || probe.Started != "2026-01-01T00:00:00Z" {
+		t.Fatalf("expected instance label to resolve to edge-1, got=%#v", probe)
+	}
+	if len(probe.CommandTimeline) != 1 || probe.CommandTimeline[0].URL != "http://prometheus:9090/graph?g0.expr=probe_success" {
+		t.Fatalf("expected generator URL on the opened timeline entry, got=%#v", probe.CommandTimeline)
+	}
+	if site := findWebhookIncident(t, store, alerts[1].Fingerprint); site.DeviceID != "" || site.SiteID != "tower-9" {
+		t.Fatalf("expected site-only incident, got=%#v", site)
+	}
+
+	resolved, _ := mapping.Normalize(AlertWebhookPayload{Version: "4", Alerts: []AlertWebhookAlert{
+		{Status: "resolved", Fingerprint: "a1b2", Labels: map[string]string{"instance": "edge-1:9115"}, EndsAt: "2026-01-01T00:10:00Z", GeneratorURL: "http://prometheus:9090/graph"},
+		{Status: "resolved", Fingerprint: "never-seen", Labels: map[string]string{"instance": "edge-1"}},
+	}})
+	result = store.ApplyWebhookAlerts(alertmanagerSource, resolved, 0)
+	if len(result.Resolved) != 1 || result.Ignored != 1 {
+		t.Fatalf("expected one resolve and one ignored, got=%#v", result)
+	}
+	probe = findWebhookIncident(t, store, "a1b2")
+	if probe.Resolved == nil || *probe.Resolved != "2026-01-01T00:10:00Z" || probe.CommandTimeline[1].EventType != "resolved" {
+		t.Fatalf("expected incident resolved at endsAt, got=%#v", probe)
+	}
+
+	// Device coming back online leaves the alert incident to the webhook.
+	store.IngestTelemetry(TelemetryIngestRequest{Source: "uisp", DeviceID: "dev-edge-1", Online: &online})
+	if site := findWebhookIncident(t, store, alerts[1].Fingerprint); site.Resolved != nil {
+		t.Fatalf("expected site alert to stay open, got=%#v", site)
+	}
+}
+
+func TestGrafanaLegacyWebhookUsesRuleID(t *testing.T) {
+	store := LoadStore("")
+	mapping := NewAlertLabelMapping(nil, nil, "")
+	payload := AlertWebhookPayload{RuleID: 7, OrgID: 1, RuleName: "Core latency", State: "alerting", Message: "Latency above 50ms", RuleURL: "http://grafana/d/abc?viewPanel=2", Tags: map[string]string{"device": "core-1", "severity": "major"}}
+	alerts, _ := mapping.Normalize(payload)
+	result := store.ApplyWebhookAlerts(grafanaSource, alerts, 0)
+	if len(result.Opened) != 1 || alerts[0].Severity != "high" {
+		t.Fatalf("expected one high incident, alerts=%#v result=%#v", alerts, result)
+	}
+	payload.State = "ok"
+	alerts, _ = mapping.Normalize(payload)
+	if result = store.ApplyWebhookAlerts(grafanaSource, alerts, 0); len(result.Resolved) != 1 {
+		t.Fatalf("expected ok state to resolve, got=%#v", result)
+	}
+	if inc := findWebhookIncident(t, store, "rule-1-7"); inc.DeviceID != "core-1" || inc.CommandTimeline[1].URL != "http://grafana/d/abc?viewPanel=2" {
+		t.Fatalf("expected rule URL on resolve entry, got=%#v", inc)
+	}
+}
+
+func findWebhookIncident(t *testing.T, store *Store, fingerprint string) Incident {
+	t.Helper()
+	for _, inc := range store.ListIncidents() {
+		if inc.ExternalID == fingerprint {
+			return inc
+		}
+	}
+	t.Fatalf("no incident for fingerprint %s", fingerprint)
+	return Incident{}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultExchangeTokenTTLSec = 3300
+	defaultSessionCookieTTLSec = 1800
+	maxAuthRefreshSkew         = 60 * time.Second
+	minAuthRefreshSkew         = 5 * time.Second
+)
+
+var (
+	ErrConnectorAuthConfig = errors.New("invalid_connector_auth")
+	ErrConnectorAuthFailed = errors.New("connector_auth_failed")
+)
+
+// ConnectorAuth authorizes outbound connector requests. Invalidate drops
+// any cached credential and reports whether logging in again could help.
+type ConnectorAuth interface {
+	Apply(ctx context.Context, req *http.Request) error
+	Invalidate() bool
+}
+
+// headerAuth adapts the static header schemes to ConnectorAuth.
+type headerAuth func(*http.Request)
+
+func (h headerAuth) Apply(_ context.Context, req *http.Request) error {
+	if h != nil {
+		h(req)
+	}
+	return nil
+}
+
+func (h headerAuth) Invalidate() bool {
+	return false
+}
+
+type ConnectorAuthConfig struct {
+	Scheme        string // oauth2_client_credentials | token_exchange | session_cookie
+	URL           string
+	ClientID      string
+	ClientSecret  string
+	Scope         string
+	Audience      string
+	Username      string
+	Password      string
+	TokenPath     string
+	TokenHeader   string
+	TokenPrefix   string
+	TTLSec        int
+	LoginFormat   string // json | form
+	UsernameField string
+	PasswordField string
+	CSRFHeader    string
+}
+
+type connectorCredential struct {
+	headers   map[string]string
+	cookies   []*http.Cookie
+	expiresAt time.Time
+	issuedAt  time.Time
+}
+
+// cachedConnectorAuth caches one credential and refreshes it shortly
+// before expiry so polls do not start with a token about to lapse.
+type cachedConnectorAuth struct {
+	scheme string
+	login  func(ctx context.Context) (connectorCredential, error)
+	now    func() time.Time
+
+	mu     sync.Mutex
+	cred   connectorCredential
+	valid  bool
+	logins int
+}
+
+func isDynamicConnectorAuthScheme(scheme string) bool {
+	switch normalizeConnectorAuthScheme(scheme) {
+	case "oauth2_client_credentials", "token_exchange", "session_cookie":
+		return true
+	}
+	return false
+}
+
+func normalizeConnectorAuthScheme(raw string) string {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "oauth2", "oauth2_client_credentials", "client_credentials":
+		return "oauth2_client_credentials"
+	case "token_exchange", "basic_token", "basic-token":
+		return "token_exchange"
+	case "session_cookie", "session", "cookie":
+		return "session_cookie"
+	default:
+		return strings.ToLower(strings.TrimSpace(raw))
+	}
+}
+
+// NewConnectorAuth builds a login-based auth provider. Relative auth URLs
+// are resolved against the connector base URL.
+func NewConnectorAuth(cfg ConnectorAuthConfig, baseURL string, client *http.Client) (ConnectorAuth, error) {
+	cfg.Scheme = normalizeConnectorAuthScheme(cfg.Scheme)
+	authURL := strings.TrimSpace(cfg.URL)
+	if authURL == "" {
+		return nil, fmt.Errorf("%w: auth url is required", ErrConnectorAuthConfig)
+	}
+	if strings.HasPrefix(authURL, "/") {
+		authURL = strings.TrimRight(strings.TrimSpace(baseURL), "/") + authURL
+	}
+	cfg.URL = authURL
+	if client == nil {
+		client = &http.Client{Timeout: 12 * time.Second}
+	}
+
+	auth := &cachedConnectorAuth{scheme: cfg.Scheme, now: time.Now}
+	switch cfg.Scheme {
+	case "oauth2_client_credentials":
+		if cfg.ClientID == "" || cfg.ClientSecret == "" {
+			return nil, fmt.Errorf("%w: client id and secret are required", ErrConnectorAuthConfig)
+		}
+		auth.login = func(ctx context.Context) (connectorCredential, error) {
+			return loginOAuth2ClientCredentials(ctx, client, cfg, auth.now())
+		}
+	case "token_exchange":
+		if cfg.Username == "" {
+			return nil, fmt.Errorf("%w: username is required", ErrConnectorAuthConfig)
+		}
+		auth.login = func(ctx context.Context) (connectorCredential, error) {
+			return loginTokenExchange(ctx, client, cfg, auth.now())
+		}
+	case "session_cookie":
+		if cfg.Username == "" {
+			return nil, fmt.Errorf("%w: username is required", ErrConnectorAuthConfig)
+		}
+		auth.login = func(ctx context.Context) (connectorCredential, error) {
+			return loginSessionCookie(ctx, client, cfg, auth.now())
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrConnectorAuthConfig, cfg.Scheme)
+	}
+	return auth, nil
+}
+
+// connectorAuthFromEnv returns nil for the static header schemes, which
+// connectors already handle themselves.
+func connectorAuthFromEnv(prefix, baseURL string, client *http.Client) (ConnectorAuth, error) {
+	scheme := getenv(prefix+"_AUTH_SCHEME", "")
+	if !isDynamicConnectorAuthScheme(scheme) {
+		return nil, nil
+	}
+	return NewConnectorAuth(ConnectorAuthConfig{
+		Scheme:        scheme,
+		URL:           getenv(prefix+"_AUTH_URL", ""),
+		ClientID:      getenv(prefix+"_CLIENT_ID", ""),
+		ClientSecret:  getenv(prefix+"_CLIENT_SECRET", ""),
+		Scope:         getenv(prefix+"_AUTH_SCOPE", ""),
+		Audience:      getenv(prefix+"_AUTH_AUDIENCE", ""),
+		Username:      getenv(prefix+"_USERNAME", ""),
+		Password:      getenv(prefix+"_PASSWORD", ""),
+		TokenPath:     getenv(prefix+"_TOKEN_PATH", ""),
+		TokenHeader:   getenv(prefix+"_TOKEN_HEADER", ""),
+		TokenPrefix:   getenv(prefix+"_TOKEN_PREFIX", ""),
+		TTLSec:        getenvInt(prefix+"_TOKEN_TTL_SEC", 0),
+		LoginFormat:   getenv(prefix+"_LOGIN_FORMAT", ""),
+		UsernameField: getenv(prefix+"_LOGIN_USERNAME_FIELD", ""),
+		PasswordField: getenv(prefix+"_LOGIN_PASSWORD_FIELD", ""),
+		CSRFHeader:    getenv(prefix+"_CSRF_HEADER", ""),
+	}, baseURL, client)
+}
+
+func (a *cachedConnectorAuth) Apply(ctx context.Context, req *http.Request) error {
+	a.mu.Lock()
+	if !a.valid || !a.now().Before(a.cred.expiresAt.Add(-authRefreshSkew(a.cred))) {
+		cred, err := a.login(ctx)
+		if err != nil {
+			a.valid = false
+			a.mu.Unlock()
+			return err
+		}
+		a.cred = cred
+		a.valid = true
+		a.logins++
+	}
+	cred := a.cred
+	a.mu.Unlock()
+
+	for name, value := range cred.headers {
+		req.Header.Set(name, value)
+	}
+	for _, cookie := range cred.cookies {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return nil
+}
+
+func (a *cachedConnectorAuth) Invalidate() bool {
+	a.mu.Lock()
+	a.valid = false
+	a.mu.Unlock()
+	return true
+}
+
+func (a *cachedConnectorAuth) Logins() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.logins
+}
+
+// authRefreshSkew is 10% of the credential lifetime, clamped to 5s-60s.
+func authRefreshSkew(cred connectorCredential) time.Duration {
+	skew := cred.expiresAt.Sub(cred.issuedAt) / 10
+	if skew > maxAuthRefreshSkew {
+		skew = maxAuthRefreshSkew
+	}
+	if skew < minAuthRefreshSkew {
+		skew = minAuthRefreshSkew
+	}
+	return skew
+}
+
+func loginOAuth2ClientCredentials(ctx context.Context, client *http.Client, cfg ConnectorAuthConfig, now time.Time) (connectorCredential, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if cfg.Scope != "" {
+		form.Set("scope", cfg.Scope)
+	}
+	if cfg.Audience != "" {
+		form.Set("audience", cfg.Audience)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return connectorCredential{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+
+	payload, _, err := doConnectorAuthRequest(client, req)
+	if err != nil {
+		return connectorCredential{}, err
+	}
+	token := jsonPathString(payload, firstNonEmpty(cfg.TokenPath, "$.access_token"))
+	if token == "" {
+		return connectorCredential{}, fmt.Errorf("%w: token response had no access_token", ErrConnectorAuthFailed)
+	}
+	prefix := cfg.TokenPrefix
+	if prefix == "" {
+		prefix = "Bearer "
+		if tokenType := jsonPathString(payload, "$.token_type"); tokenType != "" && !strings.EqualFold(tokenType, "bearer") {
+			prefix = tokenType + " "
+		}
+	}
+	ttl := tokenTTLFromPayload(payload, cfg.TTLSec, defaultExchangeTokenTTLSec)
+	return connectorCredential{
+		headers:   map[string]string{firstNonEmpty(cfg.TokenHeader, "Authorization"): prefix + token},
+		issuedAt:  now,
+		expiresAt: now.Add(ttl),
+	}, nil
+}
+
+// loginTokenExchange trades basic credentials for a token, e.g. Catalyst
+// Center POST /dna/system/api/v1/auth/token returning {"Token": "..."}.
+func loginTokenExchange(ctx context.Context, client *http.Client, cfg ConnectorAuthConfig, now time.Time) (connectorCredential, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, nil)
+	if err != nil {
+		return connectorCredential{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(cfg.Username, cfg.Password)
+
+	payload, header, err := doConnectorAuthRequest(client, req)
+	if err != nil {
+		return connectorCredential{}, err
+	}
+	token := ""
+	if cfg.TokenPath != "" {
+		token = jsonPathString(payload, cfg.TokenPath)
+	} else {
+		for _, path := range []string{"$.Token", "$.token", "$.access_token", "$.response.Token"} {
+			if token = jsonPathString(payload, path); token != "" {
+				break
+			}
+		}
+	}
+	if token == "" {
+		token = strings.TrimSpace(header.Get("X-Auth-Token"))
+	}
+	if token == "" {
+		return connectorCredential{}, fmt.Errorf("%w: token exchange returned no token", ErrConnectorAuthFailed)
+	}
+	ttl := tokenTTLFromPayload(payload, cfg.TTLSec, defaultExchangeTokenTTLSec)
+	return connectorCredential{
+		headers:   map[string]string{firstNonEmpty(cfg.TokenHeader, "X-Auth-Token"): cfg.TokenPrefix + token},
+		issuedAt:  now,
+		expiresAt: now.Add(ttl),
+	}, nil
+}
+
+func loginSessionCookie(ctx context.Context, client *http.Client, cfg ConnectorAuthConfig, now time.Time) (connectorCredential, error) {
+	userField := firstNonEmpty(cfg.UsernameField, "username")
+	passField := firstNonEmpty(cfg.PasswordField, "password")
+	var (
+		body        io.Reader
+		contentType string
+	)
+	if strings.EqualFold(cfg.LoginFormat, "form") {
+		form := url.Values{}
+		form.Set(userField, cfg.Username)
+		form.Set(passField, cfg.Password)
+		body = strings.NewReader(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else {
+		raw, _ := json.Marshal(map[string]string{userField: cfg.Username, passField: cfg.Password})
+		body = bytes.NewReader(raw)
+		contentType = "application/json"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, body)
+	if err != nil {
+		return connectorCredential{}, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return connectorCredential{}, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return connectorCredential{}, fmt.Errorf("%w: login status %d", ErrConnectorAuthFailed, resp.StatusCode)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return connectorCredential{}, fmt.Errorf("%w: login returned no session cookie", ErrConnectorAuthFailed)
+	}
+	cred := connectorCredential{
+		cookies:   cookies,
+		headers:   map[string]string{},
+		issuedAt:  now,
+		expiresAt: now.Add(time.Duration(firstPositiveInt(cfg.TTLSec, defaultSessionCookieTTLSec)) * time.Second),
+	}
+	if cfg.CSRFHeader != "" {
+		if token := strings.TrimSpace(resp.Header.Get(cfg.CSRFHeader)); token != "" {
+			cred.headers[cfg.CSRFHeader] = token
+		}
+	}
+	return cred, nil
+}
+
+func doConnectorAuthRequest(client *http.Client, req *http.Request) (any, http.Header, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("%w: auth status %d", ErrConnectorAuthFailed, resp.StatusCode)
+	}
+	var payload any
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrConnectorAuthFailed, err)
+		}
+	}
+	return payload, resp.Header, nil
+}
+
+func tokenTTLFromPayload(payload any, configuredSec, defaultSec int) time.Duration {
+	if configuredSec > 0 {
+		return time.Duration(configuredSec) * time.Second
+	}
+	if expires := jsonPathFloat(payload, "$.expires_in"); expires != nil && *expires > 0 {
+		return time.Duration(*expires * float64(time.Second))
+	}
+	return time.Duration(defaultSec) * time.Second
+}
+
+func firstPositiveInt(values ...int) int {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
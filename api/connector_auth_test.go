@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOAuth2ClientCredentialsCachesAndRefreshesBeforeExpiry(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		tokenCalls  int
+		issuedToken string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth/token":
+			user, pass, ok := r.BasicAuth()
+			_ = r.ParseForm()
+			if !ok || user != "client-a" || pass != "secret-a" || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read:devices" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			mu.Lock()
+			tokenCalls++
+			issuedToken = fmt.Sprintf("tok-%d", tokenCalls)
+			token := issuedToken
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"access_token":"` + token + `","token_type":"bearer","expires_in":300}`))
+		case "/api/v1/devices":
+			mu.Lock()
+			want := "Bearer " + issuedToken
+			mu.Unlock()
+			if r.Header.Get("Authorization") != want {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(pagedTestDevices(0, 2)))
+		}
+	}))
+	defer server.Close()
+
+	auth, err := NewConnectorAuth(ConnectorAuthConfig{
+		Scheme:       "oauth2",
+		URL:          "/oauth/token",
+		ClientID:     "client-a",
+		ClientSecret: "secret-a",
+		Scope:        "read:devices",
+	}, server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("expected valid oauth2 config, got=%v", err)
+	}
+	cached := auth.(*cachedConnectorAuth)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cached.now = func() time.Time { return now }
+
+	connector := NewVendorConnector("cisco", "Cisco", server.URL, "", "/api/v1/devices", "oauth2")
+	connector.SetAuth(auth)
+	for i := 0; i < 2; i++ {
+		batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10})
+		if err != nil {
+			t.Fatalf("poll %d: %v", i, err)
+		}
+		if batch.Response.Demo || batch.Response.Fetched != 2 {
+			t.Fatalf("expected live poll with login auth, got=%#v", batch.Response)
+		}
+	}
+	if cached.Logins() != 1 {
+		t.Fatalf("expected cached token reuse, logins=%d", cached.Logins())
+	}
+
+	// 300s token with 30s skew: at 275s the provider should refresh early.
+	now = now.Add(275 * time.Second)
+	if _, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); err != nil {
+		t.Fatalf("poll after refresh window: %v", err)
+	}
+	if cached.Logins() != 2 {
+		t.Fatalf("expected proactive refresh before expiry, logins=%d", cached.Logins())
+	}
+}
+
+func TestTokenExchangeReauthsOnceOn401(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		logins      int
+		deviceCalls int
+		revoked     bool
+		alwaysDeny  bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/dna/system/api/v1/auth/token":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "pw" || r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			logins++
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"Token":"dnac-%d"}`, logins)))
+		case "/dna/intent/api/v1/network-device":
+			deviceCalls++
+			token := r.Header.Get("X-Auth-Token")
+			// The first token is revoked server-side after one use.
+			if alwaysDeny || token == "" || (token == "dnac-1" && revoked) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			revoked = true
+			_, _ = w.Write([]byte(`{"response":` + pagedTestDevices(0, 1) + `}`))
+		}
+	}))
+	defer server.Close()
+
+	auth, err := NewConnectorAuth(ConnectorAuthConfig{
+		Scheme:   "token_exchange",
+		URL:      "/dna/system/api/v1/auth/token",
+		Username: "admin",
+		Password: "pw",
+	}, server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("expected valid token exchange config, got=%v", err)
+	}
+	connector := NewVendorConnector("cisco", "Cisco", server.URL, "", "/dna/intent/api/v1/network-device", "token_exchange")
+	connector.SetAuth(auth)
+
+	if _, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); err != nil {
+		t.Fatalf("first poll: %v", err)
+	}
+	if _, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); err != nil {
+		t.Fatalf("expected re-auth to recover revoked token, got=%v", err)
+	}
+	mu.Lock()
+	if logins != 2 || deviceCalls != 3 {
+		t.Fatalf("expected one re-auth after 401, logins=%d device_calls=%d", logins, deviceCalls)
+	}
+	alwaysDeny = true
+	deviceCalls = 0
+	mu.Unlock()
+
+	_, err = connector.Poll(context.Background(), SourcePollRequest{Limit: 10})
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Fatalf("expected persistent 401 to surface, got=%v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if deviceCalls != 2 || logins != 3 {
+		t.Fatalf("expected a single re-auth retry, device_calls=%d logins=%d", deviceCalls, logins)
+	}
+}
+
+func TestSessionCookieAuthCarriesCookieAndCSRF(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/auth/login":
+			body := make([]byte, 256)
+			n, _ := r.Body.Read(body)
+			if !strings.Contains(string(body[:n]), `"username":"noc"`) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "TOKEN", Value: "sess-1", Path: "/"})
+			w.Header().Set("X-CSRF-Token", "csrf-1")
+			_, _ = w.Write([]byte(`{}`))
+		case "/proxy/network/api/s/default/stat/device":
+			cookie, err := r.Cookie("TOKEN")
+			if err != nil || cookie.Value != "sess-1" || r.Header.Get("X-CSRF-Token") != "csrf-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":` + pagedTestDevices(0, 3) + `}`))
+		}
+	}))
+	defer server.Close()
+
+	auth, err := NewConnectorAuth(ConnectorAuthConfig{
+		Scheme:     "session_cookie",
+		URL:        "/api/auth/login",
+		Username:   "noc",
+		Password:   "pw",
+		CSRFHeader: "X-CSRF-Token",
+	}, server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("expected valid session config, got=%v", err)
+	}
+	connector := NewVendorConnector("unifi", "UniFi", server.URL, "", "/proxy/network/api/s/default/stat/device", "session_cookie")
+	connector.SetAuth(auth)
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("session poll: %v", err)
+	}
+	if batch.Response.Fetched != 3 {
+		t.Fatalf("expected 3 devices through session auth, got=%#v", batch.Response)
+	}
+}
+
+func TestConnectorAuthConfigValidation(t *testing.T) {
+	if _, err := NewConnectorAuth(ConnectorAuthConfig{Scheme: "oauth2", URL: "https://idp/token"}, "", nil); err == nil {
+		t.Fatalf("expected missing client credentials to fail")
+	}
+	if _, err := NewConnectorAuth(ConnectorAuthConfig{Scheme: "token_exchange"}, "", nil); err == nil {
+		t.Fatalf("expected missing auth url to fail")
+	}
+	if isDynamicConnectorAuthScheme("bearer") || !isDynamicConnectorAuthScheme("session") {
+		t.Fatalf("unexpected dynamic scheme detection")
+	}
+}
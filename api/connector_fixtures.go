@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const connectorFixtureRedacted = "REDACTED"
+
+var (
+	ErrConnectorFixtureConfig  = errors.New("invalid_connector_fixture")
+	ErrConnectorFixtureMissing = errors.New("connector_fixture_not_found")
+)
+
+// connectorFixture is one recorded HTTP exchange. Only the path and query
+// are kept so a capture replays against any host; a request body is kept
+// as a hash of its redacted form.
+type connectorFixture struct {
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	BodyHash   string              `json:"body_hash,omitempty"`
+	Status     int                 `json:"status"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Body       string              `json:"body"`
+	RecordedAt string              `json:"recorded_at,omitempty"`
+}
+
+var connectorSensitiveFragments = []string{
+	"token", "password", "passwd", "secret", "apikey", "api_key", "api-key",
+	"cookie", "csrf", "xsrf", "authorization", "credential", "signature", "private_key", "session",
+}
+
+func isSensitiveConnectorName(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "key" || name == "auth" {
+		return true
+	}
+	for _, fragment := range connectorSensitiveFragments {
+		if strings.Contains(name, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// connectorFixtureKey identifies a request by method, path, redacted and
+// sorted query and, for requests with a body, the body hash. JSON-RPC APIs
+// such as Zabbix post every call to one URL, so the body tells them apart.
+func connectorFixtureKey(method string, u *url.URL, bodyHash string) string {
+	key := strings.ToUpper(method) + " " + redactConnectorURL(u)
+	if bodyHash != "" {
+		key += " #" + bodyHash
+	}
+	return key
+}
+
+// connectorRequestBodyHash hashes the redacted request body. Credentials
+// never reach the hash input, and a JSON-RPC "id" is dropped because it
+// changes per call without changing the answer.
+func connectorRequestBodyHash(body []byte) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+	var payload any
+	if err := json.Unmarshal(body, &payload); err == nil {
+		if object, ok := payload.(map[string]any); ok {
+			if _, isRPC := object["jsonrpc"]; isRPC {
+				delete(object, "id")
+			}
+		}
+		if encoded, err := json.Marshal(redactConnectorJSON(payload)); err == nil {
+			body = encoded
+		}
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// connectorLoginMethod returns the JSON-RPC method of a login call, whose
+// bare string result is a session token.
+func connectorLoginMethod(body []byte) string {
+	var payload struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.JSONRPC == "" {
+		return ""
+	}
+	if strings.Contains(strings.ToLower(payload.Method), "login") {
+		return payload.Method
+	}
+	return ""
+}
+
+// connectorSessionResult returns the session token a login call answered
+// with, if the result is a bare string.
+func connectorSessionResult(body []byte) string {
+	var payload struct {
+		Result any `json:"result"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	token, _ := payload.Result.(string)
+	return token
+}
+
+func readConnectorRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	return body, err
+}
+
+func redactConnectorURL(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query := u.Query()
+	if len(query) == 0 {
+		return path
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			if isSensitiveConnectorName(key) {
+				value = connectorFixtureRedacted
+			}
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	return path + "?" + strings.Join(parts, "&")
+}
+
+var (
+	setCookieValuePattern  = regexp.MustCompile(`^([^=;]+)=[^;]*`)
+	fixtureFileSlugPattern = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+)
+
+func redactConnectorHeader(header http.Header) map[string][]string {
+	out := map[string][]string{}
+	for name, values := range header {
+		canonical := http.CanonicalHeaderKey(name)
+		redacted := make([]string, 0, len(values))
+		for _, value := range values {
+			switch {
+			case canonical == "Set-Cookie":
+				value = setCookieValuePattern.ReplaceAllString(value, "${1}="+connectorFixtureRedacted)
+			case isSensitiveConnectorName(canonical):
+				value = connectorFixtureRedacted
+			}
+			redacted = append(redacted, value)
+		}
+		out[canonical] = redacted
+	}
+	return out
+}
+
+// redactConnectorBody blanks sensitive JSON fields and scrubs any literal
+// secret the connector was configured with, whatever the content type.
+// Everything else keeps its original bytes, so large numbers, duplicate
+// keys and escaping replay exactly as the source sent them.
+func redactConnectorBody(body []byte, secrets []string) string {
+	text := string(redactConnectorJSONBytes(body))
+	for _, secret := range secrets {
+		if len(secret) >= 4 {
+			text = strings.ReplaceAll(text, secret, connectorFixtureRedacted)
+		}
+	}
+	return text
+}
+
+// redactConnectorJSONBytes replaces string values under sensitive keys in
+// place. It walks the token stream for their offsets instead of decoding
+// and re-encoding the document. Input that stops parsing keeps whatever
+// was redacted before the error.
+func redactConnectorJSONBytes(body []byte) []byte {
+	type frame struct {
+		object  bool
+		wantKey bool
+		key     string
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var (
+		stack []frame
+		spans [][2]int64
+	)
+	for {
+		before := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		var top *frame
+		if len(stack) > 0 {
+			top = &stack[len(stack)-1]
+		}
+		if top != nil && top.object && top.wantKey {
+			if key, ok := tok.(string); ok {
+				top.key, top.wantKey = key, false
+			} else {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		if delim, ok := tok.(json.Delim); ok && (delim == ']' || delim == '}') {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		sensitive := top != nil && top.object && isSensitiveConnectorName(top.key)
+		if top != nil && top.object {
+			top.wantKey = true
+		}
+		switch tok := tok.(type) {
+		case json.Delim:
+			stack = append(stack, frame{object: tok == '{', wantKey: tok == '{'})
+		case string:
+			if sensitive {
+				if start := bytes.IndexByte(body[before:], '"'); start >= 0 {
+					spans = append(spans, [2]int64{before + int64(start), dec.InputOffset()})
+				}
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return body
+	}
+	out := make([]byte, 0, len(body))
+	last := int64(0)
+	for _, span := range spans {
+		out = append(out, body[last:span[0]]...)
+		out = append(out, '"')
+		out = append(out, connectorFixtureRedacted...)
+		out = append(out, '"')
+		last = span[1]
+	}
+	return append(out, body[last:]...)
+}
+
+func redactConnectorJSON(value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, item := range typed {
+			if _, isString := item.(string); isString && isSensitiveConnectorName(key) {
+				typed[key] = connectorFixtureRedacted
+				continue
+			}
+			typed[key] = redactConnectorJSON(item)
+		}
+		return typed
+	case []any:
+		for i := range typed {
+			typed[i] = redactConnectorJSON(typed[i])
+		}
+		return typed
+	default:
+		return value
+	}
+}
+
+func connectorFixtureFileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	method, rest, _ := strings.Cut(key, " ")
+	path, _, _ := strings.Cut(rest, "?")
+	slug := strings.Trim(fixtureFileSlugPattern.ReplaceAllString(path, "_"), "_")
+	if len(slug) > 48 {
+		slug = slug[len(slug)-48:]
+	}
+	if slug == "" {
+		slug = "root"
+	}
+	return fmt.Sprintf("%s_%s_%s.json", strings.ToLower(method), slug, hex.EncodeToString(sum[:])[:12])
+}
+
+// fixtureRecordingTransport passes requests through and writes every
+// response, redacted, to dir. A repeated request overwrites its fixture.
+// Session tokens returned by login calls are added to the secrets so they
+// are scrubbed wherever they show up later.
+type fixtureRecordingTransport struct {
+	base    http.RoundTripper
+	dir     string
+	mu      sync.Mutex
+	secrets []string
+}
+
+func NewFixtureRecordingTransport(dir string, base http.RoundTripper, secrets ...string) (http.RoundTripper, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil, fmt.Errorf("%w: fixture dir is required", ErrConnectorFixtureConfig)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &fixtureRecordingTransport{base: base, dir: dir, secrets: secrets}, nil
+}
+
+func (t *fixtureRecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readConnectorRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if reqBody != nil {
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	body, readErr := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		return resp, readErr
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if connectorLoginMethod(reqBody) != "" {
+		if token := connectorSessionResult(body); token != "" && !containsString(t.secrets, token) {
+			t.secrets = append(t.secrets, token)
+		}
+	}
+	bodyHash := connectorRequestBodyHash(reqBody)
+	key := connectorFixtureKey(req.Method, req.URL, bodyHash)
+	fixture := connectorFixture{
+		Method:     strings.ToUpper(req.Method),
+		URL:        redactConnectorURL(req.URL),
+		BodyHash:   bodyHash,
+		Status:     resp.StatusCode,
+		Header:     redactConnectorHeader(resp.Header),
+		Body:       redactConnectorBody(body, t.secrets),
+		RecordedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	encoded, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		slog.Warn("connector_fixture_encode_failed", "url", fixture.URL, "error", err)
+		return resp, nil
+	}
+	// A failed write loses the capture, not the live response.
+	if err := os.WriteFile(filepath.Join(t.dir, connectorFixtureFileName(key)), encoded, 0o644); err != nil {
+		slog.Warn("connector_fixture_write_failed", "url", fixture.URL, "dir", t.dir, "error", err)
+	}
+	return resp, nil
+}
+
+// fixtureReplayTransport serves recorded fixtures without touching the
+// network; unknown requests fail with ErrConnectorFixtureMissing.
+type fixtureReplayTransport struct {
+	fixtures map[string]connectorFixture
+}
+
+func NewFixtureReplayTransport(dir string) (http.RoundTripper, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil, fmt.Errorf("%w: fixture dir is required", ErrConnectorFixtureConfig)
+	}
+	fixtures, err := loadConnectorFixtures(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &fixtureReplayTransport{fixtures: fixtures}, nil
+}
+
+func loadConnectorFixtures(dir string) (map[string]connectorFixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	fixtures := map[string]connectorFixture{}
+	for _, path := range paths {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var fixture connectorFixture
+		if err := json.Unmarshal(body, &fixture); err != nil || fixture.Method == "" || fixture.URL == "" {
+			// Other JSON files (expectations, notes) may share the directory.
+			continue
+		}
+		parsed, err := url.Parse(fixture.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrConnectorFixtureConfig, path, err)
+		}
+		fixtures[connectorFixtureKey(fixture.Method, parsed, fixture.BodyHash)] = fixture
+	}
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("%w: no fixtures in %s", ErrConnectorFixtureConfig, dir)
+	}
+	return fixtures, nil
+}
+
+func (t *fixtureReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readConnectorRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	key := connectorFixtureKey(req.Method, req.URL, connectorRequestBodyHash(body))
+	fixture, ok := t.fixtures[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrConnectorFixtureMissing, key)
+	}
+	header := http.Header{}
+	for name, values := range fixture.Header {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	status := fixture.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(fixture.Body)),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       req,
+	}, nil
+}
+
+// connectorFixtureTransportFromEnv reads <PREFIX>_FIXTURE_MODE (record or
+// replay) and <PREFIX>_FIXTURE_DIR. It returns nil when fixtures are off.
+func connectorFixtureTransportFromEnv(prefix string) (http.RoundTripper, error) {
+	mode := strings.ToLower(strings.TrimSpace(getenv(prefix+"_FIXTURE_MODE", "")))
+	dir := getenv(prefix+"_FIXTURE_DIR", "")
+	switch mode {
+	case "", "off":
+		return nil, nil
+	case "record":
+		return NewFixtureRecordingTransport(dir, nil,
+			getenv(prefix+"_TOKEN", ""),
+			getenv(prefix+"_PASSWORD", ""),
+			getenv(prefix+"_CLIENT_SECRET", ""),
+		)
+	case "replay":
+		return NewFixtureReplayTransport(dir)
+	default:
+		return nil, fmt.Errorf("%w: unsupported mode %q", ErrConnectorFixtureConfig, mode)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type connectorFixtureExpectation struct {
+	Connector   string `json:"connector"`
+	Source      string `json:"source"`
+	Vendor      string `json:"vendor"`
+	DevicesPath string `json:"devices_path"`
+	Devices     []struct {
+		DeviceID string `json:"device_id"`
+		Device   string `json:"device"`
+		SiteID   string `json:"site_id"`
+		Mac      string `json:"mac"`
+		Online   bool   `json:"online"`
+	} `json:"devices"`
+}
+
+// TestConnectorFixtureCorpus replays every capture under
+// testdata/connector_fixtures through its connector. Add a directory with
+// recorded fixtures and an expect.json to pin a parsing regression.
+func TestConnectorFixtureCorpus(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "connector_fixtures", "*"))
+	if err != nil || len(dirs) == 0 {
+		t.Fatalf("expected connector fixture corpus, err=%v", err)
+	}
+	for _, dir := range dirs {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join(dir, "expect.json"))
+			if err != nil {
+				t.Fatalf("read expect.json: %v", err)
+			}
+			var expect connectorFixtureExpectation
+			if err := json.Unmarshal(body, &expect); err != nil {
+				t.Fatalf("decode expect.json: %v", err)
+			}
+			replay, err := NewFixtureReplayTransport(dir)
+			if err != nil {
+				t.Fatalf("load fixtures: %v", err)
+			}
+
+			var connector transportSourceConnector
+			switch expect.Connector {
+			case "uisp":
+				connector = NewUISPConnector("http://fixture.invalid", "fixture-token", expect.DevicesPath)
+			case "vendor":
+				connector = NewVendorConnector(expect.Source, expect.Vendor, "http://fixture.invalid", "fixture-token", expect.DevicesPath, "bearer")
+			default:
+				t.Fatalf("unknown connector %q", expect.Connector)
+			}
+			connector.SetTransport(replay)
+
+			batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 500, FullSync: true})
+			if err != nil {
+				t.Fatalf("replay poll: %v", err)
+			}
+			if batch.Response.Demo || len(batch.Events) != len(expect.Devices) {
+				t.Fatalf("expected %d events from replay, got demo=%v events=%d", len(expect.Devices), batch.Response.Demo, len(batch.Events))
+			}
+			events := append([]TelemetryIngestRequest(nil), batch.Events...)
+			sort.Slice(events, func(i, j int) bool { return events[i].DeviceID < events[j].DeviceID })
+			sort.Slice(expect.Devices, func(i, j int) bool { return expect.Devices[i].DeviceID < expect.Devices[j].DeviceID })
+			for i, want := range expect.Devices {
+				got := events[i]
+				if got.DeviceID != want.DeviceID || got.Device != want.Device || got.SiteID != want.SiteID || got.Mac != want.Mac {
+					t.Fatalf("record %d mismatch: want=%+v got id=%s name=%s site=%s mac=%s", i, want, got.DeviceID, got.Device, got.SiteID, got.Mac)
+				}
+				if got.Online == nil || *got.Online != want.Online {
+					t.Fatalf("record %s online mismatch: want=%v got=%v", want.DeviceID, want.Online, got.Online)
+				}
+			}
+		})
+	}
+}
+
+func TestFixtureRecordingRedactsAndReplays(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Auth-Token", "live-token-abcdef")
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "sess-secret-123"})
+		_, _ = w.Write([]byte(`{"devices":[{"id":"sw-1","name":"Core","status":"online","apiToken":"nested-secret","note":"token live-token-abcdef leaked"}]}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder, err := NewFixtureRecordingTransport(dir, nil, "live-token-abcdef")
+	if err != nil {
+		t.Fatalf("recorder: %v", err)
+	}
+	live := NewVendorConnector("juniper", "Juniper", server.URL, "live-token-abcdef", "/devices", "bearer")
+	live.SetTransport(recorder)
+	if _, err := live.Poll(context.Background(), SourcePollRequest{Limit: 10}); err != nil {
+		t.Fatalf("record poll: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("expected one recorded fixture, got=%v", files)
+	}
+	raw, _ := os.ReadFile(files[0])
+	for _, secret := range []string{"live-token-abcdef", "sess-secret-123", "nested-secret"} {
+		if strings.Contains(string(raw), secret) {
+			t.Fatalf("expected %q redacted from fixture: %s", secret, raw)
+		}
+	}
+
+	replay, err := NewFixtureReplayTransport(dir)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	offline := NewVendorConnector("juniper", "Juniper", "http://fixture.invalid", "placeholder", "/devices", "bearer")
+	offline.SetTransport(replay)
+	batch, err := offline.Poll(context.Background(), SourcePollRequest{Limit: 10, FullSync: true})
+	if err != nil {
+		t.Fatalf("replay poll: %v", err)
+	}
+	if len(batch.Events) != 1 || batch.Events[0].DeviceID != "sw-1" {
+		t.Fatalf("expected replayed record, got=%#v", batch.Events)
+	}
+
+	missing := NewVendorConnector("juniper", "Juniper", "http://fixture.invalid", "placeholder", "/other", "bearer")
+	missing.SetTransport(replay)
+	if _, err := missing.Poll(context.Background(), SourcePollRequest{Limit: 10}); err == nil || !strings.Contains(err.Error(), ErrConnectorFixtureMissing.Error()) {
+		t.Fatalf("expected missing fixture error, got=%v", err)
+	}
+	if _, err := NewFixtureReplayTransport(t.TempDir()); !errors.Is(err, ErrConnectorFixtureConfig) {
+		t.Fatalf("expected empty fixture dir to be rejected, got=%v", err)
+	}
+}
+
+func TestRedactConnectorBodyKeepsOriginalBytes(t *testing.T) {
+	body := `{"id":9007199254740993,"token":"a","token":"b\u0041","name":"caf\u00e9 \/ x","items":[{"password": "p1","n":1.50}],"auth":{"user":"u"}}`
+	want := `{"id":9007199254740993,"token":"REDACTED","token":"REDACTED","name":"caf\u00e9 \/ x","items":[{"password": "REDACTED","n":1.50}],"auth":{"user":"u"}}`
+	if got := redactConnectorBody([]byte(body), nil); got != want {
+		t.Fatalf("unexpected redaction:\n got=%s\nwant=%s", got, want)
+	}
+	if got := redactConnectorBody([]byte("<html>token abcd1234</html>"), []string{"abcd1234"}); got != "<html>token REDACTED</html>" {
+		t.Fatalf("expected literal secret scrubbed from non-JSON body, got=%s", got)
+	}
+}
+
+func TestFixtureRecordingKeysJSONRPCCallsByBody(t *testing.T) {
+	standIn := &zabbixStandIn{problems: `[{"eventid":"502","objectid":"2002","name":"Unavailable by ICMP ping","severity":"5","clock":"1767225660"}]`}
+	server := standIn.serve(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder, err := NewFixtureRecordingTransport(dir, nil, "pw")
+	if err != nil {
+		t.Fatalf("recorder: %v", err)
+	}
+	live := NewZabbixConnector(ZabbixConfig{URL: server.URL, Username: "noc", Password: "pw"})
+	live.SetTransport(recorder)
+	recorded, err := live.Poll(context.Background(), SourcePollRequest{Limit: 50, FullSync: true})
+	if err != nil {
+		t.Fatalf("record poll: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) < 3 {
+		t.Fatalf("expected one fixture per JSON-RPC method, got=%v", files)
+	}
+	for _, file := range files {
+		raw, _ := os.ReadFile(file)
+		if strings.Contains(string(raw), standIn.session) {
+			t.Fatalf("expected login session %q redacted from fixture: %s", standIn.session, raw)
+		}
+	}
+
+	replay, err := NewFixtureReplayTransport(dir)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	offline := NewZabbixConnector(ZabbixConfig{URL: "http://fixture.invalid", Username: "noc", Password: "pw"})
+	offline.SetTransport(replay)
+	replayed, err := offline.Poll(context.Background(), SourcePollRequest{Limit: 50, FullSync: true})
+	if err != nil {
+		t.Fatalf("replay poll: %v", err)
+	}
+	if len(replayed.Events) != len(recorded.Events) || len(replayed.Problems) != 1 || replayed.Problems[0].DeviceID != recorded.Problems[0].DeviceID {
+		t.Fatalf("expected replay to reproduce hosts and problems, got events=%d problems=%#v", len(replayed.Events), replayed.Problems)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	deviceLifecycleRemoved        = "removed_from_source"
+	deviceLifecycleDecommissioned = "decommissioned"
+	defaultSourceRemovalGraceMs   = int64(24 * time.Hour / time.Millisecond)
+)
+
+var (
+	ErrDeviceNotFound              = errors.New("device_not_found")
+	ErrDeviceAlreadyDecommissioned = errors.New("device_already_decommissioned")
+	ErrDeviceDecommissionReason    = errors.New("missing_reason")
+)
+
+type SourceInventoryReconcileResult struct {
+	Source   string   `json:"source"`
+	Seen     int      `json:"seen"`
+	Missing  int      `json:"missing"`
+	Removed  []string `json:"removed,omitempty"`
+	Restored []string `json:"restored,omitempty"`
+}
+
+type DeviceDecommissionRequest struct {
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+}
+
+type DeviceDecommissionResponse struct {
+	Device              Device   `json:"device"`
+	IdentityID          string   `json:"identity_id,omitempty"`
+	ClosedIncidents     []string `json:"closed_incidents"`
+	HiddenNeighborLinks int      `json:"hidden_neighbor_links"`
+	Stub                bool     `json:"stub"`
+}
+
+func isRetiredDeviceLifecycle(lifecycle string) bool {
+	return lifecycle == deviceLifecycleRemoved || lifecycle == deviceLifecycleDecommissioned
+}
+
+// SetSourceRemovalGrace sets how long a device may be missing from a
+// complete poll of its source before it is marked removed_from_source.
+func (s *Store) SetSourceRemovalGrace(source string, grace time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sourceRemovalGraceMs == nil {
+		s.sourceRemovalGraceMs = map[string]int64{}
+	}
+	if grace < 0 {
+		grace = 0
+	}
+	s.sourceRemovalGraceMs[strings.TrimSpace(source)] = grace.Milliseconds()
+}
+
+// ReconcileSourceInventory compares the full ID set from a complete poll
+// with the devices that source owns. Devices missing for longer than the
+// source grace become removed_from_source; devices that reappear are
+// restored. An empty ID set is ignored so a blank response cannot wipe a
+// source.
+func (s *Store) ReconcileSourceInventory(source string, seenIDs []string, nowMs int64) SourceInventoryReconcileResult {
+	source = strings.TrimSpace(source)
+	result := SourceInventoryReconcileResult{Source: source, Seen: len(seenIDs)}
+	if source == "" || len(seenIDs) == 0 {
+		return result
+	}
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+	seen := make(map[string]bool, len(seenIDs))
+	for _, id := range seenIDs {
+		seen[strings.TrimSpace(id)] = true
+	}
+	nowISO := time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	graceMs, ok := s.sourceRemovalGraceMs[source]
+	if !ok {
+		graceMs = defaultSourceRemovalGraceMs
+	}
+	changed := false
+	for i := range s.Devices {
+		dev := &s.Devices[i]
+		if dev.Source != source || dev.Lifecycle == deviceLifecycleDecommissioned {
+			continue
+		}
+		if seen[dev.ID] {
+			if dev.MissingSinceMs != 0 || dev.Lifecycle == deviceLifecycleRemoved {
+				if dev.Lifecycle == deviceLifecycleRemoved {
+					result.Restored = append(result.Restored, dev.ID)
+				}
+				dev.MissingSinceMs = 0
+				dev.Lifecycle = ""
+				dev.RemovedAt = ""
+				changed = true
+			}
+			continue
+		}
+		result.Missing++
+		if dev.MissingSinceMs == 0 {
+			dev.MissingSinceMs = nowMs
+			changed = true
+		}
+		if dev.Lifecycle == deviceLifecycleRemoved || nowMs-dev.MissingSinceMs < graceMs {
+			continue
+		}
+		dev.Lifecycle = deviceLifecycleRemoved
+		dev.RemovedAt = nowISO
+		result.Removed = append(result.Removed, dev.ID)
+		changed = true
+		for j := range s.Incidents {
+			if s.Incidents[j].DeviceID != dev.ID || s.Incidents[j].Resolved != nil || s.Incidents[j].Type != "telemetry_gap" {
+				continue
+			}
+			resolvedAt := nowISO
+			s.Incidents[j].Resolved = &resolvedAt
+			s.appendIncidentTimelineEntryLocked(j, "resolved", "", "Device removed from source "+source+"; telemetry gap closed.", nowISO)
+		}
+	}
+	s.mu.Unlock()
+	if changed {
+		s.save()
+	}
+	return result
+}
+
+// DecommissionDevice retires a device and its identity, closes its open
+// incidents and drops it from the topology graph. Samples, observations,
+// incidents and neighbor links are kept for history.
+func (s *Store) DecommissionDevice(deviceID string, req DeviceDecommissionRequest) (DeviceDecommissionResponse, error) {
+	deviceID = strings.TrimSpace(deviceID)
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return DeviceDecommissionResponse{}, ErrDeviceDecommissionReason
+	}
+	actor := strings.TrimSpace(req.Actor)
+	nowISO := time.Now().UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	idx := -1
+	for i := range s.Devices {
+		if s.Devices[i].ID == deviceID {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		s.mu.Unlock()
+		return DeviceDecommissionResponse{}, ErrDeviceNotFound
+	}
+	if s.Devices[idx].Lifecycle == deviceLifecycleDecommissioned {
+		s.mu.Unlock()
+		return DeviceDecommissionResponse{}, ErrDeviceAlreadyDecommissioned
+	}
+	s.Devices[idx].Lifecycle = deviceLifecycleDecommissioned
+	s.Devices[idx].DecommissionedAt = nowISO
+	s.Devices[idx].DecommissionReason = reason
+	s.Devices[idx].MissingSinceMs = 0
+
+	resp := DeviceDecommissionResponse{ClosedIncidents: []string{}, Stub: true}
+	note := "Device decommissioned: " + reason
+	for i := range s.Incidents {
+		if s.Incidents[i].DeviceID != deviceID || s.Incidents[i].Resolved != nil {
+			continue
+		}
+		resolvedAt := nowISO
+		s.Incidents[i].Resolved = &resolvedAt
+		s.appendIncidentTimelineEntryLocked(i, "resolved", actor, note, nowISO)
+		s.appendIncidentAuditEventLocked(i, "incident_event", actor, note, map[string]string{
+			"device_id": deviceID,
+			"lifecycle": deviceLifecycleDecommissioned,
+		}, nowISO)
+		resp.ClosedIncidents = append(resp.ClosedIncidents, s.Incidents[i].ID)
+	}
+
+	for i := range s.DeviceIdentities {
+		if s.DeviceIdentities[i].PrimaryDeviceID != deviceID {
+			continue
+		}
+		s.DeviceIdentities[i].RetiredAt = nowISO
+		s.DeviceIdentities[i].UpdatedAt = nowISO
+		resp.IdentityID = s.DeviceIdentities[i].IdentityID
+		break
+	}
+	if resp.IdentityID != "" {
+		for _, link := range s.NeighborLinks {
+			if link.IdentityID == resp.IdentityID {
+				resp.HiddenNeighborLinks++
+			}
+		}
+	}
+	resp.Device = s.Devices[idx]
+	s.mu.Unlock()
+	s.save()
+	return resp, nil
+}
+
+func (s *Store) retiredIdentitySetLocked() map[string]bool {
+	retired := map[string]bool{}
+	for _, ident := range s.DeviceIdentities {
+		if ident.RetiredAt != "" {
+			retired[ident.IdentityID] = true
+		}
+	}
+	return retired
+}
+
+// reconcileSourceBatch applies removal detection for polls that returned
+// the source's complete inventory.
+func reconcileSourceBatch(store *Store, source string, batch sourcePollBatch) SourceInventoryReconcileResult {
+	if !batch.Complete {
+		return SourceInventoryReconcileResult{Source: source}
+	}
+	return store.ReconcileSourceInventory(source, batch.SeenIDs, time.Now().UnixMilli())
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconcileSourceInventoryMarksRemovedAfterGrace(t *testing.T) {
+	s := LoadStore("")
+	s.SetSourceRemovalGrace("juniper", time.Hour)
+	online := false
+	for _, id := range []string{"jr-1", "jr-2"} {
+		if _, _, ok := s.IngestTelemetry(TelemetryIngestRequest{Source: "juniper", EventType: "device_down", DeviceID: id, Device: id, Online: &online}); !ok {
+			t.Fatalf("ingest %s failed", id)
+		}
+	}
+	s.mu.Lock()
+	s.Incidents = append(s.Incidents, Incident{ID: "inc-gap-jr2", DeviceID: "jr-2", Type: "telemetry_gap", Started: time.Now().UTC().Format(time.RFC3339)})
+	s.mu.Unlock()
+
+	start := time.Now().UnixMilli()
+	result := s.ReconcileSourceInventory("juniper", []string{"jr-1"}, start)
+	if result.Missing != 1 || len(result.Removed) != 0 {
+		t.Fatalf("expected jr-2 missing but within grace, got=%#v", result)
+	}
+	result = s.ReconcileSourceInventory("juniper", []string{"jr-1"}, start+time.Hour.Milliseconds())
+	if len(result.Removed) != 1 || result.Removed[0] != "jr-2" {
+		t.Fatalf("expected jr-2 removed after grace, got=%#v", result)
+	}
+	if dev := findLifecycleDevice(t, s, "jr-2"); dev.Lifecycle != deviceLifecycleRemoved || dev.RemovedAt == "" {
+		t.Fatalf("expected removed_from_source lifecycle, got=%#v", dev)
+	}
+	for _, inc := range s.ListIncidents() {
+		if inc.ID == "inc-gap-jr2" && inc.Resolved == nil {
+			t.Fatalf("expected telemetry gap closed on removal")
+		}
+	}
+
+	// An empty inventory must never wipe the source.
+	if result := s.ReconcileSourceInventory("juniper", nil, start+2*time.Hour.Milliseconds()); result.Missing != 0 {
+		t.Fatalf("expected empty inventory to be ignored, got=%#v", result)
+	}
+
+	result = s.ReconcileSourceInventory("juniper", []string{"jr-1", "jr-2"}, start+3*time.Hour.Milliseconds())
+	if len(result.Restored) != 1 || result.Restored[0] != "jr-2" {
+		t.Fatalf("expected jr-2 restored, got=%#v", result)
+	}
+	if dev := findLifecycleDevice(t, s, "jr-2"); dev.Lifecycle != "" || dev.MissingSinceMs != 0 {
+		t.Fatalf("expected restored device to be active, got=%#v", dev)
+	}
+}
+
+func TestTruncatedPollSkipsRemovalDetection(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		payload = pagedTestDevices(0, 3)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write([]byte(payload))
+	}))
+	defer server.Close()
+
+	connector := NewVendorConnector("cisco", "Cisco", server.URL, "token", "/devices", "bearer")
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 1})
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if !batch.Complete || len(batch.SeenIDs) != 3 {
+		t.Fatalf("expected complete inventory with all IDs despite limit, got complete=%v ids=%v", batch.Complete, batch.SeenIDs)
+	}
+
+	demo := NewVendorConnector("cisco", "Cisco", "", "", "/devices", "bearer")
+	if batch, _ := demo.Poll(context.Background(), SourcePollRequest{Limit: 5}); batch.Complete {
+		t.Fatalf("expected demo polls never to count as a complete inventory")
+	}
+}
+
+func TestDecommissionDeviceClosesIncidentsAndLeavesTopology(t *testing.T) {
+	s := LoadStore("")
+	online := false
+	if _, _, ok := s.IngestTelemetry(TelemetryIngestRequest{Source: "topo_test", DeviceID: "dc-b", Device: "DC B", Hostname: "dc-b.local", SiteID: "site-dc"}); !ok {
+		t.Fatalf("ingest dc-b failed")
+	}
+	if _, _, ok := s.IngestTelemetry(TelemetryIngestRequest{
+		Source:    "topo_test",
+		EventType: "device_down",
+		DeviceID:  "dc-a",
+		Device:    "DC A",
+		Hostname:  "dc-a.local",
+		SiteID:    "site-dc",
+		Online:    &online,
+		Neighbors: []TelemetryNeighborFact{{LocalInterface: "eth0", NeighborDeviceName: "DC B", NeighborInterface: "eth1", Protocol: "lldp"}},
+	}); !ok {
+		t.Fatalf("ingest dc-a failed")
+	}
+	identA := findIdentityByPrimary(t, s, "dc-a")
+	nodeA := topologyNodeIDForIdentity(identA.IdentityID)
+
+	if _, err := s.DecommissionDevice("dc-a", DeviceDecommissionRequest{Actor: "noc"}); !errors.Is(err, ErrDeviceDecommissionReason) {
+		t.Fatalf("expected missing reason error, got=%v", err)
+	}
+	if _, err := s.DecommissionDevice("nope", DeviceDecommissionRequest{Reason: "rma"}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected not found error, got=%v", err)
+	}
+
+	resp, err := s.DecommissionDevice("dc-a", DeviceDecommissionRequest{Actor: "noc", Reason: "replaced by dc-c"})
+	if err != nil {
+		t.Fatalf("decommission: %v", err)
+	}
+	if resp.Device.Lifecycle != deviceLifecycleDecommissioned || resp.IdentityID != identA.IdentityID || resp.HiddenNeighborLinks != 1 {
+		t.Fatalf("unexpected decommission response: %#v", resp)
+	}
+	if len(resp.ClosedIncidents) == 0 {
+		t.Fatalf("expected open incidents to be closed")
+	}
+	for _, inc := range s.ListIncidents() {
+		if inc.DeviceID == "dc-a" && inc.Resolved == nil {
+			t.Fatalf("expected no open incidents for decommissioned device, got=%#v", inc)
+		}
+	}
+
+	nodes, _, _ := s.ListTopologyNodes(200, "")
+	for _, node := range nodes {
+		if node.NodeID == nodeA {
+			t.Fatalf("expected decommissioned device to leave the topology graph")
+		}
+	}
+	if edges, _, _ := s.ListTopologyEdges(200, identA.IdentityID); len(edges) != 0 {
+		t.Fatalf("expected decommissioned device edges hidden, got=%d", len(edges))
+	}
+
+	// Late telemetry must not bring a decommissioned device back.
+	up := true
+	s.IngestTelemetry(TelemetryIngestRequest{Source: "topo_test", EventType: "device_up", DeviceID: "dc-a", Device: "DC A", Online: &up})
+	if dev := findLifecycleDevice(t, s, "dc-a"); dev.Lifecycle != deviceLifecycleDecommissioned {
+		t.Fatalf("expected decommissioned lifecycle to stick, got=%#v", dev)
+	}
+	down := false
+	_, created, decision, ok := s.IngestTelemetryWithDecision(TelemetryIngestRequest{Source: "topo_test", EventType: "device_down", DeviceID: "dc-a", Device: "DC A", Online: &down})
+	if !ok || created != nil || decision.Accepted || decision.Reason != deviceLifecycleDecommissioned {
+		t.Fatalf("expected samples for a decommissioned device to be dropped, created=%#v decision=%#v", created, decision)
+	}
+	for _, inc := range s.ListIncidents() {
+		if inc.DeviceID == "dc-a" && inc.Resolved == nil {
+			t.Fatalf("expected no incident for decommissioned device, got=%#v", inc)
+		}
+	}
+	if retired := findIdentityByPrimary(t, s, "dc-a"); retired.RetiredAt == "" {
+		t.Fatalf("expected identity to stay retired, got=%#v", retired)
+	}
+	if _, err := s.DecommissionDevice("dc-a", DeviceDecommissionRequest{Reason: "again"}); !errors.Is(err, ErrDeviceAlreadyDecommissioned) {
+		t.Fatalf("expected already decommissioned error, got=%v", err)
+	}
+}
+
+func findLifecycleDevice(t *testing.T, s *Store, id string) Device {
+	t.Helper()
+	for _, dev := range s.ListDevices() {
+		if dev.ID == id {
+			return dev
+		}
+	}
+	t.Fatalf("device %s not found", id)
+	return Device{}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxTelemetryGauges         = 32
+	healthShiftPct             = 20.0
+	healthShiftTempC           = 10.0
+	defaultDeviceMetricsWindow = 60
+	maxDeviceMetricsWindow     = 90 * 24 * 60
+	defaultDeviceMetricPoints  = 500
+	maxDeviceMetricPoints      = 5000
+)
+
+// healthMetricPaths lists where a connector payload keeps each health
+// metric; the first path present wins.
+type healthMetricPaths struct {
+	cpu    [][]string
+	mem    [][]string
+	temp   [][]string
+	uptime [][]string
+}
+
+type DeviceMetricPoint struct {
+	Timestamp    int64              `json:"timestamp"`
+	ObservedAtMs int64              `json:"observed_at_ms"`
+	Source       string             `json:"source,omitempty"`
+	Online       *bool              `json:"online,omitempty"`
+	Latency      *float64           `json:"latency,omitempty"`
+	CPU          *float64           `json:"cpu,omitempty"`
+	RAM          *float64           `json:"ram,omitempty"`
+	TempC        *float64           `json:"temp_c,omitempty"`
+	UptimeS      *int64             `json:"uptime_s,omitempty"`
+	Gauges       map[string]float64 `json:"gauges,omitempty"`
+}
+
+type DeviceMetricSeries struct {
+	DeviceID      string              `json:"device_id"`
+	WindowMinutes int                 `json:"window_minutes"`
+	Count         int                 `json:"count"`
+	Truncated     bool                `json:"truncated"`
+	Limit         int                 `json:"limit"`
+	Latest        *TelemetryMetrics   `json:"latest,omitempty"`
+	Points        []DeviceMetricPoint `json:"points"`
+	Stub          bool                `json:"stub"`
+}
+
+// normalizeTelemetryMetrics returns a validated copy, or nil when nothing
+// usable is left. Out-of-range values are dropped rather than clamped so a
+// bad sensor reading does not pose as a real one.
+func normalizeTelemetryMetrics(m *TelemetryMetrics) *TelemetryMetrics {
+	if m == nil {
+		return nil
+	}
+	out := &TelemetryMetrics{
+		CPUPct: boundedMetric(m.CPUPct, 0, 100),
+		MemPct: boundedMetric(m.MemPct, 0, 100),
+		TempC:  boundedMetric(m.TempC, -60, 200),
+	}
+	if m.UptimeS != nil && *m.UptimeS >= 0 {
+		v := *m.UptimeS
+		out.UptimeS = &v
+	}
+	if len(m.Gauges) > 0 {
+		names := make([]string, 0, len(m.Gauges))
+		for name := range m.Gauges {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v := m.Gauges[name]
+			key := normalizeGaugeName(name)
+			if key == "" || math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			if out.Gauges == nil {
+				out.Gauges = map[string]float64{}
+			}
+			if len(out.Gauges) >= maxTelemetryGauges {
+				break
+			}
+			out.Gauges[key] = v
+		}
+	}
+	if out.CPUPct == nil && out.MemPct == nil && out.TempC == nil && out.UptimeS == nil && len(out.Gauges) == 0 {
+		return nil
+	}
+	return out
+}
+
+func boundedMetric(v *float64, lo, hi float64) *float64 {
+	if v == nil || math.IsNaN(*v) || math.IsInf(*v, 0) || *v < lo || *v > hi {
+		return nil
+	}
+	out := roundMetric(*v)
+	return &out
+}
+
+func normalizeGaugeName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.Join(strings.Fields(name), "_")
+}
+
+// healthMetricsShifted reports a change worth keeping even when the
+// governor would sample the event out: an uptime that went backwards (a
+// reboot) or a large jump in CPU, memory or temperature.
+func healthMetricsShifted(prev, next *TelemetryMetrics) bool {
+	if prev == nil || next == nil {
+		return false
+	}
+	if prev.UptimeS != nil && next.UptimeS != nil && *next.UptimeS < *prev.UptimeS {
+		return true
+	}
+	moved := func(a, b *float64, limit float64) bool {
+		return a != nil && b != nil && math.Abs(*a-*b) >= limit
+	}
+	return moved(prev.CPUPct, next.CPUPct, healthShiftPct) ||
+		moved(prev.MemPct, next.MemPct, healthShiftPct) ||
+		moved(prev.TempC, next.TempC, healthShiftTempC)
+}
+
+// isHealthMetricTarget covers the typed health targets and "gauge.<name>".
+func isHealthMetricTarget(target string) bool {
+	switch target {
+	case metricTargetCPU, metricTargetMem, metricTargetTemp, metricTargetUptime:
+		return true
+	}
+	return strings.HasPrefix(target, metricTargetGauge) && normalizeGaugeName(strings.TrimPrefix(target, metricTargetGauge)) != ""
+}
+
+// setHealthMetric applies one mapped metric value to ev. Ratios (UCUM unit
+// "1") become percentages and uptime is converted to seconds.
+func setHealthMetric(ev *TelemetryIngestRequest, target string, value float64, unit string) {
+	if ev.Metrics == nil {
+		ev.Metrics = &TelemetryMetrics{}
+	}
+	switch target {
+	case metricTargetCPU:
+		v := percentForUnit(value, unit)
+		ev.Metrics.CPUPct = &v
+	case metricTargetMem:
+		v := percentForUnit(value, unit)
+		ev.Metrics.MemPct = &v
+	case metricTargetTemp:
+		v := value
+		ev.Metrics.TempC = &v
+	case metricTargetUptime:
+		v := int64(secondsForUnit(value, unit))
+		ev.Metrics.UptimeS = &v
+	default:
+		if ev.Metrics.Gauges == nil {
+			ev.Metrics.Gauges = map[string]float64{}
+		}
+		ev.Metrics.Gauges[normalizeGaugeName(strings.TrimPrefix(target, metricTargetGauge))] = value
+	}
+}
+
+func percentForUnit(v float64, unit string) float64 {
+	if strings.TrimSpace(unit) == "1" {
+		v *= 100
+	}
+	return v
+}
+
+func secondsForUnit(v float64, unit string) float64 {
+	switch strings.TrimSpace(unit) {
+	case "ms":
+		return v / 1000
+	case "us":
+		return v / 1e6
+	case "ns":
+		return v / 1e9
+	case "min":
+		return v * 60
+	case "h":
+		return v * 3600
+	case "d":
+		return v * 86400
+	}
+	return v
+}
+
+// pickHealthMetrics reads health metrics from a connector payload.
+func pickHealthMetrics(item map[string]any, paths healthMetricPaths) *TelemetryMetrics {
+	m := &TelemetryMetrics{
+		CPUPct: pickFloat(item, paths.cpu...),
+		MemPct: pickFloat(item, paths.mem...),
+		TempC:  pickFloat(item, paths.temp...),
+	}
+	if uptime := pickFloat(item, paths.uptime...); uptime != nil {
+		v := int64(*uptime)
+		m.UptimeS = &v
+	}
+	return normalizeTelemetryMetrics(m)
+}
+
+// DeviceMetricSeries returns a device's samples across all retention tiers,
+// oldest first. When more than limit samples fall in the window the newest
+// are kept.
+func (s *Store) DeviceMetricSeries(deviceID string, windowMinutes, limit int) (DeviceMetricSeries, bool) {
+	deviceID = strings.TrimSpace(deviceID)
+	if windowMinutes <= 0 {
+		windowMinutes = defaultDeviceMetricsWindow
+	}
+	if windowMinutes > maxDeviceMetricsWindow {
+		windowMinutes = maxDeviceMetricsWindow
+	}
+	if limit <= 0 {
+		limit = defaultDeviceMetricPoints
+	}
+	if limit > maxDeviceMetricPoints {
+		limit = maxDeviceMetricPoints
+	}
+	nowMs := time.Now().UnixMilli()
+	sinceMs := nowMs - int64(windowMinutes)*int64(time.Minute/time.Millisecond)
+
+	s.mu.RLock()
+	found := false
+	var latest *TelemetryMetrics
+	for _, d := range s.Devices {
+		if d.ID == deviceID {
+			found, latest = true, normalizeTelemetryMetrics(d.Metrics)
+			break
+		}
+	}
+	points := make([]DeviceMetricPoint, 0)
+	for _, tier := range [][]TelemetrySample{s.TelemetryCold, s.TelemetryWarm, s.TelemetryHot} {
+		for _, sample := range tier {
+			if sample.DeviceID != deviceID || sample.ObservedAt < sinceMs || sample.ObservedAt > nowMs {
+				continue
+			}
+			point := DeviceMetricPoint{
+				Timestamp:    sample.ObservedAt / 1000,
+				ObservedAtMs: sample.ObservedAt,
+				Source:       sample.Source,
+				Online:       cloneBoolPtr(sample.Online),
+				Latency:      cloneFloat64Ptr(sample.LatencyMs),
+			}
+			if m := normalizeTelemetryMetrics(sample.Metrics); m != nil {
+				point.CPU, point.RAM, point.TempC, point.UptimeS, point.Gauges = m.CPUPct, m.MemPct, m.TempC, m.UptimeS, m.Gauges
+			}
+			points = append(points, point)
+		}
+	}
+	s.mu.RUnlock()
+	if !found && len(points) == 0 {
+		return DeviceMetricSeries{}, false
+	}
+
+	sort.SliceStable(points, func(i, j int) bool { return points[i].ObservedAtMs < points[j].ObservedAtMs })
+	truncated := false
+	if len(points) > limit {
+		points = points[len(points)-limit:]
+		truncated = true
+	}
+	return DeviceMetricSeries{
+		DeviceID:      deviceID,
+		WindowMinutes: windowMinutes,
+		Count:         len(points),
+		Truncated:     truncated,
+		Limit:         limit,
+		Latest:        latest,
+		Points:        points,
+		Stub:          true,
+	}, true
+}
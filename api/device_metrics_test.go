@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDeviceHealthMetricsGovernorAndSeries(t *testing.T) {
+	s := LoadStore("")
+	s.mu.Lock()
+	s.TelemetryGovernorRules = normalizeTelemetryGovernorRules([]TelemetryClassGovernorRule{
+		{DeviceClass: "default", MinSampleIntervalMs: int64(time.Hour / time.Millisecond), Roles: []string{"router"}},
+	})
+	s.TelemetryLastByDevice = map[string]int64{}
+	s.mu.Unlock()
+
+	online := true
+	ingest := func(cpu float64, uptime int64) TelemetryIngestDecision {
+		t.Helper()
+		bogusTemp := 900.0
+		_, _, decision, ok := s.IngestTelemetryWithDecision(TelemetryIngestRequest{
+			Source:   "health_test",
+			DeviceID: "edge-r1",
+			Role:     "router",
+			Online:   &online,
+			Metrics:  &TelemetryMetrics{CPUPct: &cpu, TempC: &bogusTemp, UptimeS: &uptime, Gauges: map[string]float64{" Fan Speed ": 4200, "bad": math.NaN()}},
+		})
+		if !ok {
+			t.Fatalf("ingest failed")
+		}
+		return decision
+	}
+
+	if d := ingest(20, 1000); !d.Accepted {
+		t.Fatalf("expected first sample accepted, decision=%+v", d)
+	}
+	if d := ingest(22, 1060); d.Accepted {
+		t.Fatalf("expected steady sample sampled out, decision=%+v", d)
+	}
+	if d := ingest(75, 1120); !d.Accepted || d.Reason != "health_metric_shift" {
+		t.Fatalf("expected cpu jump to bypass sampling, decision=%+v", d)
+	}
+	if d := ingest(75, 30); !d.Accepted || d.Reason != deviceRebootIncidentType {
+		t.Fatalf("expected uptime reset to be kept as a reboot, decision=%+v", d)
+	}
+
+	series, ok := s.DeviceMetricSeries("edge-r1", 0, 0)
+	if !ok || series.WindowMinutes != defaultDeviceMetricsWindow || series.Count != 3 {
+		t.Fatalf("unexpected series: ok=%v %+v", ok, series)
+	}
+	last := series.Points[2]
+	if *last.CPU != 75 || *last.UptimeS != 30 || last.TempC != nil || len(last.Gauges) != 1 || last.Gauges["fan_speed"] != 4200 {
+		t.Fatalf("unexpected latest point: %+v", last)
+	}
+	if series.Latest == nil || *series.Latest.CPUPct != 75 {
+		t.Fatalf("expected device snapshot to follow the newest sample, got=%+v", series.Latest)
+	}
+	if limited, _ := s.DeviceMetricSeries("edge-r1", 60, 2); !limited.Truncated || limited.Count != 2 || *limited.Points[1].UptimeS != 30 {
+		t.Fatalf("expected limit to keep the newest points, got=%+v", limited)
+	}
+
+	offline := false
+	if _, _, ok := s.IngestTelemetry(TelemetryIngestRequest{Source: "health_test", DeviceID: "edge-r1", Role: "router", Online: &offline}); !ok {
+		t.Fatalf("offline ingest failed")
+	}
+	for _, d := range s.ListDevices() {
+		if d.ID == "edge-r1" && d.Metrics != nil {
+			t.Fatalf("expected offline device to drop its health snapshot, got=%+v", d.Metrics)
+		}
+	}
+	if _, ok := s.DeviceMetricSeries("no-such-device", 60, 10); ok {
+		t.Fatalf("expected unknown device to be reported missing")
+	}
+}
+
+func TestTelemetryBaselineReportIncludesHealthMetrics(t *testing.T) {
+	s := LoadStore("")
+	online := true
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 12; i++ {
+		cpu, temp := 30.0+float64(i), -5.0+float64(i%3)
+		req := TelemetryIngestRequest{
+			Source:       "baseline_test",
+			DeviceID:     "health-sw-1",
+			Role:         "switch",
+			SiteID:       "site-health",
+			ObservedAtMs: base.Add(time.Duration(i) * time.Minute).UnixMilli(),
+			Online:       &online,
+			Metrics:      &TelemetryMetrics{CPUPct: &cpu, TempC: &temp, Gauges: map[string]float64{"poe_w": 40}},
+			Interfaces:   []TelemetryInterfaceFact{{Name: "eth0"}},
+		}
+		if _, _, ok := s.IngestTelemetry(req); !ok {
+			t.Fatalf("ingest failed at index=%d", i)
+		}
+	}
+
+	group, ok := findBaselineGroup(s.TelemetryBaselineReport(24).Groups, "switch", "site-health")
+	if !ok {
+		t.Fatalf("expected baseline group role=switch site=site-health")
+	}
+	cpu, ok := findBaselineMetric(group.Metrics, "cpu_pct")
+	if !ok || cpu.SampleCount != 12 || cpu.UpperBound > 100 {
+		t.Fatalf("unexpected cpu baseline: ok=%v %+v", ok, cpu)
+	}
+	temp, ok := findBaselineMetric(group.Metrics, "temp_c")
+	if !ok || temp.LowerBound >= 0 {
+		t.Fatalf("expected sub-zero temperature bounds to survive, ok=%v %+v", ok, temp)
+	}
+	if _, ok := findBaselineMetric(group.Metrics, "gauge.poe_w"); !ok {
+		t.Fatalf("expected gauge baseline, got=%+v", group.Metrics)
+	}
+}
+
+func TestSetHealthMetricConvertsUnits(t *testing.T) {
+	var ev TelemetryIngestRequest
+	setHealthMetric(&ev, metricTargetMem, 0.42, "1")
+	setHealthMetric(&ev, metricTargetCPU, 12.5, "%")
+	setHealthMetric(&ev, metricTargetUptime, 2, "h")
+	setHealthMetric(&ev, "gauge.Signal dBm", -61, "")
+	m := normalizeTelemetryMetrics(ev.Metrics)
+	if *m.MemPct != 42 || *m.CPUPct != 12.5 || *m.UptimeS != 7200 || m.Gauges["signal_dbm"] != -61 {
+		t.Fatalf("unexpected metrics: %+v", m)
+	}
+	if isHealthMetricTarget("gauge.") || isHealthMetricTarget("cpu") || !isHealthMetricTarget("gauge.x") {
+		t.Fatalf("unexpected health target validation")
+	}
+	if normalizeTelemetryMetrics(&TelemetryMetrics{Gauges: map[string]float64{" ": 1}}) != nil {
+		t.Fatalf("expected metrics with nothing usable to normalize to nil")
+	}
+}
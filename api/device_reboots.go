@@ -0,0 +1,225 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	deviceRebootIncidentType = "device_rebooted"
+	maxDeviceReboots         = 4000
+	// Boot time is estimated as observed time minus uptime, so it jitters
+	// with polling and queueing delays. A shift within this tolerance is
+	// the same boot.
+	rebootBootShiftToleranceMs = int64(2 * time.Minute / time.Millisecond)
+	// sysUpTime is a 32-bit TimeTicks (1/100 s) counter that wraps after
+	// about 497 days without the device restarting.
+	sysUpTimeWrapMs         = int64(1<<32) * 10
+	frequentRebootThreshold = 3
+)
+
+// DeviceReboot is one detected restart. RebootedAt is estimated from the
+// uptime the device reported after it came back.
+type DeviceReboot struct {
+	EventID        string `json:"event_id"`
+	DeviceID       string `json:"device_id"`
+	SiteID         string `json:"site_id,omitempty"`
+	Source         string `json:"source,omitempty"`
+	RebootedAt     int64  `json:"rebooted_at"`
+	RebootedAtISO  string `json:"rebooted_at_iso"`
+	PreviousBootAt int64  `json:"previous_boot_at"`
+	UptimeS        int64  `json:"uptime_s"`
+	DetectedAt     int64  `json:"detected_at"`
+	IncidentID     string `json:"incident_id,omitempty"`
+}
+
+type DeviceRebootSummary struct {
+	DeviceID   string `json:"device_id"`
+	Name       string `json:"name,omitempty"`
+	SiteID     string `json:"site_id,omitempty"`
+	BootedAt   int64  `json:"booted_at,omitempty"`
+	LastReboot int64  `json:"last_reboot_at"`
+	Reboots24h int    `json:"reboots_24h"`
+	Reboots7d  int    `json:"reboots_7d"`
+	Reboots30d int    `json:"reboots_30d"`
+	Frequent   bool   `json:"frequent_rebooter"`
+}
+
+type DeviceRebootsResponse struct {
+	LastUpdated int64                 `json:"last_updated"`
+	Count       int                   `json:"count"`
+	Events      []DeviceReboot        `json:"events"`
+	Devices     []DeviceRebootSummary `json:"devices"`
+	Truncated   bool                  `json:"truncated"`
+	Limit       int                   `json:"limit"`
+	Stub        bool                  `json:"stub"`
+}
+
+// detectDeviceRebootLocked compares the boot time implied by a sample's
+// uptime with the device's last known boot. A later boot is a restart only
+// when the uptime went down against the previous sample from the same
+// source, or when the device comes back from offline: one that was gone
+// longer than its previous session reports a higher uptime than before.
+// Otherwise a later boot is polling lag, for example a poller that stamps
+// a cached uptime with its own poll time, and only moves the boot time
+// forward.
+func (s *Store) detectDeviceRebootLocked(idx int, metrics *TelemetryMetrics, source string, wasOffline bool, observedAtMs, nowMs int64) *DeviceReboot {
+	if metrics == nil || metrics.UptimeS == nil || observedAtMs <= 0 {
+		return nil
+	}
+	dev := &s.Devices[idx]
+	if s.lastUptimeS == nil {
+		s.lastUptimeS = map[string]int64{}
+	}
+	uptimeKey := dev.ID + "|" + source
+	prevUptime, seen := s.lastUptimeS[uptimeKey]
+	s.lastUptimeS[uptimeKey] = *metrics.UptimeS
+	bootMs := observedAtMs - *metrics.UptimeS*1000
+	prevBoot := dev.BootedAtMs
+	if prevBoot <= 0 || bootMs <= prevBoot {
+		if bootMs > prevBoot {
+			dev.BootedAtMs = bootMs
+		}
+		return nil
+	}
+	shift := bootMs - prevBoot
+	if shift <= rebootBootShiftToleranceMs {
+		dev.BootedAtMs = bootMs
+		return nil
+	}
+	if diff := shift - sysUpTimeWrapMs; diff >= -rebootBootShiftToleranceMs && diff <= rebootBootShiftToleranceMs {
+		return nil
+	}
+	dev.BootedAtMs = bootMs
+	if !wasOffline && (!seen || *metrics.UptimeS >= prevUptime) {
+		return nil
+	}
+
+	reboot := DeviceReboot{
+		EventID:        "rbt-" + randomID(),
+		DeviceID:       dev.ID,
+		SiteID:         dev.SiteID,
+		Source:         source,
+		RebootedAt:     bootMs,
+		RebootedAtISO:  time.UnixMilli(bootMs).UTC().Format(time.RFC3339),
+		PreviousBootAt: prevBoot,
+		UptimeS:        *metrics.UptimeS,
+		DetectedAt:     nowMs,
+	}
+
+	// A reboot is over by the time it is seen, so the incident is recorded
+	// resolved; it must not hold the slot an offline incident would use.
+	detectedISO := time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
+	inc := Incident{
+		ID:       "inc-" + randomID(),
+		DeviceID: dev.ID,
+		SiteID:   dev.SiteID,
+		Type:     deviceRebootIncidentType,
+		Severity: "warning",
+		Started:  reboot.RebootedAtISO,
+		Resolved: &detectedISO,
+		Message:  "Device rebooted; uptime reset to " + (time.Duration(reboot.UptimeS) * time.Second).String(),
+		Source:   source,
+	}
+	s.Incidents = append(s.Incidents, inc)
+	incIdx := len(s.Incidents) - 1
+	s.appendIncidentTimelineEntryLocked(incIdx, "opened", "", "Device rebooted (estimated from reported uptime).", reboot.RebootedAtISO)
+	s.appendIncidentTimelineEntryLocked(incIdx, "resolved", "", "Device reporting again after reboot.", detectedISO)
+	reboot.IncidentID = inc.ID
+
+	s.DeviceReboots = append(s.DeviceReboots, reboot)
+	if len(s.DeviceReboots) > maxDeviceReboots {
+		s.DeviceReboots = append([]DeviceReboot(nil), s.DeviceReboots[len(s.DeviceReboots)-maxDeviceReboots:]...)
+	}
+	return &reboot
+}
+
+// ListDeviceReboots returns detected reboots newest first.
+func (s *Store) ListDeviceReboots(limit int, deviceID string) ([]DeviceReboot, bool, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	deviceFilter := strings.TrimSpace(deviceID)
+	filtered := make([]DeviceReboot, 0, min(limit, len(s.DeviceReboots)))
+	total := 0
+	for i := len(s.DeviceReboots) - 1; i >= 0; i-- {
+		event := s.DeviceReboots[i]
+		if deviceFilter != "" && event.DeviceID != deviceFilter {
+			continue
+		}
+		total++
+		if len(filtered) >= limit {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+	truncated := total > len(filtered)
+	return filtered, truncated, limit
+}
+
+// DeviceRebootSummaries counts reboots per device over the last day, week
+// and 30 days, most frequent rebooters first. Devices without a reboot in
+// 30 days are left out.
+func (s *Store) DeviceRebootSummaries(deviceID string, nowMs int64) []DeviceRebootSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deviceFilter := strings.TrimSpace(deviceID)
+	byDevice := map[string]*DeviceRebootSummary{}
+	for id, counts := range s.rebootCountsLocked(nowMs) {
+		if deviceFilter != "" && id != deviceFilter {
+			continue
+		}
+		summary := counts
+		byDevice[id] = &summary
+	}
+	for _, dev := range s.Devices {
+		if summary := byDevice[dev.ID]; summary != nil {
+			summary.Name, summary.SiteID, summary.BootedAt = dev.Name, dev.SiteID, dev.BootedAtMs
+		}
+	}
+	out := make([]DeviceRebootSummary, 0, len(byDevice))
+	for _, summary := range byDevice {
+		out = append(out, *summary)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Reboots7d != out[j].Reboots7d {
+			return out[i].Reboots7d > out[j].Reboots7d
+		}
+		if out[i].LastReboot != out[j].LastReboot {
+			return out[i].LastReboot > out[j].LastReboot
+		}
+		return out[i].DeviceID < out[j].DeviceID
+	})
+	return out
+}
+
+func (s *Store) rebootCountsLocked(nowMs int64) map[string]DeviceRebootSummary {
+	dayMs := int64(24 * time.Hour / time.Millisecond)
+	counts := map[string]DeviceRebootSummary{}
+	for _, event := range s.DeviceReboots {
+		age := nowMs - event.RebootedAt
+		if age > 30*dayMs {
+			continue
+		}
+		summary := counts[event.DeviceID]
+		summary.DeviceID = event.DeviceID
+		summary.Reboots30d++
+		if age <= 7*dayMs {
+			summary.Reboots7d++
+		}
+		if age <= dayMs {
+			summary.Reboots24h++
+		}
+		if event.RebootedAt > summary.LastReboot {
+			summary.LastReboot = event.RebootedAt
+		}
+		summary.Frequent = summary.Reboots7d >= frequentRebootThreshold
+		counts[event.DeviceID] = summary
+	}
+	return counts
+}
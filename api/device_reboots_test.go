@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceRebootDetectionFromUptime(t *testing.T) {
+	s := LoadStore("")
+	s.mu.Lock()
+	s.TelemetryGovernorRules = normalizeTelemetryGovernorRules([]TelemetryClassGovernorRule{
+		{DeviceClass: "default", MinSampleIntervalMs: int64(time.Hour / time.Millisecond), Roles: []string{"cpe"}},
+	})
+	s.TelemetryLastByDevice = map[string]int64{}
+	s.mu.Unlock()
+
+	base := time.Now().Add(-12 * time.Hour).Truncate(time.Second)
+	online := true
+	ingest := func(deviceID string, at time.Time, uptime int64) TelemetryIngestDecision {
+		t.Helper()
+		_, _, decision, ok := s.IngestTelemetryWithDecision(TelemetryIngestRequest{
+			Source:       "reboot_test",
+			DeviceID:     deviceID,
+			Role:         "cpe",
+			SiteID:       "tower-9",
+			ObservedAtMs: at.UnixMilli(),
+			Online:       &online,
+			Metrics:      &TelemetryMetrics{UptimeS: &uptime},
+		})
+		if !ok {
+			t.Fatalf("ingest failed")
+		}
+		return decision
+	}
+
+	ingest("cpe-1", base, 3600)
+	if d := ingest("cpe-1", base.Add(time.Minute), 3661); d.Accepted {
+		t.Fatalf("expected same boot to be sampled normally, decision=%+v", d)
+	}
+	if d := ingest("cpe-1", base.Add(3*time.Minute), 30); !d.Accepted || d.Reason != deviceRebootIncidentType {
+		t.Fatalf("expected uptime reset to be kept as a reboot, decision=%+v", d)
+	}
+	// Back after a long outage: uptime is higher than before, but the boot
+	// time moved.
+	offline := false
+	s.IngestTelemetry(TelemetryIngestRequest{Source: "reboot_test", DeviceID: "cpe-1", Role: "cpe", SiteID: "tower-9", ObservedAtMs: base.Add(4 * time.Minute).UnixMilli(), Online: &offline})
+	ingest("cpe-1", base.Add(10*time.Hour), 7200)
+
+	// A poller that refreshes uptime every five minutes but stamps every
+	// poll with its own time moves the boot estimate forward without a
+	// reboot.
+	ingest("nms-1", base, 3600)
+	ingest("nms-1", base.Add(4*time.Minute), 3600)
+	ingest("nms-1", base.Add(5*time.Minute), 3900)
+	ingest("nms-1", base.Add(9*time.Minute), 3900)
+
+	// A 32-bit sysUpTime wrap is not a reboot.
+	ingest("olt-1", base, 42_949_670)
+	ingest("olt-1", base.Add(10*time.Second), 8)
+
+	events, _, _ := s.ListDeviceReboots(10, "")
+	if len(events) != 2 || events[0].DeviceID != "cpe-1" {
+		t.Fatalf("expected two cpe-1 reboots, got=%#v", events)
+	}
+	first := events[1]
+	if want := base.Add(3*time.Minute - 30*time.Second).UnixMilli(); first.RebootedAt != want || first.UptimeS != 30 || first.PreviousBootAt != base.Add(-time.Hour).UnixMilli() {
+		t.Fatalf("unexpected reboot estimate: %#v", first)
+	}
+	var inc Incident
+	for _, candidate := range s.ListIncidents() {
+		if candidate.ID == first.IncidentID {
+			inc = candidate
+		}
+	}
+	if inc.Type != deviceRebootIncidentType || inc.Resolved == nil || inc.Started != first.RebootedAtISO || len(inc.CommandTimeline) != 2 {
+		t.Fatalf("expected a resolved reboot incident starting at the reboot, got=%#v", inc)
+	}
+
+	ingest("cpe-1", base.Add(11*time.Hour), 60)
+	summaries := s.DeviceRebootSummaries("", time.Now().UnixMilli())
+	if len(summaries) != 1 || summaries[0].Reboots24h != 3 || summaries[0].Reboots7d != 3 || !summaries[0].Frequent || summaries[0].SiteID != "tower-9" {
+		t.Fatalf("unexpected reboot summaries: %#v", summaries)
+	}
+
+	ident := findIdentityByPrimary(t, s, "cpe-1")
+	scores, _, _ := s.ListLifecycleScores(10, ident.IdentityID)
+	if len(scores) != 1 || scores[0].Reboots7d != 3 || !containsString(scores[0].Reasons, "frequent_reboots_7d") {
+		t.Fatalf("expected lifecycle score to flag the frequent rebooter, got=%#v", scores)
+	}
+}
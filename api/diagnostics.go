@@ -0,0 +1,773 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxDiagnosticJobs          = 1000
+	maxDiagnosticOutputLines   = 60
+	defaultDiagnosticCount     = 4
+	maxDiagnosticCount         = 20
+	defaultDiagnosticTimeoutMs = 5000
+	maxDiagnosticTimeoutMs     = 60000
+	maxDiagnosticHops          = 30
+	defaultDiagnosticWorkers   = 4
+	defaultDiagnosticQueue     = 32
+	defaultDiagnosticJobTTL    = 30 * time.Minute
+	diagnosticSweepInterval    = time.Minute
+)
+
+var (
+	ErrDiagnosticKind         = errors.New("invalid_diagnostic_kind")
+	ErrDiagnosticTarget       = errors.New("invalid_diagnostic_target")
+	ErrDiagnosticPort         = errors.New("invalid_diagnostic_port")
+	ErrDiagnosticRunner       = errors.New("invalid_diagnostic_runner")
+	ErrDiagnosticAgentUnknown = errors.New("diagnostic_agent_not_found")
+	ErrDiagnosticIncident     = errors.New("diagnostic_incident_not_found")
+	ErrDiagnosticJobNotFound  = errors.New("diagnostic_job_not_found")
+	ErrDiagnosticJobFinished  = errors.New("diagnostic_job_already_finished")
+	ErrDiagnosticJobState     = errors.New("diagnostic_job_not_running")
+	ErrDiagnosticJobOwner     = errors.New("diagnostic_job_not_assigned")
+	ErrDiagnosticQueueFull    = errors.New("diagnostic_queue_full")
+
+	diagnosticTargetPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.:\-_%\[\]]*$`)
+	pingLossPattern         = regexp.MustCompile(`([0-9.]+)% packet loss`)
+	pingRTTPattern          = regexp.MustCompile(`= ([0-9.]+)/([0-9.]+)/([0-9.]+)`)
+	tracerouteHopPattern    = regexp.MustCompile(`^\s*(\d+)\s+(.*)$`)
+	tracerouteRTTPattern    = regexp.MustCompile(`([0-9.]+) ms`)
+)
+
+type DiagnosticHop struct {
+	Hop     int      `json:"hop"`
+	Address string   `json:"address,omitempty"`
+	RTTMs   *float64 `json:"rtt_ms,omitempty"`
+	Timeout bool     `json:"timeout,omitempty"`
+}
+
+type DiagnosticResult struct {
+	Success       bool            `json:"success"`
+	Summary       string          `json:"summary,omitempty"`
+	LatencyMs     *float64        `json:"latency_ms,omitempty"`
+	PacketLossPct *float64        `json:"packet_loss_pct,omitempty"`
+	Hops          []DiagnosticHop `json:"hops,omitempty"`
+	Output        []string        `json:"output,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+type DiagnosticJob struct {
+	ID         string           `json:"id"`
+	Kind       string           `json:"kind"` // ping | traceroute | tcp
+	Target     string           `json:"target"`
+	Port       int              `json:"port,omitempty"`
+	Count      int              `json:"count,omitempty"`
+	TimeoutMs  int              `json:"timeout_ms"`
+	Runner     string           `json:"runner"` // api | agent
+	AgentID    string           `json:"agent_id,omitempty"`
+	IncidentID string           `json:"incident_id,omitempty"`
+	Actor      string           `json:"actor,omitempty"`
+	State      string           `json:"state"` // queued | dispatched | running | completed | failed
+	Result     DiagnosticResult `json:"result"`
+	Attached   bool             `json:"attached_to_incident"`
+	CreatedAt  string           `json:"created_at"`
+	StartedAt  string           `json:"started_at,omitempty"`
+	FinishedAt string           `json:"finished_at,omitempty"`
+}
+
+type DiagnosticJobRequest struct {
+	Kind       string `json:"kind"`
+	Target     string `json:"target"`
+	Port       int    `json:"port,omitempty"`
+	Count      int    `json:"count,omitempty"`
+	TimeoutMs  int    `json:"timeout_ms,omitempty"`
+	Runner     string `json:"runner,omitempty"`
+	AgentID    string `json:"agent_id,omitempty"`
+	IncidentID string `json:"incident_id,omitempty"`
+	Actor      string `json:"actor,omitempty"`
+}
+
+type DiagnosticJobsResponse struct {
+	LastUpdated int64           `json:"last_updated"`
+	Count       int             `json:"count"`
+	Jobs        []DiagnosticJob `json:"jobs"`
+	Truncated   bool            `json:"truncated"`
+	Limit       int             `json:"limit"`
+	Stub        bool            `json:"stub"`
+}
+
+// DiagnosticExecutor runs a single diagnostic job from the API host.
+type DiagnosticExecutor interface {
+	Run(ctx context.Context, job DiagnosticJob) DiagnosticResult
+}
+
+type localDiagnosticExecutor struct{}
+
+func normalizeDiagnosticKind(raw string) string {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "ping", "icmp":
+		return "ping"
+	case "traceroute", "trace", "tracert":
+		return "traceroute"
+	case "tcp", "tcp_check", "port":
+		return "tcp"
+	default:
+		return ""
+	}
+}
+
+func normalizeDiagnosticJobRequest(req DiagnosticJobRequest) (DiagnosticJob, error) {
+	job := DiagnosticJob{
+		Kind:       normalizeDiagnosticKind(req.Kind),
+		Target:     strings.TrimSpace(req.Target),
+		Port:       req.Port,
+		Count:      req.Count,
+		TimeoutMs:  req.TimeoutMs,
+		Runner:     strings.ToLower(strings.TrimSpace(req.Runner)),
+		AgentID:    strings.TrimSpace(req.AgentID),
+		IncidentID: strings.TrimSpace(req.IncidentID),
+		Actor:      strings.TrimSpace(req.Actor),
+	}
+	if job.Kind == "" {
+		return DiagnosticJob{}, ErrDiagnosticKind
+	}
+	// Targets are handed to ping/traceroute, so reject anything that could be read as a flag.
+	if job.Target == "" || len(job.Target) > 253 || !diagnosticTargetPattern.MatchString(job.Target) {
+		return DiagnosticJob{}, ErrDiagnosticTarget
+	}
+	if job.Kind == "tcp" {
+		if job.Port <= 0 || job.Port > 65535 {
+			return DiagnosticJob{}, ErrDiagnosticPort
+		}
+	} else {
+		job.Port = 0
+	}
+	if job.Count <= 0 {
+		job.Count = defaultDiagnosticCount
+	}
+	if job.Count > maxDiagnosticCount {
+		job.Count = maxDiagnosticCount
+	}
+	if job.TimeoutMs <= 0 {
+		job.TimeoutMs = defaultDiagnosticTimeoutMs
+	}
+	if job.TimeoutMs > maxDiagnosticTimeoutMs {
+		job.TimeoutMs = maxDiagnosticTimeoutMs
+	}
+	if job.Runner == "" {
+		job.Runner = "api"
+		if job.AgentID != "" {
+			job.Runner = "agent"
+		}
+	}
+	switch job.Runner {
+	case "api":
+		job.AgentID = ""
+	case "agent":
+		if job.AgentID == "" {
+			return DiagnosticJob{}, ErrDiagnosticRunner
+		}
+	default:
+		return DiagnosticJob{}, ErrDiagnosticRunner
+	}
+	return job, nil
+}
+
+func (s *Store) CreateDiagnosticJob(req DiagnosticJobRequest) (DiagnosticJob, error) {
+	job, err := normalizeDiagnosticJobRequest(req)
+	if err != nil {
+		return DiagnosticJob{}, err
+	}
+	job.ID = "diag-" + randomID()
+	job.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	job.State = "queued"
+	if job.Runner == "agent" {
+		job.State = "dispatched"
+	}
+
+	s.mu.Lock()
+	if job.Runner == "agent" {
+		found := false
+		for _, agent := range s.Agents {
+			if agent.ID == job.AgentID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.mu.Unlock()
+			return DiagnosticJob{}, ErrDiagnosticAgentUnknown
+		}
+	}
+	if job.IncidentID != "" {
+		found := false
+		for _, inc := range s.Incidents {
+			if inc.ID == job.IncidentID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.mu.Unlock()
+			return DiagnosticJob{}, ErrDiagnosticIncident
+		}
+	}
+	s.DiagnosticJobs = append(s.DiagnosticJobs, job)
+	if len(s.DiagnosticJobs) > maxDiagnosticJobs {
+		s.DiagnosticJobs = append([]DiagnosticJob(nil), s.DiagnosticJobs[len(s.DiagnosticJobs)-maxDiagnosticJobs:]...)
+	}
+	out := cloneDiagnosticJob(job)
+	s.mu.Unlock()
+
+	s.save()
+	return out, nil
+}
+
+func (s *Store) findDiagnosticJobLocked(id string) int {
+	for i := range s.DiagnosticJobs {
+		if s.DiagnosticJobs[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) GetDiagnosticJob(id string) (DiagnosticJob, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx := s.findDiagnosticJobLocked(strings.TrimSpace(id))
+	if idx < 0 {
+		return DiagnosticJob{}, false
+	}
+	return cloneDiagnosticJob(s.DiagnosticJobs[idx]), true
+}
+
+func (s *Store) ListDiagnosticJobs(limit int, incidentID, agentID, state string) ([]DiagnosticJob, bool, int) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	incidentFilter := strings.TrimSpace(incidentID)
+	agentFilter := strings.TrimSpace(agentID)
+	stateFilter := strings.ToLower(strings.TrimSpace(state))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]DiagnosticJob, 0, min(limit, len(s.DiagnosticJobs)))
+	total := 0
+	for i := len(s.DiagnosticJobs) - 1; i >= 0; i-- {
+		job := s.DiagnosticJobs[i]
+		if incidentFilter != "" && job.IncidentID != incidentFilter {
+			continue
+		}
+		if agentFilter != "" && job.AgentID != agentFilter {
+			continue
+		}
+		if stateFilter != "" && job.State != stateFilter {
+			continue
+		}
+		total++
+		if len(out) >= limit {
+			continue
+		}
+		out = append(out, cloneDiagnosticJob(job))
+	}
+	return out, total > len(out), limit
+}
+
+// ClaimAgentDiagnosticJobs hands dispatched jobs to the agent that is
+// expected to run them and marks them running.
+func (s *Store) ClaimAgentDiagnosticJobs(agentID string, limit int) []DiagnosticJob {
+	agentID = strings.TrimSpace(agentID)
+	if agentID == "" {
+		return nil
+	}
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+	nowISO := time.Now().UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	out := make([]DiagnosticJob, 0, limit)
+	for i := range s.DiagnosticJobs {
+		job := &s.DiagnosticJobs[i]
+		if job.AgentID != agentID || job.State != "dispatched" {
+			continue
+		}
+		job.State = "running"
+		job.StartedAt = nowISO
+		out = append(out, cloneDiagnosticJob(*job))
+		if len(out) >= limit {
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if len(out) > 0 {
+		s.save()
+	}
+	return out
+}
+
+// MarkDiagnosticJobRunning starts a queued API-runner job.
+func (s *Store) MarkDiagnosticJobRunning(id string) (DiagnosticJob, error) {
+	s.mu.Lock()
+	idx := s.findDiagnosticJobLocked(strings.TrimSpace(id))
+	if idx < 0 {
+		s.mu.Unlock()
+		return DiagnosticJob{}, ErrDiagnosticJobNotFound
+	}
+	job := &s.DiagnosticJobs[idx]
+	if job.Runner != "api" {
+		out := cloneDiagnosticJob(*job)
+		s.mu.Unlock()
+		return out, ErrDiagnosticJobOwner
+	}
+	if job.State != "queued" {
+		out := cloneDiagnosticJob(*job)
+		s.mu.Unlock()
+		return out, ErrDiagnosticJobState
+	}
+	job.State = "running"
+	job.StartedAt = time.Now().UTC().Format(time.RFC3339)
+	out := cloneDiagnosticJob(*job)
+	s.mu.Unlock()
+
+	s.save()
+	return out, nil
+}
+
+// CompleteDiagnosticJob stores the result of a running API-runner job.
+func (s *Store) CompleteDiagnosticJob(id string, result DiagnosticResult) (DiagnosticJob, error) {
+	return s.completeDiagnosticJob(id, "", result)
+}
+
+// CompleteAgentDiagnosticJob stores a result reported by the agent the job
+// was dispatched to.
+func (s *Store) CompleteAgentDiagnosticJob(id, agentID string, result DiagnosticResult) (DiagnosticJob, error) {
+	agentID = strings.TrimSpace(agentID)
+	if agentID == "" {
+		return DiagnosticJob{}, ErrDiagnosticJobOwner
+	}
+	return s.completeDiagnosticJob(id, agentID, result)
+}
+
+// completeDiagnosticJob stores a job result and, when the job is tied to an
+// incident, appends the evidence to the incident command timeline. An empty
+// agentID completes an API-runner job; otherwise the job must be assigned to
+// that agent.
+func (s *Store) completeDiagnosticJob(id, agentID string, result DiagnosticResult) (DiagnosticJob, error) {
+	result = normalizeDiagnosticResult(result)
+	nowISO := time.Now().UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	idx := s.findDiagnosticJobLocked(strings.TrimSpace(id))
+	if idx < 0 {
+		s.mu.Unlock()
+		return DiagnosticJob{}, ErrDiagnosticJobNotFound
+	}
+	job := &s.DiagnosticJobs[idx]
+	var err error
+	switch {
+	case job.State == "completed" || job.State == "failed":
+		err = ErrDiagnosticJobFinished
+	case agentID == "" && job.Runner != "api", agentID != "" && (job.Runner != "agent" || job.AgentID != agentID):
+		err = ErrDiagnosticJobOwner
+	case agentID == "" && job.State != "running", agentID != "" && job.State != "running" && job.State != "dispatched":
+		err = ErrDiagnosticJobState
+	}
+	if err != nil {
+		out := cloneDiagnosticJob(*job)
+		s.mu.Unlock()
+		return out, err
+	}
+	s.finishDiagnosticJobLocked(job, result, nowISO)
+	out := cloneDiagnosticJob(*job)
+	s.mu.Unlock()
+
+	s.save()
+	return out, nil
+}
+
+// finishDiagnosticJobLocked records the result and, when the job is tied to
+// an incident, appends the evidence to the incident command timeline.
+func (s *Store) finishDiagnosticJobLocked(job *DiagnosticJob, result DiagnosticResult, nowISO string) {
+	job.Result = result
+	job.FinishedAt = nowISO
+	if job.StartedAt == "" {
+		job.StartedAt = nowISO
+	}
+	job.State = "completed"
+	if strings.TrimSpace(result.Error) != "" {
+		job.State = "failed"
+	}
+	if job.IncidentID == "" {
+		return
+	}
+	for i := range s.Incidents {
+		if s.Incidents[i].ID != job.IncidentID {
+			continue
+		}
+		message := diagnosticTimelineMessage(*job)
+		s.appendIncidentTimelineEntryLocked(i, "diagnostic", job.Actor, message, nowISO)
+		s.appendIncidentAuditEventLocked(i, "diagnostic_result", job.Actor, message, map[string]string{
+			"job_id": job.ID,
+			"kind":   job.Kind,
+			"target": job.Target,
+			"runner": job.Runner,
+			"agent":  job.AgentID,
+			"state":  job.State,
+		}, nowISO)
+		job.Attached = true
+		return
+	}
+}
+
+// FailDiagnosticJob fails a job that has not finished, e.g. one the runner
+// could not queue.
+func (s *Store) FailDiagnosticJob(id, reason string) (DiagnosticJob, error) {
+	s.mu.Lock()
+	idx := s.findDiagnosticJobLocked(strings.TrimSpace(id))
+	if idx < 0 {
+		s.mu.Unlock()
+		return DiagnosticJob{}, ErrDiagnosticJobNotFound
+	}
+	job := &s.DiagnosticJobs[idx]
+	if job.State == "completed" || job.State == "failed" {
+		out := cloneDiagnosticJob(*job)
+		s.mu.Unlock()
+		return out, ErrDiagnosticJobFinished
+	}
+	s.finishDiagnosticJobLocked(job, DiagnosticResult{Error: reason}, time.Now().UTC().Format(time.RFC3339))
+	out := cloneDiagnosticJob(*job)
+	s.mu.Unlock()
+
+	s.save()
+	return out, nil
+}
+
+// ExpireDiagnosticJobs fails unfinished jobs created more than ttl ago: an
+// agent that went away never reports, and API jobs queued before a restart
+// never run.
+func (s *Store) ExpireDiagnosticJobs(now time.Time, ttl time.Duration) int {
+	nowISO := now.UTC().Format(time.RFC3339)
+	reason := fmt.Sprintf("expired: no result within %s", ttl)
+
+	s.mu.Lock()
+	expired := 0
+	for i := range s.DiagnosticJobs {
+		job := &s.DiagnosticJobs[i]
+		if job.State == "completed" || job.State == "failed" {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, job.CreatedAt)
+		if err == nil && now.Sub(created) < ttl {
+			continue
+		}
+		s.finishDiagnosticJobLocked(job, DiagnosticResult{Error: reason}, nowISO)
+		expired++
+	}
+	s.mu.Unlock()
+
+	if expired > 0 {
+		s.save()
+	}
+	return expired
+}
+
+func diagnosticTimelineMessage(job DiagnosticJob) string {
+	runner := "api host"
+	if job.Runner == "agent" {
+		runner = "agent " + job.AgentID
+	}
+	target := job.Target
+	if job.Kind == "tcp" {
+		target = net.JoinHostPort(job.Target, strconv.Itoa(job.Port))
+	}
+	status := "ok"
+	if !job.Result.Success {
+		status = "failed"
+	}
+	parts := []string{fmt.Sprintf("Diagnostic %s %s from %s: %s.", job.Kind, target, runner, status)}
+	if summary := strings.TrimSpace(job.Result.Summary); summary != "" {
+		parts = append(parts, summary)
+	}
+	if errText := strings.TrimSpace(job.Result.Error); errText != "" {
+		parts = append(parts, "Error: "+errText)
+	}
+	if len(job.Result.Hops) > 0 {
+		hops := make([]string, 0, len(job.Result.Hops))
+		for _, hop := range job.Result.Hops {
+			label := firstNonEmpty(hop.Address, "*")
+			if hop.RTTMs != nil {
+				label += fmt.Sprintf(" %.1fms", *hop.RTTMs)
+			}
+			hops = append(hops, strconv.Itoa(hop.Hop)+":"+label)
+		}
+		parts = append(parts, "Path: "+strings.Join(hops, " > "))
+	}
+	return strings.Join(parts, " ")
+}
+
+func normalizeDiagnosticResult(result DiagnosticResult) DiagnosticResult {
+	result.Summary = strings.TrimSpace(result.Summary)
+	result.Error = strings.TrimSpace(result.Error)
+	if len(result.Output) > maxDiagnosticOutputLines {
+		result.Output = append([]string(nil), result.Output[:maxDiagnosticOutputLines]...)
+	}
+	if len(result.Hops) > maxDiagnosticHops {
+		result.Hops = append([]DiagnosticHop(nil), result.Hops[:maxDiagnosticHops]...)
+	}
+	if result.Error != "" {
+		result.Success = false
+	}
+	return result
+}
+
+func cloneDiagnosticJob(in DiagnosticJob) DiagnosticJob {
+	out := in
+	out.Result.LatencyMs = cloneFloat64Ptr(in.Result.LatencyMs)
+	out.Result.PacketLossPct = cloneFloat64Ptr(in.Result.PacketLossPct)
+	out.Result.Output = append([]string(nil), in.Result.Output...)
+	if len(in.Result.Hops) > 0 {
+		out.Result.Hops = make([]DiagnosticHop, len(in.Result.Hops))
+		for i, hop := range in.Result.Hops {
+			hop.RTTMs = cloneFloat64Ptr(hop.RTTMs)
+			out.Result.Hops[i] = hop
+		}
+	}
+	return out
+}
+
+func cloneDiagnosticJobs(in []DiagnosticJob) []DiagnosticJob {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]DiagnosticJob, len(in))
+	for i, job := range in {
+		out[i] = cloneDiagnosticJob(job)
+	}
+	return out
+}
+
+// runDiagnosticJob executes an API-host job and records its result.
+func runDiagnosticJob(ctx context.Context, store *Store, executor DiagnosticExecutor, job DiagnosticJob) (DiagnosticJob, error) {
+	if job.Runner != "api" {
+		return job, ErrDiagnosticRunner
+	}
+	if _, err := store.MarkDiagnosticJobRunning(job.ID); err != nil {
+		return job, err
+	}
+	timeout := time.Duration(job.TimeoutMs)*time.Millisecond*time.Duration(max(1, job.Count)) + 5*time.Second
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result := executor.Run(runCtx, job)
+	return store.CompleteDiagnosticJob(job.ID, result)
+}
+
+// DiagnosticRunner runs API-host jobs on a fixed number of workers so a
+// burst of requests cannot start unbounded ping and traceroute processes.
+type DiagnosticRunner struct {
+	store    *Store
+	executor DiagnosticExecutor
+	logger   *slog.Logger
+	workers  int
+	ttl      time.Duration
+	jobs     chan DiagnosticJob
+}
+
+func NewDiagnosticRunner(store *Store, executor DiagnosticExecutor, logger *slog.Logger, workers, queue int, ttl time.Duration) *DiagnosticRunner {
+	if workers <= 0 {
+		workers = defaultDiagnosticWorkers
+	}
+	if queue <= 0 {
+		queue = defaultDiagnosticQueue
+	}
+	if ttl <= 0 {
+		ttl = defaultDiagnosticJobTTL
+	}
+	return &DiagnosticRunner{store: store, executor: executor, logger: logger, workers: workers, ttl: ttl, jobs: make(chan DiagnosticJob, queue)}
+}
+
+// Submit queues an API-runner job without blocking. A full queue fails the
+// job and returns ErrDiagnosticQueueFull.
+func (r *DiagnosticRunner) Submit(job DiagnosticJob) error {
+	select {
+	case r.jobs <- job:
+		return nil
+	default:
+		_, _ = r.store.FailDiagnosticJob(job.ID, ErrDiagnosticQueueFull.Error())
+		return ErrDiagnosticQueueFull
+	}
+}
+
+// Run starts the workers and the expiry sweep. Jobs in flight are cancelled
+// when ctx ends.
+func (r *DiagnosticRunner) Run(ctx context.Context) {
+	for i := 0; i < r.workers; i++ {
+		go r.work(ctx)
+	}
+	ticker := time.NewTicker(diagnosticSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if expired := r.store.ExpireDiagnosticJobs(now, r.ttl); expired > 0 {
+				r.logger.Warn("diagnostic_jobs_expired", "count", expired, "ttl_sec", int(r.ttl.Seconds()))
+			}
+		}
+	}
+}
+
+func (r *DiagnosticRunner) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-r.jobs:
+			done, err := runDiagnosticJob(ctx, r.store, r.executor, job)
+			if err != nil {
+				r.logger.Warn("diagnostic_job_failed", "job_id", job.ID, "error", err)
+				continue
+			}
+			r.logger.Info("diagnostic_job_completed", "job_id", done.ID, "kind", done.Kind, "state", done.State, "incident_id", done.IncidentID)
+		}
+	}
+}
+
+func (localDiagnosticExecutor) Run(ctx context.Context, job DiagnosticJob) DiagnosticResult {
+	switch job.Kind {
+	case "tcp":
+		return runTCPDiagnostic(ctx, job)
+	case "traceroute":
+		waitSec := strconv.Itoa(max(1, job.TimeoutMs/1000))
+		out, err := exec.CommandContext(ctx, "traceroute", "-n", "-q", "1", "-w", waitSec, "-m", strconv.Itoa(maxDiagnosticHops), job.Target).CombinedOutput()
+		result := parseTracerouteOutput(string(out))
+		if err != nil && len(result.Hops) == 0 {
+			result.Error = err.Error()
+		}
+		return result
+	default:
+		waitSec := strconv.Itoa(max(1, job.TimeoutMs/1000))
+		out, err := exec.CommandContext(ctx, "ping", "-n", "-c", strconv.Itoa(job.Count), "-W", waitSec, job.Target).CombinedOutput()
+		result := parsePingOutput(string(out))
+		if err != nil && result.PacketLossPct == nil {
+			result.Error = err.Error()
+		}
+		return result
+	}
+}
+
+func runTCPDiagnostic(ctx context.Context, job DiagnosticJob) DiagnosticResult {
+	address := net.JoinHostPort(job.Target, strconv.Itoa(job.Port))
+	dialer := net.Dialer{Timeout: time.Duration(job.TimeoutMs) * time.Millisecond}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	elapsed := float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		return DiagnosticResult{
+			Success: false,
+			Summary: "TCP connect to " + address + " failed.",
+			Error:   err.Error(),
+		}
+	}
+	_ = conn.Close()
+	latency := roundMetric(elapsed)
+	return DiagnosticResult{
+		Success:   true,
+		Summary:   fmt.Sprintf("TCP connect to %s succeeded in %.2fms.", address, latency),
+		LatencyMs: &latency,
+	}
+}
+
+func parsePingOutput(raw string) DiagnosticResult {
+	result := DiagnosticResult{Output: diagnosticOutputLines(raw)}
+	if match := pingLossPattern.FindStringSubmatch(raw); len(match) == 2 {
+		if loss, err := strconv.ParseFloat(match[1], 64); err == nil {
+			result.PacketLossPct = &loss
+		}
+	}
+	if match := pingRTTPattern.FindStringSubmatch(raw); len(match) == 4 {
+		if avg, err := strconv.ParseFloat(match[2], 64); err == nil {
+			result.LatencyMs = &avg
+		}
+	}
+	switch {
+	case result.PacketLossPct == nil:
+		result.Summary = "No ping statistics returned."
+	case result.LatencyMs != nil:
+		result.Success = *result.PacketLossPct < 100
+		result.Summary = fmt.Sprintf("avg %.2fms, %.0f%% loss.", *result.LatencyMs, *result.PacketLossPct)
+	default:
+		result.Summary = fmt.Sprintf("%.0f%% loss.", *result.PacketLossPct)
+	}
+	return result
+}
+
+func parseTracerouteOutput(raw string) DiagnosticResult {
+	result := DiagnosticResult{Output: diagnosticOutputLines(raw)}
+	for _, line := range strings.Split(raw, "\n") {
+		match := tracerouteHopPattern.FindStringSubmatch(line)
+		if len(match) != 3 {
+			continue
+		}
+		hopNum, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		hop := DiagnosticHop{Hop: hopNum}
+		rest := strings.TrimSpace(match[2])
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || fields[0] == "*" {
+			hop.Timeout = true
+		} else {
+			hop.Address = fields[0]
+			if rtt := tracerouteRTTPattern.FindStringSubmatch(rest); len(rtt) == 2 {
+				if val, err := strconv.ParseFloat(rtt[1], 64); err == nil {
+					hop.RTTMs = &val
+				}
+			}
+		}
+		result.Hops = append(result.Hops, hop)
+		if len(result.Hops) >= maxDiagnosticHops {
+			break
+		}
+	}
+	if len(result.Hops) == 0 {
+		result.Summary = "No traceroute hops returned."
+		return result
+	}
+	last := result.Hops[len(result.Hops)-1]
+	result.Success = !last.Timeout
+	if last.RTTMs != nil {
+		latency := *last.RTTMs
+		result.LatencyMs = &latency
+	}
+	result.Summary = fmt.Sprintf("%d hops, last hop %s.", len(result.Hops), firstNonEmpty(last.Address, "timed out"))
+	return result
+}
+
+func diagnosticOutputLines(raw string) []string {
+	lines := make([]string, 0, 8)
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) >= maxDiagnosticOutputLines {
+			break
+		}
+	}
+	return lines
+}
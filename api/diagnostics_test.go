@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeDiagnosticExecutor struct {
+	result DiagnosticResult
+	jobs   []DiagnosticJob
+}
+
+func (f *fakeDiagnosticExecutor) Run(ctx context.Context, job DiagnosticJob) DiagnosticResult {
+	f.jobs = append(f.jobs, job)
+	return f.result
+}
+
+func TestDiagnosticJobAttachesResultToIncidentTimeline(t *testing.T) {
+	s := LoadStore("")
+	s.mu.Lock()
+	s.Devices = nil
+	s.Incidents = nil
+	s.mu.Unlock()
+
+	offline := false
+	_, incident, ok := s.IngestTelemetry(TelemetryIngestRequest{
+		Source:    "diagnostics_test",
+		EventType: "offline",
+		DeviceID:  "diag-node-1",
+		Device:    "Diag Node 1",
+		SiteID:    "diag-site",
+		Online:    &offline,
+	})
+	if !ok || incident == nil {
+		t.Fatalf("expected incident for diagnostics test")
+	}
+
+	job, err := s.CreateDiagnosticJob(DiagnosticJobRequest{Kind: "ping", Target: "10.20.0.1", IncidentID: incident.ID, Actor: "alice"})
+	if err != nil {
+		t.Fatalf("create diagnostic job: %v", err)
+	}
+	if job.Runner != "api" || job.State != "queued" || job.Count != defaultDiagnosticCount {
+		t.Fatalf("unexpected job defaults: %#v", job)
+	}
+
+	latency := 12.5
+	loss := 25.0
+	executor := &fakeDiagnosticExecutor{result: DiagnosticResult{Success: true, Summary: "avg 12.50ms, 25% loss.", LatencyMs: &latency, PacketLossPct: &loss}}
+	done, err := runDiagnosticJob(context.Background(), s, executor, job)
+	if err != nil {
+		t.Fatalf("run diagnostic job: %v", err)
+	}
+	if len(executor.jobs) != 1 || done.State != "completed" || !done.Attached {
+		t.Fatalf("expected completed attached job, got=%#v", done)
+	}
+
+	doc, ok := s.IncidentTimelineExport(incident.ID)
+	if !ok {
+		t.Fatalf("expected export document for incident")
+	}
+	found := false
+	for _, entry := range doc.Incident.CommandTimeline {
+		if entry.EventType == "diagnostic" && strings.Contains(entry.Message, "ping 10.20.0.1") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected diagnostic entry in timeline, got=%#v", doc.Incident.CommandTimeline)
+	}
+	if markdown := BuildIncidentTimelineMarkdown(doc); !strings.Contains(markdown, "avg 12.50ms, 25% loss.") {
+		t.Fatalf("expected diagnostic summary in markdown export")
+	}
+
+	if _, err := s.CompleteDiagnosticJob(job.ID, DiagnosticResult{Success: true}); err != ErrDiagnosticJobFinished {
+		t.Fatalf("expected duplicate result to be rejected, got=%v", err)
+	}
+	if _, err := s.MarkDiagnosticJobRunning(job.ID); err != ErrDiagnosticJobState {
+		t.Fatalf("expected completed job to stay completed, got=%v", err)
+	}
+	jobs, _, _ := s.ListDiagnosticJobs(10, incident.ID, "", "completed")
+	if len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Fatalf("expected completed job in incident filter, got=%#v", jobs)
+	}
+}
+
+func TestDiagnosticJobDispatchesToAgent(t *testing.T) {
+	s := LoadStore("")
+	s.RegisterAgent(AgentRegisterRequest{ID: "agent-diag", SiteID: "site-1"})
+
+	if _, err := s.CreateDiagnosticJob(DiagnosticJobRequest{Kind: "tcp", Target: "10.0.0.5", Port: 22, AgentID: "agent-missing"}); err != ErrDiagnosticAgentUnknown {
+		t.Fatalf("expected unknown agent error, got=%v", err)
+	}
+	job, err := s.CreateDiagnosticJob(DiagnosticJobRequest{Kind: "tcp", Target: "10.0.0.5", Port: 22, AgentID: "agent-diag"})
+	if err != nil {
+		t.Fatalf("create agent job: %v", err)
+	}
+	if job.Runner != "agent" || job.State != "dispatched" {
+		t.Fatalf("expected dispatched agent job, got=%#v", job)
+	}
+
+	claimed := s.ClaimAgentDiagnosticJobs("agent-diag", 10)
+	if len(claimed) != 1 || claimed[0].State != "running" {
+		t.Fatalf("expected claimed running job, got=%#v", claimed)
+	}
+	if again := s.ClaimAgentDiagnosticJobs("agent-diag", 10); len(again) != 0 {
+		t.Fatalf("expected job to be claimed once, got=%#v", again)
+	}
+
+	if _, err := s.CompleteAgentDiagnosticJob(job.ID, "agent-other", DiagnosticResult{Success: true}); err != ErrDiagnosticJobOwner {
+		t.Fatalf("expected result from another agent to be rejected, got=%v", err)
+	}
+	if _, err := s.CompleteDiagnosticJob(job.ID, DiagnosticResult{Success: true}); err != ErrDiagnosticJobOwner {
+		t.Fatalf("expected api completion of an agent job to be rejected, got=%v", err)
+	}
+	done, err := s.CompleteAgentDiagnosticJob(job.ID, "agent-diag", DiagnosticResult{Error: "connection refused"})
+	if err != nil {
+		t.Fatalf("complete agent job: %v", err)
+	}
+	if done.State != "failed" || done.Result.Success || done.Attached {
+		t.Fatalf("expected failed unattached job, got=%#v", done)
+	}
+	if _, err := s.MarkDiagnosticJobRunning(job.ID); err != ErrDiagnosticJobOwner {
+		t.Fatalf("expected finished agent job to stay finished, got=%v", err)
+	}
+}
+
+// blockingDiagnosticExecutor holds every job until its context ends.
+type blockingDiagnosticExecutor struct{ started chan string }
+
+func (b blockingDiagnosticExecutor) Run(ctx context.Context, job DiagnosticJob) DiagnosticResult {
+	b.started <- job.ID
+	<-ctx.Done()
+	return DiagnosticResult{Error: ctx.Err().Error()}
+}
+
+func TestDiagnosticRunnerBoundsAndCancelsJobs(t *testing.T) {
+	s := LoadStore("")
+	executor := blockingDiagnosticExecutor{started: make(chan string, 4)}
+	runner := NewDiagnosticRunner(s, executor, slog.New(slog.NewTextHandler(io.Discard, nil)), 1, 1, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	go runner.Run(ctx)
+
+	create := func() DiagnosticJob {
+		job, err := s.CreateDiagnosticJob(DiagnosticJobRequest{Kind: "tcp", Target: "10.0.0.5", Port: 22})
+		if err != nil {
+			t.Fatalf("create job: %v", err)
+		}
+		return job
+	}
+	first := create()
+	if err := runner.Submit(first); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	<-executor.started
+	if err := runner.Submit(create()); err != nil {
+		t.Fatalf("expected one job to wait in the queue, got=%v", err)
+	}
+	overflow := create()
+	if err := runner.Submit(overflow); err != ErrDiagnosticQueueFull {
+		t.Fatalf("expected a full queue, got=%v", err)
+	}
+	if job, _ := s.GetDiagnosticJob(overflow.ID); job.State != "failed" || job.Result.Error != ErrDiagnosticQueueFull.Error() {
+		t.Fatalf("expected the rejected job to fail, got=%#v", job)
+	}
+
+	cancel()
+	waitFor(t, "cancelled job", func() bool {
+		job, _ := s.GetDiagnosticJob(first.ID)
+		return job.State == "failed"
+	})
+}
+
+func TestExpireDiagnosticJobsFailsStaleDispatchedJobs(t *testing.T) {
+	s := LoadStore("")
+	s.RegisterAgent(AgentRegisterRequest{ID: "agent-gone", SiteID: "site-1"})
+	stale, err := s.CreateDiagnosticJob(DiagnosticJobRequest{Kind: "tcp", Target: "10.0.0.5", Port: 22, AgentID: "agent-gone"})
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	done, _ := s.CreateDiagnosticJob(DiagnosticJobRequest{Kind: "tcp", Target: "10.0.0.6", Port: 22, AgentID: "agent-gone"})
+	s.ClaimAgentDiagnosticJobs("agent-gone", 10)
+	if _, err := s.CompleteAgentDiagnosticJob(done.ID, "agent-gone", DiagnosticResult{Success: true}); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	if n := s.ExpireDiagnosticJobs(time.Now(), time.Hour); n != 0 {
+		t.Fatalf("expected fresh jobs to be kept, expired=%d", n)
+	}
+	if n := s.ExpireDiagnosticJobs(time.Now().Add(2*time.Hour), time.Hour); n != 1 {
+		t.Fatalf("expected the running job to expire, expired=%d", n)
+	}
+	if job, _ := s.GetDiagnosticJob(stale.ID); job.State != "failed" || !strings.HasPrefix(job.Result.Error, "expired") {
+		t.Fatalf("expected expired job to fail, got=%#v", job)
+	}
+	if job, _ := s.GetDiagnosticJob(done.ID); job.State != "completed" {
+		t.Fatalf("expected finished job to stay completed, got=%#v", job)
+	}
+	if _, err := s.CompleteAgentDiagnosticJob(stale.ID, "agent-gone", DiagnosticResult{Success: true}); err != ErrDiagnosticJobFinished {
+		t.Fatalf("expected a late result to be rejected, got=%v", err)
+	}
+}
+
+func TestDiagnosticJobRequestValidation(t *testing.T) {
+	cases := []struct {
+		req DiagnosticJobRequest
+		err error
+	}{
+		{DiagnosticJobRequest{Kind: "dig", Target: "10.0.0.1"}, ErrDiagnosticKind},
+		{DiagnosticJobRequest{Kind: "ping", Target: "-f 10.0.0.1"}, ErrDiagnosticTarget},
+		{DiagnosticJobRequest{Kind: "ping", Target: "10.0.0.1; reboot"}, ErrDiagnosticTarget},
+		{DiagnosticJobRequest{Kind: "tcp", Target: "10.0.0.1"}, ErrDiagnosticPort},
+		{DiagnosticJobRequest{Kind: "tcp", Target: "10.0.0.1", Port: 70000}, ErrDiagnosticPort},
+		{DiagnosticJobRequest{Kind: "ping", Target: "10.0.0.1", Runner: "agent"}, ErrDiagnosticRunner},
+	}
+	for _, tc := range cases {
+		if _, err := normalizeDiagnosticJobRequest(tc.req); err != tc.err {
+			t.Fatalf("expected %v for %#v, got=%v", tc.err, tc.req, err)
+		}
+	}
+}
+
+func TestLocalDiagnosticExecutorTCPCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	result := localDiagnosticExecutor{}.Run(context.Background(), DiagnosticJob{Kind: "tcp", Target: "127.0.0.1", Port: port, TimeoutMs: 1000})
+	if !result.Success || result.LatencyMs == nil {
+		t.Fatalf("expected successful tcp check, got=%#v", result)
+	}
+
+	ln.Close()
+	result = localDiagnosticExecutor{}.Run(context.Background(), DiagnosticJob{Kind: "tcp", Target: "127.0.0.1", Port: port, TimeoutMs: 1000})
+	if result.Success || result.Error == "" {
+		t.Fatalf("expected failed tcp check after close, got=%#v", result)
+	}
+}
+
+func TestParseDiagnosticCommandOutput(t *testing.T) {
+	ping := parsePingOutput(`PING 10.0.0.1 (10.0.0.1) 56(84) bytes of data.
+64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=1.10 ms
+
+--- 10.0.0.1 ping statistics ---
+4 packets transmitted, 3 received, 25% packet loss, time 3004ms
+rtt min/avg/max/mdev = 0.900/1.250/1.600/0.250 ms
+`)
+	if !ping.Success || ping.PacketLossPct == nil || *ping.PacketLossPct != 25 || ping.LatencyMs == nil || *ping.LatencyMs != 1.25 {
+		t.Fatalf("unexpected ping parse: %#v", ping)
+	}
+	down := parsePingOutput("4 packets transmitted, 0 received, 100% packet loss, time 3060ms\n")
+	if down.Success || down.PacketLossPct == nil || *down.PacketLossPct != 100 {
+		t.Fatalf("expected total loss parse, got=%#v", down)
+	}
+
+	trace := parseTracerouteOutput(`traceroute to 10.9.9.9 (10.9.9.9), 30 hops max, 60 byte packets
+ 1  10.0.0.1  0.512 ms
+ 2  *
+ 3  10.9.9.9  4.210 ms
+`)
+	if len(trace.Hops) != 3 || !trace.Hops[1].Timeout || trace.Hops[2].Address != "10.9.9.9" || !trace.Success {
+		t.Fatalf("unexpected traceroute parse: %#v", trace)
+	}
+	if trace.LatencyMs == nil || *trace.LatencyMs != 4.21 {
+		t.Fatalf("expected last hop latency, got=%v", trace.LatencyMs)
+	}
+}
@@ -0,0 +1,704 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	flowBucketMs          = 60_000
+	defaultFlowRetention  = 60 * time.Minute
+	defaultFlowWindowMins = 15
+	maxFlowKeysPerBucket  = 2000
+	flowOtherKey          = "other"
+	maxFlowPacketBytes    = 65535
+
+	// Senders are not authenticated, so every per-exporter map is capped.
+	maxFlowExporters            = 1024
+	maxFlowIfacesPerExporter    = 4096
+	maxFlowTemplatesPerExporter = 512
+)
+
+var flowAppNames = map[string]string{
+	"tcp/20": "ftp-data", "tcp/21": "ftp", "tcp/22": "ssh", "tcp/23": "telnet", "tcp/25": "smtp",
+	"udp/53": "dns", "tcp/53": "dns", "udp/67": "dhcp", "udp/68": "dhcp", "tcp/80": "http",
+	"tcp/110": "pop3", "udp/123": "ntp", "tcp/143": "imap", "udp/161": "snmp", "udp/162": "snmp-trap",
+	"tcp/179": "bgp", "tcp/443": "https", "udp/443": "quic", "udp/500": "ike", "udp/514": "syslog",
+	"tcp/587": "submission", "tcp/853": "dns-over-tls", "tcp/993": "imaps", "tcp/995": "pop3s",
+	"udp/1194": "openvpn", "udp/1812": "radius", "udp/1813": "radius-acct", "tcp/1883": "mqtt",
+	"udp/2055": "netflow", "tcp/3389": "rdp", "udp/3478": "stun", "udp/4500": "ipsec-nat-t",
+	"udp/5060": "sip", "tcp/8080": "http-alt", "tcp/8291": "winbox", "tcp/8443": "https-alt",
+	"udp/51820": "wireguard",
+}
+
+var flowProtocolNames = map[uint8]string{1: "icmp", 6: "tcp", 17: "udp", 47: "gre", 50: "esp", 58: "icmpv6", 89: "ospf", 112: "vrrp"}
+
+type FlowExporterStats struct {
+	Address          string `json:"address"`
+	Protocol         string `json:"protocol"`
+	Versions         []int  `json:"versions"`
+	Packets          int64  `json:"packets"`
+	Records          int64  `json:"records"`
+	CounterSamples   int64  `json:"counter_samples,omitempty"`
+	DecodeErrors     int64  `json:"decode_errors"`
+	MissingTemplates int64  `json:"missing_templates"`
+	LastError        string `json:"last_error,omitempty"`
+	LastSeen         string `json:"last_seen,omitempty"`
+	lastSeenMs       int64
+}
+
+type FlowTopItem struct {
+	Key           string  `json:"key"`
+	Bytes         uint64  `json:"bytes"`
+	Packets       uint64  `json:"packets"`
+	Bps           float64 `json:"bps"`
+	Share         float64 `json:"share"`
+	SentBytes     uint64  `json:"sent_bytes,omitempty"`
+	ReceivedBytes uint64  `json:"received_bytes,omitempty"`
+}
+
+type FlowTopQuery struct {
+	WindowMinutes int
+	DeviceID      string
+	SiteID        string
+	Interface     string
+	Limit         int
+}
+
+type FlowTopResponse struct {
+	LastUpdated   int64         `json:"last_updated"`
+	WindowMinutes int           `json:"window_minutes"`
+	TotalBytes    uint64        `json:"total_bytes"`
+	Count         int           `json:"count"`
+	Items         []FlowTopItem `json:"items"`
+	Truncated     bool          `json:"truncated"`
+	Limit         int           `json:"limit"`
+	Stub          bool          `json:"stub"`
+}
+
+type flowTally struct {
+	bytes, packets, sent, received uint64
+}
+
+type flowScopeTally struct {
+	rxBytes, txBytes uint64
+	talkers          map[string]*flowTally
+	apps             map[string]*flowTally
+}
+
+func newFlowScopeTally() *flowScopeTally {
+	return &flowScopeTally{talkers: map[string]*flowTally{}, apps: map[string]*flowTally{}}
+}
+
+type flowIfaceKey struct {
+	exporter string
+	ifIndex  uint32
+}
+
+type flowBucket struct {
+	startMs    int64
+	flushed    bool
+	exporters  map[string]*flowScopeTally
+	ifaces     map[flowIfaceKey]*flowScopeTally
+	ifaceCount map[string]int
+}
+
+// flowPendingCounters holds the latest counter-derived facts per
+// interface of one agent until the next flush.
+type flowPendingCounters struct {
+	atMs  int64
+	facts map[uint32]TelemetryInterfaceFact
+}
+
+// FlowInterfaceRates is one flushed sample of an exporter's interface
+// facts, keyed by the exporter address rather than a device.
+type FlowInterfaceRates struct {
+	Source       string
+	Exporter     string
+	Interfaces   []TelemetryInterfaceFact
+	ObservedAtMs int64
+}
+
+// FlowCollector aggregates flow records into one-minute buckets per
+// exporter and exporter interface. Closed buckets are flushed as
+// interface rx/tx rates; retained buckets answer top talker and top
+// application queries. Interfaces that also report counters (sFlow) take
+// their rates from the counters instead of the sampled flows.
+type FlowCollector struct {
+	mu            sync.Mutex
+	retention     time.Duration
+	sources       map[string]string
+	decoder       *netflowDecoder
+	ifNames       map[string]map[uint32]string
+	exporters     map[string]*FlowExporterStats
+	buckets       []*flowBucket
+	counters      map[flowIfaceKey]sflowCounter
+	counterSeen   map[flowIfaceKey]int64
+	counterIfaces map[string]int
+	pending       map[string]*flowPendingCounters
+}
+
+func NewFlowCollector(retention time.Duration, ifNames map[string]map[uint32]string) *FlowCollector {
+	if retention < flowBucketMs*time.Millisecond {
+		retention = defaultFlowRetention
+	}
+	if ifNames == nil {
+		ifNames = map[string]map[uint32]string{}
+	}
+	return &FlowCollector{
+		retention:     retention,
+		sources:       map[string]string{netflowSource: netflowSource, sflowSource: sflowSource},
+		decoder:       newNetflowDecoder(),
+		ifNames:       ifNames,
+		exporters:     map[string]*FlowExporterStats{},
+		counters:      map[flowIfaceKey]sflowCounter{},
+		counterSeen:   map[flowIfaceKey]int64{},
+		counterIfaces: map[string]int{},
+		pending:       map[string]*flowPendingCounters{},
+	}
+}
+
+// SetSource names the telemetry source for rates from one protocol.
+func (c *FlowCollector) SetSource(protocol, name string) {
+	if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+		c.sources[protocol] = name
+	}
+}
+
+// loadFlowInterfaceNames reads FLOW_INTERFACE_NAMES: exporter address to
+// ifIndex to interface name, for exporters that do not announce names in
+// options records.
+func loadFlowInterfaceNames(inline, filePath string) (map[string]map[uint32]string, error) {
+	raw, err := readMappingSource(inline, filePath)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]map[uint32]string{}
+	if len(raw) == 0 {
+		return out, nil
+	}
+	var parsed map[string]map[string]string
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, err
+	}
+	for exporter, names := range parsed {
+		for index, name := range names {
+			n, err := strconv.ParseUint(strings.TrimSpace(index), 10, 32)
+			if err != nil || strings.TrimSpace(name) == "" {
+				return nil, fmt.Errorf("invalid interface mapping %s/%s", exporter, index)
+			}
+			exporter = strings.TrimSpace(exporter)
+			if out[exporter] == nil {
+				out[exporter] = map[uint32]string{}
+			}
+			out[exporter][uint32(n)] = strings.TrimSpace(name)
+		}
+	}
+	return out, nil
+}
+
+// HandleNetFlow decodes one NetFlow v5/v9 or IPFIX datagram.
+func (c *FlowCollector) HandleNetFlow(exporter string, data []byte, nowMs int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pkt, err := c.decoder.Decode(exporter, data)
+	version := pkt.Version
+	if err != nil {
+		version = 0
+	}
+	stats := c.exporterLocked(exporter, netflowSource, version, nowMs)
+	stats.MissingTemplates += int64(pkt.MissingTemplate)
+	if err != nil {
+		stats.DecodeErrors++
+		stats.LastError = err.Error()
+	}
+	c.addRecordsLocked(exporter, pkt.Records, nowMs)
+	return err
+}
+
+func (c *FlowCollector) exporterLocked(exporter, protocol string, version int, nowMs int64) *FlowExporterStats {
+	stats := c.exporters[exporter]
+	if stats == nil {
+		if len(c.exporters) >= maxFlowExporters {
+			c.evictStalestExporterLocked()
+		}
+		stats = &FlowExporterStats{Address: exporter}
+		c.exporters[exporter] = stats
+	}
+	stats.Protocol = protocol
+	stats.Packets++
+	stats.lastSeenMs = nowMs
+	stats.LastSeen = time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
+	if version > 0 && !containsInt(stats.Versions, version) {
+		stats.Versions = append(stats.Versions, version)
+		sort.Ints(stats.Versions)
+	}
+	return stats
+}
+
+// evictStalestExporterLocked forgets the exporter heard from longest ago,
+// with its templates, interface names and counter state. Its tallies in
+// retained buckets age out with them.
+func (c *FlowCollector) evictStalestExporterLocked() {
+	stalest := ""
+	for addr, stats := range c.exporters {
+		if stalest == "" || stats.lastSeenMs < c.exporters[stalest].lastSeenMs {
+			stalest = addr
+		}
+	}
+	if stalest == "" {
+		return
+	}
+	delete(c.exporters, stalest)
+	c.decoder.forget(stalest)
+	for key := range c.counters {
+		if key.exporter == stalest {
+			delete(c.counters, key)
+			delete(c.counterSeen, key)
+		}
+	}
+	delete(c.counterIfaces, stalest)
+	delete(c.pending, stalest)
+}
+
+// addRecordsLocked counts each flow as received on its input interface
+// and sent on its output interface. Exporters should meter ingress or
+// egress on every interface, not both, or traffic is counted twice.
+func (c *FlowCollector) addRecordsLocked(exporter string, records []FlowRecord, nowMs int64) {
+	if len(records) == 0 {
+		return
+	}
+	c.exporters[exporter].Records += int64(len(records))
+	bucket := c.bucketLocked(nowMs)
+	total := bucket.exporters[exporter]
+	if total == nil {
+		if len(bucket.exporters) >= maxFlowExporters {
+			return
+		}
+		total = newFlowScopeTally()
+		bucket.exporters[exporter] = total
+	}
+	for _, rec := range records {
+		app := flowApplication(rec)
+		total.add(rec, app)
+		if in := bucket.iface(exporter, rec.InputIf); in != nil {
+			in.rxBytes += rec.Bytes
+			in.add(rec, app)
+		}
+		if out := bucket.iface(exporter, rec.OutputIf); out != nil {
+			out.txBytes += rec.Bytes
+			if rec.OutputIf != rec.InputIf {
+				out.add(rec, app)
+			}
+		}
+	}
+}
+
+// iface returns the tally of one exporter interface, or nil for ifIndex 0
+// and for interfaces past maxFlowIfacesPerExporter in this bucket.
+func (b *flowBucket) iface(exporter string, ifIndex uint32) *flowScopeTally {
+	if ifIndex == 0 {
+		return nil
+	}
+	key := flowIfaceKey{exporter: exporter, ifIndex: ifIndex}
+	t := b.ifaces[key]
+	if t == nil {
+		if b.ifaceCount[exporter] >= maxFlowIfacesPerExporter {
+			return nil
+		}
+		b.ifaceCount[exporter]++
+		t = newFlowScopeTally()
+		b.ifaces[key] = t
+	}
+	return t
+}
+
+func (t *flowScopeTally) add(rec FlowRecord, app string) {
+	if rec.SrcAddr != "" {
+		talker := tallyKey(t.talkers, rec.SrcAddr)
+		talker.bytes += rec.Bytes
+		talker.packets += rec.Packets
+		talker.sent += rec.Bytes
+	}
+	if rec.DstAddr != "" && rec.DstAddr != rec.SrcAddr {
+		talker := tallyKey(t.talkers, rec.DstAddr)
+		talker.bytes += rec.Bytes
+		talker.packets += rec.Packets
+		talker.received += rec.Bytes
+	}
+	a := tallyKey(t.apps, app)
+	a.bytes += rec.Bytes
+	a.packets += rec.Packets
+}
+
+// tallyKey caps the keys per bucket; the long tail lands in "other".
+func tallyKey(m map[string]*flowTally, key string) *flowTally {
+	if t := m[key]; t != nil {
+		return t
+	}
+	if len(m) >= maxFlowKeysPerBucket {
+		key = flowOtherKey
+		if t := m[key]; t != nil {
+			return t
+		}
+	}
+	t := &flowTally{}
+	m[key] = t
+	return t
+}
+
+// flowApplication names a flow by protocol and the well-known side of its
+// port pair, e.g. "tcp/443 https".
+func flowApplication(rec FlowRecord) string {
+	if rec.Protocol == 0 && rec.SrcAddr == "" && rec.DstAddr == "" {
+		// sFlow samples of ARP, LLDP and other non-IP frames.
+		return "non-ip"
+	}
+	proto := flowProtocolNames[rec.Protocol]
+	if proto == "" {
+		proto = "ip/" + strconv.Itoa(int(rec.Protocol))
+	}
+	if rec.Protocol != 6 && rec.Protocol != 17 {
+		return proto
+	}
+	for _, port := range []uint16{rec.DstPort, rec.SrcPort} {
+		key := proto + "/" + strconv.Itoa(int(port))
+		if name := flowAppNames[key]; name != "" {
+			return key + " " + name
+		}
+	}
+	port := rec.DstPort
+	if rec.SrcPort != 0 && (port == 0 || rec.SrcPort < port) {
+		port = rec.SrcPort
+	}
+	if port >= 1024 {
+		return proto + "/ephemeral"
+	}
+	return proto + "/" + strconv.Itoa(int(port))
+}
+
+func (c *FlowCollector) bucketLocked(nowMs int64) *flowBucket {
+	start := nowMs - nowMs%flowBucketMs
+	if n := len(c.buckets); n > 0 && c.buckets[n-1].startMs == start {
+		return c.buckets[n-1]
+	}
+	b := &flowBucket{startMs: start, exporters: map[string]*flowScopeTally{}, ifaces: map[flowIfaceKey]*flowScopeTally{}, ifaceCount: map[string]int{}}
+	c.buckets = append(c.buckets, b)
+	return b
+}
+
+func (c *FlowCollector) interfaceNameLocked(exporter string, ifIndex uint32) string {
+	if name := c.ifNames[exporter][ifIndex]; name != "" {
+		return name
+	}
+	if name := c.decoder.InterfaceName(exporter, ifIndex); name != "" {
+		return name
+	}
+	return "if" + strconv.FormatUint(uint64(ifIndex), 10)
+}
+
+// FlushRates turns each closed, unflushed bucket into one sample per
+// exporter carrying its interface rates, emits pending counter facts, and
+// drops buckets past retention.
+func (c *FlowCollector) FlushRates(nowMs int64) []FlowInterfaceRates {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var events []FlowInterfaceRates
+	for _, b := range c.buckets {
+		if b.flushed || b.startMs+flowBucketMs > nowMs {
+			continue
+		}
+		b.flushed = true
+		endMs := b.startMs + flowBucketMs
+		byExporter := map[string][]TelemetryInterfaceFact{}
+		for key, t := range b.ifaces {
+			if seen := c.counterSeen[key]; seen > 0 && endMs-seen < 2*flowBucketMs {
+				continue
+			}
+			rx := float64(t.rxBytes*8) / (flowBucketMs / 1000)
+			tx := float64(t.txBytes*8) / (flowBucketMs / 1000)
+			byExporter[key.exporter] = append(byExporter[key.exporter], TelemetryInterfaceFact{Name: c.interfaceNameLocked(key.exporter, key.ifIndex), RxBps: &rx, TxBps: &tx})
+		}
+		exporters := make([]string, 0, len(byExporter))
+		for exporter := range byExporter {
+			exporters = append(exporters, exporter)
+		}
+		sort.Strings(exporters)
+		for _, exporter := range exporters {
+			events = append(events, c.exporterRatesLocked(exporter, byExporter[exporter], endMs))
+		}
+	}
+	agents := make([]string, 0, len(c.pending))
+	for agent := range c.pending {
+		agents = append(agents, agent)
+	}
+	sort.Strings(agents)
+	for _, agent := range agents {
+		p := c.pending[agent]
+		facts := make([]TelemetryInterfaceFact, 0, len(p.facts))
+		for _, fact := range p.facts {
+			facts = append(facts, fact)
+		}
+		events = append(events, c.exporterRatesLocked(agent, facts, p.atMs))
+	}
+	c.pending = map[string]*flowPendingCounters{}
+
+	cutoff := nowMs - c.retention.Milliseconds()
+	kept := c.buckets[:0]
+	for _, b := range c.buckets {
+		if b.startMs+flowBucketMs > cutoff {
+			kept = append(kept, b)
+		}
+	}
+	c.buckets = kept
+	return events
+}
+
+func (c *FlowCollector) exporterRatesLocked(exporter string, facts []TelemetryInterfaceFact, atMs int64) FlowInterfaceRates {
+	sort.Slice(facts, func(i, j int) bool { return facts[i].Name < facts[j].Name })
+	source := netflowSource
+	if stats := c.exporters[exporter]; stats != nil {
+		source = c.sources[stats.Protocol]
+	}
+	return FlowInterfaceRates{Source: source, Exporter: exporter, Interfaces: facts, ObservedAtMs: atMs}
+}
+
+// TopTalkers ranks addresses by bytes sent plus received in the window.
+func (c *FlowCollector) TopTalkers(q FlowTopQuery, nowMs int64, resolve func(string) (string, string)) FlowTopResponse {
+	return c.top(q, nowMs, resolve, func(t *flowScopeTally) map[string]*flowTally { return t.talkers })
+}
+
+// TopApplications ranks protocol/port applications by bytes in the window.
+func (c *FlowCollector) TopApplications(q FlowTopQuery, nowMs int64, resolve func(string) (string, string)) FlowTopResponse {
+	return c.top(q, nowMs, resolve, func(t *flowScopeTally) map[string]*flowTally { return t.apps })
+}
+
+func (c *FlowCollector) top(q FlowTopQuery, nowMs int64, resolve func(string) (string, string), pick func(*flowScopeTally) map[string]*flowTally) FlowTopResponse {
+	maxWindow := int(c.retention / time.Minute)
+	if q.WindowMinutes <= 0 {
+		q.WindowMinutes = defaultFlowWindowMins
+	}
+	if q.WindowMinutes > maxWindow {
+		q.WindowMinutes = maxWindow
+	}
+	if q.Limit <= 0 || q.Limit > 500 {
+		q.Limit = 20
+	}
+	deviceFilter := strings.TrimSpace(q.DeviceID)
+	siteFilter := strings.TrimSpace(q.SiteID)
+	ifaceFilter := strings.TrimSpace(q.Interface)
+
+	c.mu.Lock()
+	sinceMs := nowMs - int64(q.WindowMinutes)*60_000
+	matches := map[string]bool{}
+	merged := map[string]*flowTally{}
+	var total uint64
+	for _, b := range c.buckets {
+		if b.startMs+flowBucketMs <= sinceMs {
+			continue
+		}
+		scopes := make([]*flowScopeTally, 0)
+		if ifaceFilter == "" {
+			for exporter, t := range b.exporters {
+				if c.exporterMatches(exporter, deviceFilter, siteFilter, matches, resolve) {
+					scopes = append(scopes, t)
+				}
+			}
+		} else {
+			for key, t := range b.ifaces {
+				name := c.interfaceNameLocked(key.exporter, key.ifIndex)
+				if (name == ifaceFilter || strconv.FormatUint(uint64(key.ifIndex), 10) == ifaceFilter) && c.exporterMatches(key.exporter, deviceFilter, siteFilter, matches, resolve) {
+					scopes = append(scopes, t)
+				}
+			}
+		}
+		for _, scope := range scopes {
+			for key, t := range pick(scope) {
+				m := merged[key]
+				if m == nil {
+					m = &flowTally{}
+					merged[key] = m
+				}
+				m.bytes += t.bytes
+				m.packets += t.packets
+				m.sent += t.sent
+				m.received += t.received
+				if t.sent == 0 && t.received == 0 {
+					total += t.bytes
+				} else {
+					total += t.sent
+				}
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	items := make([]FlowTopItem, 0, len(merged))
+	seconds := float64(q.WindowMinutes * 60)
+	for key, t := range merged {
+		item := FlowTopItem{Key: key, Bytes: t.bytes, Packets: t.packets, Bps: float64(t.bytes*8) / seconds, SentBytes: t.sent, ReceivedBytes: t.received}
+		if total > 0 {
+			item.Share = float64(t.bytes) / float64(total)
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Bytes != items[j].Bytes {
+			return items[i].Bytes > items[j].Bytes
+		}
+		return items[i].Key < items[j].Key
+	})
+	truncated := len(items) > q.Limit
+	if truncated {
+		items = items[:q.Limit]
+	}
+	return FlowTopResponse{
+		LastUpdated:   nowMs,
+		WindowMinutes: q.WindowMinutes,
+		TotalBytes:    total,
+		Count:         len(items),
+		Items:         items,
+		Truncated:     truncated,
+		Limit:         q.Limit,
+		Stub:          true,
+	}
+}
+
+// exporterMatches resolves each exporter once per query.
+func (c *FlowCollector) exporterMatches(exporter, deviceID, siteID string, cache map[string]bool, resolve func(string) (string, string)) bool {
+	if deviceID == "" && siteID == "" {
+		return true
+	}
+	if ok, seen := cache[exporter]; seen {
+		return ok
+	}
+	resolvedDevice, resolvedSite := resolve(exporter)
+	ok := (deviceID == "" || resolvedDevice == deviceID) && (siteID == "" || resolvedSite == siteID)
+	cache[exporter] = ok
+	return ok
+}
+
+// Exporters lists exporters seen since start, newest first.
+func (c *FlowCollector) Exporters() []FlowExporterStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]FlowExporterStats, 0, len(c.exporters))
+	for _, stats := range c.exporters {
+		item := *stats
+		item.Versions = append([]int(nil), stats.Versions...)
+		out = append(out, item)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].LastSeen != out[j].LastSeen {
+			return out[i].LastSeen > out[j].LastSeen
+		}
+		return out[i].Address < out[j].Address
+	})
+	return out
+}
+
+// ResolveDeviceRef maps a device ID, name, hostname or address to a known
+// device and its site; unknown values come back unchanged.
+func (s *Store) ResolveDeviceRef(value string) (string, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.resolveAlertDeviceLocked(value)
+}
+
+// ApplyFlowRates writes flushed flow and counter rates onto the interface
+// facts of known devices. Name, role, source and online state stay with
+// the sources that own the device. Exporters that match no device are
+// dropped: flow senders are not authenticated and must not create
+// devices.
+func (s *Store) ApplyFlowRates(rates []FlowInterfaceRates) (int, int) {
+	applied, dropped := 0, 0
+	s.mu.Lock()
+	for _, r := range rates {
+		deviceID, _, ok := s.resolveKnownDeviceLocked(r.Exporter)
+		identityID := s.identityIndex["device:"+normalizeKeyToken(deviceID)]
+		for _, device := range s.Devices {
+			if device.ID == deviceID && device.Lifecycle == deviceLifecycleDecommissioned {
+				ok = false
+			}
+		}
+		if !ok || identityID == "" {
+			dropped++
+			continue
+		}
+		s.mergeInterfaceFactsLocked(identityID, r.Source, r.Interfaces)
+		applied++
+	}
+	s.mu.Unlock()
+	if applied > 0 {
+		s.save()
+	}
+	return applied, dropped
+}
+
+// runFlowListener reads datagrams until ctx is cancelled and hands each
+// one to handle with the sender's address.
+func runFlowListener(ctx context.Context, addr, kind string, logger *slog.Logger, handle func(exporter string, data []byte, nowMs int64) error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		logger.Warn("flow_listener_failed", "kind", kind, "addr", addr, "error", err.Error())
+		return
+	}
+	logger.Info("flow_listener_started", "kind", kind, "addr", conn.LocalAddr().String())
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, maxFlowPacketBytes)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		exporter := from.String()
+		if udp, ok := from.(*net.UDPAddr); ok {
+			exporter = udp.AddrPort().Addr().Unmap().String()
+		}
+		packet := append([]byte(nil), buf[:n]...)
+		_ = handle(exporter, packet, time.Now().UnixMilli())
+	}
+}
+
+// runFlowRateFlush writes closed buckets and counter facts to the store.
+func runFlowRateFlush(ctx context.Context, collector *FlowCollector, store *Store, logger *slog.Logger) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rates := collector.FlushRates(time.Now().UnixMilli())
+			if len(rates) == 0 {
+				continue
+			}
+			applied, dropped := store.ApplyFlowRates(rates)
+			logger.Info("flow_rates_applied", "samples", len(rates), "applied", applied, "dropped", dropped)
+		}
+	}
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFlowCollectorFlushesInterfaceRatesAndRanksTalkers(t *testing.T) {
+	store := LoadStore("")
+	online := true
+	store.IngestTelemetry(TelemetryIngestRequest{Source: "uisp", DeviceID: "dev-core-1", Device: "core-1", SiteID: "tower-3", Online: &online})
+	store.mu.Lock()
+	for i := range store.DeviceIdentities {
+		if store.DeviceIdentities[i].PrimaryDeviceID == "dev-core-1" {
+			store.DeviceIdentities[i].PrimaryIP = "10.0.0.1"
+		}
+	}
+	store.mu.Unlock()
+
+	collector := NewFlowCollector(time.Hour, map[string]map[uint32]string{"10.0.0.1": {1: "sfp-wan"}})
+	base := int64(1_767_225_600_000)
+	packet := netflowV5Packet(0,
+		netflowV5Record([4]byte{192, 168, 1, 10}, [4]byte{1, 1, 1, 1}, 2, 1, 100, 600_000, 51000, 443, 6),
+		netflowV5Record([4]byte{192, 168, 1, 11}, [4]byte{9, 9, 9, 9}, 2, 1, 10, 150_000, 40000, 53, 17),
+		netflowV5Record([4]byte{1, 1, 1, 1}, [4]byte{192, 168, 1, 10}, 1, 2, 50, 300_000, 443, 51000, 6),
+	)
+	if err := collector.HandleNetFlow("10.0.0.1", packet, base+5_000); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+
+	if rates := collector.FlushRates(base + 30_000); len(rates) != 0 {
+		t.Fatalf("expected open bucket to wait, got=%#v", rates)
+	}
+	rates := collector.FlushRates(base + flowBucketMs)
+	if len(rates) != 1 || rates[0].Exporter != "10.0.0.1" || rates[0].Source != netflowSource || rates[0].ObservedAtMs != base+flowBucketMs {
+		t.Fatalf("expected one sample for the exporter, got=%#v", rates)
+	}
+	facts := rates[0].Interfaces
+	if len(facts) != 2 || facts[0].Name != "if2" || facts[1].Name != "sfp-wan" {
+		t.Fatalf("expected configured and fallback interface names, got=%#v", facts)
+	}
+	// sfp-wan: 300 kB in, 750 kB out over 60 s.
+	if *facts[1].RxBps != 40_000 || *facts[1].TxBps != 100_000 {
+		t.Fatalf("unexpected wan rates: rx=%v tx=%v", *facts[1].RxBps, *facts[1].TxBps)
+	}
+	if again := collector.FlushRates(base + 2*flowBucketMs); len(again) != 0 {
+		t.Fatalf("expected bucket to flush once, got=%#v", again)
+	}
+	if applied, dropped := store.ApplyFlowRates(rates); applied != 1 || dropped != 0 {
+		t.Fatalf("expected flow rates on the resolved device, applied=%d dropped=%d", applied, dropped)
+	}
+	if ifaces, _, _ := store.ListDeviceInterfaces(10, ""); len(ifaces) != 2 {
+		t.Fatalf("expected flow interface facts, got=%#v", ifaces)
+	}
+	// A later sample naming one interface updates it and keeps the other.
+	rx := float64(1)
+	if applied, _ := store.ApplyFlowRates([]FlowInterfaceRates{{Source: netflowSource, Exporter: "10.0.0.1", Interfaces: []TelemetryInterfaceFact{{Name: "if2", RxBps: &rx}}}}); applied != 1 {
+		t.Fatalf("expected second sample to apply")
+	}
+	ifaces, _, _ := store.ListDeviceInterfaces(10, "")
+	if len(ifaces) != 2 {
+		t.Fatalf("expected merged interface facts, got=%#v", ifaces)
+	}
+	for _, iface := range ifaces {
+		if iface.Name == "if2" && (*iface.RxBps != 1 || iface.TxBps == nil) {
+			t.Fatalf("expected rx update with tx kept, got=%#v", iface)
+		}
+	}
+	for _, device := range store.ListDevices() {
+		if device.ID == "dev-core-1" && (device.Name != "core-1" || device.Source != "uisp" || !device.Online) {
+			t.Fatalf("expected flow rates to leave the device row alone, got=%#v", device)
+		}
+	}
+
+	talkers := collector.TopTalkers(FlowTopQuery{SiteID: "tower-3", Limit: 2}, base+2*flowBucketMs, store.ResolveDeviceRef)
+	if talkers.Count != 2 || !talkers.Truncated || talkers.TotalBytes != 1_050_000 {
+		t.Fatalf("unexpected talkers: %#v", talkers)
+	}
+	top := talkers.Items[0]
+	if top.Key != "1.1.1.1" && top.Key != "192.168.1.10" || top.Bytes != 900_000 || top.Bps != 8_000 {
+		t.Fatalf("unexpected top talker: %#v", top)
+	}
+	apps := collector.TopApplications(FlowTopQuery{Interface: "sfp-wan"}, base+2*flowBucketMs, store.ResolveDeviceRef)
+	if len(apps.Items) != 2 || apps.Items[0].Key != "tcp/443 https" || apps.Items[1].Key != "udp/53 dns" {
+		t.Fatalf("unexpected applications: %#v", apps.Items)
+	}
+	if other := collector.TopTalkers(FlowTopQuery{DeviceID: "dev-other"}, base+2*flowBucketMs, store.ResolveDeviceRef); other.Count != 0 {
+		t.Fatalf("expected device filter to exclude exporter, got=%#v", other)
+	}
+
+	// Buckets past retention are dropped.
+	collector.FlushRates(base + 2*time.Hour.Milliseconds())
+	if gone := collector.TopTalkers(FlowTopQuery{WindowMinutes: 60}, base+2*time.Hour.Milliseconds(), store.ResolveDeviceRef); gone.Count != 0 {
+		t.Fatalf("expected retention to expire buckets, got=%#v", gone)
+	}
+	if exporters := collector.Exporters(); len(exporters) != 1 || exporters[0].Records != 3 || exporters[0].Versions[0] != 5 {
+		t.Fatalf("unexpected exporter stats: %#v", exporters)
+	}
+}
+
+func TestFlowApplicationNames(t *testing.T) {
+	for _, tc := range []struct {
+		rec  FlowRecord
+		want string
+	}{
+		{FlowRecord{Protocol: 6, SrcPort: 51000, DstPort: 22}, "tcp/22 ssh"},
+		{FlowRecord{Protocol: 17, SrcPort: 123, DstPort: 40000}, "udp/123 ntp"},
+		{FlowRecord{Protocol: 6, SrcPort: 50000, DstPort: 60000}, "tcp/ephemeral"},
+		{FlowRecord{Protocol: 6, SrcPort: 50000, DstPort: 999}, "tcp/999"},
+		{FlowRecord{Protocol: 1}, "icmp"},
+		{FlowRecord{Protocol: 132}, "ip/132"},
+	} {
+		if got := flowApplication(tc.rec); got != tc.want {
+			t.Fatalf("flowApplication(%#v) = %q, want %q", tc.rec, got, tc.want)
+		}
+	}
+}
+
+func TestFlowRatesFromUnknownExportersAreDropped(t *testing.T) {
+	store := LoadStore("")
+	collector := NewFlowCollector(time.Hour, nil)
+	base := int64(1_767_225_600_000)
+	packet := netflowV5Packet(0, netflowV5Record([4]byte{192, 168, 1, 10}, [4]byte{1, 1, 1, 1}, 2, 1, 1, 1_000, 51000, 443, 6))
+	if err := collector.HandleNetFlow("203.0.113.9", packet, base+1_000); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	rates := collector.FlushRates(base + flowBucketMs)
+	if applied, dropped := store.ApplyFlowRates(rates); applied != 0 || dropped != 1 {
+		t.Fatalf("expected unknown exporter to be dropped, applied=%d dropped=%d", applied, dropped)
+	}
+	for _, device := range store.ListDevices() {
+		if device.ID == "203.0.113.9" {
+			t.Fatalf("expected no device for the exporter, got=%#v", device)
+		}
+	}
+}
+
+func TestFlowCollectorCapsExporters(t *testing.T) {
+	collector := NewFlowCollector(time.Hour, nil)
+	base := int64(1_767_225_600_000)
+	for i := 0; i <= maxFlowExporters; i++ {
+		exporter := fmt.Sprintf("10.%d.%d.1", i/256, i%256)
+		packet := netflowV5Packet(0, netflowV5Record([4]byte{192, 168, 1, 10}, [4]byte{1, 1, 1, 1}, 2, 1, 1, 1_000, 51000, 443, 6))
+		if err := collector.HandleNetFlow(exporter, packet, base+int64(i)); err != nil {
+			t.Fatalf("handle: %v", err)
+		}
+	}
+	exporters := collector.Exporters()
+	if len(exporters) != maxFlowExporters {
+		t.Fatalf("expected exporters capped at %d, got=%d", maxFlowExporters, len(exporters))
+	}
+	for _, e := range exporters {
+		if e.Address == "10.0.0.1" {
+			t.Fatalf("expected the stalest exporter to be evicted")
+		}
+	}
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxHTTPJSONDryRunSamples = 25
+
+var (
+	ErrHTTPJSONMapping  = errors.New("invalid_field_mapping")
+	ErrHTTPJSONPath     = errors.New("invalid_json_path")
+	ErrHTTPJSONNoSource = errors.New("connector_not_configured")
+)
+
+// HTTPJSONMapping declares where device fields live in an arbitrary JSON
+// response. Paths use a small JSONPath subset: $.a.b, a['b c'], a[0], a[*].
+type HTTPJSONMapping struct {
+	ItemsPath    string          `json:"items_path"`
+	ID           string          `json:"id"`
+	Name         string          `json:"name,omitempty"`
+	Role         string          `json:"role,omitempty"`
+	Site         string          `json:"site,omitempty"`
+	Online       string          `json:"online,omitempty"`
+	OnlineValues map[string]bool `json:"online_values,omitempty"`
+	Latency      string          `json:"latency,omitempty"`
+	LatencyScale float64         `json:"latency_scale,omitempty"`
+	Serial       string          `json:"serial,omitempty"`
+	Mac          string          `json:"mac,omitempty"`
+	Hostname     string          `json:"hostname,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	Vendor       string          `json:"vendor,omitempty"`
+	ObservedAt   string          `json:"observed_at,omitempty"`
+	// Metrics maps health targets (cpu_pct, mem_pct, temp_c, uptime_s or
+	// gauge.<name>) to JSON paths.
+	Metrics    map[string]string         `json:"metrics,omitempty"`
+	Interfaces *HTTPJSONInterfaceMapping `json:"interfaces,omitempty"`
+	Neighbors  *HTTPJSONNeighborMapping  `json:"neighbors,omitempty"`
+}
+
+type HTTPJSONInterfaceMapping struct {
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+	AdminUp   string `json:"admin_up,omitempty"`
+	OperUp    string `json:"oper_up,omitempty"`
+	RxBps     string `json:"rx_bps,omitempty"`
+	TxBps     string `json:"tx_bps,omitempty"`
+	ErrorRate string `json:"error_rate,omitempty"`
+}
+
+type HTTPJSONNeighborMapping struct {
+	Path              string `json:"path"`
+	LocalInterface    string `json:"local_interface,omitempty"`
+	NeighborName      string `json:"neighbor_name,omitempty"`
+	NeighborInterface string `json:"neighbor_interface,omitempty"`
+	NeighborHint      string `json:"neighbor_hint,omitempty"`
+	Protocol          string `json:"protocol,omitempty"`
+}
+
+type HTTPJSONDryRunRequest struct {
+	Mapping *HTTPJSONMapping `json:"mapping,omitempty"`
+	Sample  json.RawMessage  `json:"sample,omitempty"`
+	Limit   int              `json:"limit,omitempty"`
+}
+
+type HTTPJSONDryRunItem struct {
+	Index    int                     `json:"index"`
+	Mapped   *TelemetryIngestRequest `json:"mapped,omitempty"`
+	Emit     bool                    `json:"emit"` // false when the next poll would send nothing for this record
+	Warnings []string                `json:"warnings,omitempty"`
+}
+
+type HTTPJSONDryRunResponse struct {
+	Source     string               `json:"source"`
+	URL        string               `json:"url,omitempty"`
+	Mapping    HTTPJSONMapping      `json:"mapping"`
+	ItemsFound int                  `json:"items_found"`
+	Mapped     int                  `json:"mapped"`
+	Skipped    int                  `json:"skipped"`
+	Items      []HTTPJSONDryRunItem `json:"items"`
+	Error      string               `json:"error,omitempty"`
+	Stub       bool                 `json:"stub"`
+}
+
+type jsonPathStep struct {
+	key      string
+	index    int
+	wildcard bool
+	isIndex  bool
+}
+
+// NewHTTPJSONConnector builds a VendorConnector whose records are parsed
+// with a declarative mapping instead of the built-in field guesses.
+func NewHTTPJSONConnector(source, vendorLabel, baseURL, token, devicesPath, authScheme string, mapping HTTPJSONMapping) (*VendorConnector, error) {
+	mapping, err := normalizeHTTPJSONMapping(mapping)
+	if err != nil {
+		return nil, err
+	}
+	connector := NewVendorConnector(source, vendorLabel, baseURL, token, devicesPath, authScheme)
+	connector.mapping = &mapping
+	return connector, nil
+}
+
+// loadHTTPJSONMapping reads the mapping from an inline JSON value or a file path.
+func loadHTTPJSONMapping(inline, filePath string) (HTTPJSONMapping, error) {
+	raw, err := readMappingSource(inline, filePath)
+	if err != nil {
+		return HTTPJSONMapping{}, err
+	}
+	if len(raw) == 0 {
+		return HTTPJSONMapping{}, ErrHTTPJSONNoSource
+	}
+	var mapping HTTPJSONMapping
+	if err := json.Unmarshal(raw, &mapping); err != nil {
+		return HTTPJSONMapping{}, fmt.Errorf("%w: %v", ErrHTTPJSONMapping, err)
+	}
+	return normalizeHTTPJSONMapping(mapping)
+}
+
+func normalizeHTTPJSONMapping(mapping HTTPJSONMapping) (HTTPJSONMapping, error) {
+	mapping.ItemsPath = strings.TrimSpace(mapping.ItemsPath)
+	if mapping.ItemsPath == "" {
+		mapping.ItemsPath = "$"
+	}
+	mapping.ID = strings.TrimSpace(mapping.ID)
+	if mapping.ID == "" {
+		return HTTPJSONMapping{}, ErrHTTPJSONMapping
+	}
+	if mapping.LatencyScale <= 0 {
+		mapping.LatencyScale = 1
+	}
+	if len(mapping.OnlineValues) > 0 {
+		values := make(map[string]bool, len(mapping.OnlineValues))
+		for raw, online := range mapping.OnlineValues {
+			values[strings.ToLower(strings.TrimSpace(raw))] = online
+		}
+		mapping.OnlineValues = values
+	}
+
+	paths := []string{
+		mapping.ItemsPath, mapping.ID, mapping.Name, mapping.Role, mapping.Site, mapping.Online,
+		mapping.Latency, mapping.Serial, mapping.Mac, mapping.Hostname, mapping.Model, mapping.Vendor, mapping.ObservedAt,
+	}
+	for target, path := range mapping.Metrics {
+		if !isHealthMetricTarget(target) || strings.TrimSpace(path) == "" {
+			return HTTPJSONMapping{}, fmt.Errorf("%w: metric %s", ErrHTTPJSONMapping, target)
+		}
+		paths = append(paths, path)
+	}
+	if mapping.Interfaces != nil {
+		if strings.TrimSpace(mapping.Interfaces.Path) == "" || strings.TrimSpace(mapping.Interfaces.Name) == "" {
+			return HTTPJSONMapping{}, ErrHTTPJSONMapping
+		}
+		paths = append(paths, mapping.Interfaces.Path, mapping.Interfaces.Name, mapping.Interfaces.AdminUp,
+			mapping.Interfaces.OperUp, mapping.Interfaces.RxBps, mapping.Interfaces.TxBps, mapping.Interfaces.ErrorRate)
+	}
+	if mapping.Neighbors != nil {
+		if strings.TrimSpace(mapping.Neighbors.Path) == "" {
+			return HTTPJSONMapping{}, ErrHTTPJSONMapping
+		}
+		paths = append(paths, mapping.Neighbors.Path, mapping.Neighbors.LocalInterface, mapping.Neighbors.NeighborName,
+			mapping.Neighbors.NeighborInterface, mapping.Neighbors.NeighborHint, mapping.Neighbors.Protocol)
+	}
+	for _, path := range paths {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		if _, err := parseJSONPath(path); err != nil {
+			return HTTPJSONMapping{}, fmt.Errorf("%w: %s", ErrHTTPJSONPath, path)
+		}
+	}
+	return mapping, nil
+}
+
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	steps := make([]jsonPathStep, 0, 4)
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			i++
+			start := i
+			for i < len(path) && path[i] != '.' && path[i] != '[' {
+				i++
+			}
+			key := path[start:i]
+			if key == "" {
+				return nil, ErrHTTPJSONPath
+			}
+			if key == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else {
+				steps = append(steps, jsonPathStep{key: key})
+			}
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, ErrHTTPJSONPath
+			}
+			inner := strings.TrimSpace(path[i+1 : i+end])
+			i += end + 1
+			switch {
+			case inner == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, ErrHTTPJSONPath
+				}
+				steps = append(steps, jsonPathStep{index: idx, isIndex: true})
+			}
+		default:
+			// Bare leading key, e.g. "status.online".
+			start := i
+			for i < len(path) && path[i] != '.' && path[i] != '[' {
+				i++
+			}
+			steps = append(steps, jsonPathStep{key: path[start:i]})
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath returns every value the path selects; wildcards fan out.
+func evalJSONPath(root any, path string) []any {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil
+	}
+	current := []any{root}
+	for _, step := range steps {
+		next := make([]any, 0, len(current))
+		for _, node := range current {
+			switch {
+			case step.wildcard:
+				switch t := node.(type) {
+				case []any:
+					next = append(next, t...)
+				case map[string]any:
+					for _, v := range t {
+						next = append(next, v)
+					}
+				}
+			case step.isIndex:
+				if arr, ok := node.([]any); ok && step.index < len(arr) {
+					next = append(next, arr[step.index])
+				}
+			default:
+				if m, ok := node.(map[string]any); ok {
+					if v, ok := m[step.key]; ok {
+						next = append(next, v)
+					}
+				}
+			}
+		}
+		current = next
+		if len(current) == 0 {
+			return nil
+		}
+	}
+	return current
+}
+
+func firstJSONPathValue(root any, path string) (any, bool) {
+	if strings.TrimSpace(path) == "" {
+		return nil, false
+	}
+	values := evalJSONPath(root, path)
+	for _, v := range values {
+		if v != nil {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func jsonPathString(root any, path string) string {
+	v, ok := firstJSONPathValue(root, path)
+	if !ok {
+		return ""
+	}
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	return ""
+}
+
+func jsonPathFloat(root any, path string) *float64 {
+	v, ok := firstJSONPathValue(root, path)
+	if !ok {
+		return nil
+	}
+	return pickFloat(map[string]any{"v": v}, []string{"v"})
+}
+
+func jsonPathBool(root any, path string) *bool {
+	v, ok := firstJSONPathValue(root, path)
+	if !ok {
+		return nil
+	}
+	return pickBool(map[string]any{"v": v}, []string{"v"})
+}
+
+func extractMappedItems(payload any, mapping HTTPJSONMapping) []map[string]any {
+	values := evalJSONPath(payload, mapping.ItemsPath)
+	// "$.devices" selects the array itself; flatten one level so both
+	// "$.devices" and "$.devices[*]" work.
+	if len(values) == 1 {
+		if arr, ok := values[0].([]any); ok {
+			values = arr
+		}
+	}
+	items := make([]map[string]any, 0, len(values))
+	for _, v := range values {
+		if m, ok := v.(map[string]any); ok {
+			items = append(items, m)
+		}
+	}
+	return items
+}
+
+// mapHTTPJSONItem converts one item into a record and lists fields that
+// were mapped but missing, so dry-runs can explain what went wrong.
+func mapHTTPJSONItem(item map[string]any, mapping HTTPJSONMapping, source, vendorLabel string) (uiSPDeviceRecord, []string) {
+	warnings := make([]string, 0)
+	id := jsonPathString(item, mapping.ID)
+	if id == "" {
+		return uiSPDeviceRecord{}, []string{"missing id at " + mapping.ID}
+	}
+	rec := uiSPDeviceRecord{
+		ID:     id,
+		Name:   jsonPathString(item, mapping.Name),
+		Role:   jsonPathString(item, mapping.Role),
+		SiteID: jsonPathString(item, mapping.Site),
+		Host:   jsonPathString(item, mapping.Hostname),
+		Mac:    jsonPathString(item, mapping.Mac),
+		Serial: jsonPathString(item, mapping.Serial),
+		Model:  jsonPathString(item, mapping.Model),
+		Vendor: jsonPathString(item, mapping.Vendor),
+		Online: true,
+	}
+	check := func(field, path, value string) {
+		if path != "" && value == "" {
+			warnings = append(warnings, "missing "+field+" at "+path)
+		}
+	}
+	check("name", mapping.Name, rec.Name)
+	check("role", mapping.Role, rec.Role)
+	check("site", mapping.Site, rec.SiteID)
+	check("serial", mapping.Serial, rec.Serial)
+	check("mac", mapping.Mac, rec.Mac)
+
+	if rec.Name == "" {
+		rec.Name = id
+	}
+	rec.Role = normalizeVendorRole(firstNonEmpty(rec.Role, "device"))
+	if rec.SiteID == "" {
+		rec.SiteID = source
+	}
+	if rec.Vendor == "" {
+		rec.Vendor = vendorLabel
+	}
+
+	if mapping.Online != "" {
+		raw, ok := firstJSONPathValue(item, mapping.Online)
+		switch {
+		case !ok:
+			warnings = append(warnings, "missing online at "+mapping.Online)
+		default:
+			key := strings.ToLower(strings.TrimSpace(fmt.Sprint(raw)))
+			if online, mapped := mapping.OnlineValues[key]; mapped {
+				rec.Online = online
+			} else if b := pickBool(map[string]any{"v": raw}, []string{"v"}); b != nil {
+				rec.Online = *b
+			} else {
+				rec.Online = parseConnectorOnlineState(key)
+				if len(mapping.OnlineValues) > 0 {
+					warnings = append(warnings, "unmapped online value "+strconv.Quote(key))
+				}
+			}
+		}
+	}
+
+	if mapping.Latency != "" {
+		if latency := jsonPathFloat(item, mapping.Latency); latency != nil {
+			scaled := roundMetric(*latency * mapping.LatencyScale)
+			rec.Latency = &scaled
+		} else {
+			warnings = append(warnings, "missing latency at "+mapping.Latency)
+		}
+	}
+	if len(mapping.Metrics) > 0 {
+		targets := make([]string, 0, len(mapping.Metrics))
+		for target := range mapping.Metrics {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+		var health TelemetryIngestRequest
+		for _, target := range targets {
+			if v := jsonPathFloat(item, mapping.Metrics[target]); v != nil {
+				setHealthMetric(&health, target, *v, "")
+			} else {
+				warnings = append(warnings, "missing "+target+" at "+mapping.Metrics[target])
+			}
+		}
+		rec.Metrics = normalizeTelemetryMetrics(health.Metrics)
+	}
+	if mapping.ObservedAt != "" {
+		if v, ok := firstJSONPathValue(item, mapping.ObservedAt); ok {
+			rec.ObservedAtMs = pickTimestampMs(map[string]any{"v": v}, []string{"v"})
+		}
+	}
+
+	if m := mapping.Interfaces; m != nil {
+		for _, node := range flattenJSONPathItems(evalJSONPath(item, m.Path)) {
+			name := jsonPathString(node, m.Name)
+			if name == "" {
+				continue
+			}
+			fact := TelemetryInterfaceFact{Name: name}
+			if m.AdminUp != "" {
+				fact.AdminUp = jsonPathBool(node, m.AdminUp)
+			}
+			if m.OperUp != "" {
+				fact.OperUp = jsonPathBool(node, m.OperUp)
+			}
+			if m.RxBps != "" {
+				fact.RxBps = jsonPathFloat(node, m.RxBps)
+			}
+			if m.TxBps != "" {
+				fact.TxBps = jsonPathFloat(node, m.TxBps)
+			}
+			if m.ErrorRate != "" {
+				fact.ErrorRate = jsonPathFloat(node, m.ErrorRate)
+			}
+			rec.Ifaces = append(rec.Ifaces, fact)
+			if len(rec.Ifaces) >= 256 {
+				break
+			}
+		}
+	}
+	if m := mapping.Neighbors; m != nil {
+		for _, node := range flattenJSONPathItems(evalJSONPath(item, m.Path)) {
+			fact := TelemetryNeighborFact{
+				LocalInterface:       jsonPathString(node, m.LocalInterface),
+				NeighborDeviceName:   jsonPathString(node, m.NeighborName),
+				NeighborInterface:    jsonPathString(node, m.NeighborInterface),
+				NeighborIdentityHint: jsonPathString(node, m.NeighborHint),
+				Protocol:             jsonPathString(node, m.Protocol),
+			}
+			if fact.LocalInterface == "" && fact.NeighborDeviceName == "" && fact.NeighborInterface == "" && fact.NeighborIdentityHint == "" {
+				continue
+			}
+			rec.Neighs = append(rec.Neighs, fact)
+			if len(rec.Neighs) >= 256 {
+				break
+			}
+		}
+	}
+	return rec, warnings
+}
+
+func flattenJSONPathItems(values []any) []map[string]any {
+	if len(values) == 1 {
+		if arr, ok := values[0].([]any); ok {
+			values = arr
+		}
+	}
+	out := make([]map[string]any, 0, len(values))
+	for _, v := range values {
+		if m, ok := v.(map[string]any); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func parseMappedDevices(body []byte, mapping HTTPJSONMapping, source, vendorLabel string) ([]uiSPDeviceRecord, error) {
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	items := extractMappedItems(payload, mapping)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%s response had no items at %s", source, mapping.ItemsPath)
+	}
+	records := make([]uiSPDeviceRecord, 0, len(items))
+	for _, item := range items {
+		rec, _ := mapHTTPJSONItem(item, mapping, source, vendorLabel)
+		if rec.ID == "" {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s response had no valid records", source)
+	}
+	return records, nil
+}
+
+func (v *VendorConnector) Mapping() (HTTPJSONMapping, bool) {
+	if v.mapping == nil {
+		return HTTPJSONMapping{}, false
+	}
+	return *v.mapping, true
+}
+
+// DryRun fetches one sample (or uses the supplied body) and shows the
+// telemetry requests the mapping would produce, without ingesting anything.
+// Each request is classified against the poller's current state, so the
+// event type matches what the next incremental poll would emit.
+func (v *VendorConnector) DryRun(ctx context.Context, req HTTPJSONDryRunRequest) (HTTPJSONDryRunResponse, error) {
+	resp := HTTPJSONDryRunResponse{Source: v.source, Stub: true}
+	var mapping HTTPJSONMapping
+	switch {
+	case req.Mapping != nil:
+		normalized, err := normalizeHTTPJSONMapping(*req.Mapping)
+		if err != nil {
+			return resp, err
+		}
+		mapping = normalized
+	case v.mapping != nil:
+		mapping = *v.mapping
+	default:
+		return resp, ErrHTTPJSONMapping
+	}
+	resp.Mapping = mapping
+	limit := req.Limit
+	if limit <= 0 || limit > maxHTTPJSONDryRunSamples {
+		limit = 5
+	}
+
+	body := []byte(req.Sample)
+	if len(body) == 0 {
+		if v.baseURL == "" {
+			return resp, ErrHTTPJSONNoSource
+		}
+		resp.URL = v.baseURL + v.devicesPath
+		fetched, err := v.fetchRawBody(ctx)
+		if err != nil {
+			resp.Error = err.Error()
+			return resp, err
+		}
+		body = fetched
+	}
+
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		resp.Error = err.Error()
+		return resp, err
+	}
+	items := extractMappedItems(payload, mapping)
+	resp.ItemsFound = len(items)
+	resp.Items = make([]HTTPJSONDryRunItem, 0, min(limit, len(items)))
+	for i, item := range items {
+		rec, warnings := mapHTTPJSONItem(item, mapping, v.source, v.vendorLabel)
+		if rec.ID == "" {
+			resp.Skipped++
+		} else {
+			resp.Mapped++
+		}
+		if len(resp.Items) >= limit {
+			continue
+		}
+		out := HTTPJSONDryRunItem{Index: i, Warnings: warnings}
+		if rec.ID != "" {
+			eventType, changed := v.previewRecord(rec)
+			mapped := v.recordEvent(rec, eventType, changed)
+			out.Mapped = &mapped
+			out.Emit = eventType != ""
+		}
+		resp.Items = append(resp.Items, out)
+	}
+	if resp.ItemsFound == 0 {
+		resp.Error = "no items at " + mapping.ItemsPath
+	}
+	return resp, nil
+}
+
+func (v *VendorConnector) fetchRawBody(ctx context.Context) ([]byte, error) {
+	body, _, err := fetchPageBody(ctx, v.client, v.baseURL+v.devicesPath, 0, v.source, v.authProvider(), v.guard, nil)
+	return body, err
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const httpJSONTestPayload = `{
+	"result": {
+		"boxes": [
+			{
+				"uid": "box-1",
+				"meta": {"label": "Tower Box 1", "kind": "edge-router", "pop": "pop-north"},
+				"health": {"state": "GREEN", "rtt_s": 0.012, "cpu": 37, "temp": 51.5},
+				"hw": {"serial": "SN-001", "mac": "00:11:22:33:44:55"},
+				"ports": [
+					{"ifname": "eth0", "link": "up", "counters": {"rx": 1200, "tx": 800}},
+					{"ifname": "eth1", "link": "down"}
+				],
+				"lldp": [{"port": "eth0", "peer": "core-sw-1", "peer_port": "ge-0/0/1"}]
+			},
+			{
+				"uid": "box-2",
+				"meta": {"label": "Tower Box 2", "kind": "wireless-ap", "pop": "pop-north"},
+				"health": {"state": "RED"}
+			},
+			{
+				"meta": {"label": "no id"}
+			}
+		]
+	}
+}`
+
+func httpJSONTestMapping() HTTPJSONMapping {
+	return HTTPJSONMapping{
+		ItemsPath:    "$.result.boxes[*]",
+		ID:           "$.uid",
+		Name:         "$.meta.label",
+		Role:         "$.meta.kind",
+		Site:         "$.meta.pop",
+		Online:       "$.health.state",
+		OnlineValues: map[string]bool{"GREEN": true, "AMBER": true, "RED": false},
+		Latency:      "$.health.rtt_s",
+		LatencyScale: 1000,
+		Serial:       "$.hw.serial",
+		Mac:          "$.hw['mac']",
+		Metrics:      map[string]string{"cpu_pct": "$.health.cpu", "temp_c": "$.health.temp"},
+		Interfaces: &HTTPJSONInterfaceMapping{
+			Path:   "$.ports",
+			Name:   "$.ifname",
+			OperUp: "$.link",
+			RxBps:  "$.counters.rx",
+			TxBps:  "$.counters.tx",
+		},
+		Neighbors: &HTTPJSONNeighborMapping{
+			Path:              "$.lldp[*]",
+			LocalInterface:    "$.port",
+			NeighborName:      "$.peer",
+			NeighborInterface: "$.peer_port",
+		},
+	}
+}
+
+func TestHTTPJSONConnectorPollAppliesMapping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(httpJSONTestPayload))
+	}))
+	defer server.Close()
+
+	connector, err := NewHTTPJSONConnector("custombox", "CustomBox", server.URL, "", "/api/boxes", "none", httpJSONTestMapping())
+	if err != nil {
+		t.Fatalf("expected valid mapping, got=%v", err)
+	}
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("expected no error, got=%v", err)
+	}
+	if batch.Response.Demo {
+		t.Fatalf("expected live poll with auth scheme none")
+	}
+	if batch.Response.Fetched != 2 || batch.Response.Normalized != 2 {
+		t.Fatalf("unexpected fetched/normalized=%d/%d", batch.Response.Fetched, batch.Response.Normalized)
+	}
+	if len(batch.Events) != 1 || batch.Events[0].DeviceID != "box-2" || batch.Events[0].EventType != "device_down" {
+		t.Fatalf("expected device_down for box-2 via online value map, got=%#v", batch.Events)
+	}
+	if batch.Events[0].Role != "ap" || batch.Events[0].SiteID != "pop-north" {
+		t.Fatalf("unexpected mapped role/site: %#v", batch.Events[0])
+	}
+}
+
+func TestHTTPJSONDryRunShowsMappedRequests(t *testing.T) {
+	connector := NewVendorConnector("custombox", "CustomBox", "", "", "/api/boxes", "none")
+	mapping := httpJSONTestMapping()
+	resp, err := connector.DryRun(context.Background(), HTTPJSONDryRunRequest{
+		Mapping: &mapping,
+		Sample:  json.RawMessage(httpJSONTestPayload),
+	})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if resp.ItemsFound != 3 || resp.Mapped != 2 || resp.Skipped != 1 {
+		t.Fatalf("unexpected dry run counts: %#v", resp)
+	}
+	first := resp.Items[0].Mapped
+	if first == nil || first.DeviceID != "box-1" || first.Device != "Tower Box 1" || first.Role != "gateway" {
+		t.Fatalf("unexpected first mapped request: %#v", first)
+	}
+	if first.LatencyMs == nil || *first.LatencyMs != 12 || first.Serial != "SN-001" || first.Mac != "00:11:22:33:44:55" {
+		t.Fatalf("expected scaled latency and hardware ids, got=%#v", first)
+	}
+	if first.Metrics == nil || *first.Metrics.CPUPct != 37 || *first.Metrics.TempC != 51.5 {
+		t.Fatalf("expected mapped health metrics, got=%#v", first.Metrics)
+	}
+	if len(first.Interfaces) != 2 || first.Interfaces[0].RxBps == nil || *first.Interfaces[0].RxBps != 1200 || first.Interfaces[1].OperUp == nil || *first.Interfaces[1].OperUp {
+		t.Fatalf("unexpected mapped interfaces: %#v", first.Interfaces)
+	}
+	if len(first.Neighbors) != 1 || first.Neighbors[0].NeighborDeviceName != "core-sw-1" {
+		t.Fatalf("unexpected mapped neighbors: %#v", first.Neighbors)
+	}
+	if first.EventType != "" || resp.Items[0].Emit {
+		t.Fatalf("expected unseen online device to emit nothing, got=%q emit=%v", first.EventType, resp.Items[0].Emit)
+	}
+	if second := resp.Items[1].Mapped; second == nil || second.EventType != "device_down" || !resp.Items[1].Emit {
+		t.Fatalf("expected unseen offline device to preview as device_down, got=%#v", resp.Items[1])
+	}
+	if len(resp.Items[1].Warnings) == 0 || resp.Items[2].Mapped != nil {
+		t.Fatalf("expected warnings for partial item and skip for missing id, got=%#v", resp.Items)
+	}
+
+	if _, err := connector.DryRun(context.Background(), HTTPJSONDryRunRequest{Sample: json.RawMessage(httpJSONTestPayload)}); err != ErrHTTPJSONMapping {
+		t.Fatalf("expected mapping error without configured mapping, got=%v", err)
+	}
+}
+
+func TestHTTPJSONMappingValidation(t *testing.T) {
+	if _, err := normalizeHTTPJSONMapping(HTTPJSONMapping{ItemsPath: "$.items"}); err != ErrHTTPJSONMapping {
+		t.Fatalf("expected missing id error, got=%v", err)
+	}
+	if _, err := normalizeHTTPJSONMapping(HTTPJSONMapping{ID: "$.a[oops]"}); !errors.Is(err, ErrHTTPJSONPath) {
+		t.Fatalf("expected bad path error, got=%v", err)
+	}
+	if _, err := normalizeHTTPJSONMapping(HTTPJSONMapping{ID: "$.id", Metrics: map[string]string{"cpu": "$.cpu"}}); !errors.Is(err, ErrHTTPJSONMapping) {
+		t.Fatalf("expected unknown metric target error, got=%v", err)
+	}
+	values := evalJSONPath(map[string]any{"a": []any{map[string]any{"b": "x"}, map[string]any{"b": "y"}}}, "a[*].b")
+	if len(values) != 2 || values[1] != "y" {
+		t.Fatalf("expected wildcard fan-out, got=%#v", values)
+	}
+	if got := jsonPathString(map[string]any{"odd key": 7.0}, "$['odd key']"); got != "7" {
+		t.Fatalf("expected bracket key lookup, got=%q", got)
+	}
+}
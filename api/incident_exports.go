@@ -85,6 +85,9 @@ func BuildIncidentTimelineMarkdown(doc IncidentTimelineExport) string {
 		}
 		lines = append(lines, fmt.Sprintf("1. `%s` `%s` `%s`", at, eventType, actor))
 		lines = append(lines, "   "+text)
+		if link := strings.TrimSpace(entry.URL); link != "" {
+			lines = append(lines, "   <"+link+">")
+		}
 		lines = append(lines, "")
 	}
 
@@ -174,6 +177,9 @@ func buildIncidentExportLines(doc IncidentTimelineExport) []incidentExportLine {
 		header := fmt.Sprintf("%d. %s | %s | %s", idx+1, at, eventType, actor)
 		lines = appendWrappedIncidentExportLines(lines, header, 10, 90)
 		lines = appendWrappedIncidentExportLines(lines, "   "+message, 10, 90)
+		if link := strings.TrimSpace(entry.URL); link != "" {
+			lines = appendWrappedIncidentExportLines(lines, "   "+link, 10, 90)
+		}
 		lines = append(lines, incidentExportLine{Text: "", Size: 10})
 	}
 
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	influxSource        = "influx"
+	maxInfluxLineErrors = 5
+)
+
+var (
+	ErrInfluxMapping   = errors.New("invalid_influx_mapping")
+	ErrInfluxPrecision = errors.New("invalid_precision")
+)
+
+// InfluxMapping says which tags place a line on a device and which
+// measurement fields feed which telemetry field. Field keys are
+// "measurement.field", optionally narrowed by tags as in
+// "net.bytes_recv{interface=eth0}"; targets are the OTLP ones.
+type InfluxMapping struct {
+	DeviceTags    []string          `json:"device_tags"`
+	NameTags      []string          `json:"name_tags"`
+	SiteTags      []string          `json:"site_tags"`
+	RoleTags      []string          `json:"role_tags"`
+	InterfaceTags []string          `json:"interface_tags"`
+	Fields        map[string]string `json:"fields"`
+}
+
+// defaultInfluxMapping covers the Telegraf ping, net, mem, system, temp and
+// snmp (IF-MIB "interface" table) inputs.
+func defaultInfluxMapping() InfluxMapping {
+	return InfluxMapping{
+		DeviceTags:    []string{"device_id", "url", "agent_host", "host"},
+		NameTags:      []string{"sysName"},
+		SiteTags:      []string{"site_id", "site"},
+		RoleTags:      []string{"role"},
+		InterfaceTags: []string{"interface", "ifName", "ifDescr"},
+		Fields: map[string]string{
+			"ping.packets_received":    metricTargetOnline,
+			"ping.average_response_ms": metricTargetLatency,
+			"net.bytes_recv":           metricTargetRxBytes,
+			"net.bytes_sent":           metricTargetTxBytes,
+			"interface.ifHCInOctets":   metricTargetRxBytes,
+			"interface.ifHCOutOctets":  metricTargetTxBytes,
+			"interface.ifOperStatus":   metricTargetOperUp,
+			"interface.ifAdminStatus":  metricTargetAdminUp,
+			"mem.used_percent":         metricTargetMem,
+			"system.uptime":            metricTargetUptime,
+			"temp.temp":                metricTargetTemp,
+		},
+	}
+}
+
+// loadInfluxMapping reads a mapping from an inline JSON value or a file
+// path. Tag lists left empty keep their defaults; field rules replace the
+// defaults.
+func loadInfluxMapping(inline, filePath string) (InfluxMapping, error) {
+	raw, err := readMappingSource(inline, filePath)
+	if err != nil {
+		return InfluxMapping{}, err
+	}
+	mapping := defaultInfluxMapping()
+	if len(raw) == 0 {
+		return mapping, nil
+	}
+	var custom InfluxMapping
+	if err := json.Unmarshal(raw, &custom); err != nil {
+		return InfluxMapping{}, fmt.Errorf("%w: %v", ErrInfluxMapping, err)
+	}
+	if keys := trimLabelKeys(custom.DeviceTags); len(keys) > 0 {
+		mapping.DeviceTags = keys
+	}
+	if keys := trimLabelKeys(custom.NameTags); len(keys) > 0 {
+		mapping.NameTags = keys
+	}
+	if keys := trimLabelKeys(custom.SiteTags); len(keys) > 0 {
+		mapping.SiteTags = keys
+	}
+	if keys := trimLabelKeys(custom.RoleTags); len(keys) > 0 {
+		mapping.RoleTags = keys
+	}
+	if keys := trimLabelKeys(custom.InterfaceTags); len(keys) > 0 {
+		mapping.InterfaceTags = keys
+	}
+	if len(custom.Fields) > 0 {
+		mapping.Fields = custom.Fields
+	}
+	if _, err := compileMetricRules(mapping.Fields); err != nil {
+		return InfluxMapping{}, fmt.Errorf("%w: %v", ErrInfluxMapping, err)
+	}
+	return mapping, nil
+}
+
+type influxLine struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+	TimeMs      int64
+}
+
+type InfluxWriteResult struct {
+	Source         string           `json:"source"`
+	Lines          int              `json:"lines"`
+	InvalidLines   int              `json:"invalid_lines"`
+	Fields         int              `json:"fields"`
+	MappedFields   int              `json:"mapped_fields"`
+	UnmappedFields int              `json:"unmapped_fields"`
+	RejectedFields int              `json:"rejected_fields"`
+	Unmapped       map[string]int64 `json:"unmapped,omitempty"`
+	Devices        int              `json:"devices"`
+	Events         int              `json:"events"`
+	Ingested       int              `json:"ingested"`
+	Dropped        int              `json:"dropped"`
+	Incidents      int              `json:"incidents"`
+}
+
+// influxPrecisionMs returns the factor from a write timestamp to
+// milliseconds. v1 spells precisions n, u, ms, s, m, h; v2 ns, us, ms, s.
+func influxPrecisionMs(precision string) (float64, error) {
+	switch strings.TrimSpace(precision) {
+	case "", "n", "ns":
+		return 1e-6, nil
+	case "u", "us":
+		return 1e-3, nil
+	case "ms":
+		return 1, nil
+	case "s":
+		return 1e3, nil
+	case "m":
+		return 60e3, nil
+	case "h":
+		return 3600e3, nil
+	}
+	return 0, ErrInfluxPrecision
+}
+
+// parseLineProtocol parses a line protocol batch. Lines that do not parse
+// are reported and skipped so the rest of the batch can still be written,
+// as InfluxDB does for partial writes. String fields carry no telemetry and
+// are dropped.
+func parseLineProtocol(body []byte, precision string) ([]influxLine, []string, error) {
+	scale, err := influxPrecisionMs(precision)
+	if err != nil {
+		return nil, nil, err
+	}
+	var lines []influxLine
+	var errs []string
+	for n, raw := range strings.Split(string(body), "\n") {
+		text := strings.TrimSpace(raw)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		line, err := parseInfluxLine(text, scale)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("line %d: %v", n+1, err))
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, errs, nil
+}
+
+func parseInfluxLine(text string, scale float64) (influxLine, error) {
+	sections := splitInfluxUnescaped(text, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return influxLine{}, errors.New("expected measurement, fields and optional timestamp")
+	}
+	keys := splitInfluxUnescaped(sections[0], ',', false)
+	line := influxLine{Measurement: unescapeInflux(keys[0]), Tags: map[string]string{}, Fields: map[string]float64{}}
+	if line.Measurement == "" {
+		return influxLine{}, errors.New("missing measurement")
+	}
+	for _, pair := range keys[1:] {
+		k, v, ok := cutInfluxUnescaped(pair, '=')
+		if !ok || k == "" || v == "" {
+			return influxLine{}, fmt.Errorf("invalid tag %q", pair)
+		}
+		line.Tags[unescapeInflux(k)] = unescapeInflux(v)
+	}
+	fieldCount := 0
+	for _, pair := range splitInfluxUnescaped(sections[1], ',', true) {
+		k, v, ok := cutInfluxUnescaped(pair, '=')
+		if !ok || k == "" || v == "" {
+			return influxLine{}, fmt.Errorf("invalid field %q", pair)
+		}
+		fieldCount++
+		if strings.HasPrefix(v, `"`) {
+			if len(v) < 2 || !strings.HasSuffix(v, `"`) {
+				return influxLine{}, fmt.Errorf("unterminated string field %q", k)
+			}
+			continue
+		}
+		value, err := parseInfluxFieldValue(v)
+		if err != nil {
+			return influxLine{}, fmt.Errorf("field %q: %v", k, err)
+		}
+		line.Fields[unescapeInflux(k)] = value
+	}
+	if fieldCount == 0 {
+		return influxLine{}, errors.New("missing fields")
+	}
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return influxLine{}, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+		line.TimeMs = int64(math.Round(float64(ts) * scale))
+	}
+	return line, nil
+}
+
+func parseInfluxFieldValue(v string) (float64, error) {
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, nil
+	}
+	if strings.HasSuffix(v, "i") {
+		n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		return float64(n), err
+	}
+	if strings.HasSuffix(v, "u") {
+		n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		return float64(n), err
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// splitInfluxUnescaped splits on sep unless it is backslash-escaped or,
+// when quotes is set, inside a double-quoted string field.
+func splitInfluxUnescaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	start, inQuote := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == sep && !inQuote:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func cutInfluxUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+func unescapeInflux(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, ="\`, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// influxRequestToken returns the credential an Influx client sent: a v2
+// "Token" or "Bearer" header, the password of Basic auth, or the v1 p=
+// query parameter. Telegraf's influxdb outputs use the first and last
+// two forms.
+func influxRequestToken(authorization, queryPassword string) string {
+	scheme, value, _ := strings.Cut(strings.TrimSpace(authorization), " ")
+	switch strings.ToLower(scheme) {
+	case "token", "bearer":
+		return strings.TrimSpace(value)
+	case "basic":
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return ""
+		}
+		_, password, _ := strings.Cut(string(decoded), ":")
+		return password
+	}
+	return queryPassword
+}
+
+// InfluxReceiver converts line protocol points into telemetry samples.
+type InfluxReceiver struct {
+	source   string
+	mapping  InfluxMapping
+	rules    map[string][]metricRule
+	counters *counterRates
+}
+
+func NewInfluxReceiver(source string, mapping InfluxMapping) *InfluxReceiver {
+	rules, err := compileMetricRules(mapping.Fields)
+	if err != nil {
+		rules = map[string][]metricRule{}
+	}
+	return &InfluxReceiver{
+		source:   firstNonEmpty(strings.ToLower(strings.TrimSpace(source)), influxSource),
+		mapping:  mapping,
+		rules:    rules,
+		counters: newCounterRates(),
+	}
+}
+
+func (r *InfluxReceiver) Name() string {
+	return r.source
+}
+
+func (r *InfluxReceiver) Mapping() InfluxMapping {
+	return r.mapping
+}
+
+// Convert maps each field, then merges them per device and timestamp.
+// Lines without a timestamp take the receive time, as InfluxDB does.
+func (r *InfluxReceiver) Convert(lines []influxLine, nowMs int64) ([]TelemetryIngestRequest, InfluxWriteResult) {
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+	result := InfluxWriteResult{Source: r.source, Lines: len(lines), Unmapped: map[string]int64{}}
+	samples := make([]metricSample, 0, len(lines))
+	for _, line := range lines {
+		at := line.TimeMs
+		if at <= 0 {
+			at = nowMs
+		}
+		deviceID := alertTargetHost(firstAttribute(line.Tags, r.mapping.DeviceTags))
+		for field, value := range line.Fields {
+			result.Fields++
+			name := line.Measurement + "." + field
+			target, ok := matchMetricRule(r.rules, name, line.Tags)
+			if !ok {
+				result.UnmappedFields++
+				result.Unmapped[name]++
+				continue
+			}
+			if deviceID == "" {
+				result.RejectedFields++
+				continue
+			}
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				result.RejectedFields++
+				continue
+			}
+			samples = append(samples, metricSample{deviceID: deviceID, labels: line.Tags, name: name, unit: influxUnit(field), target: target, value: value, atMs: at})
+		}
+	}
+	keys := metricLabelKeys{name: r.mapping.NameTags, site: r.mapping.SiteTags, role: r.mapping.RoleTags, iface: r.mapping.InterfaceTags}
+	events, grouped := groupMetricSamples(r.source, samples, keys, r.counters)
+	result.MappedFields = grouped.mapped
+	for name, count := range grouped.unmapped {
+		result.UnmappedFields += int(count)
+		result.Unmapped[name] += count
+	}
+	result.Devices = grouped.devices
+	result.Events = len(events)
+	if len(result.Unmapped) == 0 {
+		result.Unmapped = nil
+	}
+	return events, result
+}
+
+// influxUnit reads the unit Telegraf field names carry in their suffix.
+func influxUnit(field string) string {
+	lower := strings.ToLower(field)
+	switch {
+	case strings.HasSuffix(lower, "_ms"):
+		return "ms"
+	case strings.HasSuffix(lower, "_us"):
+		return "us"
+	case strings.HasSuffix(lower, "_ns"):
+		return "ns"
+	case strings.HasSuffix(lower, "_s"), strings.HasSuffix(lower, "_seconds"):
+		return "s"
+	case strings.Contains(lower, "bits"):
+		return "bit"
+	case strings.Contains(lower, "bytes"), strings.Contains(lower, "octets"):
+		return "By/s"
+	}
+	return ""
+}
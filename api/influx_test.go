@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLineProtocolParsesEscapesAndTypes(t *testing.T) {
+	body := strings.Join([]string{
+		`# telegraf batch`,
+		`ping,url=10.0.0.5,host=sbc-1,site=tower\ 3 packets_received=3i,average_response_ms=4.25,result_code=0i,note="a, b=\"c\"" 1767225600000000000`,
+		`weather,location=us\,midwest temperature=82,ok=t`,
+		`broken line`,
+		`cpu usage=abc 1`,
+	}, "\n")
+	lines, errs, err := parseLineProtocol([]byte(body), "")
+	if err != nil || len(lines) != 2 || len(errs) != 2 {
+		t.Fatalf("expected two valid and two bad lines, lines=%#v errs=%v err=%v", lines, errs, err)
+	}
+	ping := lines[0]
+	if ping.Tags["site"] != "tower 3" || ping.Fields["packets_received"] != 3 || ping.Fields["average_response_ms"] != 4.25 || ping.TimeMs != 1_767_225_600_000 {
+		t.Fatalf("unexpected ping line: %#v", ping)
+	}
+	if _, ok := ping.Fields["note"]; ok {
+		t.Fatalf("expected string field to be dropped")
+	}
+	if lines[1].Tags["location"] != "us,midwest" || lines[1].Fields["ok"] != 1 || lines[1].TimeMs != 0 {
+		t.Fatalf("unexpected escaped line: %#v", lines[1])
+	}
+	if !strings.HasPrefix(errs[0], "line 4:") {
+		t.Fatalf("expected line numbers in errors, got=%v", errs)
+	}
+	if lines, _, _ := parseLineProtocol([]byte("ping,url=a packets_received=1i 1767225600"), "s"); lines[0].TimeMs != 1_767_225_600_000 {
+		t.Fatalf("expected second precision, got=%d", lines[0].TimeMs)
+	}
+	if _, _, err := parseLineProtocol(nil, "fortnight"); !errors.Is(err, ErrInfluxPrecision) {
+		t.Fatalf("expected precision error, got=%v", err)
+	}
+	if _, err := loadInfluxMapping(`{"fields":{"cpu":"cpu_percent"}}`, ""); !errors.Is(err, ErrInfluxMapping) || errors.Is(err, ErrOTLPMapping) {
+		t.Fatalf("expected an influx mapping error, got=%v", err)
+	}
+}
+
+func TestInfluxReceiverMapsTelegrafInputs(t *testing.T) {
+	body := strings.Join([]string{
+		`ping,url=10.0.0.5,host=sbc-1,site_id=tower-3 packets_received=3i,average_response_ms=4.2 1767225600000`,
+		`ping,url=10.0.0.5,host=sbc-1 packets_received=0i 1767225610000`,
+		`net,host=sbc-1,interface=eth0 bytes_recv=1000u,bytes_sent=500u 1767225600000`,
+		`net,host=sbc-1,interface=eth0 bytes_recv=11000u,bytes_sent=500u 1767225610000`,
+		`interface,agent_host=10.0.0.9,sysName=core-1 ifOperStatus=1i 1767225600000`,
+		`cpu,host=sbc-1 usage_idle=97.5 1767225600000`,
+		`mem,host=sbc-1 used_percent=61.5 1767225600000`,
+		`system,host=sbc-1 uptime=3600i 1767225600000`,
+	}, "\n")
+	lines, errs, err := parseLineProtocol([]byte(body), "ms")
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("parse: errs=%v err=%v", errs, err)
+	}
+	receiver := NewInfluxReceiver("", defaultInfluxMapping())
+	events, result := receiver.Convert(lines, 0)
+	if result.Unmapped["cpu.usage_idle"] != 1 || result.UnmappedFields != 2 || result.Devices != 2 {
+		t.Fatalf("unexpected counts: %#v", result)
+	}
+	// The snmp line has no interface tag, so its oper status is unmapped.
+	if result.Unmapped["interface.ifOperStatus"] != 1 {
+		t.Fatalf("expected interface field without interface tag to be unmapped: %#v", result.Unmapped)
+	}
+	byKey := map[string]TelemetryIngestRequest{}
+	for _, ev := range events {
+		byKey[ev.DeviceID+"@"+strconv.FormatInt(ev.ObservedAtMs, 10)] = ev
+	}
+	up := byKey["10.0.0.5@1767225600000"]
+	if up.Source != influxSource || up.SiteID != "tower-3" || up.Online == nil || !*up.Online || up.LatencyMs == nil || *up.LatencyMs != 4.2 {
+		t.Fatalf("expected ping target online with latency, got=%#v", up)
+	}
+	if down := byKey["10.0.0.5@1767225610000"]; down.Online == nil || *down.Online {
+		t.Fatalf("expected no replies to mark the target offline, got=%#v", down)
+	}
+	if m := byKey["sbc-1@1767225600000"].Metrics; m == nil || *m.MemPct != 61.5 || *m.UptimeS != 3600 {
+		t.Fatalf("expected mem and system inputs as health metrics, got=%#v", m)
+	}
+	second := byKey["sbc-1@1767225610000"]
+	if len(second.Interfaces) != 1 || second.Interfaces[0].RxBps == nil || *second.Interfaces[0].RxBps != 8_000 || second.Interfaces[0].TxBps == nil || *second.Interfaces[0].TxBps != 0 {
+		t.Fatalf("expected byte counter rates on eth0, got=%#v", second.Interfaces)
+	}
+}
+
+func TestInfluxRequestTokenForms(t *testing.T) {
+	basic := base64.StdEncoding.EncodeToString([]byte("telegraf:secret"))
+	for _, tc := range []struct{ header, query, want string }{
+		{"Token secret", "", "secret"},
+		{"Bearer secret", "", "secret"},
+		{"Basic " + basic, "", "secret"},
+		{"", "secret", "secret"},
+		{"Basic !!", "", ""},
+	} {
+		if got := influxRequestToken(tc.header, tc.query); got != tc.want {
+			t.Fatalf("influxRequestToken(%q, %q) = %q, want %q", tc.header, tc.query, got, tc.want)
+		}
+	}
+}
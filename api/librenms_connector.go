@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type LibreNMSConfig struct {
+	URL    string
+	Token  string
+	SiteID string
+}
+
+// LibreNMSConnector imports device status and open alerts from the
+// LibreNMS v0 REST API.
+type LibreNMSConnector struct {
+	*VendorConnector
+	siteID string
+}
+
+func NewLibreNMSConnector(cfg LibreNMSConfig) *LibreNMSConnector {
+	vendor := NewVendorConnector("librenms", "LibreNMS", cfg.URL, strings.TrimSpace(cfg.Token), "", "x-auth-token")
+	l := &LibreNMSConnector{VendorConnector: vendor, siteID: firstNonEmpty(cfg.SiteID, "librenms")}
+	vendor.fetcher = l.fetchLibreNMSRecords
+	return l
+}
+
+// validateLibreNMSEnvelope rejects {"status":"error"} bodies.
+func validateLibreNMSEnvelope(body []byte) error {
+	var envelope struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("librenms invalid json: %w", err)
+	}
+	if status := strings.ToLower(envelope.Status); status != "" && status != "ok" {
+		return fmt.Errorf("librenms api error: %s", firstNonEmpty(envelope.Message, status))
+	}
+	return nil
+}
+
+func (l *LibreNMSConnector) fetchLibreNMSRecords(ctx context.Context, retries int) (pagedFetchResult, error) {
+	auth := l.authProvider()
+	body, _, err := fetchPageBody(ctx, l.client, l.baseURL+"/api/v0/devices", retries, l.source, auth, l.guard, validateLibreNMSEnvelope)
+	if err != nil {
+		return pagedFetchResult{}, err
+	}
+	var devices struct {
+		Devices []map[string]any `json:"devices"`
+	}
+	if err := json.Unmarshal(body, &devices); err != nil {
+		return pagedFetchResult{}, fmt.Errorf("librenms devices: %w", err)
+	}
+
+	result := pagedFetchResult{Pages: 1, Problems: []SourceProblem{}}
+	deviceByID := map[string]string{}
+	for _, item := range devices.Devices {
+		rec, ok := l.parseDevice(item)
+		if !ok {
+			continue
+		}
+		deviceByID[libreNMSField(item, "device_id")] = rec.ID
+		result.Records = append(result.Records, rec)
+	}
+
+	body, _, err = fetchPageBody(ctx, l.client, l.baseURL+"/api/v0/alerts", retries, l.source, auth, l.guard, validateLibreNMSEnvelope)
+	if err != nil {
+		return result, err
+	}
+	result.Pages++
+	var alerts struct {
+		Alerts []map[string]any `json:"alerts"`
+	}
+	if err := json.Unmarshal(body, &alerts); err != nil {
+		return result, fmt.Errorf("librenms alerts: %w", err)
+	}
+	for _, alert := range alerts.Alerts {
+		// State 0 is recovered; alerting, acknowledged, worse and better
+		// are all still open.
+		if state := libreNMSField(alert, "state"); state == "" || state == "0" {
+			continue
+		}
+		deviceID, ok := deviceByID[libreNMSField(alert, "device_id")]
+		if !ok {
+			continue
+		}
+		alertID := libreNMSField(alert, "id")
+		result.Problems = append(result.Problems, SourceProblem{
+			ExternalID:  alertID,
+			DeviceID:    deviceID,
+			Type:        "librenms_alert",
+			Severity:    libreNMSSeverity(pickString(alert, []string{"severity"})),
+			Message:     firstNonEmpty(pickString(alert, []string{"name"}, []string{"rule_name"}), "LibreNMS alert rule "+libreNMSField(alert, "rule_id")),
+			StartedAtMs: libreNMSTimestampMs(pickString(alert, []string{"timestamp"})),
+		})
+	}
+	return result, nil
+}
+
+// parseDevice maps one device. Disabled and ignored devices are not
+// monitored by LibreNMS and are skipped.
+func (l *LibreNMSConnector) parseDevice(item map[string]any) (uiSPDeviceRecord, bool) {
+	hostname := pickString(item, []string{"hostname"})
+	if hostname == "" || libreNMSField(item, "disabled") == "1" || libreNMSField(item, "ignore") == "1" {
+		return uiSPDeviceRecord{}, false
+	}
+	online := false
+	if up := pickBool(item, []string{"status"}); up != nil {
+		online = *up
+	}
+	return uiSPDeviceRecord{
+		ID:     hostname,
+		Name:   firstNonEmpty(pickString(item, []string{"display"}), pickString(item, []string{"sysName"}), hostname),
+		Role:   libreNMSDeviceRole(pickString(item, []string{"type"}), pickString(item, []string{"hardware"})),
+		SiteID: l.siteID,
+		Host:   hostname,
+		Serial: pickString(item, []string{"serial"}),
+		Model:  pickString(item, []string{"hardware"}),
+		Vendor: "LibreNMS",
+		Online: online,
+		Metrics: pickHealthMetrics(item, healthMetricPaths{
+			uptime: [][]string{{"uptime"}},
+		}),
+	}, true
+}
+
+func libreNMSDeviceRole(deviceType, hardware string) string {
+	switch strings.ToLower(strings.TrimSpace(deviceType)) {
+	case "wireless":
+		return "ap"
+	case "firewall":
+		return "gateway"
+	case "network", "":
+		return normalizeVendorRole(hardware)
+	default:
+		return strings.ToLower(strings.TrimSpace(deviceType))
+	}
+}
+
+func libreNMSSeverity(severity string) string {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "critical":
+		return "critical"
+	case "ok", "info":
+		return "info"
+	default:
+		return "warning"
+	}
+}
+
+// libreNMSTimestampMs parses the server-local "2006-01-02 15:04:05"
+// timestamps LibreNMS returns; the API does not include a zone, so they
+// are read as UTC.
+func libreNMSTimestampMs(raw string) int64 {
+	ts, err := time.Parse("2006-01-02 15:04:05", strings.TrimSpace(raw))
+	if err != nil {
+		return 0
+	}
+	return ts.UnixMilli()
+}
+
+// libreNMSField reads IDs and flags, which LibreNMS returns as numbers or
+// strings depending on the database driver.
+func libreNMSField(item map[string]any, key string) string {
+	if v := pickFloat(item, []string{key}); v != nil {
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	return pickString(item, []string{key})
+}
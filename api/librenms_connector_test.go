@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestLibreNMSConnectorImportsDevicesAndAlerts(t *testing.T) {
+	var mu sync.Mutex
+	alerts := `{"status":"ok","count":3,"alerts":[
+		{"id":71,"device_id":1,"rule_id":4,"state":1,"severity":"critical","name":"Port down","timestamp":"2026-01-01 00:00:00"},
+		{"id":72,"device_id":2,"rule_id":5,"state":2,"severity":"warning","timestamp":"2026-01-01 00:05:00"},
+		{"id":73,"device_id":1,"rule_id":6,"state":0,"severity":"critical","name":"Recovered"}
+	]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != "lnms-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status":"error","message":"Unauthenticated."}`))
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v0/devices":
+			_, _ = w.Write([]byte(`{"status":"ok","count":4,"devices":[
+				{"device_id":1,"hostname":"dist-sw-1.example.net","sysName":"dist-sw-1","status":1,"disabled":0,"ignore":0,"type":"network","hardware":"Cisco Catalyst switch","serial":"FDO1","os":"ios"},
+				{"device_id":2,"hostname":"10.2.0.1","display":"Tower AP","status":0,"status_reason":"icmp","disabled":0,"ignore":0,"type":"wireless","hardware":"airMAX"},
+				{"device_id":3,"hostname":"old-rtr","status":1,"disabled":1,"ignore":0,"type":"network"},
+				{"device_id":"4","hostname":"ups-1","status":"1","disabled":"0","ignore":"1","type":"power"}
+			]}`))
+		case "/api/v0/alerts":
+			_, _ = w.Write([]byte(alerts))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	connector := NewLibreNMSConnector(LibreNMSConfig{URL: server.URL, Token: "lnms-token", SiteID: "metro"})
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 50, FullSync: true})
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if batch.Response.Demo || len(batch.Events) != 2 || batch.Response.Pages != 2 {
+		t.Fatalf("expected two monitored devices, demo=%v events=%#v", batch.Response.Demo, batch.Events)
+	}
+	sw, ap := batch.Events[0], batch.Events[1]
+	if sw.DeviceID != "dist-sw-1.example.net" || sw.Device != "dist-sw-1" || sw.Role != "switch" || sw.SiteID != "metro" || !*sw.Online {
+		t.Fatalf("unexpected switch mapping: %#v", sw)
+	}
+	if ap.Device != "Tower AP" || ap.Role != "ap" || *ap.Online {
+		t.Fatalf("unexpected ap mapping: %#v", ap)
+	}
+	if len(batch.Problems) != 2 || batch.Problems[0].ExternalID != "71" || batch.Problems[0].Message != "Port down" || batch.Problems[1].Message != "LibreNMS alert rule 5" || batch.Problems[1].Severity != "warning" {
+		t.Fatalf("expected open and acknowledged alerts only, got=%#v", batch.Problems)
+	}
+
+	store := LoadStore("")
+	ingestSourceEvents(store, batch.Events)
+	if sync := syncSourceProblemsBatch(store, connector.Name(), batch); len(sync.Opened) != 2 {
+		t.Fatalf("expected two alert incidents, got=%#v", sync)
+	}
+
+	mu.Lock()
+	alerts = `{"status":"ok","count":0,"alerts":[]}`
+	mu.Unlock()
+	batch, err = connector.Poll(context.Background(), SourcePollRequest{Limit: 50})
+	if err != nil {
+		t.Fatalf("second poll: %v", err)
+	}
+	if sync := syncSourceProblemsBatch(store, connector.Name(), batch); len(sync.Resolved) != 2 {
+		t.Fatalf("expected cleared alerts to resolve incidents, got=%#v", sync)
+	}
+
+	bad := NewLibreNMSConnector(LibreNMSConfig{URL: server.URL, Token: "wrong"})
+	if _, err := bad.Poll(context.Background(), SourcePollRequest{Limit: 10}); err == nil {
+		t.Fatalf("expected rejected token to fail the poll")
+	}
+}
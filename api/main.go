@@ -4,12 +4,15 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -22,6 +25,14 @@ func main() {
 	dataFile := getenv("DATA_FILE", "")
 	store := LoadStore(dataFile)
 	apiToken := getenv("API_TOKEN", "")
+	var diagnosticExecutor DiagnosticExecutor = localDiagnosticExecutor{}
+	serverCtx, stopServer := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopServer()
+	diagnosticRunner := NewDiagnosticRunner(store, diagnosticExecutor, logger,
+		getenvInt("DIAGNOSTIC_WORKERS", defaultDiagnosticWorkers),
+		getenvInt("DIAGNOSTIC_QUEUE", defaultDiagnosticQueue),
+		time.Duration(getenvInt("DIAGNOSTIC_JOB_TTL_SEC", int(defaultDiagnosticJobTTL.Seconds())))*time.Second)
+	go diagnosticRunner.Run(serverCtx)
 
 	uispConnector := NewUISPConnector(
 		getenv("UISP_URL", ""),
@@ -53,25 +64,267 @@ func main() {
 		getenv("MERAKI_AUTH_SCHEME", "x-cisco-meraki-api-key"),
 	)
 
+	unifiConnector := NewUniFiConnector(UniFiConfig{
+		BaseURL:            getenv("UNIFI_URL", ""),
+		Username:           getenv("UNIFI_USERNAME", ""),
+		Password:           getenv("UNIFI_PASSWORD", ""),
+		APIKey:             getenv("UNIFI_API_KEY", ""),
+		UniFiOS:            strings.ToLower(getenv("UNIFI_API_STYLE", "unifi_os")) != "classic",
+		Sites:              strings.Split(getenv("UNIFI_SITES", ""), ","),
+		CAFile:             getenv("UNIFI_CA_FILE", ""),
+		InsecureSkipVerify: getenvBool("UNIFI_INSECURE_SKIP_VERIFY", false),
+	})
+	if err := unifiConnector.ConfigError(); err != nil {
+		logger.Warn("connector_auth_invalid", "source", unifiConnector.Name(), "error", err)
+	}
+	mikrotikConnector := NewMikroTikConnector(MikroTikConfig{
+		Hosts:              parseMikroTikHosts(getenv("MIKROTIK_HOSTS", "")),
+		Username:           getenv("MIKROTIK_USERNAME", ""),
+		Password:           getenv("MIKROTIK_PASSWORD", ""),
+		SiteID:             getenv("MIKROTIK_SITE_ID", ""),
+		Role:               getenv("MIKROTIK_ROLE", ""),
+		Concurrency:        getenvInt("MIKROTIK_POLL_CONCURRENCY", defaultMikroTikConcurrency),
+		CAFile:             getenv("MIKROTIK_CA_FILE", ""),
+		InsecureSkipVerify: getenvBool("MIKROTIK_INSECURE_SKIP_VERIFY", false),
+	})
+	if err := mikrotikConnector.ConfigError(); err != nil {
+		logger.Warn("connector_auth_invalid", "source", mikrotikConnector.Name(), "error", err)
+	}
+	zabbixConnector := NewZabbixConnector(ZabbixConfig{
+		URL:        getenv("ZABBIX_URL", ""),
+		APIToken:   getenv("ZABBIX_API_TOKEN", ""),
+		Username:   getenv("ZABBIX_USERNAME", ""),
+		Password:   getenv("ZABBIX_PASSWORD", ""),
+		LegacyAuth: strings.ToLower(getenv("ZABBIX_API_STYLE", "header")) == "legacy",
+		HostGroups: strings.Split(getenv("ZABBIX_HOST_GROUPS", ""), ","),
+		SiteID:     getenv("ZABBIX_SITE_ID", ""),
+	})
+	libreNMSConnector := NewLibreNMSConnector(LibreNMSConfig{
+		URL:    getenv("LIBRENMS_URL", ""),
+		Token:  getenv("LIBRENMS_TOKEN", ""),
+		SiteID: getenv("LIBRENMS_SITE_ID", ""),
+	})
+
+	uispConnector.SetPagination(paginationConfigFromEnv("UISP", PaginationConfig{}))
+	ciscoConnector.SetPagination(paginationConfigFromEnv("CISCO", PaginationConfig{}))
+	juniperConnector.SetPagination(paginationConfigFromEnv("JUNIPER", PaginationConfig{}))
+	merakiConnector.SetPagination(paginationConfigFromEnv("MERAKI", PaginationConfig{Mode: "link", PageSize: 1000, SizeParam: "perPage"}))
+	uispConnector.SetGuard(sourceGuardConfigFromEnv("UISP"))
+	ciscoConnector.SetGuard(sourceGuardConfigFromEnv("CISCO"))
+	juniperConnector.SetGuard(sourceGuardConfigFromEnv("JUNIPER"))
+	merakiConnector.SetGuard(sourceGuardConfigFromEnv("MERAKI"))
+	unifiConnector.SetGuard(sourceGuardConfigFromEnv("UNIFI"))
+	mikrotikConnector.SetGuard(sourceGuardConfigFromEnv("MIKROTIK"))
+	zabbixConnector.SetGuard(sourceGuardConfigFromEnv("ZABBIX"))
+	libreNMSConnector.SetGuard(sourceGuardConfigFromEnv("LIBRENMS"))
+
+	httpJSONSource := strings.ToLower(getenv("HTTPJSON_SOURCE", "httpjson"))
+	httpJSONVendor := getenv("HTTPJSON_VENDOR", "Generic")
+	httpJSONURL := getenv("HTTPJSON_URL", "")
+	httpJSONToken := getenv("HTTPJSON_TOKEN", "")
+	httpJSONDevicesPath := getenv("HTTPJSON_DEVICES_PATH", "/devices")
+	httpJSONAuthScheme := getenv("HTTPJSON_AUTH_SCHEME", "bearer")
+	var httpJSONConnector *VendorConnector
+	mapping, err := loadHTTPJSONMapping(getenv("HTTPJSON_MAPPING", ""), getenv("HTTPJSON_MAPPING_FILE", ""))
+	if err == nil {
+		httpJSONConnector, err = NewHTTPJSONConnector(httpJSONSource, httpJSONVendor, httpJSONURL, httpJSONToken, httpJSONDevicesPath, httpJSONAuthScheme, mapping)
+	}
+	if err != nil {
+		if err != ErrHTTPJSONNoSource {
+			logger.Warn("httpjson_mapping_invalid", "source", httpJSONSource, "error", err)
+		}
+		// Without a mapping the connector still serves dry runs and source routes.
+		httpJSONConnector = NewVendorConnector(httpJSONSource, httpJSONVendor, httpJSONURL, httpJSONToken, httpJSONDevicesPath, httpJSONAuthScheme)
+	}
+	httpJSONConnector.SetPagination(paginationConfigFromEnv("HTTPJSON", PaginationConfig{}))
+	httpJSONConnector.SetGuard(sourceGuardConfigFromEnv("HTTPJSON"))
+	for prefix, connector := range map[string]*VendorConnector{
+		"CISCO":    ciscoConnector,
+		"JUNIPER":  juniperConnector,
+		"MERAKI":   merakiConnector,
+		"HTTPJSON": httpJSONConnector,
+	} {
+		auth, err := connectorAuthFromEnv(prefix, connector.baseURL, connector.client)
+		if err != nil {
+			logger.Warn("connector_auth_invalid", "source", connector.Name(), "error", err)
+			connector.SetConfigError(err)
+			continue
+		}
+		if auth != nil {
+			connector.SetAuth(auth)
+		}
+	}
+
+	for prefix, connector := range map[string]transportSourceConnector{
+		"UISP":     uispConnector,
+		"CISCO":    ciscoConnector,
+		"JUNIPER":  juniperConnector,
+		"MERAKI":   merakiConnector,
+		"UNIFI":    unifiConnector,
+		"MIKROTIK": mikrotikConnector,
+		"ZABBIX":   zabbixConnector,
+		"LIBRENMS": libreNMSConnector,
+		"HTTPJSON": httpJSONConnector,
+	} {
+		transport, err := connectorFixtureTransportFromEnv(prefix)
+		if err != nil {
+			logger.Warn("connector_fixture_invalid", "source", connector.Name(), "error", err)
+			continue
+		}
+		if transport != nil {
+			connector.SetTransport(transport)
+			logger.Info("connector_fixture_enabled", "source", connector.Name(), "mode", getenv(prefix+"_FIXTURE_MODE", ""), "dir", getenv(prefix+"_FIXTURE_DIR", ""))
+		}
+	}
+
+	for prefix, source := range map[string]string{
+		"UISP":     "uisp",
+		"CISCO":    ciscoConnector.Name(),
+		"JUNIPER":  juniperConnector.Name(),
+		"MERAKI":   merakiConnector.Name(),
+		"UNIFI":    unifiConnector.Name(),
+		"MIKROTIK": mikrotikConnector.Name(),
+		"ZABBIX":   zabbixConnector.Name(),
+		"LIBRENMS": libreNMSConnector.Name(),
+		"HTTPJSON": httpJSONConnector.Name(),
+	} {
+		graceSec := getenvInt(prefix+"_REMOVAL_GRACE_SEC", int(defaultSourceRemovalGraceMs/1000))
+		store.SetSourceRemovalGrace(source, time.Duration(graceSec)*time.Second)
+	}
+
 	pollSec := getenvInt("UISP_POLL_INTERVAL_SEC", 0)
 	pollRetries := getenvInt("UISP_POLL_RETRIES", 1)
+	pollFullSyncSec := getenvInt("UISP_FULL_SYNC_INTERVAL_SEC", 3600)
 	if pollSec > 0 {
-		go runSourcePoller(context.Background(), uispConnector, store, logger, time.Duration(pollSec)*time.Second, pollRetries)
+		go runSourcePoller(context.Background(), uispConnector, store, logger, time.Duration(pollSec)*time.Second, pollRetries, time.Duration(pollFullSyncSec)*time.Second)
 	}
 	ciscoPollSec := getenvInt("CISCO_POLL_INTERVAL_SEC", 0)
 	ciscoPollRetries := getenvInt("CISCO_POLL_RETRIES", 1)
+	ciscoPollFullSyncSec := getenvInt("CISCO_FULL_SYNC_INTERVAL_SEC", 3600)
 	if ciscoPollSec > 0 {
-		go runSourcePoller(context.Background(), ciscoConnector, store, logger, time.Duration(ciscoPollSec)*time.Second, ciscoPollRetries)
+		go runSourcePoller(context.Background(), ciscoConnector, store, logger, time.Duration(ciscoPollSec)*time.Second, ciscoPollRetries, time.Duration(ciscoPollFullSyncSec)*time.Second)
 	}
 	juniperPollSec := getenvInt("JUNIPER_POLL_INTERVAL_SEC", 0)
 	juniperPollRetries := getenvInt("JUNIPER_POLL_RETRIES", 1)
+	juniperPollFullSyncSec := getenvInt("JUNIPER_FULL_SYNC_INTERVAL_SEC", 3600)
 	if juniperPollSec > 0 {
-		go runSourcePoller(context.Background(), juniperConnector, store, logger, time.Duration(juniperPollSec)*time.Second, juniperPollRetries)
+		go runSourcePoller(context.Background(), juniperConnector, store, logger, time.Duration(juniperPollSec)*time.Second, juniperPollRetries, time.Duration(juniperPollFullSyncSec)*time.Second)
 	}
 	merakiPollSec := getenvInt("MERAKI_POLL_INTERVAL_SEC", 0)
 	merakiPollRetries := getenvInt("MERAKI_POLL_RETRIES", 1)
+	merakiPollFullSyncSec := getenvInt("MERAKI_FULL_SYNC_INTERVAL_SEC", 3600)
 	if merakiPollSec > 0 {
-		go runSourcePoller(context.Background(), merakiConnector, store, logger, time.Duration(merakiPollSec)*time.Second, merakiPollRetries)
+		go runSourcePoller(context.Background(), merakiConnector, store, logger, time.Duration(merakiPollSec)*time.Second, merakiPollRetries, time.Duration(merakiPollFullSyncSec)*time.Second)
+	}
+	unifiPollSec := getenvInt("UNIFI_POLL_INTERVAL_SEC", 0)
+	unifiPollRetries := getenvInt("UNIFI_POLL_RETRIES", 1)
+	unifiPollFullSyncSec := getenvInt("UNIFI_FULL_SYNC_INTERVAL_SEC", 3600)
+	if unifiPollSec > 0 {
+		go runSourcePoller(context.Background(), unifiConnector, store, logger, time.Duration(unifiPollSec)*time.Second, unifiPollRetries, time.Duration(unifiPollFullSyncSec)*time.Second)
+	}
+	mikrotikPollSec := getenvInt("MIKROTIK_POLL_INTERVAL_SEC", 0)
+	mikrotikPollRetries := getenvInt("MIKROTIK_POLL_RETRIES", 1)
+	mikrotikPollFullSyncSec := getenvInt("MIKROTIK_FULL_SYNC_INTERVAL_SEC", 3600)
+	if mikrotikPollSec > 0 {
+		go runSourcePoller(context.Background(), mikrotikConnector, store, logger, time.Duration(mikrotikPollSec)*time.Second, mikrotikPollRetries, time.Duration(mikrotikPollFullSyncSec)*time.Second)
+	}
+	zabbixPollSec := getenvInt("ZABBIX_POLL_INTERVAL_SEC", 0)
+	zabbixPollRetries := getenvInt("ZABBIX_POLL_RETRIES", 1)
+	zabbixPollFullSyncSec := getenvInt("ZABBIX_FULL_SYNC_INTERVAL_SEC", 3600)
+	if zabbixPollSec > 0 {
+		go runSourcePoller(context.Background(), zabbixConnector, store, logger, time.Duration(zabbixPollSec)*time.Second, zabbixPollRetries, time.Duration(zabbixPollFullSyncSec)*time.Second)
+	}
+	libreNMSPollSec := getenvInt("LIBRENMS_POLL_INTERVAL_SEC", 0)
+	libreNMSPollRetries := getenvInt("LIBRENMS_POLL_RETRIES", 1)
+	libreNMSPollFullSyncSec := getenvInt("LIBRENMS_FULL_SYNC_INTERVAL_SEC", 3600)
+	if libreNMSPollSec > 0 {
+		go runSourcePoller(context.Background(), libreNMSConnector, store, logger, time.Duration(libreNMSPollSec)*time.Second, libreNMSPollRetries, time.Duration(libreNMSPollFullSyncSec)*time.Second)
+	}
+	httpJSONPollSec := getenvInt("HTTPJSON_POLL_INTERVAL_SEC", 0)
+	httpJSONPollRetries := getenvInt("HTTPJSON_POLL_RETRIES", 1)
+	httpJSONPollFullSyncSec := getenvInt("HTTPJSON_FULL_SYNC_INTERVAL_SEC", 3600)
+	if httpJSONPollSec > 0 && httpJSONConnector.mapping != nil {
+		go runSourcePoller(context.Background(), httpJSONConnector, store, logger, time.Duration(httpJSONPollSec)*time.Second, httpJSONPollRetries, time.Duration(httpJSONPollFullSyncSec)*time.Second)
+	}
+
+	netBoxClient := NewNetBoxClient(getenv("NETBOX_URL", ""), getenv("NETBOX_TOKEN", ""))
+	netBoxRetries := getenvInt("NETBOX_SYNC_RETRIES", 1)
+	netBoxSyncSec := getenvInt("NETBOX_SYNC_INTERVAL_SEC", 0)
+	if netBoxSyncSec > 0 {
+		go runNetBoxSync(context.Background(), netBoxClient, store, logger, time.Duration(netBoxSyncSec)*time.Second, netBoxRetries)
+	}
+
+	subscriberClient := NewUISPSubscriberClient(
+		getenv("UISP_URL", ""),
+		getenv("UISP_TOKEN", ""),
+		getenv("UISP_SITES_PATH", defaultUISPSitesPath),
+		getenv("UISP_DEVICES_PATH", "/nms/api/v2.1/devices"),
+		getenv("UISP_CRM_URL", ""),
+		getenv("UISP_CRM_TOKEN", ""),
+	)
+	subscriberRetries := getenvInt("SUBSCRIBER_SYNC_RETRIES", 1)
+	subscriberSyncSec := getenvInt("SUBSCRIBER_SYNC_INTERVAL_SEC", 0)
+	if subscriberSyncSec > 0 {
+		go runSubscriberSync(context.Background(), subscriberClient, store, logger, time.Duration(subscriberSyncSec)*time.Second, subscriberRetries)
+	}
+
+	alertLabels := NewAlertLabelMapping(
+		strings.Split(getenv("ALERT_WEBHOOK_DEVICE_LABELS", ""), ","),
+		strings.Split(getenv("ALERT_WEBHOOK_SITE_LABELS", ""), ","),
+		getenv("ALERT_WEBHOOK_SEVERITY_LABEL", ""),
+	)
+
+	otlpMapping, err := loadOTLPMapping(getenv("OTLP_MAPPING", ""), getenv("OTLP_MAPPING_FILE", ""))
+	if err != nil {
+		logger.Warn("otlp_mapping_invalid", "error", err)
+		otlpMapping = defaultOTLPMapping()
+	}
+	otlpReceiver := NewOTLPReceiver(getenv("OTLP_SOURCE", otlpSource), otlpMapping)
+	remoteWriteMapping, err := loadRemoteWriteMapping(getenv("PROM_REMOTE_WRITE_MAPPING", ""), getenv("PROM_REMOTE_WRITE_MAPPING_FILE", ""))
+	if err != nil {
+		logger.Warn("remote_write_mapping_invalid", "error", err)
+		remoteWriteMapping = defaultRemoteWriteMapping()
+	}
+	remoteWriteReceiver := NewRemoteWriteReceiver(getenv("PROM_REMOTE_WRITE_SOURCE", remoteWriteSource), remoteWriteMapping)
+	influxMapping, err := loadInfluxMapping(getenv("INFLUX_MAPPING", ""), getenv("INFLUX_MAPPING_FILE", ""))
+	if err != nil {
+		logger.Warn("influx_mapping_invalid", "error", err)
+		influxMapping = defaultInfluxMapping()
+	}
+	influxReceiver := NewInfluxReceiver(getenv("INFLUX_SOURCE", influxSource), influxMapping)
+
+	flowIfNames, err := loadFlowInterfaceNames(getenv("FLOW_INTERFACE_NAMES", ""), getenv("FLOW_INTERFACE_NAMES_FILE", ""))
+	if err != nil {
+		logger.Warn("flow_interface_names_invalid", "error", err)
+	}
+	flowCollector := NewFlowCollector(time.Duration(getenvInt("FLOW_RETENTION_MIN", 60))*time.Minute, flowIfNames)
+	flowCollector.SetSource(netflowSource, getenv("NETFLOW_SOURCE", ""))
+	flowCollector.SetSource(sflowSource, getenv("SFLOW_SOURCE", ""))
+	netflowAddr := strings.TrimSpace(getenv("NETFLOW_LISTEN_ADDR", ""))
+	sflowAddr := strings.TrimSpace(getenv("SFLOW_LISTEN_ADDR", ""))
+	if netflowAddr != "" {
+		go runFlowListener(context.Background(), netflowAddr, netflowSource, logger, flowCollector.HandleNetFlow)
+	}
+	if sflowAddr != "" {
+		go runFlowListener(context.Background(), sflowAddr, sflowSource, logger, flowCollector.HandleSFlow)
+	}
+	if netflowAddr != "" || sflowAddr != "" {
+		go runFlowRateFlush(context.Background(), flowCollector, store, logger)
+	}
+
+	mqttBridge := NewMQTTBridge(MQTTConfig{
+		BrokerURL:       getenv("MQTT_BROKER_URL", ""),
+		ClientID:        getenv("MQTT_CLIENT_ID", ""),
+		Username:        getenv("MQTT_USERNAME", ""),
+		Password:        getenv("MQTT_PASSWORD", ""),
+		Topics:          strings.Split(getenv("MQTT_SUBSCRIBE_TOPICS", ""), ","),
+		QoS:             byte(getenvInt("MQTT_QOS", 1)),
+		TopicPrefix:     getenv("MQTT_TOPIC_PREFIX", ""),
+		Source:          getenv("MQTT_SOURCE", ""),
+		PublishInterval: time.Duration(getenvInt("MQTT_PUBLISH_INTERVAL_SEC", 15)) * time.Second,
+	}, store, logger)
+	if mqttBridge.Enabled() {
+		go runMQTTBridge(context.Background(), mqttBridge, logger)
 	}
 
 	app := fiber.New()
@@ -137,7 +390,30 @@ func main() {
 				"incident_workspace_mode":      true,
 				"incident_shift_handoff":       true,
 				"incident_audit_events":        true,
-				"source_poll_background":       pollSec > 0 || ciscoPollSec > 0 || juniperPollSec > 0 || merakiPollSec > 0,
+				"agent_remote_config":          true,
+				"incident_remote_diagnostics":  true,
+				"agent_sequenced_ingest":       true,
+				"connector_http_json_mapping":  true,
+				"connector_pagination":         true,
+				"connector_login_auth":         true,
+				"connector_circuit_breaker":    true,
+				"connector_attribute_events":   true,
+				"device_lifecycle":             true,
+				"connector_fixtures":           true,
+				"connector_unifi":              true,
+				"connector_mikrotik":           true,
+				"netbox_sync":                  true,
+				"connector_zabbix":             true,
+				"connector_librenms":           true,
+				"webhook_alertmanager":         true,
+				"webhook_grafana":              true,
+				"otlp_metrics_ingest":          true,
+				"prometheus_remote_write":      true,
+				"influx_line_protocol":         true,
+				"netflow_collector":            true,
+				"sflow_collector":              true,
+				"mqtt_bridge":                  mqttBridge.Enabled(),
+				"source_poll_background":       pollSec > 0 || ciscoPollSec > 0 || juniperPollSec > 0 || merakiPollSec > 0 || httpJSONPollSec > 0,
 				"cloud_multi_tenant_stub":      true,
 				"connector_multivendor_stub":   false,
 			},
@@ -151,9 +427,38 @@ func main() {
 
 	app.Get("/devices", authMiddleware, func(c *fiber.Ctx) error {
 		devices := store.ListDevices()
+		if !c.QueryBool("include_decommissioned", false) {
+			active := make([]Device, 0, len(devices))
+			for _, device := range devices {
+				if device.Lifecycle != deviceLifecycleDecommissioned {
+					active = append(active, device)
+				}
+			}
+			devices = active
+		}
 		return c.JSON(DevicesResponse{LastUpdated: time.Now().UnixMilli(), Devices: devices})
 	})
 
+	app.Post("/devices/:id/decommission", authMiddleware, func(c *fiber.Ctx) error {
+		var req DeviceDecommissionRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
+		}
+		resp, err := store.DecommissionDevice(c.Params("id"), req)
+		switch {
+		case errors.Is(err, ErrDeviceDecommissionReason):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "missing_reason", "message": "A decommission reason is required"})
+		case errors.Is(err, ErrDeviceNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": "not_found", "message": "Device not found"})
+		case errors.Is(err, ErrDeviceAlreadyDecommissioned):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"code": err.Error(), "message": "Device is already decommissioned"})
+		case err != nil:
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"code": "decommission_failed", "message": err.Error()})
+		}
+		logger.Info("device_decommissioned", "device_id", resp.Device.ID, "actor", req.Actor, "closed_incidents", len(resp.ClosedIncidents))
+		return c.JSON(resp)
+	})
+
 	app.Get("/incidents", authMiddleware, func(c *fiber.Ctx) error {
 		return c.JSON(store.ListIncidents())
 	})
@@ -285,12 +590,13 @@ func main() {
 	})
 
 	app.Get("/metrics/devices/:id", authMiddleware, func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		points := []fiber.Map{
-			{"timestamp": time.Now().Add(-5 * time.Minute).Unix(), "latency": 5, "cpu": 20, "ram": 30, "online": true},
-			{"timestamp": time.Now().Unix(), "latency": 8, "cpu": 22, "ram": 31, "online": true},
+		windowMinutes := c.QueryInt("window_minutes", defaultDeviceMetricsWindow)
+		limit := c.QueryInt("limit", defaultDeviceMetricPoints)
+		series, ok := store.DeviceMetricSeries(c.Params("id"), windowMinutes, limit)
+		if !ok {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": "not_found", "message": "Device not found"})
 		}
-		return c.JSON(fiber.Map{"device_id": id, "points": points})
+		return c.JSON(series)
 	})
 
 	app.Get("/telemetry/retention", authMiddleware, func(c *fiber.Ctx) error {
@@ -314,6 +620,21 @@ func main() {
 		return c.JSON(store.TelemetryBaselineReport(windowHours))
 	})
 
+	app.Get("/telemetry/reboots", authMiddleware, func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 200)
+		deviceID := strings.TrimSpace(c.Query("device_id", ""))
+		events, truncated, normalizedLimit := store.ListDeviceReboots(limit, deviceID)
+		return c.JSON(DeviceRebootsResponse{
+			LastUpdated: time.Now().UnixMilli(),
+			Count:       len(events),
+			Events:      events,
+			Devices:     store.DeviceRebootSummaries(deviceID, time.Now().UnixMilli()),
+			Truncated:   truncated,
+			Limit:       normalizedLimit,
+			Stub:        true,
+		})
+	})
+
 	app.Get("/telemetry/alerts/intelligence", authMiddleware, func(c *fiber.Ctx) error {
 		limit := c.QueryInt("limit", 40)
 		windowMinutes := c.QueryInt("window_minutes", defaultAlertWindowMins)
@@ -334,6 +655,11 @@ func main() {
 			}
 
 			batch, err := connector.Poll(c.Context(), req)
+			if errors.Is(err, ErrSourceCircuitOpen) {
+				// The guard refused to call the source, so there is no
+				// failed poll to record.
+				return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"code": "source_circuit_open", "message": err.Error(), "source": source})
+			}
 			if err != nil {
 				store.RecordSourcePollOutcome(source, false, err.Error(), time.Now().UnixMilli())
 				store.DetectTelemetryGaps(time.Now().UnixMilli())
@@ -343,7 +669,14 @@ func main() {
 			}
 			store.RecordSourcePollOutcome(source, true, "", time.Now().UnixMilli())
 			ingested, incidents, dropped := ingestSourceEvents(store, batch.Events)
+			reconciled := reconcileSourceBatch(store, source, batch)
+			problems := syncSourceProblemsBatch(store, source, batch)
 			gapsCreated, gapsResolved := store.DetectTelemetryGaps(time.Now().UnixMilli())
+			batch.Response.Removed = len(reconciled.Removed)
+			batch.Response.Restored = len(reconciled.Restored)
+			batch.Response.ProblemsActive = problems.Active
+			batch.Response.ProblemsOpened = len(problems.Opened)
+			batch.Response.ProblemsResolved = len(problems.Resolved)
 			batch.Response.Ingested = ingested
 			batch.Response.DroppedByGovernor = dropped
 			batch.Response.IncidentsCreated = incidents
@@ -351,8 +684,16 @@ func main() {
 			logger.Info("source_poll_manual",
 				"source", source,
 				"fetched", batch.Response.Fetched,
+				"pages", batch.Response.Pages,
+				"truncated", batch.Response.Truncated,
 				"normalized", batch.Response.Normalized,
 				"emitted", batch.Response.Emitted,
+				"updated", batch.Response.Updated,
+				"full_sync", batch.Response.FullSync,
+				"removed", batch.Response.Removed,
+				"restored", batch.Response.Restored,
+				"problems_opened", batch.Response.ProblemsOpened,
+				"problems_resolved", batch.Response.ProblemsResolved,
 				"ingested", ingested,
 				"dropped_by_governor", dropped,
 				"incidents", incidents,
@@ -367,6 +708,38 @@ func main() {
 	registerSourceRoutes("cisco", ciscoConnector)
 	registerSourceRoutes("juniper", juniperConnector)
 	registerSourceRoutes("meraki", merakiConnector)
+	registerSourceRoutes("unifi", unifiConnector)
+	registerSourceRoutes("mikrotik", mikrotikConnector)
+	registerSourceRoutes("zabbix", zabbixConnector)
+	registerSourceRoutes("librenms", libreNMSConnector)
+	registerSourceRoutes(httpJSONSource, httpJSONConnector)
+
+	app.Get("/sources/"+httpJSONSource+"/mapping", authMiddleware, func(c *fiber.Ctx) error {
+		mapping, ok := httpJSONConnector.Mapping()
+		return c.JSON(fiber.Map{"source": httpJSONSource, "configured": ok, "mapping": mapping, "stub": true})
+	})
+
+	app.Post("/sources/"+httpJSONSource+"/dry-run", authMiddleware, func(c *fiber.Ctx) error {
+		var req HTTPJSONDryRunRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
+			}
+		}
+		resp, err := httpJSONConnector.DryRun(c.Context(), req)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrHTTPJSONMapping), errors.Is(err, ErrHTTPJSONPath):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": ErrHTTPJSONMapping.Error(), "message": err.Error()})
+			case errors.Is(err, ErrHTTPJSONNoSource):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": "set HTTPJSON_URL or include a sample body"})
+			default:
+				resp.Error = err.Error()
+				return c.Status(http.StatusBadGateway).JSON(resp)
+			}
+		}
+		return c.JSON(resp)
+	})
 
 	app.Get("/inventory/schema", authMiddleware, func(c *fiber.Ctx) error {
 		return c.JSON(store.InventorySchema())
@@ -452,6 +825,85 @@ func main() {
 		})
 	})
 
+	app.Post("/inventory/netbox/sync", authMiddleware, func(c *fiber.Ctx) error {
+		result, err := SyncNetBox(c.Context(), netBoxClient, store, netBoxRetries)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrNetBoxNotConfigured):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": "NETBOX_URL and NETBOX_TOKEN are required"})
+			case errors.Is(err, ErrNetBoxEmpty):
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"code": err.Error(), "message": "NetBox returned no devices; inventory left unchanged"})
+			case errors.Is(err, ErrNetBoxTruncated):
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"code": ErrNetBoxTruncated.Error(), "message": "NetBox inventory exceeded the page cap; inventory left unchanged"})
+			default:
+				return c.Status(http.StatusBadGateway).JSON(fiber.Map{"code": "netbox_sync_failed", "message": err.Error()})
+			}
+		}
+		logger.Info("netbox_sync_ok", "devices", result.Devices, "matched", result.Matched, "created", result.Created, "cable_links", result.CableLinks, "mismatches", result.Mismatches)
+		return c.JSON(fiber.Map{"result": result, "stub": true})
+	})
+
+	app.Post("/subscribers/sync", authMiddleware, func(c *fiber.Ctx) error {
+		result, err := SyncSubscribers(c.Context(), subscriberClient, store, subscriberRetries)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrSubscribersNotConfigured):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": "UISP_URL and UISP_TOKEN are required"})
+			case errors.Is(err, ErrSubscribersEmpty):
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"code": err.Error(), "message": "UISP returned no client sites; subscribers left unchanged"})
+			default:
+				return c.Status(http.StatusBadGateway).JSON(fiber.Map{"code": "subscriber_sync_failed", "message": err.Error()})
+			}
+		}
+		logger.Info("subscriber_sync_ok", "subscribers", result.Subscribers, "paying", result.Paying, "with_cpe", result.WithCPE, "incidents_updated", result.IncidentsUpdated)
+		return c.JSON(fiber.Map{"result": result, "stub": true})
+	})
+
+	app.Get("/subscribers", authMiddleware, func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 200)
+		items, truncated, normalizedLimit, syncedAt := store.ListSubscribers(limit, c.Query("site_id", ""), c.Query("device_id", ""), c.Query("status", ""))
+		return c.JSON(SubscribersResponse{
+			LastUpdated: time.Now().UnixMilli(),
+			SyncedAt:    syncedAt,
+			Count:       len(items),
+			Subscribers: items,
+			Truncated:   truncated,
+			Limit:       normalizedLimit,
+			Stub:        true,
+		})
+	})
+
+	app.Get("/subscribers/counts", authMiddleware, func(c *fiber.Ctx) error {
+		return c.JSON(store.SubscriberCounts())
+	})
+
+	app.Get("/subscribers/impact", authMiddleware, func(c *fiber.Ctx) error {
+		deviceID := strings.TrimSpace(c.Query("device_id", ""))
+		if deviceID == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "missing_device_id", "message": "device_id is required"})
+		}
+		return c.JSON(store.SubscriberImpact(deviceID))
+	})
+
+	app.Get("/inventory/netbox", authMiddleware, func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"configured": netBoxClient.Configured(), "inventory": store.NetBoxInventorySnapshot(), "stub": true})
+	})
+
+	app.Get("/inventory/netbox/mismatches", authMiddleware, func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 200)
+		kind := c.Query("kind", "")
+		items, truncated, normalizedLimit, syncedAt := store.ListNetBoxMismatches(limit, kind)
+		return c.JSON(NetBoxMismatchesResponse{
+			LastUpdated: time.Now().UnixMilli(),
+			SyncedAt:    syncedAt,
+			Count:       len(items),
+			Items:       items,
+			Truncated:   truncated,
+			Limit:       normalizedLimit,
+			Stub:        true,
+		})
+	})
+
 	app.Get("/topology/nodes", authMiddleware, func(c *fiber.Ctx) error {
 		limit := c.QueryInt("limit", 300)
 		siteID := c.Query("site_id", "")
@@ -518,6 +970,27 @@ func main() {
 		})
 	})
 
+	app.Get("/topology/wireless/links", authMiddleware, func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 200)
+		links, truncated, normalizedLimit := store.ListWirelessLinks(limit, c.Query("status", ""), c.Query("site_id", ""), c.Query("ap_device_id", ""))
+		return c.JSON(WirelessLinksResponse{
+			LastUpdated: time.Now().UnixMilli(),
+			Count:       len(links),
+			Links:       links,
+			Truncated:   truncated,
+			Limit:       normalizedLimit,
+			Stub:        true,
+		})
+	})
+
+	app.Get("/topology/wireless/links/:id", authMiddleware, func(c *fiber.Ctx) error {
+		history, ok := store.WirelessLinkHistory(c.Params("id"), c.QueryInt("window_minutes", defaultWirelessLinkWindow), c.QueryInt("limit", defaultWirelessLinkSamples))
+		if !ok {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": "not_found", "message": "Wireless link not found"})
+		}
+		return c.JSON(history)
+	})
+
 	app.Get("/topology/path", authMiddleware, func(c *fiber.Ctx) error {
 		sourceIdentityID := strings.TrimSpace(c.Query("source_identity_id", ""))
 		targetIdentityID := strings.TrimSpace(c.Query("target_identity_id", ""))
@@ -586,11 +1059,222 @@ func main() {
 		return c.JSON(fiber.Map{"agent": agent, "stub": true})
 	})
 
+	app.Get("/agents/config/versions", authMiddleware, func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 100)
+		scope := strings.TrimSpace(c.Query("scope", ""))
+		scopeID := strings.TrimSpace(c.Query("scope_id", ""))
+		versions, truncated, normalizedLimit := store.ListAgentConfigVersions(limit, scope, scopeID)
+		return c.JSON(AgentConfigVersionsResponse{
+			LastUpdated: time.Now().UnixMilli(),
+			Count:       len(versions),
+			Versions:    versions,
+			Truncated:   truncated,
+			Limit:       normalizedLimit,
+			Stub:        true,
+		})
+	})
+
+	app.Post("/agents/config", authMiddleware, func(c *fiber.Ctx) error {
+		var req AgentConfigPublishRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
+		}
+		version, err := store.PublishAgentConfig(req)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": "scope must be global, site or agent with scope_id"})
+		}
+		logger.Info("agent_config_published", "scope", version.Scope, "scope_id", version.ScopeID, "version", version.Version)
+		return c.JSON(version)
+	})
+
+	app.Post("/agents/config/rollback", authMiddleware, func(c *fiber.Ctx) error {
+		var req AgentConfigRollbackRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
+		}
+		version, err := store.RollbackAgentConfig(req)
+		if err != nil {
+			switch err {
+			case ErrAgentConfigNotFound:
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": err.Error(), "message": "config version not found"})
+			default:
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": err.Error()})
+			}
+		}
+		logger.Info("agent_config_rolled_back", "scope", version.Scope, "scope_id", version.ScopeID, "version", version.Version, "rolled_back_from", version.RolledBackFrom)
+		return c.JSON(version)
+	})
+
+	app.Get("/agents/config/rollouts", authMiddleware, func(c *fiber.Ctx) error {
+		agentID := strings.TrimSpace(c.Query("agent_id", ""))
+		state := strings.TrimSpace(c.Query("state", ""))
+		return c.JSON(store.ListAgentConfigRollouts(agentID, state))
+	})
+
+	app.Get("/agents/:id/config", authMiddleware, func(c *fiber.Ctx) error {
+		agentID := c.Params("id")
+		ifNoneMatch := strings.TrimSpace(c.Get(fiber.HeaderIfNoneMatch))
+		waitSec := c.QueryInt("wait_sec", defaultAgentConfigWait)
+		if waitSec < 0 {
+			waitSec = 0
+		}
+		if waitSec > maxAgentConfigWaitSec {
+			waitSec = maxAgentConfigWaitSec
+		}
+
+		start := time.Now()
+		deadline := time.NewTimer(time.Duration(waitSec) * time.Second)
+		defer deadline.Stop()
+		for {
+			changed := store.AgentConfigChanged()
+			version, rollout, found := store.ResolveAgentConfig(agentID)
+			if found && (ifNoneMatch == "" || ifNoneMatch != version.ETag) {
+				c.Set(fiber.HeaderETag, version.ETag)
+				return c.JSON(AgentConfigResponse{
+					AgentID:  agentID,
+					Found:    true,
+					Config:   version,
+					Rollout:  rollout,
+					WaitedMs: time.Since(start).Milliseconds(),
+					Stub:     true,
+				})
+			}
+			if waitSec == 0 {
+				break
+			}
+			select {
+			case <-changed:
+				continue
+			case <-deadline.C:
+			}
+			break
+		}
+
+		if version, _, found := store.ResolveAgentConfig(agentID); found {
+			c.Set(fiber.HeaderETag, version.ETag)
+			return c.SendStatus(http.StatusNotModified)
+		}
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": "not_found", "message": "No config published for agent"})
+	})
+
+	app.Post("/agents/:id/config/status", authMiddleware, func(c *fiber.Ctx) error {
+		agentID := c.Params("id")
+		var req AgentConfigStatusRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
+		}
+		rollout, err := store.ReportAgentConfigStatus(agentID, req)
+		if err != nil {
+			switch err {
+			case ErrAgentConfigNotFound:
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": err.Error(), "message": "no config published for this agent"})
+			case ErrAgentConfigStale:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"code": err.Error(), "message": "status does not match the current config version", "rollout": rollout})
+			default:
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": err.Error()})
+			}
+		}
+		logger.Info("agent_config_status", "agent_id", rollout.AgentID, "version", rollout.Version, "state", rollout.State)
+		return c.JSON(rollout)
+	})
+
+	app.Get("/agents/:id/diagnostics", authMiddleware, func(c *fiber.Ctx) error {
+		agentID := c.Params("id")
+		jobs := store.ClaimAgentDiagnosticJobs(agentID, c.QueryInt("limit", 10))
+		return c.JSON(DiagnosticJobsResponse{
+			LastUpdated: time.Now().UnixMilli(),
+			Count:       len(jobs),
+			Jobs:        jobs,
+			Limit:       len(jobs),
+			Stub:        true,
+		})
+	})
+
+	app.Post("/diagnostics/jobs", authMiddleware, func(c *fiber.Ctx) error {
+		var req DiagnosticJobRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
+		}
+		job, err := store.CreateDiagnosticJob(req)
+		if err != nil {
+			switch err {
+			case ErrDiagnosticAgentUnknown, ErrDiagnosticIncident:
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": err.Error(), "message": err.Error()})
+			default:
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": "kind must be ping, traceroute or tcp with a valid target"})
+			}
+		}
+		if job.Runner == "api" {
+			if err := diagnosticRunner.Submit(job); err != nil {
+				logger.Warn("diagnostic_job_rejected", "job_id", job.ID, "error", err)
+				return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"code": err.Error(), "message": "too many diagnostic jobs in progress, retry shortly", "job_id": job.ID})
+			}
+		}
+		logger.Info("diagnostic_job_created", "job_id", job.ID, "kind", job.Kind, "runner", job.Runner, "agent_id", job.AgentID, "incident_id", job.IncidentID)
+		return c.Status(http.StatusAccepted).JSON(job)
+	})
+
+	app.Get("/diagnostics/jobs", authMiddleware, func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 100)
+		incidentID := strings.TrimSpace(c.Query("incident_id", ""))
+		agentID := strings.TrimSpace(c.Query("agent_id", ""))
+		state := strings.TrimSpace(c.Query("state", ""))
+		jobs, truncated, normalizedLimit := store.ListDiagnosticJobs(limit, incidentID, agentID, state)
+		return c.JSON(DiagnosticJobsResponse{
+			LastUpdated: time.Now().UnixMilli(),
+			Count:       len(jobs),
+			Jobs:        jobs,
+			Truncated:   truncated,
+			Limit:       normalizedLimit,
+			Stub:        true,
+		})
+	})
+
+	app.Get("/diagnostics/jobs/:id", authMiddleware, func(c *fiber.Ctx) error {
+		job, ok := store.GetDiagnosticJob(c.Params("id"))
+		if !ok {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": "not_found", "message": "Diagnostic job not found"})
+		}
+		return c.JSON(job)
+	})
+
+	app.Post("/diagnostics/jobs/:id/result", authMiddleware, func(c *fiber.Ctx) error {
+		var req DiagnosticResult
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
+		}
+		job, err := store.CompleteAgentDiagnosticJob(c.Params("id"), c.Query("agent_id", ""), req)
+		if err != nil {
+			switch err {
+			case ErrDiagnosticJobNotFound:
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": err.Error(), "message": "Diagnostic job not found"})
+			case ErrDiagnosticJobFinished:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"code": err.Error(), "message": "Diagnostic job already has a result", "job": job})
+			case ErrDiagnosticJobOwner:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"code": err.Error(), "message": "Diagnostic job is not assigned to this agent"})
+			case ErrDiagnosticJobState:
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"code": err.Error(), "message": "Diagnostic job is not running", "job": job})
+			default:
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": err.Error()})
+			}
+		}
+		logger.Info("diagnostic_job_result", "job_id", job.ID, "state", job.State, "attached", job.Attached)
+		return c.JSON(job)
+	})
+
 	app.Post("/telemetry/ingest", authMiddleware, func(c *fiber.Ctx) error {
 		var req TelemetryIngestRequest
 		if err := c.BodyParser(&req); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
 		}
+		if strings.TrimSpace(req.AgentID) != "" && req.Seq > 0 {
+			device, incident, ack, err := store.IngestAgentTelemetry(req)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": err.Error()})
+			}
+			logger.Info("telemetry_ingested", "device_id", req.DeviceID, "agent_id", ack.AgentID, "seq", ack.Seq, "ack_status", ack.Status, "source", req.Source)
+			return c.JSON(TelemetryIngestResponse{Accepted: agentAckApplied(ack.Status), Device: device, Incident: incident, Ack: &ack, Stub: true})
+		}
 		device, incident, ok := store.IngestTelemetry(req)
 		if !ok {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "missing_device_id", "message": "device_id is required"})
@@ -599,6 +1283,37 @@ func main() {
 		return c.JSON(TelemetryIngestResponse{Accepted: true, Device: device, Incident: incident, Stub: true})
 	})
 
+	app.Post("/agents/:id/ingest", authMiddleware, func(c *fiber.Ctx) error {
+		var req AgentIngestBatchRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
+		}
+		resp, err := store.IngestAgentTelemetryBatch(c.Params("id"), req.Epoch, req.Samples)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": err.Error(), "message": err.Error()})
+		}
+		logger.Info("agent_batch_ingested", "agent_id", resp.AgentID, "accepted", resp.Accepted, "duplicates", resp.Duplicates, "rejected", resp.Rejected, "durable_through", resp.Ack.DurableThrough, "gaps", len(resp.Ack.Gaps))
+		return c.JSON(resp)
+	})
+
+	app.Get("/agents/ingest/cursors", authMiddleware, func(c *fiber.Ctx) error {
+		cursors := store.ListAgentIngestCursors()
+		return c.JSON(AgentIngestCursorsResponse{
+			LastUpdated: time.Now().UnixMilli(),
+			Count:       len(cursors),
+			Cursors:     cursors,
+			Stub:        true,
+		})
+	})
+
+	app.Get("/agents/:id/ingest/cursor", authMiddleware, func(c *fiber.Ctx) error {
+		cursor, ok := store.GetAgentIngestCursor(c.Params("id"))
+		if !ok {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"code": "not_found", "message": "No sequenced ingest recorded for agent"})
+		}
+		return c.JSON(cursor)
+	})
+
 	app.Post("/events/ingest", authMiddleware, func(c *fiber.Ctx) error {
 		var req EventIngestRequest
 		if err := c.BodyParser(&req); err != nil {
@@ -630,6 +1345,135 @@ func main() {
 		return c.JSON(TelemetryIngestResponse{Accepted: true, Device: device, Incident: incident, Stub: true})
 	})
 
+	for _, source := range []string{alertmanagerSource, grafanaSource} {
+		source := source
+		app.Post("/webhooks/"+source, authMiddleware, func(c *fiber.Ctx) error {
+			var payload AlertWebhookPayload
+			if err := c.BodyParser(&payload); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": "Invalid request body"})
+			}
+			if source == alertmanagerSource && payload.Version != "" && payload.Version != "4" {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": ErrAlertWebhookVersion.Error(), "message": "Alertmanager webhook version 4 is required"})
+			}
+			alerts, skipped := alertLabels.Normalize(payload)
+			result := store.ApplyWebhookAlerts(source, alerts, time.Now().UnixMilli())
+			result.Skipped = skipped
+			logger.Info("alert_webhook_received", "source", source, "receiver", payload.Receiver, "received", result.Received, "opened", len(result.Opened), "updated", len(result.Updated), "resolved", len(result.Resolved), "ignored", result.Ignored, "skipped", skipped)
+			return c.JSON(fiber.Map{"result": result, "stub": true})
+		})
+	}
+	app.Get("/webhooks/mapping", authMiddleware, func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"mapping": alertLabels, "stub": true})
+	})
+
+	// OTLP/HTTP exporters post to the fixed /v1/metrics path.
+	app.Post("/v1/metrics", authMiddleware, func(c *fiber.Ctx) error {
+		body, err := readIngestBody(c.Get(fiber.HeaderContentEncoding), c.Request().Body())
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": err.Error()})
+		}
+		resources, protobuf, err := decodeOTLPMetrics(c.Get(fiber.HeaderContentType), body)
+		if err != nil {
+			if errors.Is(err, ErrOTLPContentType) {
+				return c.Status(http.StatusUnsupportedMediaType).JSON(fiber.Map{"code": err.Error(), "message": "Content-Type must be application/x-protobuf or application/json"})
+			}
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": err.Error()})
+		}
+		events, result := otlpReceiver.Convert(resources, time.Now().UnixMilli())
+		result.Ingested, result.Incidents, result.Dropped = ingestSourceEvents(store, events)
+		store.RecordUnmappedMetrics(otlpReceiver.Name(), result.Unmapped, time.Now().UnixMilli())
+		logger.Info("otlp_metrics_ingested", "source", result.Source, "resources", result.Resources, "data_points", result.DataPoints, "mapped", result.MappedPoints, "unmapped", result.UnmappedPoints, "rejected", result.RejectedPoints, "devices", result.Devices, "ingested", result.Ingested, "dropped", result.Dropped)
+		resp, contentType := otlpExportResponse(protobuf, result.RejectedPoints, "resource has no device attribute ("+strings.Join(otlpReceiver.Mapping().DeviceAttributes, ", ")+")")
+		c.Set(fiber.HeaderContentType, contentType)
+		return c.Send(resp)
+	})
+	app.Get("/telemetry/otlp/mapping", authMiddleware, func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"source": otlpReceiver.Name(), "mapping": otlpReceiver.Mapping(), "stub": true})
+	})
+
+	// Prometheus remote_write 1.0. Senders retry 5xx and drop 4xx, so decode
+	// failures are 400 and a 2.0 body gets 415 to force the 1.0 fallback.
+	app.Post("/api/v1/write", authMiddleware, func(c *fiber.Ctx) error {
+		series, err := decodeRemoteWrite(c.Get(fiber.HeaderContentType), c.Get(fiber.HeaderContentEncoding), c.Request().Body())
+		if err != nil {
+			if errors.Is(err, ErrRemoteWriteContentType) || errors.Is(err, ErrRemoteWriteVersion) {
+				return c.Status(http.StatusUnsupportedMediaType).JSON(fiber.Map{"code": err.Error(), "message": "send remote_write 1.0 (application/x-protobuf, prometheus.WriteRequest)"})
+			}
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid_body", "message": err.Error()})
+		}
+		events, result := remoteWriteReceiver.Convert(series, time.Now().UnixMilli())
+		result.Ingested, result.Incidents, result.Dropped = ingestSourceEvents(store, events)
+		store.RecordUnmappedMetrics(remoteWriteReceiver.Name(), result.Unmapped, time.Now().UnixMilli())
+		logger.Info("remote_write_ingested", "source", result.Source, "series", result.Series, "samples", result.Samples, "mapped", result.MappedSamples, "unmapped", result.UnmappedSamples, "rejected", result.RejectedSamples, "stale", result.StaleSamples, "devices", result.Devices, "ingested", result.Ingested, "dropped", result.Dropped)
+		return c.SendStatus(http.StatusNoContent)
+	})
+	app.Get("/telemetry/remote-write/mapping", authMiddleware, func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"source": remoteWriteReceiver.Name(), "mapping": remoteWriteReceiver.Mapping(), "stub": true})
+	})
+
+	// InfluxDB write API, v1 (/write) and v2 (/api/v2/write) shapes. Telegraf
+	// authenticates with "Token", Basic auth or u/p query parameters rather
+	// than a bearer header, so these routes take the API token in any of them.
+	influxAuth := func(c *fiber.Ctx) error {
+		if apiToken == "" || influxRequestToken(c.Get("Authorization"), c.Query("p")) == apiToken {
+			return c.Next()
+		}
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"code": "unauthorized", "message": "Invalid or missing token"})
+	}
+	influxWrite := func(c *fiber.Ctx) error {
+		body, err := readIngestBody(c.Get(fiber.HeaderContentEncoding), c.Request().Body())
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid", "message": err.Error()})
+		}
+		lines, lineErrs, err := parseLineProtocol(body, c.Query("precision"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid", "message": err.Error()})
+		}
+		events, result := influxReceiver.Convert(lines, time.Now().UnixMilli())
+		result.InvalidLines = len(lineErrs)
+		result.Ingested, result.Incidents, result.Dropped = ingestSourceEvents(store, events)
+		store.RecordUnmappedMetrics(influxReceiver.Name(), result.Unmapped, time.Now().UnixMilli())
+		logger.Info("influx_lines_ingested", "source", result.Source, "lines", result.Lines, "invalid", result.InvalidLines, "fields", result.Fields, "mapped", result.MappedFields, "unmapped", result.UnmappedFields, "rejected", result.RejectedFields, "devices", result.Devices, "ingested", result.Ingested, "dropped", result.Dropped)
+		if len(lineErrs) > 0 {
+			// Valid lines are already written; 400 keeps Telegraf from
+			// retrying the batch.
+			if len(lineErrs) > maxInfluxLineErrors {
+				lineErrs = append(lineErrs[:maxInfluxLineErrors], fmt.Sprintf("and %d more", len(lineErrs)-maxInfluxLineErrors))
+			}
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"code": "invalid", "message": "partial write: " + strings.Join(lineErrs, "; ")})
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+	app.Post("/write", influxAuth, influxWrite)
+	app.Post("/api/v2/write", influxAuth, influxWrite)
+	app.Get("/telemetry/influx/mapping", authMiddleware, func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"source": influxReceiver.Name(), "mapping": influxReceiver.Mapping(), "stub": true})
+	})
+
+	flowTopQuery := func(c *fiber.Ctx) FlowTopQuery {
+		return FlowTopQuery{
+			WindowMinutes: c.QueryInt("window_minutes", defaultFlowWindowMins),
+			DeviceID:      c.Query("device_id", ""),
+			SiteID:        c.Query("site_id", ""),
+			Interface:     c.Query("interface", ""),
+			Limit:         c.QueryInt("limit", 20),
+		}
+	}
+	app.Get("/flows/top-talkers", authMiddleware, func(c *fiber.Ctx) error {
+		return c.JSON(flowCollector.TopTalkers(flowTopQuery(c), time.Now().UnixMilli(), store.ResolveDeviceRef))
+	})
+	app.Get("/flows/top-applications", authMiddleware, func(c *fiber.Ctx) error {
+		return c.JSON(flowCollector.TopApplications(flowTopQuery(c), time.Now().UnixMilli(), store.ResolveDeviceRef))
+	})
+	app.Get("/flows/exporters", authMiddleware, func(c *fiber.Ctx) error {
+		items := flowCollector.Exporters()
+		return c.JSON(fiber.Map{"last_updated": time.Now().UnixMilli(), "count": len(items), "items": items, "stub": true})
+	})
+
+	app.Get("/telemetry/mqtt/status", authMiddleware, func(c *fiber.Ctx) error {
+		return c.JSON(mqttBridge.Status())
+	})
+
 	app.Post("/push/register", func(c *fiber.Ctx) error {
 		var req PushRegisterRequest
 		if err := c.BodyParser(&req); err != nil {
@@ -645,6 +1489,10 @@ func main() {
 	})
 
 	addr := getenv("API_ADDR", ":8080")
+	go func() {
+		<-serverCtx.Done()
+		_ = app.Shutdown()
+	}()
 	logger.Info("api_listening", "addr", addr, "data_file", dataFile, "uisp_poll_interval_sec", pollSec)
 	if err := app.Listen(addr); err != nil {
 		logger.Error("api_start_failed", "error", err)
@@ -678,6 +1526,18 @@ func getenvInt(key string, def int) int {
 	return parsed
 }
 
+func getenvBool(key string, def bool) bool {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
 func randomID() string {
 	buf := make([]byte, 8)
 	if _, err := rand.Read(buf); err == nil {
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMikroTikConcurrency bounds how many routers one poll talks to at
+// once, so a long host list neither serializes nor floods the network.
+const defaultMikroTikConcurrency = 4
+
+type MikroTikConfig struct {
+	Hosts    []string
+	Username string
+	Password string
+	SiteID   string
+	Role     string
+	// Concurrency is the number of routers polled in parallel.
+	Concurrency int
+	// CAFile trusts a PEM bundle for the routers' www-ssl certificates;
+	// InsecureSkipVerify turns verification off instead.
+	CAFile             string
+	InsecureSkipVerify bool
+}
+
+// mikroTikCounter is the last interface counter sample used to turn
+// RouterOS byte/packet totals into rates.
+type mikroTikCounter struct {
+	rxBytes, txBytes float64
+	packets, errors  float64
+	sampledAt        time.Time
+}
+
+// MikroTikConnector polls RouterOS v7 routers over the REST API, one
+// device per configured host. It reuses the vendor connector's polling and
+// event machinery and swaps the fetch for a per-router walk.
+type MikroTikConnector struct {
+	*VendorConnector
+	hosts       []string
+	siteID      string
+	role        string
+	concurrency int
+
+	stateMu  sync.Mutex
+	counters map[string]mikroTikCounter
+	last     map[string]uiSPDeviceRecord
+	now      func() time.Time
+}
+
+func NewMikroTikConnector(cfg MikroTikConfig) *MikroTikConnector {
+	hosts := make([]string, 0, len(cfg.Hosts))
+	for _, host := range cfg.Hosts {
+		host = strings.TrimRight(strings.TrimSpace(host), "/")
+		if host == "" {
+			continue
+		}
+		if !strings.Contains(host, "://") {
+			host = "https://" + host
+		}
+		hosts = append(hosts, host)
+	}
+	// The vendor connector only needs a base URL to leave demo mode; each
+	// poll walks every host.
+	baseURL := ""
+	if len(hosts) > 0 {
+		baseURL = hosts[0]
+	}
+	vendor := NewVendorConnector("mikrotik", "MikroTik", baseURL, "", "", "basic")
+	m := &MikroTikConnector{
+		VendorConnector: vendor,
+		hosts:           hosts,
+		siteID:          firstNonEmpty(cfg.SiteID, "mikrotik"),
+		role:            normalizeVendorRole(firstNonEmpty(cfg.Role, "router")),
+		concurrency:     firstPositiveInt(cfg.Concurrency, defaultMikroTikConcurrency),
+		counters:        map[string]mikroTikCounter{},
+		last:            map[string]uiSPDeviceRecord{},
+		now:             time.Now,
+	}
+	vendor.fetcher = m.fetchMikroTikRecords
+	if err := vendor.SetTLS(cfg.CAFile, cfg.InsecureSkipVerify); err != nil {
+		vendor.SetConfigError(fmt.Errorf("mikrotik tls: %w", err))
+	}
+	if strings.TrimSpace(cfg.Username) != "" {
+		username, password := cfg.Username, cfg.Password
+		vendor.SetAuth(headerAuth(func(req *http.Request) {
+			req.SetBasicAuth(username, password)
+		}))
+	}
+	return m
+}
+
+// fetchMikroTikRecords polls every router, up to m.concurrency at a time.
+// An unreachable router is reported offline with its last known
+// attributes; the poll only fails when no router answered. An open breaker
+// or spent request budget stops the remaining routers.
+func (m *MikroTikConnector) fetchMikroTikRecords(ctx context.Context, retries int) (pagedFetchResult, error) {
+	type routerResult struct {
+		rec   uiSPDeviceRecord
+		pages int
+		err   error
+	}
+	results := make([]routerResult, len(m.hosts))
+	walkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sem := make(chan struct{}, m.concurrency)
+	var wg sync.WaitGroup
+	for i, host := range m.hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-walkCtx.Done():
+				results[i].err = walkCtx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			rec, pages, err := m.fetchRouter(walkCtx, host, retries)
+			results[i] = routerResult{rec: rec, pages: pages, err: err}
+			if errors.Is(err, ErrSourceCircuitOpen) || errors.Is(err, ErrSourceBudgetExhaust) {
+				cancel()
+			}
+		}(i, host)
+	}
+	wg.Wait()
+
+	result := pagedFetchResult{}
+	for _, r := range results {
+		result.Pages += r.pages
+		if errors.Is(r.err, ErrSourceCircuitOpen) || errors.Is(r.err, ErrSourceBudgetExhaust) {
+			return result, r.err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	var lastErr error
+	answered := 0
+	for i, host := range m.hosts {
+		rec, err := results[i].rec, results[i].err
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", host, err)
+			m.stateMu.Lock()
+			prev, ok := m.last[host]
+			m.stateMu.Unlock()
+			if !ok {
+				label := mikroTikHostLabel(host)
+				prev = uiSPDeviceRecord{ID: label, Name: label, Role: m.role, SiteID: m.siteID, Host: label, Vendor: "MikroTik"}
+			}
+			prev.Online = false
+			prev.Latency = nil
+			prev.Metrics = nil
+			prev.ObservedAtMs = 0
+			result.Records = append(result.Records, prev)
+			continue
+		}
+		answered++
+		m.stateMu.Lock()
+		m.last[host] = rec
+		m.stateMu.Unlock()
+		result.Records = append(result.Records, rec)
+	}
+	if answered == 0 && lastErr != nil {
+		return pagedFetchResult{}, lastErr
+	}
+	return result, nil
+}
+
+func (m *MikroTikConnector) fetchRouter(ctx context.Context, host string, retries int) (uiSPDeviceRecord, int, error) {
+	auth := m.authProvider()
+	pages := 0
+	get := func(path string, optional bool) (any, error) {
+		attempts := retries
+		if optional {
+			attempts = 0
+		}
+		body, _, err := fetchPageBody(ctx, m.client, host+"/rest"+path, attempts, m.source, auth, m.guard, nil)
+		if err != nil {
+			if optional && !errors.Is(err, ErrSourceCircuitOpen) && !errors.Is(err, ErrSourceBudgetExhaust) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		pages++
+		var payload any
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("mikrotik %s invalid json: %w", path, err)
+		}
+		return payload, nil
+	}
+
+	start := time.Now()
+	identity, err := get("/system/identity", false)
+	if err != nil {
+		return uiSPDeviceRecord{}, pages, err
+	}
+	latency := float64(time.Since(start).Milliseconds())
+	resource, err := get("/system/resource", false)
+	if err != nil {
+		return uiSPDeviceRecord{}, pages, err
+	}
+	// CHR and x86 installs have no routerboard; neighbors can be disabled.
+	routerboard, _ := get("/system/routerboard", true)
+	interfaces, err := get("/interface", false)
+	if err != nil {
+		return uiSPDeviceRecord{}, pages, err
+	}
+	neighbors, _ := get("/ip/neighbor", true)
+
+	identityMap, _ := identity.(map[string]any)
+	resourceMap, _ := resource.(map[string]any)
+	routerboardMap, _ := routerboard.(map[string]any)
+	ifaceItems, _ := interfaces.([]any)
+	neighborItems, _ := neighbors.([]any)
+
+	label := mikroTikHostLabel(host)
+	return uiSPDeviceRecord{
+		ID:      label,
+		Name:    firstNonEmpty(pickString(identityMap, []string{"name"}), label),
+		Role:    m.role,
+		SiteID:  m.siteID,
+		Host:    label,
+		Mac:     mikroTikPrimaryMac(ifaceItems),
+		Serial:  pickString(routerboardMap, []string{"serial-number"}),
+		Model:   firstNonEmpty(pickString(routerboardMap, []string{"model"}), pickString(resourceMap, []string{"board-name"})),
+		Vendor:  "MikroTik",
+		Online:  true,
+		Latency: &latency,
+		Metrics: mikroTikHealthMetrics(resourceMap),
+		Ifaces:  m.parseInterfaces(host, ifaceItems),
+		Neighs:  parseMikroTikNeighbors(neighborItems),
+	}, pages, nil
+}
+
+func (m *MikroTikConnector) parseInterfaces(host string, items []any) []TelemetryInterfaceFact {
+	now := m.now()
+	out := make([]TelemetryInterfaceFact, 0, len(items))
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	for _, raw := range items {
+		item, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		name := pickString(item, []string{"name"})
+		if name == "" {
+			continue
+		}
+		fact := TelemetryInterfaceFact{Name: name, OperUp: pickBool(item, []string{"running"})}
+		if disabled := pickBool(item, []string{"disabled"}); disabled != nil {
+			adminUp := !*disabled
+			fact.AdminUp = &adminUp
+		}
+
+		sample := mikroTikCounter{sampledAt: now}
+		sample.rxBytes = mikroTikNumber(item, "rx-byte")
+		sample.txBytes = mikroTikNumber(item, "tx-byte")
+		sample.packets = mikroTikNumber(item, "rx-packet") + mikroTikNumber(item, "tx-packet")
+		sample.errors = mikroTikNumber(item, "rx-error") + mikroTikNumber(item, "tx-error")
+		key := host + "|" + name
+		if prev, ok := m.counters[key]; ok {
+			elapsed := now.Sub(prev.sampledAt).Seconds()
+			// Counters reset on reboot or interface reset; skip that sample.
+			if elapsed > 0 && sample.rxBytes >= prev.rxBytes && sample.txBytes >= prev.txBytes {
+				rx := (sample.rxBytes - prev.rxBytes) * 8 / elapsed
+				tx := (sample.txBytes - prev.txBytes) * 8 / elapsed
+				fact.RxBps, fact.TxBps = &rx, &tx
+				if packets := sample.packets - prev.packets; packets > 0 && sample.errors >= prev.errors {
+					rate := (sample.errors - prev.errors) / packets
+					fact.ErrorRate = &rate
+				}
+			}
+		}
+		m.counters[key] = sample
+		out = append(out, fact)
+	}
+	return out
+}
+
+func parseMikroTikNeighbors(items []any) []TelemetryNeighborFact {
+	out := make([]TelemetryNeighborFact, 0, len(items))
+	for _, raw := range items {
+		item, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		// v7 lists every bridge member the neighbor was heard on.
+		local, _, _ := strings.Cut(pickString(item, []string{"interface"}), ",")
+		mac := strings.ToLower(pickString(item, []string{"mac-address"}))
+		identity := pickString(item, []string{"identity"})
+		if mac == "" && identity == "" {
+			continue
+		}
+		protocol, _, _ := strings.Cut(pickString(item, []string{"discovered-by"}), ",")
+		out = append(out, TelemetryNeighborFact{
+			LocalInterface:       local,
+			NeighborIdentityHint: firstNonEmpty(mac, identity),
+			NeighborDeviceName:   identity,
+			NeighborInterface:    pickString(item, []string{"interface-name"}),
+			Protocol:             firstNonEmpty(protocol, "mndp"),
+		})
+	}
+	return out
+}
+
+// mikroTikPrimaryMac picks the first ethernet MAC, which RouterOS uses as
+// the chassis address in neighbor discovery.
+func mikroTikPrimaryMac(items []any) string {
+	for _, raw := range items {
+		item, ok := raw.(map[string]any)
+		if !ok || pickString(item, []string{"type"}) != "ether" {
+			continue
+		}
+		if mac := pickString(item, []string{"mac-address"}); mac != "" {
+			return strings.ToLower(mac)
+		}
+	}
+	return ""
+}
+
+// mikroTikNumber reads RouterOS counters, which the REST API returns as
+// strings.
+func mikroTikNumber(item map[string]any, key string) float64 {
+	if v := pickFloat(item, []string{key}); v != nil {
+		return *v
+	}
+	return 0
+}
+
+// mikroTikHealthMetrics reads /system/resource. Memory is reported as free
+// and total bytes, uptime as a RouterOS duration.
+func mikroTikHealthMetrics(resource map[string]any) *TelemetryMetrics {
+	m := &TelemetryMetrics{CPUPct: pickFloat(resource, []string{"cpu-load"})}
+	if total := mikroTikNumber(resource, "total-memory"); total > 0 {
+		used := (total - mikroTikNumber(resource, "free-memory")) / total * 100
+		m.MemPct = &used
+	}
+	if uptime, ok := parseRouterOSDuration(pickString(resource, []string{"uptime"})); ok {
+		m.UptimeS = &uptime
+	}
+	return normalizeTelemetryMetrics(m)
+}
+
+// parseRouterOSDuration parses durations like "1w2d3h4m5s" and the older
+// "2d03:04:05" form into whole seconds.
+func parseRouterOSDuration(raw string) (int64, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, false
+	}
+	var total int64
+	if strings.Contains(raw, ":") {
+		cut := strings.LastIndexAny(raw, "wd") + 1
+		parts := strings.Split(raw[cut:], ":")
+		if len(parts) != 3 {
+			return 0, false
+		}
+		for _, part := range parts {
+			v, err := strconv.ParseInt(part, 10, 64)
+			if err != nil || v < 0 {
+				return 0, false
+			}
+			total = total*60 + v
+		}
+		raw = raw[:cut]
+	}
+	units := map[string]int64{"w": 7 * 86400, "d": 86400, "h": 3600, "m": 60, "s": 1, "ms": 0}
+	for raw != "" {
+		i := 0
+		for i < len(raw) && raw[i] >= '0' && raw[i] <= '9' {
+			i++
+		}
+		j := i
+		for j < len(raw) && (raw[j] < '0' || raw[j] > '9') {
+			j++
+		}
+		n, err := strconv.ParseInt(raw[:i], 10, 64)
+		scale, ok := units[raw[i:j]]
+		if err != nil || !ok {
+			return 0, false
+		}
+		total += n * scale
+		raw = raw[j:]
+	}
+	return total, true
+}
+
+func mikroTikHostLabel(host string) string {
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	host, _, _ = strings.Cut(host, "/")
+	return host
+}
+
+func parseMikroTikHosts(raw string) []string {
+	parts := strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' })
+	hosts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			hosts = append(hosts, part)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRouterOSStandIn(t *testing.T, identity, serial, mac string, rxBytes *int, neighbors string) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "api" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/rest/system/identity":
+			fmt.Fprintf(w, `{"name":%q}`, identity)
+		case "/rest/system/resource":
+			_, _ = w.Write([]byte(`{"board-name":"CCR2004-16G-2S+","version":"7.14.3 (stable)","uptime":"3d4h","cpu-load":"4","free-memory":"805306368","total-memory":"1073741824"}`))
+		case "/rest/system/routerboard":
+			if serial == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"routerboard":"true","model":"CCR2004-16G-2S+","serial-number":%q}`, serial)
+		case "/rest/interface":
+			fmt.Fprintf(w, `[
+				{".id":"*1","name":"ether1","type":"ether","mac-address":%q,"running":"true","disabled":"false","rx-byte":"%d","tx-byte":"2000","rx-packet":"1000","tx-packet":"1000","rx-error":"0","tx-error":"0"},
+				{".id":"*2","name":"ether2","type":"ether","mac-address":"48:A9:8A:00:00:99","running":"false","disabled":"true","rx-byte":"0","tx-byte":"0"}
+			]`, mac, *rxBytes)
+		case "/rest/ip/neighbor":
+			_, _ = w.Write([]byte(neighbors))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestMikroTikConnectorMapsRoutersIntoTopology(t *testing.T) {
+	edgeRx, coreRx := 1000, 5000
+	core := newRouterOSStandIn(t, "core-rtr", "HE1234", "48:A9:8A:00:00:01", &coreRx, `[]`)
+	defer core.Close()
+	edge := newRouterOSStandIn(t, "edge-rtr", "", "48:A9:8A:00:00:02", &edgeRx,
+		`[{".id":"*1","interface":"ether1,bridge","mac-address":"48:A9:8A:00:00:01","identity":"core-rtr","interface-name":"ether5","platform":"MikroTik","discovered-by":"lldp,mndp"}]`)
+	defer edge.Close()
+
+	connector := NewMikroTikConnector(MikroTikConfig{Hosts: []string{core.URL, edge.URL}, Username: "api", Password: "secret", SiteID: "pop-1"})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	connector.now = func() time.Time { return now }
+
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10, FullSync: true, Cursor: "c1"})
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if batch.Response.Demo || len(batch.Events) != 2 || !batch.Complete {
+		t.Fatalf("expected two live router events, got demo=%v events=%#v", batch.Response.Demo, batch.Events)
+	}
+	coreEvent, edgeEvent := batch.Events[0], batch.Events[1]
+	if coreEvent.Device != "core-rtr" || coreEvent.Serial != "HE1234" || coreEvent.Mac != "48:a9:8a:00:00:01" || coreEvent.SiteID != "pop-1" || coreEvent.Role != "router" {
+		t.Fatalf("unexpected core mapping: %#v", coreEvent)
+	}
+	if m := coreEvent.Metrics; m == nil || *m.CPUPct != 4 || *m.MemPct != 25 || *m.UptimeS != 273600 {
+		t.Fatalf("unexpected resource metrics: %#v", m)
+	}
+	if edgeEvent.Model != "CCR2004-16G-2S+" || edgeEvent.Serial != "" {
+		t.Fatalf("expected resource board name without routerboard serial, got=%#v", edgeEvent)
+	}
+	if len(edgeEvent.Interfaces) != 2 || *edgeEvent.Interfaces[0].OperUp != true || *edgeEvent.Interfaces[1].AdminUp != false {
+		t.Fatalf("unexpected interface facts: %#v", edgeEvent.Interfaces)
+	}
+	if edgeEvent.Interfaces[0].RxBps != nil {
+		t.Fatalf("expected no rate on first counter sample")
+	}
+	if len(edgeEvent.Neighbors) != 1 || edgeEvent.Neighbors[0].LocalInterface != "ether1" || edgeEvent.Neighbors[0].NeighborInterface != "ether5" || edgeEvent.Neighbors[0].Protocol != "lldp" {
+		t.Fatalf("unexpected neighbor facts: %#v", edgeEvent.Neighbors)
+	}
+
+	store := LoadStore("")
+	ingestSourceEvents(store, batch.Events)
+	coreIdent := findIdentityByPrimary(t, store, coreEvent.DeviceID)
+	edgeIdent := findIdentityByPrimary(t, store, edgeEvent.DeviceID)
+	edges, _, _ := store.ListTopologyEdges(50, edgeIdent.IdentityID)
+	resolved := false
+	for _, e := range edges {
+		resolved = resolved || (e.Resolved && e.ToNodeID == topologyNodeIDForIdentity(coreIdent.IdentityID))
+	}
+	if !resolved {
+		t.Fatalf("expected edge router to resolve its LLDP neighbor, edges=%#v", edges)
+	}
+
+	edgeRx = 1000 + 125000
+	now = now.Add(10 * time.Second)
+	batch, err = connector.Poll(context.Background(), SourcePollRequest{Limit: 10, FullSync: true, Cursor: "c2"})
+	if err != nil {
+		t.Fatalf("second poll: %v", err)
+	}
+	if rx := batch.Events[1].Interfaces[0].RxBps; rx == nil || *rx != 100000 {
+		t.Fatalf("expected 100 kbps from counter delta, got=%v", rx)
+	}
+}
+
+func TestMikroTikConnectorReportsUnreachableRouterOffline(t *testing.T) {
+	rx := 0
+	up := newRouterOSStandIn(t, "up-rtr", "", "48:A9:8A:00:00:03", &rx, `[]`)
+	defer up.Close()
+	down := newRouterOSStandIn(t, "down-rtr", "", "48:A9:8A:00:00:04", &rx, `[]`)
+	downURL := down.URL
+	connector := NewMikroTikConnector(MikroTikConfig{Hosts: []string{up.URL, downURL}, Username: "api", Password: "secret"})
+
+	if _, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); err != nil {
+		t.Fatalf("first poll: %v", err)
+	}
+	down.Close()
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("expected partial outage not to fail the poll, got=%v", err)
+	}
+	if len(batch.Events) != 1 || batch.Events[0].EventType != "device_down" || batch.Events[0].Device != "down-rtr" {
+		t.Fatalf("expected device_down for unreachable router with last known name, got=%#v", batch.Events)
+	}
+
+	up.Close()
+	if _, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); err == nil {
+		t.Fatalf("expected poll to fail when no router answers")
+	}
+}
+
+func TestMikroTikConnectorPollsRoutersWithBoundedConcurrency(t *testing.T) {
+	var (
+		mu                  sync.Mutex
+		inFlight, maxFlight int
+	)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/system/identity" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		mu.Lock()
+		inFlight++
+		maxFlight = max(maxFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(30 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		fmt.Fprintf(w, `{"name":%q}`, r.Host)
+	}
+	hosts := make([]string, 0, 6)
+	for i := 0; i < 6; i++ {
+		server := httptest.NewServer(http.HandlerFunc(handler))
+		defer server.Close()
+		hosts = append(hosts, server.URL)
+	}
+
+	connector := NewMikroTikConnector(MikroTikConfig{Hosts: hosts, Username: "api", Password: "secret", Concurrency: 2})
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10, FullSync: true})
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(batch.Events) != len(hosts) {
+		t.Fatalf("expected one event per router, got=%d", len(batch.Events))
+	}
+	for i, event := range batch.Events {
+		if event.DeviceID != mikroTikHostLabel(hosts[i]) {
+			t.Fatalf("expected events in host order, got %q at %d", event.DeviceID, i)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxFlight != 2 {
+		t.Fatalf("expected routers polled two at a time, max in flight=%d", maxFlight)
+	}
+
+	if err := NewMikroTikConnector(MikroTikConfig{Hosts: hosts, CAFile: "/nonexistent/ca.pem"}).ConfigError(); !errors.Is(err, ErrConnectorTLSConfig) {
+		t.Fatalf("expected unreadable CA bundle to be a config error, got=%v", err)
+	}
+}
+
+func TestParseRouterOSDuration(t *testing.T) {
+	for raw, want := range map[string]int64{"3d4h": 273600, "1w2d3h4m5s": 788645, "45s": 45, "2d03:04:05": 183845, "00:00:09": 9, "5m30s120ms": 330} {
+		if got, ok := parseRouterOSDuration(raw); !ok || got != want {
+			t.Fatalf("parseRouterOSDuration(%q) = %d, %v; want %d", raw, got, ok, want)
+		}
+	}
+	for _, raw := range []string{"", "3x", "d", "4h5", "1:2"} {
+		if _, ok := parseRouterOSDuration(raw); ok {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
@@ -13,20 +13,30 @@ type MobileConfig struct {
 }
 
 type Device struct {
-	ID        string   `json:"id"`
-	Name      string   `json:"name"`
-	Role      string   `json:"role"`
-	SiteID    string   `json:"site_id"`
-	Online    bool     `json:"online"`
-	LatencyMs *float64 `json:"latency_ms"`
-	AckUntil  *int64   `json:"ack_until"`
-	Source    string   `json:"source,omitempty"`
-	LastSeen  int64    `json:"last_seen,omitempty"`
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Role      string            `json:"role"`
+	SiteID    string            `json:"site_id"`
+	Online    bool              `json:"online"`
+	LatencyMs *float64          `json:"latency_ms"`
+	Metrics   *TelemetryMetrics `json:"metrics,omitempty"`
+	AckUntil  *int64            `json:"ack_until"`
+	Source    string            `json:"source,omitempty"`
+	LastSeen  int64             `json:"last_seen,omitempty"`
+	// BootedAtMs is the boot time implied by the last reported uptime.
+	BootedAtMs int64 `json:"booted_at_ms,omitempty"`
+
+	Lifecycle          string `json:"lifecycle,omitempty"` // "" active | removed_from_source | decommissioned
+	MissingSinceMs     int64  `json:"missing_since_ms,omitempty"`
+	RemovedAt          string `json:"removed_at,omitempty"`
+	DecommissionedAt   string `json:"decommissioned_at,omitempty"`
+	DecommissionReason string `json:"decommission_reason,omitempty"`
 }
 
 type Incident struct {
 	ID                    string                  `json:"id"`
 	DeviceID              string                  `json:"device_id"`
+	SiteID                string                  `json:"site_id,omitempty"`
 	Type                  string                  `json:"type"`
 	Severity              string                  `json:"severity"`
 	Started               string                  `json:"started_at"`
@@ -34,6 +44,9 @@ type Incident struct {
 	AckUntil              *string                 `json:"ack_until"`
 	Message               string                  `json:"message,omitempty"`
 	Source                string                  `json:"source,omitempty"`
+	ExternalID            string                  `json:"external_id,omitempty"`
+	AffectedSubscribers   int                     `json:"affected_subscribers,omitempty"`
+	AffectedPaying        int                     `json:"affected_paying_subscribers,omitempty"`
 	Commander             string                  `json:"commander,omitempty"`
 	CommanderAssignedAt   *string                 `json:"commander_assigned_at,omitempty"`
 	CommandTimeline       []IncidentTimelineEntry `json:"command_timeline,omitempty"`
@@ -47,6 +60,7 @@ type IncidentTimelineEntry struct {
 	At         string `json:"at"`
 	Actor      string `json:"actor,omitempty"`
 	Message    string `json:"message"`
+	URL        string `json:"url,omitempty"`
 }
 
 type IncidentCommanderDelta struct {
@@ -106,6 +120,8 @@ type AgentRegisterRequest struct {
 type TelemetryIngestRequest struct {
 	Source       string                   `json:"source,omitempty"`
 	AgentID      string                   `json:"agent_id,omitempty"`
+	Seq          int64                    `json:"seq,omitempty"`
+	Epoch        string                   `json:"epoch,omitempty"`
 	EventType    string                   `json:"event_type,omitempty"`
 	ObservedAt   string                   `json:"observed_at,omitempty"`
 	ObservedAtMs int64                    `json:"observed_at_ms,omitempty"`
@@ -121,10 +137,42 @@ type TelemetryIngestRequest struct {
 	Online       *bool                    `json:"online,omitempty"`
 	LatencyMs    *float64                 `json:"latency_ms,omitempty"`
 	Message      string                   `json:"message,omitempty"`
+	Metrics      *TelemetryMetrics        `json:"metrics,omitempty"`
+	Wireless     *TelemetryWirelessFact   `json:"wireless,omitempty"`
 	Interfaces   []TelemetryInterfaceFact `json:"interfaces,omitempty"`
 	Neighbors    []TelemetryNeighborFact  `json:"neighbors,omitempty"`
 }
 
+// TelemetryMetrics carries device health gauges. CPU and memory are percent
+// used, temperature is degrees Celsius and uptime is seconds since boot;
+// Gauges holds any other named value.
+type TelemetryMetrics struct {
+	CPUPct  *float64           `json:"cpu_pct,omitempty"`
+	MemPct  *float64           `json:"mem_pct,omitempty"`
+	TempC   *float64           `json:"temp_c,omitempty"`
+	UptimeS *int64             `json:"uptime_s,omitempty"`
+	Gauges  map[string]float64 `json:"gauges,omitempty"`
+}
+
+// TelemetryWirelessFact is a radio's view of its wireless link. A station
+// names the AP it is associated with. Signal and noise are dBm, capacity is
+// bits per second and distance is metres.
+type TelemetryWirelessFact struct {
+	Mode                string   `json:"mode,omitempty"`
+	Technology          string   `json:"technology,omitempty"`
+	APDeviceID          string   `json:"ap_device_id,omitempty"`
+	APName              string   `json:"ap_name,omitempty"`
+	SSID                string   `json:"ssid,omitempty"`
+	FrequencyMHz        *float64 `json:"frequency_mhz,omitempty"`
+	SignalDbm           *float64 `json:"signal_dbm,omitempty"`
+	RemoteSignalDbm     *float64 `json:"remote_signal_dbm,omitempty"`
+	NoiseDbm            *float64 `json:"noise_dbm,omitempty"`
+	CCQPct              *float64 `json:"ccq_pct,omitempty"`
+	DownlinkCapacityBps *float64 `json:"downlink_capacity_bps,omitempty"`
+	UplinkCapacityBps   *float64 `json:"uplink_capacity_bps,omitempty"`
+	DistanceM           *float64 `json:"distance_m,omitempty"`
+}
+
 type TelemetryInterfaceFact struct {
 	Name      string   `json:"name"`
 	AdminUp   *bool    `json:"admin_up,omitempty"`
@@ -157,6 +205,13 @@ type DeviceIdentity struct {
 	LastSeen        int64    `json:"last_seen"`
 	CreatedAt       string   `json:"created_at"`
 	UpdatedAt       string   `json:"updated_at"`
+	RetiredAt       string   `json:"retired_at,omitempty"`
+	// Authority names the inventory system that owns role, site and serial;
+	// live observations no longer overwrite them.
+	Authority string `json:"authority,omitempty"`
+	NetBoxID  int    `json:"netbox_id,omitempty"`
+	Platform  string `json:"platform,omitempty"`
+	PrimaryIP string `json:"primary_ip,omitempty"`
 }
 
 type DeviceInterface struct {
@@ -308,27 +363,35 @@ type TelemetryGovernorStatus struct {
 }
 
 type TelemetrySourceQualityStats struct {
-	Source                  string  `json:"source"`
-	LastPollAtMs            int64   `json:"last_poll_at_ms,omitempty"`
-	LastIngestAtMs          int64   `json:"last_ingest_at_ms,omitempty"`
-	LastPollError           string  `json:"last_poll_error,omitempty"`
-	PollAttempts            int64   `json:"poll_attempts"`
-	PollFailures            int64   `json:"poll_failures"`
-	ConsecutivePollFailures int64   `json:"consecutive_poll_failures"`
-	AcceptedSamples         int64   `json:"accepted_samples"`
-	DroppedSamples          int64   `json:"dropped_samples"`
-	TotalSamples            int64   `json:"total_samples"`
-	CompleteSamples         int64   `json:"complete_samples"`
-	MissingRoleSamples      int64   `json:"missing_role_samples"`
-	MissingSiteSamples      int64   `json:"missing_site_samples"`
-	MissingOnlineSamples    int64   `json:"missing_online_samples"`
-	LowConfidenceSamples    int64   `json:"low_confidence_samples"`
-	TimestampCorrectedCount int64   `json:"timestamp_corrected_count"`
-	ClockSkewViolationCount int64   `json:"clock_skew_violation_count"`
-	SumAbsClockSkewMs       int64   `json:"sum_abs_clock_skew_ms"`
-	MaxAbsClockSkewMs       int64   `json:"max_abs_clock_skew_ms"`
-	CompletenessScoreSum    float64 `json:"completeness_score_sum"`
-	UpdatedAtMs             int64   `json:"updated_at_ms,omitempty"`
+	Source                  string   `json:"source"`
+	LastPollAtMs            int64    `json:"last_poll_at_ms,omitempty"`
+	LastIngestAtMs          int64    `json:"last_ingest_at_ms,omitempty"`
+	LastPollError           string   `json:"last_poll_error,omitempty"`
+	PollAttempts            int64    `json:"poll_attempts"`
+	PollFailures            int64    `json:"poll_failures"`
+	ConsecutivePollFailures int64    `json:"consecutive_poll_failures"`
+	AcceptedSamples         int64    `json:"accepted_samples"`
+	DroppedSamples          int64    `json:"dropped_samples"`
+	DuplicateSamples        int64    `json:"duplicate_samples"`
+	ThrottledResponses      int64    `json:"throttled_responses"`
+	RateLimitedUntilMs      int64    `json:"rate_limited_until_ms,omitempty"`
+	BreakerState            string   `json:"breaker_state,omitempty"`
+	BreakerOpenCount        int64    `json:"breaker_open_count"`
+	PollIntervalSec         int      `json:"poll_interval_sec,omitempty"`
+	TotalSamples            int64    `json:"total_samples"`
+	CompleteSamples         int64    `json:"complete_samples"`
+	MissingRoleSamples      int64    `json:"missing_role_samples"`
+	MissingSiteSamples      int64    `json:"missing_site_samples"`
+	MissingOnlineSamples    int64    `json:"missing_online_samples"`
+	LowConfidenceSamples    int64    `json:"low_confidence_samples"`
+	TimestampCorrectedCount int64    `json:"timestamp_corrected_count"`
+	ClockSkewViolationCount int64    `json:"clock_skew_violation_count"`
+	SumAbsClockSkewMs       int64    `json:"sum_abs_clock_skew_ms"`
+	MaxAbsClockSkewMs       int64    `json:"max_abs_clock_skew_ms"`
+	CompletenessScoreSum    float64  `json:"completeness_score_sum"`
+	UnmappedMetricPoints    int64    `json:"unmapped_metric_points,omitempty"`
+	UnmappedMetricNames     []string `json:"unmapped_metric_names,omitempty"`
+	UpdatedAtMs             int64    `json:"updated_at_ms,omitempty"`
 }
 
 type TelemetrySourceQualityScorecard struct {
@@ -355,6 +418,9 @@ type TelemetryIngestionHealth struct {
 	PollFailures       int64 `json:"poll_failures"`
 	AcceptedSamples    int64 `json:"accepted_samples"`
 	DroppedSamples     int64 `json:"dropped_samples"`
+	// UnmappedMetricPoints counts pushed metric points (OTLP and similar
+	// receivers) that matched no mapping rule and were discarded.
+	UnmappedMetricPoints int64 `json:"unmapped_metric_points"`
 }
 
 type TelemetryQualityResponse struct {
@@ -473,6 +539,7 @@ type LifecycleScore struct {
 	Score      int      `json:"score"`
 	Level      string   `json:"level"`
 	Reasons    []string `json:"reasons,omitempty"`
+	Reboots7d  int      `json:"reboots_7d,omitempty"`
 }
 
 type InventoryLifecycleResponse struct {
@@ -507,6 +574,7 @@ type TopologyEdge struct {
 	Source             string `json:"source,omitempty"`
 	UpdatedAt          string `json:"updated_at,omitempty"`
 	Resolved           bool   `json:"resolved"`
+	LinkStatus         string `json:"link_status,omitempty"`
 }
 
 type TopologyHealth struct {
@@ -633,30 +701,41 @@ type EventIngestRequest struct {
 }
 
 type TelemetryIngestResponse struct {
-	Accepted bool      `json:"accepted"`
-	Device   Device    `json:"device"`
-	Incident *Incident `json:"incident,omitempty"`
-	Stub     bool      `json:"stub"`
+	Accepted bool                `json:"accepted"`
+	Device   Device              `json:"device"`
+	Incident *Incident           `json:"incident,omitempty"`
+	Ack      *TelemetryIngestAck `json:"ack,omitempty"`
+	Stub     bool                `json:"stub"`
 }
 
 type SourcePollRequest struct {
-	Cursor  string `json:"cursor,omitempty"`
-	Limit   int    `json:"limit,omitempty"`
-	Demo    bool   `json:"demo,omitempty"`
-	Retries int    `json:"retries,omitempty"`
+	Cursor   string `json:"cursor,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+	Demo     bool   `json:"demo,omitempty"`
+	Retries  int    `json:"retries,omitempty"`
+	FullSync bool   `json:"full_sync,omitempty"`
 }
 
 type SourcePollResponse struct {
 	Source            string `json:"source"`
 	Cursor            string `json:"cursor"`
 	Fetched           int    `json:"fetched"`
+	Pages             int    `json:"pages"`
+	Truncated         bool   `json:"truncated"`
 	Normalized        int    `json:"normalized"`
 	Emitted           int    `json:"emitted"`
+	Updated           int    `json:"updated"`
+	Removed           int    `json:"removed"`
+	Restored          int    `json:"restored"`
 	Deduped           int    `json:"deduped"`
 	Ingested          int    `json:"ingested"`
 	DroppedByGovernor int    `json:"dropped_by_governor"`
 	IncidentsCreated  int    `json:"incidents_created"`
+	ProblemsActive    int    `json:"problems_active"`
+	ProblemsOpened    int    `json:"problems_opened"`
+	ProblemsResolved  int    `json:"problems_resolved"`
 	Backfill          bool   `json:"backfill"`
+	FullSync          bool   `json:"full_sync"`
 	Demo              bool   `json:"demo"`
 	DurationMs        int64  `json:"duration_ms"`
 	Stub              bool   `json:"stub"`
@@ -669,10 +748,14 @@ type SourceStatus struct {
 	LastCursor     string `json:"last_cursor,omitempty"`
 	LastError      string `json:"last_error,omitempty"`
 	LastFetched    int    `json:"last_fetched"`
+	LastPages      int    `json:"last_pages"`
+	LastTruncated  bool   `json:"last_truncated"`
 	LastNormalized int    `json:"last_normalized"`
 	LastEmitted    int    `json:"last_emitted"`
 	Demo           bool   `json:"demo"`
 	Stub           bool   `json:"stub"`
+
+	Breaker *SourceBreakerStatus `json:"breaker,omitempty"`
 }
 
 type PushRegisterRequest struct {
@@ -722,14 +805,17 @@ type IncidentChecklistAuditRequest struct {
 }
 
 type IncidentWorkspaceResponse struct {
-	LastUpdatedMs   int64      `json:"last_updated_ms"`
-	ActiveCount     int        `json:"active_count"`
-	AssignedCount   int        `json:"assigned_count"`
-	UnassignedCount int        `json:"unassigned_count"`
-	RecentCount     int        `json:"recent_count"`
-	Active          []Incident `json:"active"`
-	Recent          []Incident `json:"recent"`
-	Stub            bool       `json:"stub"`
+	LastUpdatedMs   int64 `json:"last_updated_ms"`
+	ActiveCount     int   `json:"active_count"`
+	AssignedCount   int   `json:"assigned_count"`
+	UnassignedCount int   `json:"unassigned_count"`
+	RecentCount     int   `json:"recent_count"`
+	// Distinct live subscribers affected across the active incidents.
+	AffectedSubscribers int        `json:"affected_subscribers"`
+	AffectedPaying      int        `json:"affected_paying_subscribers"`
+	Active              []Incident `json:"active"`
+	Recent              []Incident `json:"recent"`
+	Stub                bool       `json:"stub"`
 }
 
 type IncidentHandoffHistoryResponse struct {
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	mqttSource                 = "mqtt"
+	defaultMQTTClientID        = "nocwall-api"
+	defaultMQTTTopicPrefix     = "nocwall"
+	defaultMQTTSubscribeTopic  = "nocwall/telemetry/#"
+	defaultMQTTPublishInterval = 15 * time.Second
+	mqttPublishTimeout         = 10 * time.Second
+	maxMQTTPayloadBytes        = 4 << 20
+)
+
+var (
+	ErrMQTTPayload      = errors.New("invalid_mqtt_payload")
+	ErrMQTTNotConnected = errors.New("mqtt_not_connected")
+)
+
+// MQTTConfig configures the broker connection, the telemetry topics the
+// bridge subscribes to and the prefix it publishes state under.
+type MQTTConfig struct {
+	BrokerURL       string        `json:"broker_url"`
+	ClientID        string        `json:"client_id"`
+	Username        string        `json:"username,omitempty"`
+	Password        string        `json:"-"`
+	Topics          []string      `json:"topics"`
+	QoS             byte          `json:"qos"`
+	TopicPrefix     string        `json:"topic_prefix"`
+	Source          string        `json:"source"`
+	PublishInterval time.Duration `json:"-"`
+}
+
+type MQTTBridgeStatus struct {
+	Enabled         bool     `json:"enabled"`
+	Broker          string   `json:"broker,omitempty"`
+	ClientID        string   `json:"client_id,omitempty"`
+	Connected       bool     `json:"connected"`
+	Topics          []string `json:"topics"`
+	TopicPrefix     string   `json:"topic_prefix"`
+	Source          string   `json:"source"`
+	Connects        int64    `json:"connects"`
+	ConnectionLost  int64    `json:"connection_lost"`
+	Messages        int64    `json:"messages"`
+	InvalidMessages int64    `json:"invalid_messages"`
+	Samples         int64    `json:"samples"`
+	Ingested        int64    `json:"ingested"`
+	Duplicates      int64    `json:"duplicates"`
+	Dropped         int64    `json:"dropped"`
+	Published       int64    `json:"published"`
+	PublishErrors   int64    `json:"publish_errors"`
+	RetainedDevices int      `json:"retained_devices"`
+	OpenIncidents   int      `json:"open_incidents"`
+	LastMessageAt   string   `json:"last_message_at,omitempty"`
+	LastPublishAt   string   `json:"last_publish_at,omitempty"`
+	LastError       string   `json:"last_error,omitempty"`
+	Stub            bool     `json:"stub"`
+}
+
+// MQTTDeviceStatus is the retained payload under <prefix>/devices/<id>/status.
+type MQTTDeviceStatus struct {
+	DeviceID  string   `json:"device_id"`
+	Name      string   `json:"name"`
+	Role      string   `json:"role"`
+	SiteID    string   `json:"site_id"`
+	Online    bool     `json:"online"`
+	LatencyMs *float64 `json:"latency_ms"`
+	Source    string   `json:"source,omitempty"`
+	LastSeen  int64    `json:"last_seen,omitempty"`
+	Lifecycle string   `json:"lifecycle,omitempty"`
+	Acked     bool     `json:"acked"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// MQTTIncidentEvent is published under <prefix>/incidents/<id>. Open
+// incidents stay retained so a reconnecting subscriber sees what is active;
+// resolution is sent as a plain event and then clears the retained copy.
+type MQTTIncidentEvent struct {
+	Event    string   `json:"event"` // opened | acked | updated | resolved
+	Incident Incident `json:"incident"`
+	At       string   `json:"at"`
+}
+
+type mqttIncidentState struct {
+	key      string
+	ackUntil string
+	resolved bool
+}
+
+type mqttMessage struct {
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+// MQTTBridge ingests telemetry published by field agents and mirrors device
+// status and incident changes back to the broker.
+type MQTTBridge struct {
+	cfg    MQTTConfig
+	store  *Store
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	client    mqtt.Client
+	status    MQTTBridgeStatus
+	devices   map[string]string // device ID -> published state key
+	incidents map[string]mqttIncidentState
+	seeded    bool
+}
+
+func NewMQTTBridge(cfg MQTTConfig, store *Store, logger *slog.Logger) *MQTTBridge {
+	cfg.BrokerURL = strings.TrimSpace(cfg.BrokerURL)
+	cfg.ClientID = firstNonEmpty(cfg.ClientID, defaultMQTTClientID)
+	cfg.TopicPrefix = strings.Trim(firstNonEmpty(cfg.TopicPrefix, defaultMQTTTopicPrefix), "/")
+	cfg.Source = strings.ToLower(firstNonEmpty(cfg.Source, mqttSource))
+	cfg.Topics = trimLabelKeys(cfg.Topics)
+	if len(cfg.Topics) == 0 {
+		cfg.Topics = []string{defaultMQTTSubscribeTopic}
+	}
+	if cfg.QoS > 1 {
+		cfg.QoS = 1
+	}
+	if cfg.PublishInterval <= 0 {
+		cfg.PublishInterval = defaultMQTTPublishInterval
+	}
+	return &MQTTBridge{
+		cfg:       cfg,
+		store:     store,
+		logger:    logger,
+		devices:   map[string]string{},
+		incidents: map[string]mqttIncidentState{},
+		status: MQTTBridgeStatus{
+			Enabled:     cfg.BrokerURL != "",
+			Broker:      cfg.BrokerURL,
+			ClientID:    cfg.ClientID,
+			Topics:      cfg.Topics,
+			TopicPrefix: cfg.TopicPrefix,
+			Source:      cfg.Source,
+		},
+	}
+}
+
+func (b *MQTTBridge) Enabled() bool { return b.cfg.BrokerURL != "" }
+
+// Connect starts the client. Paho keeps retrying the first connection and
+// reconnects after drops; subscriptions are renewed in the connect handler
+// because the bridge uses a clean session.
+func (b *MQTTBridge) Connect() {
+	if !b.Enabled() {
+		return
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(b.cfg.BrokerURL).
+		SetClientID(b.cfg.ClientID).
+		SetUsername(b.cfg.Username).
+		SetPassword(b.cfg.Password).
+		SetCleanSession(true).
+		SetOrderMatters(false).
+		SetKeepAlive(30*time.Second).
+		SetConnectTimeout(10*time.Second).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5*time.Second).
+		SetMaxReconnectInterval(2*time.Minute).
+		SetWill(b.bridgeTopic(), "offline", 1, true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			b.mu.Lock()
+			b.status.Connected = false
+			b.status.ConnectionLost++
+			b.status.LastError = err.Error()
+			b.mu.Unlock()
+			b.logger.Warn("mqtt_connection_lost", "broker", b.cfg.BrokerURL, "error", err)
+		})
+	client := mqtt.NewClient(opts)
+	b.mu.Lock()
+	b.client = client
+	b.mu.Unlock()
+	// With ConnectRetry the token only completes once connected, so the
+	// caller is not blocked on an unreachable broker.
+	client.Connect()
+}
+
+func (b *MQTTBridge) onConnect(client mqtt.Client) {
+	filters := map[string]byte{}
+	for _, topic := range b.cfg.Topics {
+		filters[topic] = b.cfg.QoS
+	}
+	token := client.SubscribeMultiple(filters, func(_ mqtt.Client, msg mqtt.Message) {
+		b.HandleMessage(msg.Topic(), msg.Payload())
+	})
+	token.WaitTimeout(mqttPublishTimeout)
+	err := token.Error()
+	if err == nil {
+		client.Publish(b.bridgeTopic(), 1, true, "online")
+	}
+
+	b.mu.Lock()
+	b.status.Connected = true
+	b.status.Connects++
+	if err != nil {
+		b.status.LastError = err.Error()
+	}
+	// A fresh session republishes every retained state on the next tick
+	// in case the broker lost its retained store.
+	b.devices = map[string]string{}
+	b.mu.Unlock()
+	if err != nil {
+		b.logger.Warn("mqtt_subscribe_failed", "broker", b.cfg.BrokerURL, "topics", b.cfg.Topics, "error", err)
+		return
+	}
+	b.logger.Info("mqtt_connected", "broker", b.cfg.BrokerURL, "client_id", b.cfg.ClientID, "topics", b.cfg.Topics)
+}
+
+// Close publishes the offline marker the will would have sent and
+// disconnects.
+func (b *MQTTBridge) Close() {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	if client == nil || !client.IsConnected() {
+		return
+	}
+	client.Publish(b.bridgeTopic(), 1, true, "offline").WaitTimeout(mqttPublishTimeout)
+	client.Disconnect(250)
+}
+
+func (b *MQTTBridge) bridgeTopic() string { return b.cfg.TopicPrefix + "/bridge/status" }
+func (b *MQTTBridge) deviceTopic(id string) string {
+	return b.cfg.TopicPrefix + "/devices/" + mqttTopicSegment(id) + "/status"
+}
+func (b *MQTTBridge) incidentTopic(id string) string {
+	return b.cfg.TopicPrefix + "/incidents/" + mqttTopicSegment(id)
+}
+func (b *MQTTBridge) agentAckTopic(agentID string) string {
+	return b.cfg.TopicPrefix + "/agents/" + mqttTopicSegment(agentID) + "/ack"
+}
+
+// ownTopic reports whether topic is one the bridge publishes, so a wide
+// subscription such as nocwall/# does not feed state back in as telemetry.
+func (b *MQTTBridge) ownTopic(topic string) bool {
+	for _, level := range []string{"/bridge/", "/devices/", "/incidents/", "/agents/"} {
+		if strings.HasPrefix(topic, b.cfg.TopicPrefix+level) {
+			return true
+		}
+	}
+	return false
+}
+
+// mqttTopicSegment keeps an ID inside one topic level; wildcards and level
+// separators are not allowed in published topic names.
+func mqttTopicSegment(id string) string {
+	id = strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(strings.TrimSpace(id))
+	if id == "" {
+		return "_"
+	}
+	return id
+}
+
+// decodeMQTTTelemetry accepts a single TelemetryIngestRequest, a JSON array
+// of them, or an agent batch ({"samples": [...]}). Samples without a device
+// ID take the last topic level, so agents can publish to
+// nocwall/telemetry/<device_id>.
+func decodeMQTTTelemetry(topic string, payload []byte, source string) ([]TelemetryIngestRequest, error) {
+	if len(payload) > maxMQTTPayloadBytes {
+		return nil, fmt.Errorf("%w: payload exceeds %d bytes", ErrMQTTPayload, maxMQTTPayloadBytes)
+	}
+	trimmed := strings.TrimSpace(string(payload))
+	var samples []TelemetryIngestRequest
+	switch {
+	case strings.HasPrefix(trimmed, "["):
+		if err := json.Unmarshal([]byte(trimmed), &samples); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMQTTPayload, err)
+		}
+	case strings.HasPrefix(trimmed, "{"):
+		var envelope struct {
+			TelemetryIngestRequest
+			Samples []TelemetryIngestRequest `json:"samples"`
+		}
+		if err := json.Unmarshal([]byte(trimmed), &envelope); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMQTTPayload, err)
+		}
+		if envelope.Samples != nil {
+			for _, sample := range envelope.Samples {
+				sample.AgentID = firstNonEmpty(sample.AgentID, envelope.AgentID)
+				sample.Epoch = firstNonEmpty(sample.Epoch, envelope.Epoch)
+				samples = append(samples, sample)
+			}
+		} else {
+			samples = []TelemetryIngestRequest{envelope.TelemetryIngestRequest}
+		}
+	default:
+		return nil, fmt.Errorf("%w: expected a JSON object or array", ErrMQTTPayload)
+	}
+
+	topicDevice := ""
+	if i := strings.LastIndex(topic, "/"); i >= 0 {
+		topicDevice = strings.TrimSpace(topic[i+1:])
+	}
+	out := samples[:0]
+	for _, sample := range samples {
+		sample.DeviceID = firstNonEmpty(sample.DeviceID, topicDevice)
+		if sample.DeviceID == "" {
+			continue
+		}
+		sample.Source = strings.ToLower(firstNonEmpty(sample.Source, source))
+		out = append(out, sample)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: no sample names a device", ErrMQTTPayload)
+	}
+	return out, nil
+}
+
+// HandleMessage ingests one telemetry message. Sequenced agent samples go
+// through the agent cursor so QoS 1 redeliveries are acknowledged without
+// being applied twice; the agent's cursor is published back so it can trim
+// its local buffer.
+func (b *MQTTBridge) HandleMessage(topic string, payload []byte) {
+	if b.ownTopic(topic) {
+		return
+	}
+	now := time.Now().UTC()
+	samples, err := decodeMQTTTelemetry(topic, payload, b.cfg.Source)
+
+	b.mu.Lock()
+	b.status.Messages++
+	b.status.LastMessageAt = now.Format(time.RFC3339)
+	if err != nil {
+		b.status.InvalidMessages++
+		b.status.LastError = err.Error()
+	}
+	b.mu.Unlock()
+	if err != nil {
+		b.logger.Warn("mqtt_message_invalid", "topic", topic, "bytes", len(payload), "error", err)
+		return
+	}
+
+	var unsequenced []TelemetryIngestRequest
+	agents := map[string]bool{}
+	ingested, duplicates := 0, 0
+	for _, sample := range samples {
+		if strings.TrimSpace(sample.AgentID) == "" || sample.Seq <= 0 {
+			unsequenced = append(unsequenced, sample)
+			continue
+		}
+		_, _, ack, err := b.store.IngestAgentTelemetry(sample)
+		if err != nil {
+			continue
+		}
+		if !agentAckApplied(ack.Status) {
+			duplicates++
+		} else {
+			ingested++
+		}
+		agents[ack.AgentID] = true
+	}
+	accepted, _, dropped := ingestSourceEvents(b.store, unsequenced)
+	ingested += accepted
+
+	for agentID := range agents {
+		if cursor, ok := b.store.GetAgentIngestCursor(agentID); ok {
+			body, _ := json.Marshal(cursor)
+			b.publish([]mqttMessage{{topic: b.agentAckTopic(agentID), payload: body}})
+		}
+	}
+
+	b.mu.Lock()
+	b.status.Samples += int64(len(samples))
+	b.status.Ingested += int64(ingested)
+	b.status.Duplicates += int64(duplicates)
+	b.status.Dropped += int64(dropped)
+	b.mu.Unlock()
+	b.logger.Debug("mqtt_telemetry_ingested", "topic", topic, "samples", len(samples), "ingested", ingested, "duplicates", duplicates, "dropped", dropped)
+}
+
+// stateMessages diffs devices and incidents against what was last
+// published. The first pass only records incidents that are already
+// resolved, so a restart does not replay old resolutions.
+func (b *MQTTBridge) stateMessages(devices []Device, incidents []Incident, now time.Time) []mqttMessage {
+	nowISO := now.UTC().Format(time.RFC3339)
+	acked := map[string]bool{}
+	for _, inc := range incidents {
+		if inc.Resolved == nil && incidentAcked(inc, now) {
+			acked[inc.DeviceID] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []mqttMessage
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	seen := map[string]bool{}
+	for _, d := range devices {
+		seen[d.ID] = true
+		latency := ""
+		if d.LatencyMs != nil {
+			latency = fmt.Sprintf("%.0f", *d.LatencyMs)
+		}
+		// Latency is rounded so jitter alone does not rewrite retained state.
+		key := strings.Join([]string{d.Name, d.Role, d.SiteID, fmt.Sprint(d.Online), latency, d.Lifecycle, fmt.Sprint(acked[d.ID])}, "|")
+		if b.devices[d.ID] == key {
+			continue
+		}
+		body, _ := json.Marshal(MQTTDeviceStatus{
+			DeviceID: d.ID, Name: d.Name, Role: d.Role, SiteID: d.SiteID, Online: d.Online, LatencyMs: d.LatencyMs,
+			Source: d.Source, LastSeen: d.LastSeen, Lifecycle: d.Lifecycle, Acked: acked[d.ID], UpdatedAt: nowISO,
+		})
+		out = append(out, mqttMessage{topic: b.deviceTopic(d.ID), payload: body, retained: true})
+		b.devices[d.ID] = key
+	}
+	for id := range b.devices {
+		if !seen[id] {
+			// An empty retained payload deletes the retained message.
+			out = append(out, mqttMessage{topic: b.deviceTopic(id), payload: []byte{}, retained: true})
+			delete(b.devices, id)
+		}
+	}
+
+	sort.Slice(incidents, func(i, j int) bool { return incidents[i].Started < incidents[j].Started })
+	current := map[string]bool{}
+	for _, inc := range incidents {
+		current[inc.ID] = true
+		prev, known := b.incidents[inc.ID]
+		if inc.Resolved != nil {
+			if known && !prev.resolved {
+				body, _ := json.Marshal(MQTTIncidentEvent{Event: "resolved", Incident: inc, At: nowISO})
+				out = append(out,
+					mqttMessage{topic: b.incidentTopic(inc.ID), payload: body},
+					mqttMessage{topic: b.incidentTopic(inc.ID), payload: []byte{}, retained: true})
+			}
+			if known || !b.seeded {
+				b.incidents[inc.ID] = mqttIncidentState{resolved: true}
+			}
+			continue
+		}
+		state := mqttIncidentState{}
+		if incidentAcked(inc, now) {
+			state.ackUntil = *inc.AckUntil
+		}
+		state.key = strings.Join([]string{inc.Severity, inc.Message, state.ackUntil, inc.Commander}, "|")
+		if known && prev == state {
+			continue
+		}
+		event := "updated"
+		switch {
+		case !known || prev.resolved:
+			event = "opened"
+		case state.ackUntil != "" && state.ackUntil != prev.ackUntil:
+			event = "acked"
+		}
+		body, _ := json.Marshal(MQTTIncidentEvent{Event: event, Incident: inc, At: nowISO})
+		out = append(out, mqttMessage{topic: b.incidentTopic(inc.ID), payload: body, retained: true})
+		b.incidents[inc.ID] = state
+	}
+	for id := range b.incidents {
+		if !current[id] {
+			delete(b.incidents, id)
+		}
+	}
+	b.seeded = true
+
+	b.status.RetainedDevices = len(b.devices)
+	b.status.OpenIncidents = 0
+	for _, state := range b.incidents {
+		if !state.resolved {
+			b.status.OpenIncidents++
+		}
+	}
+	return out
+}
+
+func incidentAcked(inc Incident, now time.Time) bool {
+	if inc.AckUntil == nil {
+		return false
+	}
+	until, err := time.Parse(time.RFC3339, *inc.AckUntil)
+	return err == nil && until.After(now)
+}
+
+// PublishState publishes changed device status and incident events. Nothing
+// is diffed while disconnected, so changes made offline go out on the first
+// tick after reconnecting. A failed publish puts incident state back as it
+// was, so the next tick sends the same events again.
+func (b *MQTTBridge) PublishState(now time.Time) (int, error) {
+	b.mu.Lock()
+	client := b.client
+	incidents := make(map[string]mqttIncidentState, len(b.incidents))
+	for id, state := range b.incidents {
+		incidents[id] = state
+	}
+	seeded := b.seeded
+	b.mu.Unlock()
+	if client == nil || !client.IsConnectionOpen() {
+		return 0, ErrMQTTNotConnected
+	}
+	messages := b.stateMessages(b.store.ListDevices(), b.store.ListIncidents(), now)
+	published, err := b.publish(messages)
+	if err != nil {
+		b.mu.Lock()
+		b.incidents, b.seeded = incidents, seeded
+		b.mu.Unlock()
+	}
+	return published, err
+}
+
+func (b *MQTTBridge) publish(messages []mqttMessage) (int, error) {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	if client == nil {
+		return 0, ErrMQTTNotConnected
+	}
+	published := 0
+	var lastErr error
+	for _, msg := range messages {
+		token := client.Publish(msg.topic, b.cfg.QoS, msg.retained, msg.payload)
+		if !token.WaitTimeout(mqttPublishTimeout) {
+			lastErr = fmt.Errorf("publish %s: timed out", msg.topic)
+		} else if err := token.Error(); err != nil {
+			lastErr = fmt.Errorf("publish %s: %w", msg.topic, err)
+		} else {
+			published++
+		}
+	}
+
+	b.mu.Lock()
+	b.status.Published += int64(published)
+	if lastErr != nil {
+		b.status.PublishErrors += int64(len(messages) - published)
+		b.status.LastError = lastErr.Error()
+		// Forget published state so the next tick retries everything.
+		b.devices = map[string]string{}
+	}
+	if published > 0 {
+		b.status.LastPublishAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	b.mu.Unlock()
+	return published, lastErr
+}
+
+func (b *MQTTBridge) Status() MQTTBridgeStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := b.status
+	out.Topics = append([]string(nil), b.status.Topics...)
+	if b.client != nil {
+		out.Connected = b.client.IsConnectionOpen()
+	}
+	out.Stub = true
+	return out
+}
+
+func runMQTTBridge(ctx context.Context, bridge *MQTTBridge, logger *slog.Logger) {
+	bridge.Connect()
+	logger.Info("mqtt_bridge_started", "broker", bridge.cfg.BrokerURL, "topics", bridge.cfg.Topics, "topic_prefix", bridge.cfg.TopicPrefix, "publish_interval_sec", int(bridge.cfg.PublishInterval.Seconds()))
+	ticker := time.NewTicker(bridge.cfg.PublishInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			bridge.Close()
+			return
+		case <-ticker.C:
+			published, err := bridge.PublishState(time.Now())
+			if err != nil && !errors.Is(err, ErrMQTTNotConnected) {
+				logger.Warn("mqtt_publish_failed", "published", published, "error", err)
+			} else if published > 0 {
+				logger.Info("mqtt_state_published", "messages", published)
+			}
+		}
+	}
+}
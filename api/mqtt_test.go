@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// testBroker is a single-client MQTT 3.1.1 broker: it acks connects,
+// subscribes and QoS 1 publishes, keeps retained messages and records
+// everything the client publishes.
+type testBroker struct {
+	ln         net.Listener
+	mu         sync.Mutex
+	conn       net.Conn
+	retained   map[string][]byte
+	published  chan *packets.PublishPacket
+	subscribed chan []string
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	b := &testBroker{ln: ln, retained: map[string][]byte{}, published: make(chan *packets.PublishPacket, 256), subscribed: make(chan []string, 4)}
+	t.Cleanup(func() {
+		ln.Close()
+		b.mu.Lock()
+		if b.conn != nil {
+			b.conn.Close()
+		}
+		b.mu.Unlock()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conn = conn
+			b.mu.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	for {
+		pkt, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		var reply packets.ControlPacket
+		switch p := pkt.(type) {
+		case *packets.ConnectPacket:
+			reply = packets.NewControlPacket(packets.Connack)
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID, ack.ReturnCodes = p.MessageID, p.Qoss
+			reply = ack
+			b.subscribed <- p.Topics
+		case *packets.PublishPacket:
+			if p.Retain {
+				b.mu.Lock()
+				if len(p.Payload) == 0 {
+					delete(b.retained, p.TopicName)
+				} else {
+					b.retained[p.TopicName] = p.Payload
+				}
+				b.mu.Unlock()
+			}
+			b.published <- p
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				reply = ack
+			}
+		case *packets.PingreqPacket:
+			reply = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+		if reply != nil {
+			b.mu.Lock()
+			err = reply.Write(conn)
+			b.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// send delivers a QoS 0 message to the connected client.
+func (b *testBroker) send(t *testing.T, topic, payload string) {
+	t.Helper()
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName, p.Payload = topic, []byte(payload)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := p.Write(b.conn); err != nil {
+		t.Fatalf("broker send: %v", err)
+	}
+}
+
+// next waits for the client to publish on topic, skipping other topics.
+func (b *testBroker) next(t *testing.T, topic string) *packets.PublishPacket {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case p := <-b.published:
+			if p.TopicName == topic {
+				return p
+			}
+		case <-deadline:
+			t.Fatalf("timed out waiting for publish on %s", topic)
+			return nil
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMQTTBridgeIngestsTelemetryAndPublishesState(t *testing.T) {
+	broker := newTestBroker(t)
+	store := LoadStore("")
+	bridge := NewMQTTBridge(MQTTConfig{BrokerURL: "tcp://" + broker.ln.Addr().String(), QoS: 1, Source: "Tower-Agents"}, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	bridge.Connect()
+	defer bridge.Close()
+
+	select {
+	case topics := <-broker.subscribed:
+		if len(topics) != 1 || topics[0] != defaultMQTTSubscribeTopic {
+			t.Fatalf("unexpected subscription: %v", topics)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("bridge never subscribed")
+	}
+	if online := broker.next(t, "nocwall/bridge/status"); string(online.Payload) != "online" || !online.Retain {
+		t.Fatalf("expected retained online marker, got=%s", online)
+	}
+
+	// The device ID comes from the last topic level.
+	broker.send(t, "nocwall/telemetry/tower-7-ap", `{"device":"tower-7-ap","site_id":"tower-7","online":true,"latency_ms":4}`)
+	deviceOnline := func(want bool) func() bool {
+		return func() bool {
+			for _, d := range store.ListDevices() {
+				if d.ID == "tower-7-ap" {
+					return d.Online == want && d.Source == "tower-agents"
+				}
+			}
+			return false
+		}
+	}
+	waitFor(t, "telemetry ingest", deviceOnline(true))
+
+	if _, err := bridge.PublishState(time.Now()); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	status := broker.next(t, "nocwall/devices/tower-7-ap/status")
+	var payload MQTTDeviceStatus
+	if err := json.Unmarshal(status.Payload, &payload); err != nil || !status.Retain || !payload.Online || payload.SiteID != "tower-7" || *payload.LatencyMs != 4 {
+		t.Fatalf("unexpected device status: retain=%v payload=%#v err=%v", status.Retain, payload, err)
+	}
+	if n, err := bridge.PublishState(time.Now()); err != nil || n != 0 {
+		t.Fatalf("expected unchanged state to publish nothing, n=%d err=%v", n, err)
+	}
+
+	broker.send(t, "nocwall/telemetry/tower-7-ap", `[{"device":"tower-7-ap","site_id":"tower-7","online":false}]`)
+	waitFor(t, "offline ingest", deviceOnline(false))
+	var incidentID string
+	for _, inc := range store.ListIncidents() {
+		if inc.DeviceID == "tower-7-ap" && inc.Resolved == nil {
+			incidentID = inc.ID
+		}
+	}
+	if incidentID == "" {
+		t.Fatalf("expected offline telemetry to open an incident")
+	}
+	if _, err := bridge.PublishState(time.Now()); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	opened := broker.next(t, "nocwall/incidents/"+incidentID)
+	var event MQTTIncidentEvent
+	if err := json.Unmarshal(opened.Payload, &event); err != nil || event.Event != "opened" || !opened.Retain || event.Incident.DeviceID != "tower-7-ap" {
+		t.Fatalf("unexpected incident event: retain=%v event=%#v err=%v", opened.Retain, event, err)
+	}
+	broker.mu.Lock()
+	retained := string(broker.retained["nocwall/devices/tower-7-ap/status"])
+	broker.mu.Unlock()
+	if !strings.Contains(retained, `"online":false`) {
+		t.Fatalf("expected retained status to flip offline, got=%s", retained)
+	}
+
+	// A QoS 1 redelivery of a sequenced sample is acknowledged, not applied.
+	sample := `{"agent_id":"sbc-7","seq":1,"device_id":"tower-7-sw","site_id":"tower-7","online":true}`
+	broker.send(t, "nocwall/telemetry/sbc-7", sample)
+	ack := broker.next(t, "nocwall/agents/sbc-7/ack")
+	broker.send(t, "nocwall/telemetry/sbc-7", sample)
+	broker.next(t, "nocwall/agents/sbc-7/ack")
+	var cursor AgentIngestCursor
+	if err := json.Unmarshal(ack.Payload, &cursor); err != nil || cursor.HighWaterSeq != 1 {
+		t.Fatalf("unexpected agent cursor: %s err=%v", ack.Payload, err)
+	}
+
+	broker.send(t, "nocwall/devices/tower-7-ap/status", `{"device_id":"tower-7-ap","online":true}`)
+	broker.send(t, "nocwall/telemetry/x", `not json`)
+	waitFor(t, "invalid message", func() bool { return bridge.Status().InvalidMessages == 1 })
+	if st := bridge.Status(); !st.Connected || st.Messages != 5 || st.Duplicates != 1 || st.Ingested != 3 {
+		t.Fatalf("unexpected bridge status: %#v", st)
+	}
+}
+
+func TestMQTTStateMessagesResolveClearsRetainedIncident(t *testing.T) {
+	bridge := NewMQTTBridge(MQTTConfig{TopicPrefix: "/noc/"}, LoadStore(""), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	resolvedAt := now.Format(time.RFC3339)
+	ackUntil := now.Add(30 * time.Minute).Format(time.RFC3339)
+	devices := []Device{{ID: "ap/1", Name: "ap-1", Online: true}}
+	old := Incident{ID: "inc-old", DeviceID: "ap/1", Started: "2025-12-31T00:00:00Z", Resolved: &resolvedAt}
+	open := Incident{ID: "inc-1", DeviceID: "ap/1", Severity: "critical", Started: "2026-01-01T11:00:00Z"}
+
+	first := bridge.stateMessages(devices, []Incident{old, open}, now)
+	if len(first) != 2 || first[0].topic != "noc/devices/ap_1/status" || first[1].topic != "noc/incidents/inc-1" {
+		t.Fatalf("expected status and open incident only, got=%#v", first)
+	}
+
+	open.AckUntil = &ackUntil
+	acked := bridge.stateMessages(devices, []Incident{old, open}, now)
+	var event MQTTIncidentEvent
+	if len(acked) != 2 || json.Unmarshal(acked[1].payload, &event) != nil || event.Event != "acked" || !strings.Contains(string(acked[0].payload), `"acked":true`) {
+		t.Fatalf("expected ack to update status and incident, got=%#v", acked)
+	}
+
+	open.Resolved = &resolvedAt
+	resolved := bridge.stateMessages(nil, []Incident{open}, now)
+	if len(resolved) != 3 {
+		t.Fatalf("expected resolved event, retained clear and device clear, got=%#v", resolved)
+	}
+	if resolved[0].topic != "noc/devices/ap_1/status" || len(resolved[0].payload) != 0 || !resolved[0].retained {
+		t.Fatalf("expected removed device to clear its retained status, got=%#v", resolved[0])
+	}
+	if json.Unmarshal(resolved[1].payload, &event) != nil || event.Event != "resolved" || resolved[1].retained || len(resolved[2].payload) != 0 || !resolved[2].retained {
+		t.Fatalf("unexpected resolve messages: %#v", resolved[1:])
+	}
+	if again := bridge.stateMessages(nil, []Incident{open}, now); len(again) != 0 {
+		t.Fatalf("expected resolution to publish once, got=%#v", again)
+	}
+}
+
+// stubMQTTClient publishes nothing and fails every publish while failing
+// is set.
+type stubMQTTClient struct {
+	mqtt.Client
+	failing bool
+	topics  []string
+}
+
+func (c *stubMQTTClient) IsConnectionOpen() bool { return true }
+
+func (c *stubMQTTClient) Publish(topic string, _ byte, _ bool, _ interface{}) mqtt.Token {
+	c.topics = append(c.topics, topic)
+	if c.failing {
+		return stubMQTTToken{err: errors.New("broker gone")}
+	}
+	return stubMQTTToken{}
+}
+
+type stubMQTTToken struct{ err error }
+
+func (t stubMQTTToken) Wait() bool                     { return true }
+func (t stubMQTTToken) WaitTimeout(time.Duration) bool { return true }
+func (t stubMQTTToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+func (t stubMQTTToken) Error() error { return t.err }
+
+func TestMQTTPublishStateRetriesIncidentEventsAfterFailure(t *testing.T) {
+	store := LoadStore("")
+	online, offline := true, false
+	store.IngestTelemetry(TelemetryIngestRequest{Source: "mqtt", DeviceID: "tower-9-rtr", Role: "router", Online: &online})
+	_, inc, _ := store.IngestTelemetry(TelemetryIngestRequest{Source: "mqtt", DeviceID: "tower-9-rtr", Role: "router", Online: &offline})
+	if inc == nil {
+		t.Fatalf("expected offline telemetry to open an incident")
+	}
+	client := &stubMQTTClient{failing: true}
+	bridge := NewMQTTBridge(MQTTConfig{}, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	bridge.client = client
+
+	now := time.Now()
+	if _, err := bridge.PublishState(now); err == nil {
+		t.Fatalf("expected publish to fail")
+	}
+	client.failing, client.topics = false, nil
+	if n, err := bridge.PublishState(now); err != nil || n == 0 {
+		t.Fatalf("expected retry to publish, n=%d err=%v", n, err)
+	}
+	if !containsString(client.topics, bridge.incidentTopic(inc.ID)) {
+		t.Fatalf("expected incident event to be retried, got=%v", client.topics)
+	}
+	client.topics = nil
+	if n, err := bridge.PublishState(now); err != nil || n != 0 {
+		t.Fatalf("expected nothing left to publish, n=%d err=%v topics=%v", n, err, client.topics)
+	}
+}
+
+func TestDecodeMQTTTelemetry(t *testing.T) {
+	batch := `{"agent_id":"sbc-1","samples":[{"seq":2,"device_id":"a"},{"seq":3,"source":"snmp"}]}`
+	samples, err := decodeMQTTTelemetry("nocwall/telemetry/b", []byte(batch), mqttSource)
+	if err != nil || len(samples) != 2 {
+		t.Fatalf("decode batch: samples=%#v err=%v", samples, err)
+	}
+	if samples[0].AgentID != "sbc-1" || samples[0].DeviceID != "a" || samples[0].Source != mqttSource || samples[1].DeviceID != "b" || samples[1].Source != "snmp" {
+		t.Fatalf("unexpected batch samples: %#v", samples)
+	}
+	for _, payload := range []string{`"x"`, `{"online":true`, `[]`} {
+		if _, err := decodeMQTTTelemetry("telemetry", []byte(payload), mqttSource); !errors.Is(err, ErrMQTTPayload) {
+			t.Fatalf("expected %s to be rejected, got=%v", payload, err)
+		}
+	}
+	if got := mqttTopicSegment(" a/b+c#d "); got != "a_b_c_d" {
+		t.Fatalf("mqttTopicSegment = %q", got)
+	}
+}
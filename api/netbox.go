@@ -0,0 +1,644 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	netBoxSource        = "netbox"
+	netBoxCableProtocol = "netbox_cable"
+	netBoxPageSize      = 1000
+	maxNetBoxPages      = 200
+)
+
+var (
+	ErrNetBoxNotConfigured = errors.New("netbox_not_configured")
+	ErrNetBoxEmpty         = errors.New("netbox_inventory_empty")
+	ErrNetBoxTruncated     = errors.New("netbox_inventory_truncated")
+)
+
+type NetBoxSite struct {
+	ID     int    `json:"id"`
+	Slug   string `json:"slug"`
+	Name   string `json:"name"`
+	Status string `json:"status,omitempty"`
+}
+
+type NetBoxDevice struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Role       string `json:"role,omitempty"`
+	SiteID     string `json:"site_id,omitempty"`
+	Serial     string `json:"serial,omitempty"`
+	Platform   string `json:"platform,omitempty"`
+	PrimaryIP  string `json:"primary_ip,omitempty"`
+	Status     string `json:"status,omitempty"`
+	IdentityID string `json:"identity_id,omitempty"`
+}
+
+type NetBoxCable struct {
+	ID         int    `json:"id"`
+	ADeviceID  int    `json:"a_device_id"`
+	ADevice    string `json:"a_device"`
+	AInterface string `json:"a_interface"`
+	BDeviceID  int    `json:"b_device_id"`
+	BDevice    string `json:"b_device"`
+	BInterface string `json:"b_interface"`
+	Status     string `json:"status,omitempty"`
+}
+
+// NetBoxInventory is the last imported NetBox snapshot. Device entries carry
+// the identity they were matched to so the mismatch report can be rebuilt
+// without another sync.
+type NetBoxInventory struct {
+	SyncedAt string         `json:"synced_at,omitempty"`
+	Sites    []NetBoxSite   `json:"sites,omitempty"`
+	Devices  []NetBoxDevice `json:"devices,omitempty"`
+	Cables   []NetBoxCable  `json:"cables,omitempty"`
+}
+
+type NetBoxSyncResult struct {
+	SyncedAt      string `json:"synced_at"`
+	Sites         int    `json:"sites"`
+	Devices       int    `json:"devices"`
+	Cables        int    `json:"cables"`
+	Matched       int    `json:"matched"`
+	Created       int    `json:"created"`
+	Released      int    `json:"released"`
+	CableLinks    int    `json:"cable_links"`
+	SkippedCables int    `json:"skipped_cables"`
+	Mismatches    int    `json:"mismatches"`
+}
+
+type NetBoxMismatch struct {
+	Kind        string `json:"kind"`
+	IdentityID  string `json:"identity_id,omitempty"`
+	NetBoxID    int    `json:"netbox_id,omitempty"`
+	Device      string `json:"device"`
+	Field       string `json:"field,omitempty"`
+	NetBoxValue string `json:"netbox_value,omitempty"`
+	LiveValue   string `json:"live_value,omitempty"`
+	LiveSource  string `json:"live_source,omitempty"`
+	ObservedAt  int64  `json:"observed_at,omitempty"`
+}
+
+type NetBoxMismatchesResponse struct {
+	LastUpdated int64            `json:"last_updated"`
+	SyncedAt    string           `json:"synced_at,omitempty"`
+	Count       int              `json:"count"`
+	Items       []NetBoxMismatch `json:"items"`
+	Truncated   bool             `json:"truncated"`
+	Limit       int              `json:"limit"`
+	Stub        bool             `json:"stub"`
+}
+
+// NetBoxClient reads sites, devices and cables from the NetBox REST API.
+type NetBoxClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewNetBoxClient(baseURL, token string) *NetBoxClient {
+	return &NetBoxClient{
+		baseURL: strings.TrimRight(strings.TrimSpace(baseURL), "/"),
+		token:   strings.TrimSpace(token),
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (n *NetBoxClient) Configured() bool {
+	return n != nil && n.baseURL != "" && n.token != ""
+}
+
+func (n *NetBoxClient) Fetch(ctx context.Context, retries int) (NetBoxInventory, error) {
+	if !n.Configured() {
+		return NetBoxInventory{}, ErrNetBoxNotConfigured
+	}
+	inv := NetBoxInventory{}
+	sites, err := n.fetchAll(ctx, "/api/dcim/sites/", retries)
+	if err != nil {
+		return inv, fmt.Errorf("netbox sites: %w", err)
+	}
+	for _, item := range sites {
+		inv.Sites = append(inv.Sites, NetBoxSite{
+			ID:     netBoxInt(item, "id"),
+			Slug:   pickString(item, []string{"slug"}),
+			Name:   pickString(item, []string{"name"}),
+			Status: pickString(item, []string{"status", "value"}),
+		})
+	}
+	devices, err := n.fetchAll(ctx, "/api/dcim/devices/", retries)
+	if err != nil {
+		return inv, fmt.Errorf("netbox devices: %w", err)
+	}
+	for _, item := range devices {
+		inv.Devices = append(inv.Devices, parseNetBoxDevice(item))
+	}
+	cables, err := n.fetchAll(ctx, "/api/dcim/cables/", retries)
+	if err != nil {
+		return inv, fmt.Errorf("netbox cables: %w", err)
+	}
+	for _, item := range cables {
+		if cable, ok := parseNetBoxCable(item); ok {
+			inv.Cables = append(inv.Cables, cable)
+		}
+	}
+	return inv, nil
+}
+
+// fetchAll follows NetBox's "next" links. The link is re-rooted on the
+// configured base URL because NetBox behind a proxy often advertises its
+// internal host.
+func (n *NetBoxClient) fetchAll(ctx context.Context, path string, retries int) ([]map[string]any, error) {
+	token := n.token
+	auth := headerAuth(func(req *http.Request) {
+		req.Header.Set("Authorization", "Token "+token)
+	})
+	pageURL := n.baseURL + path + "?limit=" + strconv.Itoa(netBoxPageSize)
+	var items []map[string]any
+	for page := 0; pageURL != "" && page < maxNetBoxPages; page++ {
+		body, _, err := fetchPageBody(ctx, n.client, pageURL, retries, netBoxSource, auth, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var payload struct {
+			Next    *string          `json:"next"`
+			Results []map[string]any `json:"results"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("netbox invalid json: %w", err)
+		}
+		items = append(items, payload.Results...)
+		pageURL = ""
+		if payload.Next != nil && *payload.Next != "" {
+			next, err := url.Parse(*payload.Next)
+			if err != nil {
+				return nil, fmt.Errorf("netbox invalid next link: %w", err)
+			}
+			pageURL = n.baseURL + next.RequestURI()
+		}
+	}
+	// A partial list would release authority over every device past the
+	// cap, so it fails the sync instead.
+	if pageURL != "" {
+		return nil, fmt.Errorf("%w: more than %d pages", ErrNetBoxTruncated, maxNetBoxPages)
+	}
+	return items, nil
+}
+
+func parseNetBoxDevice(item map[string]any) NetBoxDevice {
+	primaryIP := pickString(item, []string{"primary_ip", "address"}, []string{"primary_ip4", "address"}, []string{"primary_ip6", "address"})
+	primaryIP, _, _ = strings.Cut(primaryIP, "/")
+	return NetBoxDevice{
+		ID:   netBoxInt(item, "id"),
+		Name: pickString(item, []string{"name"}),
+		// NetBox 3.6 renamed device_role to role.
+		Role:      pickString(item, []string{"role", "slug"}, []string{"device_role", "slug"}),
+		SiteID:    pickString(item, []string{"site", "slug"}),
+		Serial:    pickString(item, []string{"serial"}),
+		Platform:  pickString(item, []string{"platform", "slug"}, []string{"platform", "name"}),
+		PrimaryIP: primaryIP,
+		Status:    pickString(item, []string{"status", "value"}),
+	}
+}
+
+// parseNetBoxCable keeps device-to-device interface cables. Cables landing
+// on patch panels or circuits have no device interface on one side.
+func parseNetBoxCable(item map[string]any) (NetBoxCable, bool) {
+	aDeviceID, aDevice, aIface := netBoxCableEnd(item, "a_terminations", "termination_a")
+	bDeviceID, bDevice, bIface := netBoxCableEnd(item, "b_terminations", "termination_b")
+	if aDeviceID == 0 || bDeviceID == 0 {
+		return NetBoxCable{}, false
+	}
+	return NetBoxCable{
+		ID:         netBoxInt(item, "id"),
+		ADeviceID:  aDeviceID,
+		ADevice:    aDevice,
+		AInterface: aIface,
+		BDeviceID:  bDeviceID,
+		BDevice:    bDevice,
+		BInterface: bIface,
+		Status:     pickString(item, []string{"status", "value"}),
+	}, true
+}
+
+// netBoxCableEnd reads the first interface termination of a cable side,
+// from a_terminations (3.3+) or termination_a (older releases).
+func netBoxCableEnd(item map[string]any, listKey, legacyKey string) (int, string, string) {
+	var end map[string]any
+	if terms, ok := item[listKey].([]any); ok && len(terms) > 0 {
+		term, _ := terms[0].(map[string]any)
+		if objectType := pickString(term, []string{"object_type"}); objectType != "" && objectType != "dcim.interface" {
+			return 0, "", ""
+		}
+		end, _ = term["object"].(map[string]any)
+	} else if legacy, ok := item[legacyKey].(map[string]any); ok {
+		if termType := pickString(item, []string{legacyKey + "_type"}); termType != "" && termType != "dcim.interface" {
+			return 0, "", ""
+		}
+		end = legacy
+	}
+	if end == nil {
+		return 0, "", ""
+	}
+	return netBoxInt(end, "device", "id"), pickString(end, []string{"device", "name"}), pickString(end, []string{"name"})
+}
+
+func netBoxInt(item map[string]any, path ...string) int {
+	if v := pickFloat(item, path); v != nil {
+		return int(*v)
+	}
+	return 0
+}
+
+// ApplyNetBoxInventory makes NetBox authoritative for role, site, serial,
+// platform and primary IP on the matched identities and replaces the
+// NetBox cable links. Devices are matched to identities by previous NetBox
+// ID, then serial, primary IP and name; unmatched devices get a new
+// identity so planned gear shows up before it is first polled. An empty
+// device list is rejected so a blank response cannot release every identity.
+func (s *Store) ApplyNetBoxInventory(inv NetBoxInventory, nowMs int64) (NetBoxSyncResult, error) {
+	if len(inv.Devices) == 0 {
+		return NetBoxSyncResult{}, ErrNetBoxEmpty
+	}
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+	nowISO := time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
+	inv.SyncedAt = nowISO
+	inv.Devices = append([]NetBoxDevice(nil), inv.Devices...)
+	result := NetBoxSyncResult{SyncedAt: nowISO, Sites: len(inv.Sites), Devices: len(inv.Devices), Cables: len(inv.Cables)}
+
+	s.mu.Lock()
+	lookup := s.netBoxIdentityLookupLocked()
+	identityByNetBoxID := make(map[int]string, len(inv.Devices))
+	for i := range inv.Devices {
+		dev := &inv.Devices[i]
+		identityID := lookup.match(*dev, s.identityIndex)
+		if identityID == "" {
+			identityID = "ident-" + randomID()
+			s.DeviceIdentities = append(s.DeviceIdentities, DeviceIdentity{
+				IdentityID: identityID,
+				Name:       firstNonEmpty(dev.Name, dev.Serial, "netbox-"+strconv.Itoa(dev.ID)),
+				CreatedAt:  nowISO,
+			})
+			lookup.position[identityID] = len(s.DeviceIdentities) - 1
+			result.Created++
+		} else {
+			result.Matched++
+		}
+		lookup.claimed[identityID] = true
+		identityByNetBoxID[dev.ID] = identityID
+		dev.IdentityID = identityID
+
+		identity := &s.DeviceIdentities[lookup.position[identityID]]
+		identity.Authority = netBoxSource
+		identity.NetBoxID = dev.ID
+		identity.Platform = dev.Platform
+		identity.PrimaryIP = dev.PrimaryIP
+		if dev.Role != "" {
+			identity.Role = dev.Role
+		}
+		if dev.SiteID != "" {
+			identity.SiteID = dev.SiteID
+		}
+		if serial := normalizeKeyToken(dev.Serial); serial != "" {
+			identity.SerialNumber = serial
+		}
+		if identity.Name == "" {
+			identity.Name = dev.Name
+		}
+		identity.SourceRefs = appendUnique(identity.SourceRefs, netBoxSource)
+		identity.UpdatedAt = nowISO
+		s.applyAuthoritativePlacementToDeviceLocked(*identity)
+	}
+
+	// Identities dropped from NetBox fall back to live data.
+	for i := range s.DeviceIdentities {
+		identity := &s.DeviceIdentities[i]
+		if identity.Authority == netBoxSource && !lookup.claimed[identity.IdentityID] {
+			identity.Authority = ""
+			identity.NetBoxID = 0
+			identity.UpdatedAt = nowISO
+			result.Released++
+		}
+	}
+
+	links := make([]NeighborLink, 0, len(inv.Cables))
+	for _, cable := range inv.Cables {
+		aIdentity, bIdentity := identityByNetBoxID[cable.ADeviceID], identityByNetBoxID[cable.BDeviceID]
+		if aIdentity == "" || bIdentity == "" {
+			result.SkippedCables++
+			continue
+		}
+		links = append(links, NeighborLink{
+			ID:                    "nbr-" + normalizeKeyToken(aIdentity+"|"+netBoxSource+"|cable-"+strconv.Itoa(cable.ID)),
+			IdentityID:            aIdentity,
+			LocalInterface:        cable.AInterface,
+			NeighborIdentityHint:  bIdentity,
+			NeighborDeviceName:    cable.BDevice,
+			NeighborInterfaceHint: cable.BInterface,
+			Protocol:              netBoxCableProtocol,
+			Source:                netBoxSource,
+			UpdatedAt:             nowISO,
+		})
+	}
+	next := make([]NeighborLink, 0, len(s.NeighborLinks)+len(links))
+	for _, row := range s.NeighborLinks {
+		if row.Source != netBoxSource {
+			next = append(next, row)
+		}
+	}
+	s.NeighborLinks = append(next, links...)
+	result.CableLinks = len(links)
+
+	s.NetBox = inv
+	s.rebuildIdentityIndexLocked()
+	s.impactGraph = nil
+	result.Mismatches = len(s.netBoxMismatchesLocked())
+	s.mu.Unlock()
+	s.save()
+	return result, nil
+}
+
+// netBoxIdentityLookup indexes identities once per sync so matching a
+// NetBox device does not rescan every identity. Each key lists identities
+// in store order; the first one not yet claimed wins.
+type netBoxIdentityLookup struct {
+	position   map[string]int
+	claimed    map[string]bool
+	byNetBoxID map[int][]string
+	byIP       map[string][]string
+	byName     map[string][]string
+}
+
+func (s *Store) netBoxIdentityLookupLocked() *netBoxIdentityLookup {
+	lookup := &netBoxIdentityLookup{
+		position:   make(map[string]int, len(s.DeviceIdentities)),
+		claimed:    map[string]bool{},
+		byNetBoxID: map[int][]string{},
+		byIP:       map[string][]string{},
+		byName:     map[string][]string{},
+	}
+	for i, identity := range s.DeviceIdentities {
+		id := identity.IdentityID
+		if id == "" {
+			continue
+		}
+		if _, dup := lookup.position[id]; !dup {
+			lookup.position[id] = i
+		}
+		if identity.Authority == netBoxSource && identity.NetBoxID != 0 {
+			lookup.byNetBoxID[identity.NetBoxID] = append(lookup.byNetBoxID[identity.NetBoxID], id)
+		}
+		if identity.PrimaryIP != "" {
+			lookup.byIP[identity.PrimaryIP] = append(lookup.byIP[identity.PrimaryIP], id)
+		}
+		name := normalizeKeyToken(identity.Name)
+		if name != "" {
+			lookup.byName[name] = append(lookup.byName[name], id)
+		}
+		if host := normalizeKeyToken(identity.Hostname); host != "" && host != name {
+			lookup.byName[host] = append(lookup.byName[host], id)
+		}
+	}
+	return lookup
+}
+
+func (l *netBoxIdentityLookup) usable(identityID string) bool {
+	if identityID == "" || l.claimed[identityID] {
+		return false
+	}
+	_, ok := l.position[identityID]
+	return ok
+}
+
+func (l *netBoxIdentityLookup) first(ids []string) string {
+	for _, id := range ids {
+		if l.usable(id) {
+			return id
+		}
+	}
+	return ""
+}
+
+// match finds the identity for a NetBox device by previous NetBox ID, then
+// serial, primary IP and name.
+func (l *netBoxIdentityLookup) match(dev NetBoxDevice, identityIndex map[string]string) string {
+	if id := l.first(l.byNetBoxID[dev.ID]); id != "" {
+		return id
+	}
+	if serial := normalizeKeyToken(dev.Serial); serial != "" {
+		if id := identityIndex["serial:"+serial]; l.usable(id) {
+			return id
+		}
+	}
+	if dev.PrimaryIP != "" {
+		if id := l.first(l.byIP[dev.PrimaryIP]); id != "" {
+			return id
+		}
+	}
+	// Names are only unique per site in NetBox and NMS sites rarely use
+	// NetBox slugs, so fall back to a name match anywhere.
+	if name := normalizeKeyToken(dev.Name); name != "" {
+		return l.first(l.byName[name])
+	}
+	return ""
+}
+
+// applyAuthoritativePlacementToDeviceLocked copies NetBox role and site onto
+// the device row backing the identity.
+func (s *Store) applyAuthoritativePlacementToDeviceLocked(identity DeviceIdentity) {
+	if identity.PrimaryDeviceID == "" {
+		return
+	}
+	for i := range s.Devices {
+		if s.Devices[i].ID != identity.PrimaryDeviceID {
+			continue
+		}
+		if identity.Role != "" {
+			s.Devices[i].Role = identity.Role
+		}
+		if identity.SiteID != "" {
+			s.Devices[i].SiteID = identity.SiteID
+		}
+		return
+	}
+}
+
+// authoritativePlacementLocked returns the role and site telemetry should
+// be filed under: the NetBox values when the identity is NetBox-owned,
+// otherwise what the source reported.
+func (s *Store) authoritativePlacementLocked(identityID, role, siteID string) (string, string) {
+	idx := s.findIdentityIndexLocked(identityID)
+	if idx < 0 || s.DeviceIdentities[idx].Authority == "" {
+		return role, siteID
+	}
+	identity := s.DeviceIdentities[idx]
+	return firstNonEmpty(identity.Role, role), firstNonEmpty(identity.SiteID, siteID)
+}
+
+func (s *Store) NetBoxInventorySnapshot() NetBoxInventory {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return NetBoxInventory{
+		SyncedAt: s.NetBox.SyncedAt,
+		Sites:    append([]NetBoxSite(nil), s.NetBox.Sites...),
+		Devices:  append([]NetBoxDevice(nil), s.NetBox.Devices...),
+		Cables:   append([]NetBoxCable(nil), s.NetBox.Cables...),
+	}
+}
+
+// ListNetBoxMismatches compares the last NetBox import with the latest live
+// observation of each identity. kind filters to field_mismatch,
+// missing_live or not_in_netbox.
+func (s *Store) ListNetBoxMismatches(limit int, kind string) ([]NetBoxMismatch, bool, int, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	kind = strings.TrimSpace(kind)
+	items := make([]NetBoxMismatch, 0)
+	for _, item := range s.netBoxMismatchesLocked() {
+		if kind != "" && item.Kind != kind {
+			continue
+		}
+		items = append(items, item)
+	}
+	truncated := len(items) > limit
+	if truncated {
+		items = items[:limit]
+	}
+	return items, truncated, limit, s.NetBox.SyncedAt
+}
+
+func (s *Store) netBoxMismatchesLocked() []NetBoxMismatch {
+	if s.NetBox.SyncedAt == "" {
+		return nil
+	}
+	latest := make(map[string]SourceObservation, len(s.DeviceIdentities))
+	for _, obs := range s.SourceObservations {
+		if obs.IdentityID == "" || obs.Source == netBoxSource || obs.Source == identityBackfillSource {
+			continue
+		}
+		if prev, ok := latest[obs.IdentityID]; !ok || obs.ObservedAt >= prev.ObservedAt {
+			latest[obs.IdentityID] = obs
+		}
+	}
+	retired := s.retiredIdentitySetLocked()
+
+	out := make([]NetBoxMismatch, 0)
+	inNetBox := make(map[string]bool, len(s.NetBox.Devices))
+	for _, dev := range s.NetBox.Devices {
+		inNetBox[dev.IdentityID] = true
+		base := NetBoxMismatch{IdentityID: dev.IdentityID, NetBoxID: dev.ID, Device: firstNonEmpty(dev.Name, dev.Serial)}
+		obs, ok := latest[dev.IdentityID]
+		if !ok {
+			// Planned, staged and offline devices are not expected to report.
+			if dev.Status == "" || dev.Status == "active" {
+				item := base
+				item.Kind = "missing_live"
+				out = append(out, item)
+			}
+			continue
+		}
+		for _, field := range []struct{ name, netbox, live string }{
+			{"role", dev.Role, obs.Role},
+			{"site_id", dev.SiteID, obs.SiteID},
+			{"serial_number", dev.Serial, obs.SerialNumber},
+		} {
+			if field.netbox == "" || field.live == "" || normalizeKeyToken(field.netbox) == normalizeKeyToken(field.live) {
+				continue
+			}
+			item := base
+			item.Kind = "field_mismatch"
+			item.Field = field.name
+			item.NetBoxValue = field.netbox
+			item.LiveValue = field.live
+			item.LiveSource = obs.Source
+			item.ObservedAt = obs.ObservedAt
+			out = append(out, item)
+		}
+	}
+	for identityID, obs := range latest {
+		if inNetBox[identityID] || retired[identityID] {
+			continue
+		}
+		out = append(out, NetBoxMismatch{
+			Kind:       "not_in_netbox",
+			IdentityID: identityID,
+			Device:     firstNonEmpty(obs.Name, obs.DeviceID),
+			LiveSource: obs.Source,
+			ObservedAt: obs.ObservedAt,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		if out[i].Device != out[j].Device {
+			return out[i].Device < out[j].Device
+		}
+		return out[i].Field < out[j].Field
+	})
+	return out
+}
+
+// SyncNetBox fetches the NetBox inventory and applies it to the store.
+func SyncNetBox(ctx context.Context, client *NetBoxClient, store *Store, retries int) (NetBoxSyncResult, error) {
+	inv, err := client.Fetch(ctx, retries)
+	if err != nil {
+		return NetBoxSyncResult{}, err
+	}
+	return store.ApplyNetBoxInventory(inv, time.Now().UnixMilli())
+}
+
+func runNetBoxSync(ctx context.Context, client *NetBoxClient, store *Store, logger *slog.Logger, interval time.Duration, retries int) {
+	if interval <= 0 || !client.Configured() {
+		return
+	}
+	logger.Info("netbox_sync_started", "interval_sec", int(interval.Seconds()), "retries", retries)
+	run := func() {
+		result, err := SyncNetBox(ctx, client, store, retries)
+		if err != nil {
+			logger.Warn("netbox_sync_failed", "error", err.Error())
+			return
+		}
+		logger.Info("netbox_sync_ok",
+			"sites", result.Sites,
+			"devices", result.Devices,
+			"cables", result.Cables,
+			"matched", result.Matched,
+			"created", result.Created,
+			"released", result.Released,
+			"cable_links", result.CableLinks,
+			"skipped_cables", result.SkippedCables,
+			"mismatches", result.Mismatches,
+		)
+	}
+
+	run()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
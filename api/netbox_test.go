@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newNetBoxStandIn serves two sites, three devices split over two pages and
+// one interface cable plus one patch-panel cable.
+func newNetBoxStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	authed := func(body func(r *http.Request) string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Token nb-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(body(r)))
+		}
+	}
+	mux.HandleFunc("/api/dcim/sites/", authed(func(*http.Request) string {
+		return `{"count":2,"next":null,"results":[{"id":1,"slug":"nyc1","name":"NYC 1","status":{"value":"active"}},{"id":2,"slug":"bos1","name":"BOS 1","status":{"value":"planned"}}]}`
+	}))
+	mux.HandleFunc("/api/dcim/devices/", authed(func(r *http.Request) string {
+		if r.URL.Query().Get("offset") == "" {
+			// NetBox behind a proxy advertises its internal host in next.
+			return `{"count":3,"next":"http://netbox.internal:8000/api/dcim/devices/?limit=1000&offset=2","results":[
+				{"id":10,"name":"core-1","role":{"slug":"core-switch"},"site":{"slug":"nyc1"},"serial":"SN-CORE-1","platform":{"slug":"eos"},"primary_ip":{"address":"10.0.0.1/24"},"status":{"value":"active"}},
+				{"id":11,"name":"edge-1","device_role":{"slug":"edge-router"},"site":{"slug":"nyc1"},"serial":"","primary_ip4":{"address":"10.0.0.2/24"},"status":{"value":"active"}}
+			]}`
+		}
+		return `{"count":3,"next":null,"results":[{"id":12,"name":"bos-sw-1","role":{"slug":"access-switch"},"site":{"slug":"bos1"},"serial":"SN-BOS-1","status":{"value":"active"}}]}`
+	}))
+	mux.HandleFunc("/api/dcim/cables/", authed(func(*http.Request) string {
+		return `{"count":2,"next":null,"results":[
+			{"id":100,"status":{"value":"connected"},
+			 "a_terminations":[{"object_type":"dcim.interface","object":{"id":1,"name":"Ethernet1","device":{"id":10,"name":"core-1"}}}],
+			 "b_terminations":[{"object_type":"dcim.interface","object":{"id":2,"name":"ge-0/0/0","device":{"id":11,"name":"edge-1"}}}]},
+			{"id":101,
+			 "a_terminations":[{"object_type":"dcim.interface","object":{"id":3,"name":"Ethernet2","device":{"id":10,"name":"core-1"}}}],
+			 "b_terminations":[{"object_type":"dcim.frontport","object":{"id":4,"name":"1","device":{"id":50,"name":"pp-1"}}}]}
+		]}`
+	}))
+	return httptest.NewServer(mux)
+}
+
+func TestNetBoxSyncOverridesLiveRoleAndSite(t *testing.T) {
+	server := newNetBoxStandIn(t)
+	defer server.Close()
+
+	store := LoadStore("")
+	online := true
+	live := []TelemetryIngestRequest{
+		{Source: "cisco", DeviceID: "c-1", Device: "core-1", Role: "switch", SiteID: "hq", Serial: "sn-core-1", Online: &online},
+		{Source: "juniper", DeviceID: "j-1", Device: "edge-1", Role: "router", SiteID: "nyc1", Online: &online},
+		{Source: "cisco", DeviceID: "c-9", Device: "lab-sw", Role: "switch", SiteID: "lab", Online: &online},
+	}
+	for _, req := range live {
+		if _, _, ok := store.IngestTelemetry(req); !ok {
+			t.Fatalf("ingest %s failed", req.DeviceID)
+		}
+	}
+
+	result, err := SyncNetBox(context.Background(), NewNetBoxClient(server.URL, "nb-token"), store, 0)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if result.Sites != 2 || result.Devices != 3 || result.Matched != 2 || result.Created != 1 || result.CableLinks != 1 || result.SkippedCables != 0 {
+		t.Fatalf("unexpected sync result: %#v", result)
+	}
+
+	core := findIdentityByPrimary(t, store, "c-1")
+	if core.Authority != "netbox" || core.Role != "core-switch" || core.SiteID != "nyc1" || core.Platform != "eos" || core.PrimaryIP != "10.0.0.1" {
+		t.Fatalf("expected NetBox fields on core identity, got=%#v", core)
+	}
+	edge := findIdentityByPrimary(t, store, "j-1")
+	if edge.Role != "edge-router" || edge.PrimaryIP != "10.0.0.2" {
+		t.Fatalf("expected legacy device_role and primary_ip4 to apply, got=%#v", edge)
+	}
+
+	// Live telemetry keeps reporting the NMS role and site.
+	device, _, ok := store.IngestTelemetry(live[0])
+	if !ok || device.Role != "core-switch" || device.SiteID != "nyc1" {
+		t.Fatalf("expected NetBox placement to win on ingest, got=%#v", device)
+	}
+	if core = findIdentityByPrimary(t, store, "c-1"); core.Role != "core-switch" || core.SiteID != "nyc1" {
+		t.Fatalf("expected live observation not to overwrite NetBox role/site, got=%#v", core)
+	}
+
+	edges, _, _ := store.ListTopologyEdges(50, core.IdentityID)
+	cabled := false
+	for _, e := range edges {
+		cabled = cabled || (e.Protocol == "netbox_cable" && e.Resolved && e.ToNodeID == topologyNodeIDForIdentity(edge.IdentityID) && e.LocalInterface == "Ethernet1")
+	}
+	if !cabled {
+		t.Fatalf("expected NetBox cable edge from core-1 to edge-1, edges=%#v", edges)
+	}
+
+	items, _, _, syncedAt := store.ListNetBoxMismatches(50, "")
+	if syncedAt == "" {
+		t.Fatalf("expected synced_at on mismatch report")
+	}
+	found := map[string]NetBoxMismatch{}
+	for _, item := range items {
+		found[item.Kind+"|"+item.Device+"|"+item.Field] = item
+	}
+	if m, ok := found["field_mismatch|core-1|role"]; !ok || m.LiveValue != "switch" || m.LiveSource != "cisco" {
+		t.Fatalf("expected role mismatch for core-1, items=%#v", items)
+	}
+	if _, ok := found["field_mismatch|core-1|site_id"]; !ok {
+		t.Fatalf("expected site mismatch for core-1, items=%#v", items)
+	}
+	if _, ok := found["field_mismatch|edge-1|site_id"]; ok {
+		t.Fatalf("did not expect site mismatch for edge-1, items=%#v", items)
+	}
+	if _, ok := found["missing_live|bos-sw-1|"]; !ok {
+		t.Fatalf("expected bos-sw-1 to be missing from live data, items=%#v", items)
+	}
+	if _, ok := found["not_in_netbox|lab-sw|"]; !ok {
+		t.Fatalf("expected lab-sw to be flagged as not in NetBox, items=%#v", items)
+	}
+	if only, _, _, _ := store.ListNetBoxMismatches(50, "missing_live"); len(only) != 1 {
+		t.Fatalf("expected kind filter to return one item, got=%#v", only)
+	}
+}
+
+func TestNetBoxSyncRejectsEmptyAndUnconfigured(t *testing.T) {
+	store := LoadStore("")
+	if _, err := SyncNetBox(context.Background(), NewNetBoxClient("", ""), store, 0); !errors.Is(err, ErrNetBoxNotConfigured) {
+		t.Fatalf("expected not configured error, got=%v", err)
+	}
+	if _, err := store.ApplyNetBoxInventory(NetBoxInventory{}, 0); !errors.Is(err, ErrNetBoxEmpty) {
+		t.Fatalf("expected empty inventory to be rejected, got=%v", err)
+	}
+
+	inv := NetBoxInventory{Devices: []NetBoxDevice{{ID: 1, Name: "planned-1", Role: "spine", SiteID: "dc1", Status: "planned"}}}
+	if _, err := store.ApplyNetBoxInventory(inv, 0); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if items, _, _, _ := store.ListNetBoxMismatches(50, "missing_live"); len(items) != 0 {
+		t.Fatalf("expected planned device not to be reported missing, got=%#v", items)
+	}
+	if _, err := store.ApplyNetBoxInventory(NetBoxInventory{Devices: []NetBoxDevice{{ID: 2, Name: "other"}}}, 0); err != nil {
+		t.Fatalf("second apply: %v", err)
+	}
+	for _, ident := range store.ListDeviceIdentities() {
+		if ident.Name == "planned-1" && ident.Authority != "" {
+			t.Fatalf("expected device dropped from NetBox to lose authority, got=%#v", ident)
+		}
+	}
+}
+
+func TestNetBoxSyncMatchesMixedCaseHostname(t *testing.T) {
+	store := LoadStore("")
+	online := true
+	if _, _, ok := store.IngestTelemetry(TelemetryIngestRequest{Source: "cisco", DeviceID: "c-7", Device: "Core Switch 7", Hostname: "Dist-SW-7", Online: &online}); !ok {
+		t.Fatalf("ingest failed")
+	}
+	result, err := store.ApplyNetBoxInventory(NetBoxInventory{Devices: []NetBoxDevice{{ID: 7, Name: "dist-sw-7", Role: "distribution"}}}, 0)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if result.Matched != 1 || result.Created != 0 {
+		t.Fatalf("expected NetBox name to match the live hostname, got=%#v", result)
+	}
+	if ident := findIdentityByPrimary(t, store, "c-7"); ident.Authority != "netbox" || ident.Role != "distribution" {
+		t.Fatalf("expected hostname-matched identity to be NetBox-owned, got=%#v", ident)
+	}
+}
+
+func TestNetBoxSyncPageCapKeepsAuthority(t *testing.T) {
+	store := LoadStore("")
+	if _, err := store.ApplyNetBoxInventory(NetBoxInventory{Devices: []NetBoxDevice{{ID: 1, Name: "core-1", Role: "core"}}}, 0); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	pages := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		// Every page points at another one, so the walk hits the cap.
+		fmt.Fprintf(w, `{"next":"http://netbox.internal/api/dcim/sites/?limit=1000&offset=%d","results":[]}`, pages*1000)
+	}))
+	defer server.Close()
+
+	if _, err := SyncNetBox(context.Background(), NewNetBoxClient(server.URL, "nb-token"), store, 0); !errors.Is(err, ErrNetBoxTruncated) {
+		t.Fatalf("expected page cap to fail the sync, got=%v", err)
+	}
+	if pages != maxNetBoxPages {
+		t.Fatalf("expected walk to stop at %d pages, got=%d", maxNetBoxPages, pages)
+	}
+	for _, ident := range store.ListDeviceIdentities() {
+		if ident.Name == "core-1" && ident.Authority != "netbox" {
+			t.Fatalf("expected truncated sync to keep NetBox authority, got=%#v", ident)
+		}
+	}
+}
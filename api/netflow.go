@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+const (
+	netflowSource      = "netflow"
+	netflowV5HeaderLen = 24
+	netflowV5RecordLen = 48
+	netflowV9HeaderLen = 20
+	ipfixHeaderLen     = 16
+	ipfixVarLength     = 65535
+)
+
+// NetFlow v9 / IPFIX information elements the collector reads. IPFIX
+// reuses the v9 numbers below 128.
+const (
+	flowFieldInBytes        = 1
+	flowFieldInPkts         = 2
+	flowFieldProtocol       = 4
+	flowFieldSrcPort        = 7
+	flowFieldSrcAddr        = 8
+	flowFieldInputIf        = 10
+	flowFieldDstPort        = 11
+	flowFieldDstAddr        = 12
+	flowFieldOutputIf       = 14
+	flowFieldOutBytes       = 23
+	flowFieldOutPkts        = 24
+	flowFieldSrcAddr6       = 27
+	flowFieldDstAddr6       = 28
+	flowFieldSampling       = 34
+	flowFieldIfName         = 82
+	flowFieldSamplingPkt    = 305
+	netflowV9ScopeInterface = 2
+)
+
+var (
+	ErrFlowPacket  = errors.New("malformed_flow_packet")
+	ErrFlowVersion = errors.New("unsupported_flow_version")
+)
+
+// FlowRecord is one decoded flow with byte and packet counts already
+// scaled by the sampling rate.
+type FlowRecord struct {
+	SrcAddr  string
+	DstAddr  string
+	SrcPort  uint16
+	DstPort  uint16
+	Protocol uint8
+	InputIf  uint32
+	OutputIf uint32
+	Bytes    uint64
+	Packets  uint64
+}
+
+type flowField struct {
+	id         uint16
+	length     uint16
+	enterprise uint32
+}
+
+type flowTemplate struct {
+	fields []flowField
+	scope  int
+}
+
+// netflowDecoder keeps the per-exporter state v9 and IPFIX need between
+// packets: templates, sampling rates and interface names learned from
+// options records. Callers serialize access.
+type netflowDecoder struct {
+	templates     map[string]flowTemplate
+	templateCount map[string]int
+	sampling      map[string]uint64
+	ifNames       map[string]map[uint32]string
+}
+
+func newNetflowDecoder() *netflowDecoder {
+	return &netflowDecoder{
+		templates:     map[string]flowTemplate{},
+		templateCount: map[string]int{},
+		sampling:      map[string]uint64{},
+		ifNames:       map[string]map[uint32]string{},
+	}
+}
+
+// setTemplate caches a template. An exporter holds at most
+// maxFlowTemplatesPerExporter; past that, new template IDs are ignored
+// and their data counts as missing templates.
+func (d *netflowDecoder) setTemplate(exporter, key string, tmpl flowTemplate) {
+	if _, ok := d.templates[key]; !ok {
+		if d.templateCount[exporter] >= maxFlowTemplatesPerExporter {
+			return
+		}
+		d.templateCount[exporter]++
+	}
+	d.templates[key] = tmpl
+}
+
+func (d *netflowDecoder) deleteTemplate(exporter, key string) {
+	if _, ok := d.templates[key]; ok {
+		delete(d.templates, key)
+		d.templateCount[exporter]--
+	}
+}
+
+// forget drops every template, sampling rate and interface name of one
+// exporter.
+func (d *netflowDecoder) forget(exporter string) {
+	prefix := exporter + "|"
+	for key := range d.templates {
+		if strings.HasPrefix(key, prefix) {
+			delete(d.templates, key)
+		}
+	}
+	for key := range d.sampling {
+		if strings.HasPrefix(key, prefix) {
+			delete(d.sampling, key)
+		}
+	}
+	delete(d.templateCount, exporter)
+	delete(d.ifNames, exporter)
+}
+
+type netflowPacket struct {
+	Version int
+	Records []FlowRecord
+	// MissingTemplate counts data sets that arrived before their template.
+	MissingTemplate int
+}
+
+func (d *netflowDecoder) Decode(exporter string, data []byte) (netflowPacket, error) {
+	if len(data) < 2 {
+		return netflowPacket{}, ErrFlowPacket
+	}
+	switch version := int(binary.BigEndian.Uint16(data)); version {
+	case 5:
+		return decodeNetflowV5(data)
+	case 9:
+		return d.decodeV9(exporter, data)
+	case 10:
+		return d.decodeIPFIX(exporter, data)
+	default:
+		return netflowPacket{Version: version}, fmt.Errorf("%w: %d", ErrFlowVersion, version)
+	}
+}
+
+// InterfaceName returns the name an exporter announced for ifIndex.
+func (d *netflowDecoder) InterfaceName(exporter string, ifIndex uint32) string {
+	return d.ifNames[exporter][ifIndex]
+}
+
+func decodeNetflowV5(data []byte) (netflowPacket, error) {
+	pkt := netflowPacket{Version: 5}
+	if len(data) < netflowV5HeaderLen {
+		return pkt, ErrFlowPacket
+	}
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	if len(data) < netflowV5HeaderLen+count*netflowV5RecordLen {
+		return pkt, ErrFlowPacket
+	}
+	// The low 14 bits carry the interval, the top two the sampling mode.
+	rate := uint64(binary.BigEndian.Uint16(data[22:]) & 0x3fff)
+	if rate == 0 {
+		rate = 1
+	}
+	for i := 0; i < count; i++ {
+		rec := data[netflowV5HeaderLen+i*netflowV5RecordLen:]
+		pkt.Records = append(pkt.Records, FlowRecord{
+			SrcAddr:  netip.AddrFrom4([4]byte(rec[0:4])).String(),
+			DstAddr:  netip.AddrFrom4([4]byte(rec[4:8])).String(),
+			InputIf:  uint32(binary.BigEndian.Uint16(rec[12:])),
+			OutputIf: uint32(binary.BigEndian.Uint16(rec[14:])),
+			Packets:  uint64(binary.BigEndian.Uint32(rec[16:])) * rate,
+			Bytes:    uint64(binary.BigEndian.Uint32(rec[20:])) * rate,
+			SrcPort:  binary.BigEndian.Uint16(rec[32:]),
+			DstPort:  binary.BigEndian.Uint16(rec[34:]),
+			Protocol: rec[38],
+		})
+	}
+	return pkt, nil
+}
+
+func (d *netflowDecoder) decodeV9(exporter string, data []byte) (netflowPacket, error) {
+	pkt := netflowPacket{Version: 9}
+	if len(data) < netflowV9HeaderLen {
+		return pkt, ErrFlowPacket
+	}
+	domain := fmt.Sprintf("%s|9|%d", exporter, binary.BigEndian.Uint32(data[16:]))
+	body := data[netflowV9HeaderLen:]
+	for len(body) >= 4 {
+		id, length := binary.BigEndian.Uint16(body), int(binary.BigEndian.Uint16(body[2:]))
+		if length < 4 || length > len(body) {
+			return pkt, ErrFlowPacket
+		}
+		set := body[4:length]
+		body = body[length:]
+		switch {
+		case id == 0:
+			for len(set) >= 4 {
+				tid, count := binary.BigEndian.Uint16(set), int(binary.BigEndian.Uint16(set[2:]))
+				if len(set) < 4+count*4 {
+					return pkt, ErrFlowPacket
+				}
+				d.setTemplate(exporter, fmt.Sprintf("%s|%d", domain, tid), flowTemplate{fields: readFlowFields(set[4:], count)})
+				set = set[4+count*4:]
+			}
+		case id == 1:
+			for len(set) >= 6 {
+				tid, scopeLen, optLen := binary.BigEndian.Uint16(set), int(binary.BigEndian.Uint16(set[2:])), int(binary.BigEndian.Uint16(set[4:]))
+				if scopeLen%4 != 0 || optLen%4 != 0 || len(set) < 6+scopeLen+optLen {
+					return pkt, ErrFlowPacket
+				}
+				if scopeLen+optLen == 0 {
+					break
+				}
+				d.setTemplate(exporter, fmt.Sprintf("%s|%d", domain, tid), flowTemplate{fields: readFlowFields(set[6:], (scopeLen+optLen)/4), scope: scopeLen / 4})
+				set = set[6+scopeLen+optLen:]
+			}
+		case id >= 256:
+			tmpl, ok := d.templates[fmt.Sprintf("%s|%d", domain, id)]
+			if !ok {
+				pkt.MissingTemplate++
+				continue
+			}
+			records, err := d.readDataSet(exporter, domain, tmpl, set, true)
+			if err != nil {
+				return pkt, err
+			}
+			pkt.Records = append(pkt.Records, records...)
+		}
+	}
+	return pkt, nil
+}
+
+func (d *netflowDecoder) decodeIPFIX(exporter string, data []byte) (netflowPacket, error) {
+	pkt := netflowPacket{Version: 10}
+	if len(data) < ipfixHeaderLen {
+		return pkt, ErrFlowPacket
+	}
+	if total := int(binary.BigEndian.Uint16(data[2:])); total >= ipfixHeaderLen && total < len(data) {
+		data = data[:total]
+	}
+	domain := fmt.Sprintf("%s|10|%d", exporter, binary.BigEndian.Uint32(data[12:]))
+	body := data[ipfixHeaderLen:]
+	for len(body) >= 4 {
+		id, length := binary.BigEndian.Uint16(body), int(binary.BigEndian.Uint16(body[2:]))
+		if length < 4 || length > len(body) {
+			return pkt, ErrFlowPacket
+		}
+		set := body[4:length]
+		body = body[length:]
+		switch {
+		case id == 2 || id == 3:
+			header := 4
+			if id == 3 {
+				header = 6
+			}
+			for len(set) >= header {
+				tid, count := binary.BigEndian.Uint16(set), int(binary.BigEndian.Uint16(set[2:]))
+				scope := 0
+				if id == 3 {
+					scope = int(binary.BigEndian.Uint16(set[4:]))
+				}
+				key := fmt.Sprintf("%s|%d", domain, tid)
+				if count == 0 {
+					// A template withdrawal, or set padding.
+					d.deleteTemplate(exporter, key)
+					break
+				}
+				fields, used, err := readIPFIXFields(set[header:], count)
+				if err != nil {
+					return pkt, err
+				}
+				d.setTemplate(exporter, key, flowTemplate{fields: fields, scope: scope})
+				set = set[header+used:]
+			}
+		case id >= 256:
+			tmpl, ok := d.templates[fmt.Sprintf("%s|%d", domain, id)]
+			if !ok {
+				pkt.MissingTemplate++
+				continue
+			}
+			records, err := d.readDataSet(exporter, domain, tmpl, set, false)
+			if err != nil {
+				return pkt, err
+			}
+			pkt.Records = append(pkt.Records, records...)
+		}
+	}
+	return pkt, nil
+}
+
+func readFlowFields(b []byte, count int) []flowField {
+	fields := make([]flowField, 0, count)
+	for i := 0; i < count; i++ {
+		fields = append(fields, flowField{id: binary.BigEndian.Uint16(b[i*4:]), length: binary.BigEndian.Uint16(b[i*4+2:])})
+	}
+	return fields
+}
+
+// readIPFIXFields reads field specifiers; a set enterprise bit adds a
+// four-byte enterprise number.
+func readIPFIXFields(b []byte, count int) ([]flowField, int, error) {
+	fields := make([]flowField, 0, count)
+	pos := 0
+	for i := 0; i < count; i++ {
+		if len(b) < pos+4 {
+			return nil, 0, ErrFlowPacket
+		}
+		f := flowField{id: binary.BigEndian.Uint16(b[pos:]), length: binary.BigEndian.Uint16(b[pos+2:])}
+		pos += 4
+		if f.id&0x8000 != 0 {
+			if len(b) < pos+4 {
+				return nil, 0, ErrFlowPacket
+			}
+			f.id &= 0x7fff
+			f.enterprise = binary.BigEndian.Uint32(b[pos:])
+			pos += 4
+		}
+		fields = append(fields, f)
+	}
+	return fields, pos, nil
+}
+
+// readDataSet decodes the records of one data set. Options records
+// update the domain's sampling rate and the exporter's interface names
+// instead of producing flows.
+func (d *netflowDecoder) readDataSet(exporter, domain string, tmpl flowTemplate, set []byte, v9 bool) ([]FlowRecord, error) {
+	minLen := 0
+	for _, f := range tmpl.fields {
+		if f.length == ipfixVarLength {
+			minLen++
+		} else {
+			minLen += int(f.length)
+		}
+	}
+	if minLen == 0 {
+		return nil, nil
+	}
+	var records []FlowRecord
+	for len(set) >= minLen {
+		rec := FlowRecord{}
+		var rate, ifIndex uint64
+		var ifName string
+		var inBytes, outBytes, inPkts, outPkts uint64
+		for i, f := range tmpl.fields {
+			size := int(f.length)
+			if f.length == ipfixVarLength {
+				if len(set) < 1 {
+					return records, ErrFlowPacket
+				}
+				size, set = int(set[0]), set[1:]
+				if size == 255 {
+					if len(set) < 2 {
+						return records, ErrFlowPacket
+					}
+					size, set = int(binary.BigEndian.Uint16(set)), set[2:]
+				}
+			}
+			if len(set) < size {
+				return records, ErrFlowPacket
+			}
+			value := set[:size]
+			set = set[size:]
+			if f.enterprise != 0 {
+				continue
+			}
+			if v9 && i < tmpl.scope {
+				// v9 scope fields use their own type numbers.
+				if f.id == netflowV9ScopeInterface {
+					ifIndex = flowUint(value)
+				}
+				continue
+			}
+			switch f.id {
+			case flowFieldInBytes:
+				inBytes = flowUint(value)
+			case flowFieldOutBytes:
+				outBytes = flowUint(value)
+			case flowFieldInPkts:
+				inPkts = flowUint(value)
+			case flowFieldOutPkts:
+				outPkts = flowUint(value)
+			case flowFieldProtocol:
+				rec.Protocol = uint8(flowUint(value))
+			case flowFieldSrcPort:
+				rec.SrcPort = uint16(flowUint(value))
+			case flowFieldDstPort:
+				rec.DstPort = uint16(flowUint(value))
+			case flowFieldSrcAddr, flowFieldSrcAddr6:
+				rec.SrcAddr = flowAddr(value)
+			case flowFieldDstAddr, flowFieldDstAddr6:
+				rec.DstAddr = flowAddr(value)
+			case flowFieldInputIf:
+				rec.InputIf = uint32(flowUint(value))
+				ifIndex = flowUint(value)
+			case flowFieldOutputIf:
+				rec.OutputIf = uint32(flowUint(value))
+			case flowFieldSampling, flowFieldSamplingPkt:
+				rate = flowUint(value)
+			case flowFieldIfName:
+				ifName = strings.TrimRight(string(value), "\x00 ")
+			}
+		}
+		if tmpl.scope > 0 {
+			if rate > 0 {
+				d.sampling[domain] = rate
+			}
+			if ifName != "" && ifIndex > 0 {
+				names := d.ifNames[exporter]
+				if names == nil {
+					names = map[uint32]string{}
+					d.ifNames[exporter] = names
+				}
+				if _, ok := names[uint32(ifIndex)]; ok || len(names) < maxFlowIfacesPerExporter {
+					names[uint32(ifIndex)] = ifName
+				}
+			}
+			continue
+		}
+		if rate == 0 {
+			rate = d.sampling[domain]
+		}
+		if rate == 0 {
+			rate = 1
+		}
+		rec.Bytes = firstNonZero(inBytes, outBytes) * rate
+		rec.Packets = firstNonZero(inPkts, outPkts) * rate
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func flowUint(b []byte) uint64 {
+	if len(b) > 8 {
+		b = b[len(b)-8:]
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func flowAddr(b []byte) string {
+	if addr, ok := netip.AddrFromSlice(b); ok {
+		return addr.Unmap().String()
+	}
+	return ""
+}
+
+func firstNonZero(values ...uint64) uint64 {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func be16(v int) []byte { return binary.BigEndian.AppendUint16(nil, uint16(v)) }
+func be32(v int) []byte { return binary.BigEndian.AppendUint32(nil, uint32(v)) }
+
+func joinBytes(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// flowSet wraps a set body with its id and length.
+func flowSet(id int, body ...[]byte) []byte {
+	b := joinBytes(body...)
+	return joinBytes(be16(id), be16(len(b)+4), b)
+}
+
+func netflowV5Packet(sampling int, records ...[]byte) []byte {
+	header := joinBytes(be16(5), be16(len(records)), be32(1000), be32(1767225600), be32(0), be32(1), []byte{0, 0}, be16(sampling))
+	return joinBytes(append([][]byte{header}, records...)...)
+}
+
+func netflowV5Record(src, dst [4]byte, in, out, pkts, octets, srcPort, dstPort, proto int) []byte {
+	rec := make([]byte, netflowV5RecordLen)
+	copy(rec[0:], src[:])
+	copy(rec[4:], dst[:])
+	binary.BigEndian.PutUint16(rec[12:], uint16(in))
+	binary.BigEndian.PutUint16(rec[14:], uint16(out))
+	binary.BigEndian.PutUint32(rec[16:], uint32(pkts))
+	binary.BigEndian.PutUint32(rec[20:], uint32(octets))
+	binary.BigEndian.PutUint16(rec[32:], uint16(srcPort))
+	binary.BigEndian.PutUint16(rec[34:], uint16(dstPort))
+	rec[38] = byte(proto)
+	return rec
+}
+
+func TestNetflowV5DecodesAndScalesBySampling(t *testing.T) {
+	d := newNetflowDecoder()
+	pkt, err := d.Decode("10.0.0.1", netflowV5Packet(0x4000|10, netflowV5Record([4]byte{192, 168, 1, 10}, [4]byte{1, 1, 1, 1}, 2, 1, 3, 1500, 51000, 443, 6)))
+	if err != nil || pkt.Version != 5 || len(pkt.Records) != 1 {
+		t.Fatalf("decode: pkt=%#v err=%v", pkt, err)
+	}
+	rec := pkt.Records[0]
+	if rec.SrcAddr != "192.168.1.10" || rec.DstAddr != "1.1.1.1" || rec.InputIf != 2 || rec.OutputIf != 1 || rec.DstPort != 443 || rec.Protocol != 6 {
+		t.Fatalf("unexpected record: %#v", rec)
+	}
+	if rec.Bytes != 15000 || rec.Packets != 30 {
+		t.Fatalf("expected 1-in-10 sampling to scale counts, got=%#v", rec)
+	}
+	if _, err := d.Decode("10.0.0.1", netflowV5Packet(0, []byte{1, 2, 3})); !errors.Is(err, ErrFlowPacket) {
+		t.Fatalf("expected short record to fail, got=%v", err)
+	}
+	if _, err := d.Decode("10.0.0.1", be16(7)); !errors.Is(err, ErrFlowVersion) {
+		t.Fatalf("expected v7 to be unsupported, got=%v", err)
+	}
+}
+
+func TestNetflowV9TemplatesOptionsAndData(t *testing.T) {
+	d := newNetflowDecoder()
+	header := func() []byte {
+		return joinBytes(be16(9), be16(0), be32(1000), be32(1767225600), be32(1), be32(7))
+	}
+	data := flowSet(256, []byte{10, 0, 0, 5}, []byte{8, 8, 8, 8}, be16(53000), be16(53), []byte{17}, be32(3), be32(1), be32(200), be32(2))
+
+	// Data ahead of its template is counted, not decoded.
+	pkt, err := d.Decode("10.0.0.1", joinBytes(header(), data))
+	if err != nil || pkt.MissingTemplate != 1 || len(pkt.Records) != 0 {
+		t.Fatalf("expected missing template, pkt=%#v err=%v", pkt, err)
+	}
+
+	template := flowSet(0, be16(256), be16(9),
+		be16(flowFieldSrcAddr), be16(4), be16(flowFieldDstAddr), be16(4),
+		be16(flowFieldSrcPort), be16(2), be16(flowFieldDstPort), be16(2),
+		be16(flowFieldProtocol), be16(1), be16(flowFieldInputIf), be16(4),
+		be16(flowFieldOutputIf), be16(4), be16(flowFieldInBytes), be16(4), be16(flowFieldInPkts), be16(4))
+	// Options template: scope interface, then sampling interval and name.
+	options := flowSet(1, be16(257), be16(4), be16(8), be16(netflowV9ScopeInterface), be16(4), be16(flowFieldSampling), be16(4), be16(flowFieldIfName), be16(4))
+	optionData := flowSet(257, be32(3), be32(100), []byte("wan\x00"), []byte{0, 0})
+	pkt, err = d.Decode("10.0.0.1", joinBytes(header(), template, options, optionData, data))
+	if err != nil || len(pkt.Records) != 1 {
+		t.Fatalf("decode: pkt=%#v err=%v", pkt, err)
+	}
+	rec := pkt.Records[0]
+	if rec.SrcAddr != "10.0.0.5" || rec.DstPort != 53 || rec.Protocol != 17 || rec.InputIf != 3 || rec.Bytes != 20000 || rec.Packets != 200 {
+		t.Fatalf("expected sampled DNS flow, got=%#v", rec)
+	}
+	if name := d.InterfaceName("10.0.0.1", 3); name != "wan" {
+		t.Fatalf("expected interface name from options data, got=%q", name)
+	}
+	// Templates are scoped per exporter.
+	if pkt, _ := d.Decode("10.0.0.2", joinBytes(header(), data)); pkt.MissingTemplate != 1 {
+		t.Fatalf("expected template not to leak across exporters")
+	}
+}
+
+func TestIPFIXEnterpriseAndVariableLengthFields(t *testing.T) {
+	d := newNetflowDecoder()
+	template := flowSet(2, be16(300), be16(4),
+		be16(flowFieldSrcAddr6), be16(16),
+		be16(0x8000|1), be16(ipfixVarLength), be32(29305),
+		be16(flowFieldInBytes), be16(8),
+		be16(flowFieldOutputIf), be16(2))
+	src := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	data := flowSet(300, src, []byte{3}, []byte("abc"), make([]byte, 7), []byte{0xff}, be16(4))
+	body := joinBytes(template, data)
+	msg := joinBytes(be16(10), be16(ipfixHeaderLen+len(body)), be32(1767225600), be32(1), be32(0), body)
+	pkt, err := d.Decode("10.0.0.3", msg)
+	if err != nil || pkt.Version != 10 || len(pkt.Records) != 1 {
+		t.Fatalf("decode: pkt=%#v err=%v", pkt, err)
+	}
+	if rec := pkt.Records[0]; rec.SrcAddr != "2001:db8::1" || rec.Bytes != 255 || rec.OutputIf != 4 {
+		t.Fatalf("expected enterprise field skipped, got=%#v", rec)
+	}
+}
@@ -0,0 +1,1069 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	otlpSource            = "otlp"
+	maxIngestBodyBytes    = 32 << 20
+	otlpTempCumulative    = 2
+	metricTargetOnline    = "online"
+	metricTargetLatency   = "latency"
+	metricTargetOperUp    = "interface.oper_up"
+	metricTargetAdminUp   = "interface.admin_up"
+	metricTargetRxBps     = "interface.rx_bps"
+	metricTargetTxBps     = "interface.tx_bps"
+	metricTargetRxBytes   = "interface.rx_bytes"
+	metricTargetTxBytes   = "interface.tx_bytes"
+	metricTargetErrorRate = "interface.error_rate"
+	metricTargetCPU       = "cpu_pct"
+	metricTargetMem       = "mem_pct"
+	metricTargetTemp      = "temp_c"
+	metricTargetUptime    = "uptime_s"
+	metricTargetGauge     = "gauge."
+)
+
+var (
+	ErrOTLPMapping     = errors.New("invalid_otlp_mapping")
+	ErrOTLPContentType = errors.New("unsupported_content_type")
+)
+
+var metricTargets = map[string]bool{
+	metricTargetOnline: true, metricTargetLatency: true,
+	metricTargetOperUp: true, metricTargetAdminUp: true,
+	metricTargetRxBps: true, metricTargetTxBps: true,
+	metricTargetRxBytes: true, metricTargetTxBytes: true,
+	metricTargetErrorRate: true,
+}
+
+// OTLPMapping says which resource attributes place a resource on a device
+// and which metrics feed which telemetry field. Metric keys are a metric
+// name, optionally narrowed by data point attributes:
+// "system.network.io{direction=receive}".
+type OTLPMapping struct {
+	DeviceAttributes    []string          `json:"device_attributes"`
+	NameAttributes      []string          `json:"name_attributes"`
+	SiteAttributes      []string          `json:"site_attributes"`
+	RoleAttributes      []string          `json:"role_attributes"`
+	InterfaceAttributes []string          `json:"interface_attributes"`
+	Metrics             map[string]string `json:"metrics"`
+}
+
+func defaultOTLPMapping() OTLPMapping {
+	return OTLPMapping{
+		DeviceAttributes:    []string{"device.id", "host.name"},
+		NameAttributes:      []string{"device.name", "host.name"},
+		SiteAttributes:      []string{"site.id", "site"},
+		RoleAttributes:      []string{"device.role"},
+		InterfaceAttributes: []string{"interface.name", "interface", "if_name", "device"},
+		Metrics: map[string]string{
+			"device.online":                         metricTargetOnline,
+			"up":                                    metricTargetOnline,
+			"device.latency":                        metricTargetLatency,
+			"interface.oper_status":                 metricTargetOperUp,
+			"interface.admin_status":                metricTargetAdminUp,
+			"interface.rx_bps":                      metricTargetRxBps,
+			"interface.tx_bps":                      metricTargetTxBps,
+			"interface.error_rate":                  metricTargetErrorRate,
+			"system.network.io{direction=receive}":  metricTargetRxBytes,
+			"system.network.io{direction=transmit}": metricTargetTxBytes,
+			"system.memory.utilization{state=used}": metricTargetMem,
+			"system.uptime":                         metricTargetUptime,
+			"hw.temperature":                        metricTargetTemp,
+		},
+	}
+}
+
+// readMappingSource returns the inline JSON value when set and otherwise
+// the contents of the file path. Both empty yields no bytes and no error.
+func readMappingSource(inline, filePath string) ([]byte, error) {
+	if raw := strings.TrimSpace(inline); raw != "" {
+		return []byte(raw), nil
+	}
+	if filePath = strings.TrimSpace(filePath); filePath == "" {
+		return nil, nil
+	}
+	return os.ReadFile(filePath)
+}
+
+// loadOTLPMapping reads a mapping from an inline JSON value or a file path.
+// Lists left empty keep their defaults; metric rules replace the defaults.
+func loadOTLPMapping(inline, filePath string) (OTLPMapping, error) {
+	raw, err := readMappingSource(inline, filePath)
+	if err != nil {
+		return OTLPMapping{}, err
+	}
+	mapping := defaultOTLPMapping()
+	if len(raw) == 0 {
+		return mapping, nil
+	}
+	var custom OTLPMapping
+	if err := json.Unmarshal(raw, &custom); err != nil {
+		return OTLPMapping{}, fmt.Errorf("%w: %v", ErrOTLPMapping, err)
+	}
+	if keys := trimLabelKeys(custom.DeviceAttributes); len(keys) > 0 {
+		mapping.DeviceAttributes = keys
+	}
+	if keys := trimLabelKeys(custom.NameAttributes); len(keys) > 0 {
+		mapping.NameAttributes = keys
+	}
+	if keys := trimLabelKeys(custom.SiteAttributes); len(keys) > 0 {
+		mapping.SiteAttributes = keys
+	}
+	if keys := trimLabelKeys(custom.RoleAttributes); len(keys) > 0 {
+		mapping.RoleAttributes = keys
+	}
+	if keys := trimLabelKeys(custom.InterfaceAttributes); len(keys) > 0 {
+		mapping.InterfaceAttributes = keys
+	}
+	if len(custom.Metrics) > 0 {
+		mapping.Metrics = custom.Metrics
+	}
+	if _, err := compileMetricRules(mapping.Metrics); err != nil {
+		return OTLPMapping{}, fmt.Errorf("%w: %v", ErrOTLPMapping, err)
+	}
+	return mapping, nil
+}
+
+type metricRule struct {
+	match  map[string]string
+	target string
+}
+
+// compileMetricRules indexes rules by metric name, most specific first.
+func compileMetricRules(metrics map[string]string) (map[string][]metricRule, error) {
+	rules := map[string][]metricRule{}
+	for key, target := range metrics {
+		target = strings.ToLower(strings.TrimSpace(target))
+		if !metricTargets[target] && !isHealthMetricTarget(target) {
+			return nil, fmt.Errorf("unknown target %q for %q", target, key)
+		}
+		name, match := strings.TrimSpace(key), map[string]string{}
+		if open := strings.Index(name, "{"); open >= 0 {
+			if !strings.HasSuffix(name, "}") {
+				return nil, fmt.Errorf("invalid metric key %q", key)
+			}
+			for _, pair := range strings.Split(name[open+1:len(name)-1], ",") {
+				k, v, ok := strings.Cut(pair, "=")
+				if !ok || strings.TrimSpace(k) == "" {
+					return nil, fmt.Errorf("invalid metric key %q", key)
+				}
+				match[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"`)
+			}
+			name = strings.TrimSpace(name[:open])
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid metric key %q", key)
+		}
+		rules[name] = append(rules[name], metricRule{match: match, target: target})
+	}
+	for name := range rules {
+		sort.SliceStable(rules[name], func(i, j int) bool { return len(rules[name][i].match) > len(rules[name][j].match) })
+	}
+	return rules, nil
+}
+
+// otlpPoint is one gauge or sum data point with its metric context.
+type otlpPoint struct {
+	Metric     string
+	Unit       string
+	Value      float64
+	TimeMs     int64
+	Cumulative bool
+	Attributes map[string]string
+}
+
+type otlpResource struct {
+	Attributes map[string]string
+	Points     []otlpPoint
+	// Unsupported counts histogram and summary points by metric name.
+	Unsupported map[string]int64
+}
+
+type OTLPIngestResult struct {
+	Source         string           `json:"source"`
+	Resources      int              `json:"resources"`
+	DataPoints     int              `json:"data_points"`
+	MappedPoints   int              `json:"mapped_points"`
+	UnmappedPoints int              `json:"unmapped_points"`
+	RejectedPoints int              `json:"rejected_points"`
+	Unmapped       map[string]int64 `json:"unmapped,omitempty"`
+	Devices        int              `json:"devices"`
+	Ingested       int              `json:"ingested"`
+	Dropped        int              `json:"dropped"`
+	Incidents      int              `json:"incidents"`
+}
+
+// counterRates keeps the last value of each byte counter so cumulative
+// counters pushed by OTLP and remote_write senders become bit rates.
+type counterRates struct {
+	mu   sync.Mutex
+	last map[string]counterSample
+}
+
+type counterSample struct {
+	value float64
+	atMs  int64
+}
+
+func newCounterRates() *counterRates {
+	return &counterRates{last: map[string]counterSample{}}
+}
+
+// bitsPerSecond returns the rate since the previous value of key. The first
+// value and counter resets only seed the state.
+func (c *counterRates) bitsPerSecond(key string, value float64, atMs int64, bits bool) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev, seen := c.last[key]
+	if seen && atMs < prev.atMs {
+		return 0, false
+	}
+	c.last[key] = counterSample{value: value, atMs: atMs}
+	if !seen || atMs == prev.atMs || value < prev.value {
+		return 0, false
+	}
+	delta := value - prev.value
+	if !bits {
+		delta *= 8
+	}
+	return math.Round(delta/(float64(atMs-prev.atMs)/1000)*100) / 100, true
+}
+
+// matchMetricRule returns the target of the first rule for name whose
+// label filters all match.
+func matchMetricRule(rules map[string][]metricRule, name string, labels map[string]string) (string, bool) {
+	for _, rule := range rules[name] {
+		matched := true
+		for k, v := range rule.match {
+			if labels[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule.target, true
+		}
+	}
+	return "", false
+}
+
+// metricSample is one mapped value from a receiver that carries a flat
+// label set per value (remote_write, Influx line protocol).
+type metricSample struct {
+	deviceID string
+	labels   map[string]string
+	name     string
+	unit     string
+	target   string
+	value    float64
+	atMs     int64
+	// delta marks an OTLP delta sum, which carries no running total for
+	// a byte counter to difference.
+	delta bool
+}
+
+// metricLabelKeys names the labels that fill device metadata and the
+// interface name.
+type metricLabelKeys struct {
+	name     []string
+	hostname []string
+	site     []string
+	role     []string
+	iface    []string
+}
+
+type metricGroupStats struct {
+	mapped   int
+	devices  int
+	unmapped map[string]int64
+}
+
+// groupMetricSamples emits one telemetry sample per device and timestamp,
+// oldest first, so a batch holding several collection rounds reaches the
+// sampling governor in order and counter rates see every step. Interface
+// values without an interface label are counted as unmapped.
+func groupMetricSamples(source string, samples []metricSample, keys metricLabelKeys, counters *counterRates) ([]TelemetryIngestRequest, metricGroupStats) {
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].atMs < samples[j].atMs })
+	type pending struct {
+		ev     *TelemetryIngestRequest
+		ifaces map[string]*TelemetryInterfaceFact
+		order  []string
+	}
+	stats := metricGroupStats{unmapped: map[string]int64{}}
+	byKey := map[string]*pending{}
+	order := make([]string, 0)
+	devices := map[string]bool{}
+	for _, m := range samples {
+		var ifaceName string
+		if strings.HasPrefix(m.target, "interface.") {
+			if ifaceName = firstAttribute(m.labels, keys.iface); ifaceName == "" {
+				stats.unmapped[m.name]++
+				continue
+			}
+		}
+		key := m.deviceID + "|" + strconv.FormatInt(m.atMs, 10)
+		p := byKey[key]
+		if p == nil {
+			p = &pending{ev: &TelemetryIngestRequest{
+				Source:       source,
+				DeviceID:     m.deviceID,
+				Device:       firstAttribute(m.labels, keys.name),
+				Hostname:     firstAttribute(m.labels, keys.hostname),
+				SiteID:       firstAttribute(m.labels, keys.site),
+				Role:         firstAttribute(m.labels, keys.role),
+				ObservedAtMs: m.atMs,
+			}, ifaces: map[string]*TelemetryInterfaceFact{}}
+			byKey[key] = p
+			order = append(order, key)
+		}
+		stats.mapped++
+		devices[m.deviceID] = true
+		switch m.target {
+		case metricTargetOnline:
+			online := m.value > 0
+			p.ev.Online = &online
+			continue
+		case metricTargetLatency:
+			latency := latencyMsForUnit(m.value, m.unit)
+			p.ev.LatencyMs = &latency
+			continue
+		}
+		if isHealthMetricTarget(m.target) {
+			setHealthMetric(p.ev, m.target, m.value, m.unit)
+			continue
+		}
+		fact := p.ifaces[ifaceName]
+		if fact == nil {
+			fact = &TelemetryInterfaceFact{Name: ifaceName}
+			p.ifaces[ifaceName] = fact
+			p.order = append(p.order, ifaceName)
+		}
+		switch m.target {
+		case metricTargetOperUp:
+			up := m.value == 1
+			fact.OperUp = &up
+		case metricTargetAdminUp:
+			up := m.value == 1
+			fact.AdminUp = &up
+		case metricTargetRxBps:
+			bps := bitsPerSecondForUnit(m.value, m.unit)
+			fact.RxBps = &bps
+		case metricTargetTxBps:
+			bps := bitsPerSecondForUnit(m.value, m.unit)
+			fact.TxBps = &bps
+		case metricTargetErrorRate:
+			rate := m.value
+			fact.ErrorRate = &rate
+		case metricTargetRxBytes:
+			if bps, ok := counterBitsPerSecond(counters, m, m.deviceID+"|"+ifaceName+"|rx"); ok {
+				fact.RxBps = &bps
+			}
+		case metricTargetTxBytes:
+			if bps, ok := counterBitsPerSecond(counters, m, m.deviceID+"|"+ifaceName+"|tx"); ok {
+				fact.TxBps = &bps
+			}
+		}
+	}
+
+	events := make([]TelemetryIngestRequest, 0, len(order))
+	for _, key := range order {
+		p := byKey[key]
+		for _, name := range p.order {
+			p.ev.Interfaces = append(p.ev.Interfaces, *p.ifaces[name])
+		}
+		events = append(events, *p.ev)
+	}
+	stats.devices = len(devices)
+	return events, stats
+}
+
+// OTLPReceiver converts OTLP metrics into telemetry samples.
+type OTLPReceiver struct {
+	source   string
+	mapping  OTLPMapping
+	rules    map[string][]metricRule
+	counters *counterRates
+}
+
+func NewOTLPReceiver(source string, mapping OTLPMapping) *OTLPReceiver {
+	rules, err := compileMetricRules(mapping.Metrics)
+	if err != nil {
+		rules = map[string][]metricRule{}
+	}
+	return &OTLPReceiver{
+		source:   firstNonEmpty(strings.ToLower(strings.TrimSpace(source)), otlpSource),
+		mapping:  mapping,
+		rules:    rules,
+		counters: newCounterRates(),
+	}
+}
+
+func (r *OTLPReceiver) Name() string {
+	return r.source
+}
+
+func (r *OTLPReceiver) Mapping() OTLPMapping {
+	return r.mapping
+}
+
+func (r *OTLPReceiver) rule(point otlpPoint) (string, bool) {
+	return matchMetricRule(r.rules, point.Metric, point.Attributes)
+}
+
+// Convert maps the points of every resource that names a device, then
+// merges them per device and timestamp like the other metric receivers.
+// Points from resources without a device attribute are rejected; points
+// with no mapping rule are counted by metric name.
+func (r *OTLPReceiver) Convert(resources []otlpResource, nowMs int64) ([]TelemetryIngestRequest, OTLPIngestResult) {
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+	result := OTLPIngestResult{Source: r.source, Resources: len(resources), Unmapped: map[string]int64{}}
+	samples := make([]metricSample, 0)
+	for _, res := range resources {
+		unsupported := 0
+		for _, count := range res.Unsupported {
+			unsupported += int(count)
+		}
+		result.DataPoints += len(res.Points) + unsupported
+		deviceID := firstAttribute(res.Attributes, r.mapping.DeviceAttributes)
+		if deviceID == "" {
+			result.RejectedPoints += len(res.Points) + unsupported
+			continue
+		}
+		for name, count := range res.Unsupported {
+			result.UnmappedPoints += int(count)
+			result.Unmapped[name] += count
+		}
+		// Points without a timestamp join the resource's latest collection
+		// round instead of starting a sample of their own.
+		resourceAt := int64(0)
+		for _, point := range res.Points {
+			resourceAt = max(resourceAt, point.TimeMs)
+		}
+		if resourceAt <= 0 {
+			resourceAt = nowMs
+		}
+		for _, point := range res.Points {
+			target, ok := r.rule(point)
+			if !ok {
+				result.UnmappedPoints++
+				result.Unmapped[point.Metric]++
+				continue
+			}
+			at := point.TimeMs
+			if at <= 0 {
+				at = resourceAt
+			}
+			// Resource attributes describe the device and win over point
+			// attributes, which only need to name the interface.
+			labels := make(map[string]string, len(point.Attributes)+len(res.Attributes))
+			for k, v := range point.Attributes {
+				labels[k] = v
+			}
+			for k, v := range res.Attributes {
+				labels[k] = v
+			}
+			samples = append(samples, metricSample{
+				deviceID: deviceID,
+				labels:   labels,
+				name:     point.Metric,
+				unit:     point.Unit,
+				target:   target,
+				value:    point.Value,
+				atMs:     at,
+				delta:    !point.Cumulative,
+			})
+		}
+	}
+	keys := metricLabelKeys{
+		name:     r.mapping.NameAttributes,
+		hostname: []string{"host.name"},
+		site:     r.mapping.SiteAttributes,
+		role:     r.mapping.RoleAttributes,
+		iface:    r.mapping.InterfaceAttributes,
+	}
+	events, grouped := groupMetricSamples(r.source, samples, keys, r.counters)
+	result.MappedPoints = grouped.mapped
+	for name, count := range grouped.unmapped {
+		result.UnmappedPoints += int(count)
+		result.Unmapped[name] += count
+	}
+	result.Devices = grouped.devices
+	if len(result.Unmapped) == 0 {
+		result.Unmapped = nil
+	}
+	return events, result
+}
+
+// counterBitsPerSecond turns a byte or bit counter sample into a rate.
+func counterBitsPerSecond(counters *counterRates, m metricSample, key string) (float64, bool) {
+	if m.delta {
+		return 0, false
+	}
+	return counters.bitsPerSecond(key, m.value, m.atMs, strings.HasPrefix(strings.ToLower(m.unit), "bit"))
+}
+
+func firstAttribute(attrs map[string]string, keys []string) string {
+	for _, key := range keys {
+		if v := strings.TrimSpace(attrs[key]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// latencyMsForUnit converts a latency in UCUM units to milliseconds;
+// unitless values are taken as milliseconds.
+func latencyMsForUnit(v float64, unit string) float64 {
+	switch strings.TrimSpace(unit) {
+	case "s":
+		v *= 1000
+	case "us":
+		v /= 1000
+	case "ns":
+		v /= 1e6
+	}
+	return math.Round(v*1000) / 1000
+}
+
+func bitsPerSecondForUnit(v float64, unit string) float64 {
+	switch strings.TrimSpace(unit) {
+	case "By/s", "By", "bytes/s":
+		return v * 8
+	}
+	return v
+}
+
+// readIngestBody undoes Content-Encoding gzip and caps the decoded size.
+func readIngestBody(encoding string, body []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		out, err := io.ReadAll(io.LimitReader(zr, maxIngestBodyBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > maxIngestBodyBytes {
+			return nil, errors.New("body_too_large")
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// decodeOTLPMetrics reads an ExportMetricsServiceRequest in the protobuf or
+// JSON encoding.
+func decodeOTLPMetrics(contentType string, body []byte) ([]otlpResource, bool, error) {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch mediaType {
+	case "application/x-protobuf", "application/protobuf":
+		resources, err := decodeOTLPMetricsProto(body)
+		return resources, true, err
+	case "application/json":
+		resources, err := decodeOTLPMetricsJSON(body)
+		return resources, false, err
+	default:
+		return nil, false, ErrOTLPContentType
+	}
+}
+
+// OTLP protobuf field numbers (opentelemetry/proto/metrics/v1).
+func decodeOTLPMetricsProto(body []byte) ([]otlpResource, error) {
+	var resources []otlpResource
+	r := newProtoReader(body)
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if field != 1 || wireType != protoBytes {
+			if err := r.skip(wireType); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		msg, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		res, err := decodeOTLPResourceMetrics(msg)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+func decodeOTLPResourceMetrics(msg []byte) (otlpResource, error) {
+	res := otlpResource{Attributes: map[string]string{}, Unsupported: map[string]int64{}}
+	r := newProtoReader(msg)
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			return res, err
+		}
+		if wireType != protoBytes || (field != 1 && field != 2 && field != 1000) {
+			if err := r.skip(wireType); err != nil {
+				return res, err
+			}
+			continue
+		}
+		sub, err := r.bytes()
+		if err != nil {
+			return res, err
+		}
+		if field == 1 {
+			err = decodeOTLPAttributesField(sub, 1, res.Attributes)
+		} else {
+			// ScopeMetrics, or InstrumentationLibraryMetrics from older
+			// senders, which has the same layout.
+			err = decodeOTLPScopeMetrics(sub, &res)
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// decodeOTLPAttributesField reads the repeated KeyValue at field into attrs.
+func decodeOTLPAttributesField(msg []byte, field int, attrs map[string]string) error {
+	r := newProtoReader(msg)
+	for !r.done() {
+		f, wireType, err := r.next()
+		if err != nil {
+			return err
+		}
+		if f != field || wireType != protoBytes {
+			if err := r.skip(wireType); err != nil {
+				return err
+			}
+			continue
+		}
+		kv, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		key, value, err := decodeOTLPKeyValue(kv)
+		if err != nil {
+			return err
+		}
+		if key != "" {
+			attrs[key] = value
+		}
+	}
+	return nil
+}
+
+func decodeOTLPKeyValue(msg []byte) (string, string, error) {
+	var key, value string
+	r := newProtoReader(msg)
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			return "", "", err
+		}
+		switch {
+		case field == 1 && wireType == protoBytes:
+			if key, err = r.string(); err != nil {
+				return "", "", err
+			}
+		case field == 2 && wireType == protoBytes:
+			anyValue, err := r.bytes()
+			if err != nil {
+				return "", "", err
+			}
+			if value, err = decodeOTLPAnyValue(anyValue); err != nil {
+				return "", "", err
+			}
+		default:
+			if err := r.skip(wireType); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	return key, value, nil
+}
+
+// decodeOTLPAnyValue renders scalar values as strings; arrays, key-value
+// lists and bytes are not useful as device attributes and read as empty.
+func decodeOTLPAnyValue(msg []byte) (string, error) {
+	value := ""
+	r := newProtoReader(msg)
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case field == 1 && wireType == protoBytes:
+			if value, err = r.string(); err != nil {
+				return "", err
+			}
+		case field == 2 && wireType == protoVarint:
+			v, err := r.varint()
+			if err != nil {
+				return "", err
+			}
+			value = strconv.FormatBool(v != 0)
+		case field == 3 && wireType == protoVarint:
+			v, err := r.varint()
+			if err != nil {
+				return "", err
+			}
+			value = strconv.FormatInt(int64(v), 10)
+		case field == 4 && wireType == protoFixed64:
+			v, err := r.double()
+			if err != nil {
+				return "", err
+			}
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			if err := r.skip(wireType); err != nil {
+				return "", err
+			}
+		}
+	}
+	return value, nil
+}
+
+func decodeOTLPScopeMetrics(msg []byte, res *otlpResource) error {
+	r := newProtoReader(msg)
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			return err
+		}
+		if field != 2 || wireType != protoBytes {
+			if err := r.skip(wireType); err != nil {
+				return err
+			}
+			continue
+		}
+		metric, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		if err := decodeOTLPMetric(metric, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeOTLPMetric(msg []byte, res *otlpResource) error {
+	var name, unit string
+	var points []otlpPoint
+	cumulative, unsupported := false, int64(0)
+	r := newProtoReader(msg)
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wireType == protoBytes:
+			if name, err = r.string(); err != nil {
+				return err
+			}
+		case field == 3 && wireType == protoBytes:
+			if unit, err = r.string(); err != nil {
+				return err
+			}
+		case (field == 5 || field == 7) && wireType == protoBytes:
+			// Gauge and Sum both carry NumberDataPoints at field 1; Sum adds
+			// aggregation temporality at field 2.
+			data, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			dr := newProtoReader(data)
+			for !dr.done() {
+				f, wt, err := dr.next()
+				if err != nil {
+					return err
+				}
+				switch {
+				case f == 1 && wt == protoBytes:
+					raw, err := dr.bytes()
+					if err != nil {
+						return err
+					}
+					point, err := decodeOTLPNumberPoint(raw)
+					if err != nil {
+						return err
+					}
+					points = append(points, point)
+				case f == 2 && wt == protoVarint && field == 7:
+					v, err := dr.varint()
+					if err != nil {
+						return err
+					}
+					cumulative = v == otlpTempCumulative
+				default:
+					if err := dr.skip(wt); err != nil {
+						return err
+					}
+				}
+			}
+		case (field == 9 || field == 10 || field == 11) && wireType == protoBytes:
+			data, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			unsupported += countProtoField(data, 1)
+		default:
+			if err := r.skip(wireType); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range points {
+		points[i].Metric, points[i].Unit, points[i].Cumulative = name, unit, cumulative
+	}
+	res.Points = append(res.Points, points...)
+	if unsupported > 0 {
+		res.Unsupported[name] += unsupported
+	}
+	return nil
+}
+
+func decodeOTLPNumberPoint(msg []byte) (otlpPoint, error) {
+	point := otlpPoint{Attributes: map[string]string{}}
+	r := newProtoReader(msg)
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			return point, err
+		}
+		switch {
+		case field == 3 && wireType == protoFixed64:
+			v, err := r.fixed64()
+			if err != nil {
+				return point, err
+			}
+			point.TimeMs = int64(v / uint64(time.Millisecond))
+		case field == 4 && wireType == protoFixed64:
+			if point.Value, err = r.double(); err != nil {
+				return point, err
+			}
+		case field == 6 && wireType == protoFixed64:
+			v, err := r.fixed64()
+			if err != nil {
+				return point, err
+			}
+			point.Value = float64(int64(v))
+		case field == 7 && wireType == protoBytes:
+			kv, err := r.bytes()
+			if err != nil {
+				return point, err
+			}
+			key, value, err := decodeOTLPKeyValue(kv)
+			if err != nil {
+				return point, err
+			}
+			if key != "" {
+				point.Attributes[key] = value
+			}
+		default:
+			if err := r.skip(wireType); err != nil {
+				return point, err
+			}
+		}
+	}
+	return point, nil
+}
+
+func countProtoField(msg []byte, field int) int64 {
+	count := int64(0)
+	r := newProtoReader(msg)
+	for !r.done() {
+		f, wireType, err := r.next()
+		if err != nil || r.skip(wireType) != nil {
+			return count
+		}
+		if f == field {
+			count++
+		}
+	}
+	return count
+}
+
+// OTLP/JSON uses lowerCamelCase names, 64-bit integers as strings and enum
+// values as numbers.
+type otlpJSONRequest struct {
+	ResourceMetrics []struct {
+		Resource struct {
+			Attributes []otlpJSONKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeMetrics []otlpJSONScopeMetrics `json:"scopeMetrics"`
+		// Pre-1.0 senders.
+		InstrumentationLibraryMetrics []otlpJSONScopeMetrics `json:"instrumentationLibraryMetrics"`
+	} `json:"resourceMetrics"`
+}
+
+type otlpJSONScopeMetrics struct {
+	Metrics []struct {
+		Name  string `json:"name"`
+		Unit  string `json:"unit"`
+		Gauge *struct {
+			DataPoints []otlpJSONNumberPoint `json:"dataPoints"`
+		} `json:"gauge"`
+		Sum *struct {
+			DataPoints             []otlpJSONNumberPoint `json:"dataPoints"`
+			AggregationTemporality json.RawMessage       `json:"aggregationTemporality"`
+		} `json:"sum"`
+		Histogram            *otlpJSONPointCount `json:"histogram"`
+		ExponentialHistogram *otlpJSONPointCount `json:"exponentialHistogram"`
+		Summary              *otlpJSONPointCount `json:"summary"`
+	} `json:"metrics"`
+}
+
+type otlpJSONPointCount struct {
+	DataPoints []json.RawMessage `json:"dataPoints"`
+}
+
+type otlpJSONNumberPoint struct {
+	Attributes   []otlpJSONKeyValue `json:"attributes"`
+	TimeUnixNano json.RawMessage    `json:"timeUnixNano"`
+	AsDouble     json.RawMessage    `json:"asDouble"`
+	AsInt        json.RawMessage    `json:"asInt"`
+}
+
+type otlpJSONKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string         `json:"stringValue"`
+		BoolValue   *bool           `json:"boolValue"`
+		IntValue    json.RawMessage `json:"intValue"`
+		DoubleValue json.RawMessage `json:"doubleValue"`
+	} `json:"value"`
+}
+
+func decodeOTLPMetricsJSON(body []byte) ([]otlpResource, error) {
+	var req otlpJSONRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	resources := make([]otlpResource, 0, len(req.ResourceMetrics))
+	for _, rm := range req.ResourceMetrics {
+		res := otlpResource{Attributes: otlpJSONAttributes(rm.Resource.Attributes), Unsupported: map[string]int64{}}
+		for _, scope := range append(rm.ScopeMetrics, rm.InstrumentationLibraryMetrics...) {
+			for _, metric := range scope.Metrics {
+				var raw []otlpJSONNumberPoint
+				cumulative := false
+				switch {
+				case metric.Gauge != nil:
+					raw = metric.Gauge.DataPoints
+				case metric.Sum != nil:
+					raw = metric.Sum.DataPoints
+					temporality := strings.Trim(string(metric.Sum.AggregationTemporality), `"`)
+					cumulative = temporality == "2" || temporality == "AGGREGATION_TEMPORALITY_CUMULATIVE"
+				}
+				for _, hist := range []*otlpJSONPointCount{metric.Histogram, metric.ExponentialHistogram, metric.Summary} {
+					if hist != nil && len(hist.DataPoints) > 0 {
+						res.Unsupported[metric.Name] += int64(len(hist.DataPoints))
+					}
+				}
+				for _, dp := range raw {
+					value, ok := jsonNumberish(dp.AsDouble)
+					if !ok {
+						if value, ok = jsonNumberish(dp.AsInt); !ok {
+							continue
+						}
+					}
+					nanos, _ := jsonNumberish(dp.TimeUnixNano)
+					res.Points = append(res.Points, otlpPoint{
+						Metric:     metric.Name,
+						Unit:       metric.Unit,
+						Value:      value,
+						TimeMs:     int64(nanos / float64(time.Millisecond)),
+						Cumulative: cumulative,
+						Attributes: otlpJSONAttributes(dp.Attributes),
+					})
+				}
+			}
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+func otlpJSONAttributes(kvs []otlpJSONKeyValue) map[string]string {
+	attrs := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		switch {
+		case kv.Value.StringValue != nil:
+			attrs[kv.Key] = *kv.Value.StringValue
+		case kv.Value.BoolValue != nil:
+			attrs[kv.Key] = strconv.FormatBool(*kv.Value.BoolValue)
+		case len(kv.Value.IntValue) > 0:
+			attrs[kv.Key] = strings.Trim(string(kv.Value.IntValue), `"`)
+		case len(kv.Value.DoubleValue) > 0:
+			if v, ok := jsonNumberish(kv.Value.DoubleValue); ok {
+				attrs[kv.Key] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+	}
+	return attrs
+}
+
+// jsonNumberish reads a JSON number or a number in a JSON string.
+func jsonNumberish(raw json.RawMessage) (float64, bool) {
+	text := strings.Trim(strings.TrimSpace(string(raw)), `"`)
+	if text == "" || text == "null" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// otlpExportResponse encodes ExportMetricsServiceResponse, reporting
+// rejected points as a partial success.
+func otlpExportResponse(protobuf bool, rejected int, message string) ([]byte, string) {
+	if protobuf {
+		if rejected == 0 {
+			return nil, "application/x-protobuf"
+		}
+		var partial protoWriter
+		partial.varintField(1, uint64(rejected))
+		partial.bytesField(2, []byte(message))
+		var resp protoWriter
+		resp.bytesField(1, partial.buf)
+		return resp.buf, "application/x-protobuf"
+	}
+	if rejected == 0 {
+		return []byte(`{}`), "application/json"
+	}
+	body, _ := json.Marshal(map[string]any{"partialSuccess": map[string]string{
+		"rejectedDataPoints": strconv.Itoa(rejected),
+		"errorMessage":       message,
+	}})
+	return body, "application/json"
+}
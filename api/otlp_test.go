@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// otlpKV encodes a KeyValue with a string AnyValue.
+func otlpKV(key, value string) []byte {
+	var anyValue protoWriter
+	anyValue.bytesField(1, []byte(value))
+	var kv protoWriter
+	kv.bytesField(1, []byte(key))
+	kv.bytesField(2, anyValue.buf)
+	return kv.buf
+}
+
+func otlpNumberPoint(value float64, at time.Time, attrs ...[]byte) []byte {
+	var dp protoWriter
+	dp.fixed64Field(3, uint64(at.UnixNano()))
+	dp.doubleField(4, value)
+	for _, kv := range attrs {
+		dp.bytesField(7, kv)
+	}
+	return dp.buf
+}
+
+// otlpMetric encodes a Metric; sum metrics are cumulative.
+func otlpMetric(name, unit string, sum bool, points ...[]byte) []byte {
+	var data protoWriter
+	for _, p := range points {
+		data.bytesField(1, p)
+	}
+	var m protoWriter
+	m.bytesField(1, []byte(name))
+	m.bytesField(3, []byte(unit))
+	if sum {
+		data.varintField(2, otlpTempCumulative)
+		m.bytesField(7, data.buf)
+	} else {
+		m.bytesField(5, data.buf)
+	}
+	return m.buf
+}
+
+func otlpRequest(resourceAttrs [][]byte, metrics ...[]byte) []byte {
+	var resource protoWriter
+	for _, kv := range resourceAttrs {
+		resource.bytesField(1, kv)
+	}
+	var scope protoWriter
+	for _, m := range metrics {
+		scope.bytesField(2, m)
+	}
+	var rm protoWriter
+	rm.bytesField(1, resource.buf)
+	rm.bytesField(2, scope.buf)
+	var req protoWriter
+	req.bytesField(1, rm.buf)
+	return req.buf
+}
+
+func TestOTLPProtobufMapsDevicesAndCounters(t *testing.T) {
+	receiver := NewOTLPReceiver("", defaultOTLPMapping())
+	at := time.Now().Add(-time.Minute).Truncate(time.Second)
+	attrs := [][]byte{otlpKV("host.name", "tower-7-sbc"), otlpKV("site.id", "tower-7")}
+	first := otlpRequest(attrs,
+		otlpMetric("device.online", "", false, otlpNumberPoint(1, at)),
+		otlpMetric("device.latency", "s", false, otlpNumberPoint(0.0125, at)),
+		otlpMetric("system.network.io", "By", true,
+			otlpNumberPoint(1000, at, otlpKV("device", "eth0"), otlpKV("direction", "receive")),
+			otlpNumberPoint(5000, at, otlpKV("device", "eth0"), otlpKV("direction", "transmit"))),
+		otlpMetric("system.cpu.time", "s", true, otlpNumberPoint(42, at)),
+	)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(first)
+	_ = zw.Close()
+	body, err := readIngestBody("gzip", gz.Bytes())
+	if err != nil {
+		t.Fatalf("gunzip: %v", err)
+	}
+	resources, protobuf, err := decodeOTLPMetrics("application/x-protobuf", body)
+	if err != nil || !protobuf || len(resources) != 1 {
+		t.Fatalf("decode: resources=%d protobuf=%v err=%v", len(resources), protobuf, err)
+	}
+	events, result := receiver.Convert(resources, 0)
+	if len(events) != 1 || result.MappedPoints != 4 || result.UnmappedPoints != 1 || result.Unmapped["system.cpu.time"] != 1 {
+		t.Fatalf("unexpected conversion: events=%#v result=%#v", events, result)
+	}
+	ev := events[0]
+	if ev.DeviceID != "tower-7-sbc" || ev.SiteID != "tower-7" || ev.Online == nil || !*ev.Online || ev.LatencyMs == nil || *ev.LatencyMs != 12.5 {
+		t.Fatalf("unexpected device mapping: %#v", ev)
+	}
+	if len(ev.Interfaces) != 1 || ev.Interfaces[0].RxBps != nil {
+		t.Fatalf("expected first counter point to only seed the rate, got=%#v", ev.Interfaces)
+	}
+
+	// Ten seconds later the counters moved by 10 kB and 20 kB.
+	second := otlpRequest(attrs, otlpMetric("system.network.io", "By", true,
+		otlpNumberPoint(11000, at.Add(10*time.Second), otlpKV("device", "eth0"), otlpKV("direction", "receive")),
+		otlpNumberPoint(25000, at.Add(10*time.Second), otlpKV("device", "eth0"), otlpKV("direction", "transmit"))))
+	resources, _, _ = decodeOTLPMetrics("application/x-protobuf; charset=binary", second)
+	events, _ = receiver.Convert(resources, 0)
+	eth0 := events[0].Interfaces[0]
+	if eth0.RxBps == nil || *eth0.RxBps != 8000 || eth0.TxBps == nil || *eth0.TxBps != 16000 {
+		t.Fatalf("expected counter deltas as bit rates, got=%#v", eth0)
+	}
+
+	store := LoadStore("")
+	ingested, _, _ := ingestSourceEvents(store, events)
+	store.RecordUnmappedMetrics(receiver.Name(), result.Unmapped, 0)
+	if ingested != 1 {
+		t.Fatalf("expected sample to ingest, got=%d", ingested)
+	}
+	if health := store.TelemetryIngestionHealth(); health.UnmappedMetricPoints != 1 {
+		t.Fatalf("expected unmapped points in ingestion health, got=%#v", health)
+	}
+	for _, card := range store.TelemetryQualityReport().Scorecards {
+		if card.Source == otlpSource && (len(card.Stats.UnmappedMetricNames) != 1 || card.Stats.UnmappedMetricNames[0] != "system.cpu.time") {
+			t.Fatalf("expected unmapped metric name on scorecard, got=%#v", card.Stats)
+		}
+	}
+}
+
+func TestOTLPJSONAndCustomMapping(t *testing.T) {
+	mapping, err := loadOTLPMapping(`{"device_attributes":["nocwall.device_id"],"metrics":{"ping.rtt":"latency","ifOperStatus":"interface.oper_up"}}`, "")
+	if err != nil {
+		t.Fatalf("mapping: %v", err)
+	}
+	if _, err := loadOTLPMapping(`{"metrics":{"cpu":"cpu_percent"}}`, ""); !errors.Is(err, ErrOTLPMapping) {
+		t.Fatalf("expected unknown target to be rejected, got=%v", err)
+	}
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	if err := os.WriteFile(path, []byte(`{"metrics":{"ping.rtt":"latency"}}`), 0o600); err != nil {
+		t.Fatalf("write mapping: %v", err)
+	}
+	if raw, err := readMappingSource(" ", path); err != nil || !strings.Contains(string(raw), "ping.rtt") {
+		t.Fatalf("expected file fallback, raw=%q err=%v", raw, err)
+	}
+	if raw, err := readMappingSource(`{"metrics":{}}`, path); err != nil || string(raw) != `{"metrics":{}}` {
+		t.Fatalf("expected inline value to win, raw=%q err=%v", raw, err)
+	}
+
+	body := []byte(`{"resourceMetrics":[
+		{"resource":{"attributes":[{"key":"nocwall.device_id","value":{"stringValue":"ap-12"}},{"key":"host.name","value":{"stringValue":"ap-12.example.net"}}]},
+		 "scopeMetrics":[{"metrics":[
+			{"name":"ping.rtt","unit":"ms","gauge":{"dataPoints":[{"timeUnixNano":"1767225600000000000","asDouble":3.25}]}},
+			{"name":"ifOperStatus","gauge":{"dataPoints":[{"asInt":"2","attributes":[{"key":"interface.name","value":{"stringValue":"ath0"}}]}]}},
+			{"name":"http.server.duration","histogram":{"dataPoints":[{"count":"3"}]}}
+		 ]}]},
+		{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"collector"}}]},
+		 "scopeMetrics":[{"metrics":[{"name":"ping.rtt","gauge":{"dataPoints":[{"asDouble":1}]}}]}]}
+	]}`)
+	resources, protobuf, err := decodeOTLPMetrics("application/json", body)
+	if err != nil || protobuf {
+		t.Fatalf("decode json: %v", err)
+	}
+	events, result := NewOTLPReceiver("agents", mapping).Convert(resources, 0)
+	if len(events) != 1 || result.RejectedPoints != 1 || result.Unmapped["http.server.duration"] != 1 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+	ev := events[0]
+	if ev.Source != "agents" || ev.DeviceID != "ap-12" || ev.Hostname != "ap-12.example.net" || *ev.LatencyMs != 3.25 || ev.ObservedAtMs != 1767225600000 {
+		t.Fatalf("unexpected event: %#v", ev)
+	}
+	if len(ev.Interfaces) != 1 || ev.Interfaces[0].OperUp == nil || *ev.Interfaces[0].OperUp {
+		t.Fatalf("expected ifOperStatus 2 to read as down, got=%#v", ev.Interfaces)
+	}
+
+	resp, contentType := otlpExportResponse(false, result.RejectedPoints, "no device")
+	if contentType != "application/json" || string(resp) != `{"partialSuccess":{"errorMessage":"no device","rejectedDataPoints":"1"}}` {
+		t.Fatalf("unexpected partial success body: %s", resp)
+	}
+	if _, _, err := decodeOTLPMetrics("text/plain", body); !errors.Is(err, ErrOTLPContentType) {
+		t.Fatalf("expected content type error, got=%v", err)
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSourceMaxPages = 50
+	maxSourceMaxPages     = 1000
+	maxSourcePollRecords  = 20000
+)
+
+// ErrSourceNextOrigin rejects a Link header or cursor URL that points away
+// from the configured base URL, so credentials never follow it elsewhere.
+var ErrSourceNextOrigin = errors.New("next_url_origin_mismatch")
+
+var linkHeaderPattern = regexp.MustCompile(`<([^>]*)>((?:\s*;\s*[^;,]+)*)`)
+
+// PaginationConfig selects how a connector walks a paged device list.
+//
+//	none   single request
+//	link   RFC 5988 Link header rel="next" (Meraki)
+//	offset offset/limit query params, stops on an empty page
+//	page   page number query param, stops on an empty page
+//	cursor next token (or next URL) read from the body at CursorPath
+//
+// Offset and page walks do not stop on a short page: servers may cap the
+// page size below PageSize, and a short page would then cut the list.
+type PaginationConfig struct {
+	Mode        string `json:"mode"`
+	PageSize    int    `json:"page_size,omitempty"`
+	MaxPages    int    `json:"max_pages,omitempty"`
+	SizeParam   string `json:"size_param,omitempty"`
+	OffsetParam string `json:"offset_param,omitempty"`
+	OffsetBase  int    `json:"offset_base,omitempty"`
+	PageParam   string `json:"page_param,omitempty"`
+	FirstPage   int    `json:"first_page,omitempty"`
+	CursorParam string `json:"cursor_param,omitempty"`
+	CursorPath  string `json:"cursor_path,omitempty"`
+}
+
+type pagedFetchResult struct {
+	Records   []uiSPDeviceRecord
+	Pages     int
+	Truncated bool
+	// Problems is set, possibly empty, by fetchers that also read the
+	// source's active alerts; nil means the source has none to report.
+	Problems []SourceProblem
+}
+
+func normalizePaginationConfig(cfg PaginationConfig) PaginationConfig {
+	cfg.Mode = strings.ToLower(strings.TrimSpace(cfg.Mode))
+	switch cfg.Mode {
+	case "link", "offset", "page", "cursor":
+	default:
+		cfg.Mode = "none"
+	}
+	if cfg.MaxPages <= 0 {
+		cfg.MaxPages = defaultSourceMaxPages
+	}
+	if cfg.MaxPages > maxSourceMaxPages {
+		cfg.MaxPages = maxSourceMaxPages
+	}
+	if cfg.PageSize < 0 {
+		cfg.PageSize = 0
+	}
+	cfg.SizeParam = strings.TrimSpace(cfg.SizeParam)
+	if cfg.SizeParam == "" && cfg.Mode != "link" {
+		cfg.SizeParam = "limit"
+	}
+	if (cfg.Mode == "offset" || cfg.Mode == "page") && cfg.PageSize == 0 {
+		cfg.PageSize = 100
+	}
+	cfg.OffsetParam = firstNonEmpty(strings.TrimSpace(cfg.OffsetParam), "offset")
+	cfg.PageParam = firstNonEmpty(strings.TrimSpace(cfg.PageParam), "page")
+	if cfg.FirstPage <= 0 {
+		cfg.FirstPage = 1
+	}
+	if cfg.OffsetBase < 0 {
+		cfg.OffsetBase = 0
+	}
+	cfg.CursorParam = firstNonEmpty(strings.TrimSpace(cfg.CursorParam), "cursor")
+	cfg.CursorPath = strings.TrimSpace(cfg.CursorPath)
+	if cfg.Mode == "cursor" && cfg.CursorPath == "" {
+		cfg.CursorPath = "$.next"
+	}
+	return cfg
+}
+
+// paginationConfigFromEnv reads <PREFIX>_PAGINATION and friends, keeping
+// connector defaults for anything unset.
+func paginationConfigFromEnv(prefix string, defaults PaginationConfig) PaginationConfig {
+	cfg := defaults
+	cfg.Mode = getenv(prefix+"_PAGINATION", cfg.Mode)
+	cfg.PageSize = getenvInt(prefix+"_PAGE_SIZE", cfg.PageSize)
+	cfg.MaxPages = getenvInt(prefix+"_MAX_PAGES", cfg.MaxPages)
+	cfg.SizeParam = getenv(prefix+"_PAGE_SIZE_PARAM", cfg.SizeParam)
+	cfg.OffsetParam = getenv(prefix+"_OFFSET_PARAM", cfg.OffsetParam)
+	cfg.OffsetBase = getenvInt(prefix+"_OFFSET_BASE", cfg.OffsetBase)
+	cfg.PageParam = getenv(prefix+"_PAGE_PARAM", cfg.PageParam)
+	cfg.CursorParam = getenv(prefix+"_CURSOR_PARAM", cfg.CursorParam)
+	cfg.CursorPath = getenv(prefix+"_CURSOR_PATH", cfg.CursorPath)
+	return normalizePaginationConfig(cfg)
+}
+
+func withQueryParams(rawURL string, params map[string]string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := parsed.Query()
+	for key, value := range params {
+		if strings.TrimSpace(key) == "" {
+			continue
+		}
+		q.Set(key, value)
+	}
+	parsed.RawQuery = q.Encode()
+	return parsed.String(), nil
+}
+
+// parseLinkHeaderNext returns the rel="next" target of an RFC 5988 Link
+// header, resolved against the request URL.
+func parseLinkHeaderNext(header, requestURL string) string {
+	for _, match := range linkHeaderPattern.FindAllStringSubmatch(header, -1) {
+		target := strings.TrimSpace(match[1])
+		isNext := false
+		for _, param := range strings.Split(match[2], ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+				if strings.EqualFold(rel, "next") {
+					isNext = true
+				}
+			}
+		}
+		if !isNext || target == "" {
+			continue
+		}
+		base, err := url.Parse(requestURL)
+		if err != nil {
+			return target
+		}
+		ref, err := url.Parse(target)
+		if err != nil {
+			return ""
+		}
+		return base.ResolveReference(ref).String()
+	}
+	return ""
+}
+
+// sameOrigin reports whether two URLs share scheme and host (with port).
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+func cursorFromBody(body []byte, path string) string {
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return jsonPathString(payload, path)
+}
+
+func countPageItems(body []byte) int {
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0
+	}
+	return len(extractVendorItems(payload))
+}
+
+// fetchPagedRecords walks every page of a device list. Each page gets its
+// own retry budget so one flaky page does not restart the whole walk.
+func fetchPagedRecords(
+	ctx context.Context,
+	client *http.Client,
+	firstURL string,
+	cfg PaginationConfig,
+	retries int,
+	label string,
+	auth ConnectorAuth,
+	guard *SourceGuard,
+	parse func([]byte) ([]uiSPDeviceRecord, error),
+	count func([]byte) int,
+) (pagedFetchResult, error) {
+	cfg = normalizePaginationConfig(cfg)
+	if count == nil {
+		count = countPageItems
+	}
+
+	params := map[string]string{}
+	if cfg.PageSize > 0 && cfg.SizeParam != "" {
+		params[cfg.SizeParam] = strconv.Itoa(cfg.PageSize)
+	}
+	offset := cfg.OffsetBase
+	page := cfg.FirstPage
+	switch cfg.Mode {
+	case "offset":
+		params[cfg.OffsetParam] = strconv.Itoa(offset)
+	case "page":
+		params[cfg.PageParam] = strconv.Itoa(page)
+	}
+	pageURL := firstURL
+	if len(params) > 0 {
+		built, err := withQueryParams(firstURL, params)
+		if err != nil {
+			return pagedFetchResult{}, err
+		}
+		pageURL = built
+	}
+
+	result := pagedFetchResult{}
+	seenURLs := map[string]bool{}
+	lastCursor := ""
+	for pageURL != "" {
+		if result.Pages >= cfg.MaxPages {
+			result.Truncated = true
+			break
+		}
+		if seenURLs[pageURL] {
+			break
+		}
+		seenURLs[pageURL] = true
+
+		var (
+			pageRecords []uiSPDeviceRecord
+			itemCount   int
+		)
+		body, header, err := fetchPageBody(ctx, client, pageURL, retries, label, auth, guard, func(body []byte) error {
+			itemCount = count(body)
+			// An empty page after the first one just means the list ended.
+			if result.Pages > 0 && itemCount == 0 {
+				pageRecords = nil
+				return nil
+			}
+			recs, err := parse(body)
+			pageRecords = recs
+			return err
+		})
+		if err != nil {
+			if result.Pages > 0 {
+				return result, fmt.Errorf("%s page %d: %w", label, result.Pages+1, err)
+			}
+			return result, err
+		}
+		result.Pages++
+		if itemCount == 0 && (result.Pages > 1 || cfg.Mode == "offset" || cfg.Mode == "page") {
+			break
+		}
+		result.Records = append(result.Records, pageRecords...)
+		if len(result.Records) > maxSourcePollRecords {
+			result.Records = result.Records[:maxSourcePollRecords]
+			result.Truncated = true
+			break
+		}
+
+		next := ""
+		switch cfg.Mode {
+		case "link":
+			next = parseLinkHeaderNext(header.Get("Link"), pageURL)
+		case "offset":
+			offset += itemCount
+			next, err = withQueryParams(pageURL, map[string]string{cfg.OffsetParam: strconv.Itoa(offset)})
+		case "page":
+			page++
+			next, err = withQueryParams(pageURL, map[string]string{cfg.PageParam: strconv.Itoa(page)})
+		case "cursor":
+			token := cursorFromBody(body, cfg.CursorPath)
+			switch {
+			case token == "" || token == lastCursor:
+			case strings.HasPrefix(token, "http://"), strings.HasPrefix(token, "https://"), strings.HasPrefix(token, "/"):
+				next = parseLinkHeaderNext("<"+token+">; rel=next", pageURL)
+			default:
+				next, err = withQueryParams(pageURL, map[string]string{cfg.CursorParam: token})
+			}
+			lastCursor = token
+		}
+		if err != nil {
+			return result, err
+		}
+		if next != "" && !sameOrigin(next, firstURL) {
+			return result, fmt.Errorf("%s page %d: %w", label, result.Pages+1, ErrSourceNextOrigin)
+		}
+		pageURL = next
+	}
+	return result, nil
+}
+
+// fetchPageBody GETs one page with the connector retry/backoff policy.
+// validate lets callers retry pages whose body does not parse. A 401 from
+// a login-based auth provider triggers one re-auth outside the retry budget.
+// 429/503 responses wait out Retry-After instead of the fixed backoff.
+func fetchPageBody(ctx context.Context, client *http.Client, pageURL string, retries int, label string, auth ConnectorAuth, guard *SourceGuard, validate func([]byte) error) ([]byte, http.Header, error) {
+	return doSourceRequest(ctx, client, http.MethodGet, pageURL, nil, retries, label, auth, guard, validate)
+}
+
+// postSourceBody POSTs a JSON payload under the same policy, for RPC-style
+// APIs such as Zabbix.
+func postSourceBody(ctx context.Context, client *http.Client, endpoint string, payload []byte, retries int, label string, auth ConnectorAuth, guard *SourceGuard, validate func([]byte) error) ([]byte, http.Header, error) {
+	return doSourceRequest(ctx, client, http.MethodPost, endpoint, payload, retries, label, auth, guard, validate)
+}
+
+func doSourceRequest(ctx context.Context, client *http.Client, method, pageURL string, payload []byte, retries int, label string, auth ConnectorAuth, guard *SourceGuard, validate func([]byte) error) ([]byte, http.Header, error) {
+	if retries < 0 {
+		retries = 0
+	}
+	var lastErr error
+	reauthed := false
+	for attempt := 0; attempt <= retries; attempt++ {
+		if err := guard.Acquire(ctx); err != nil {
+			return nil, nil, err
+		}
+		var reqBody io.Reader
+		if payload != nil {
+			reqBody = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, pageURL, reqBody)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if auth != nil {
+			if err := auth.Apply(ctx, req); err != nil {
+				lastErr = err
+				if attempt < retries {
+					time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
+					continue
+				}
+				break
+			}
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			if attempt < retries {
+				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
+				continue
+			}
+			break
+		}
+
+		body, readErr := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if readErr != nil {
+			lastErr = readErr
+			if attempt < retries {
+				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
+				continue
+			}
+			break
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && !reauthed && auth != nil && auth.Invalidate() {
+			reauthed = true
+			attempt--
+			continue
+		}
+		if isThrottleStatus(resp.StatusCode) {
+			retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			guard.NoteThrottle(retryAfter)
+			lastErr = fmt.Errorf("%s status %d: %w", label, resp.StatusCode, ErrSourceRateLimited)
+			if attempt >= retries || retryAfter > maxSourceGuardWait {
+				break
+			}
+			if retryAfter <= 0 {
+				retryAfter = time.Duration(attempt+1) * 500 * time.Millisecond
+			} else if guard != nil {
+				// guard.Acquire waits out the Retry-After window.
+				continue
+			}
+			time.Sleep(retryAfter)
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			lastErr = fmt.Errorf("%s status %d", label, resp.StatusCode)
+			if attempt < retries {
+				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
+				continue
+			}
+			break
+		}
+
+		if validate != nil {
+			if err := validate(body); err != nil {
+				lastErr = err
+				if attempt < retries {
+					time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
+					continue
+				}
+				break
+			}
+		}
+		return body, resp.Header, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%s poll failed", label)
+	}
+	return nil, nil, lastErr
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func pagedTestDevices(start, count int) string {
+	items := make([]string, 0, count)
+	for i := start; i < start+count; i++ {
+		items = append(items, fmt.Sprintf(`{"id":"dev-%d","name":"Device %d","status":"online"}`, i, i))
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+func TestVendorConnectorFollowsLinkHeaderWithPerPageRetry(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		page2Attempts int
+		perPage       string
+	)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("startingAfter") {
+		case "":
+			mu.Lock()
+			perPage = r.URL.Query().Get("perPage")
+			mu.Unlock()
+			w.Header().Set("Link", `<`+server.URL+`/devices/statuses?perPage=2&startingAfter=dev-1>; rel=next, <`+server.URL+`/devices/statuses?perPage=2>; rel=first`)
+			_, _ = w.Write([]byte(pagedTestDevices(0, 2)))
+		case "dev-1":
+			mu.Lock()
+			page2Attempts++
+			attempt := page2Attempts
+			mu.Unlock()
+			if attempt == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Link", `</devices/statuses?perPage=2&startingAfter=dev-3>; rel="next"`)
+			_, _ = w.Write([]byte(pagedTestDevices(2, 2)))
+		case "dev-3":
+			_, _ = w.Write([]byte(pagedTestDevices(4, 1)))
+		}
+	}))
+	defer server.Close()
+
+	connector := NewVendorConnector("meraki", "Meraki", server.URL, "meraki-key", "/devices/statuses", "x-cisco-meraki-api-key")
+	connector.SetPagination(PaginationConfig{Mode: "link", PageSize: 2, SizeParam: "perPage"})
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 3, Retries: 1})
+	if err != nil {
+		t.Fatalf("expected paged poll to succeed, got=%v", err)
+	}
+	if perPage != "2" {
+		t.Fatalf("expected perPage on first request, got=%q", perPage)
+	}
+	if page2Attempts != 2 {
+		t.Fatalf("expected page 2 to be retried once, attempts=%d", page2Attempts)
+	}
+	if batch.Response.Pages != 3 || batch.Response.Fetched != 5 {
+		t.Fatalf("expected 3 pages and 5 fetched, got pages=%d fetched=%d", batch.Response.Pages, batch.Response.Fetched)
+	}
+	if !batch.Response.Truncated || batch.Response.Normalized != 3 {
+		t.Fatalf("expected poll limit to truncate normalized records, got=%#v", batch.Response)
+	}
+	if status := connector.Status(); status.LastPages != 3 || status.LastFetched != 5 {
+		t.Fatalf("expected status to record pages and full fetch count, got=%#v", status)
+	}
+}
+
+func TestFetchPagedRecordsOffsetAndPageCap(t *testing.T) {
+	const total = 7
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		count := limit
+		if offset+count > total {
+			count = total - offset
+		}
+		if count < 0 {
+			count = 0
+		}
+		_, _ = w.Write([]byte(`{"items":` + pagedTestDevices(offset, count) + `}`))
+	}))
+	defer server.Close()
+
+	parse := func(body []byte) ([]uiSPDeviceRecord, error) {
+		return parseVendorDevices(body, "cisco", "Cisco")
+	}
+	result, err := fetchPagedRecords(context.Background(), server.Client(), server.URL+"/devices", PaginationConfig{Mode: "offset", PageSize: 3}, 0, "cisco", nil, nil, parse, nil)
+	if err != nil {
+		t.Fatalf("offset walk: %v", err)
+	}
+	if len(result.Records) != total || result.Pages != 4 || result.Truncated {
+		t.Fatalf("expected 7 records over 3 pages plus the empty end page, got records=%d pages=%d truncated=%t", len(result.Records), result.Pages, result.Truncated)
+	}
+	if result.Records[6].ID != "dev-6" {
+		t.Fatalf("expected records in page order, got last=%q", result.Records[6].ID)
+	}
+
+	capped, err := fetchPagedRecords(context.Background(), server.Client(), server.URL+"/devices", PaginationConfig{Mode: "offset", PageSize: 2, MaxPages: 2}, 0, "cisco", nil, nil, parse, nil)
+	if err != nil {
+		t.Fatalf("capped walk: %v", err)
+	}
+	if len(capped.Records) != 4 || !capped.Truncated {
+		t.Fatalf("expected page cap to truncate at 4 records, got records=%d truncated=%t", len(capped.Records), capped.Truncated)
+	}
+}
+
+func TestFetchPagedRecordsKeepsWalkingPastServerPageCap(t *testing.T) {
+	const (
+		total     = 7
+		serverCap = 2
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start := (page - 1) * serverCap
+		count := min(serverCap, max(total-start, 0))
+		_, _ = w.Write([]byte(pagedTestDevices(start, count)))
+	}))
+	defer server.Close()
+
+	parse := func(body []byte) ([]uiSPDeviceRecord, error) {
+		return parseVendorDevices(body, "cisco", "Cisco")
+	}
+	result, err := fetchPagedRecords(context.Background(), server.Client(), server.URL+"/devices", PaginationConfig{Mode: "page", PageSize: 5}, 0, "cisco", nil, nil, parse, nil)
+	if err != nil {
+		t.Fatalf("page walk: %v", err)
+	}
+	if len(result.Records) != total || result.Truncated {
+		t.Fatalf("expected all %d records despite the server capping pages at %d, got records=%d truncated=%t", total, serverCap, len(result.Records), result.Truncated)
+	}
+}
+
+func TestFetchPagedRecordsRejectsCrossOriginNextURL(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		otherHits int
+	)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		otherHits++
+		mu.Unlock()
+		_, _ = w.Write([]byte(pagedTestDevices(2, 2)))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `<`+other.URL+`/devices?page=2>; rel="next"`)
+		_, _ = w.Write([]byte(pagedTestDevices(0, 2)))
+	}))
+	defer server.Close()
+
+	parse := func(body []byte) ([]uiSPDeviceRecord, error) {
+		return parseVendorDevices(body, "meraki", "Meraki")
+	}
+	_, err := fetchPagedRecords(context.Background(), server.Client(), server.URL+"/devices", PaginationConfig{Mode: "link"}, 0, "meraki", nil, nil, parse, nil)
+	if !errors.Is(err, ErrSourceNextOrigin) {
+		t.Fatalf("expected cross-origin next URL to be rejected, got=%v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if otherHits != 0 {
+		t.Fatalf("expected no request to the other origin, got=%d", otherHits)
+	}
+}
+
+func TestFetchPagedRecordsCursorInBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			_, _ = w.Write([]byte(`{"devices":` + pagedTestDevices(0, 2) + `,"meta":{"next_token":"abc"}}`))
+		case "abc":
+			_, _ = w.Write([]byte(`{"devices":` + pagedTestDevices(2, 2) + `,"meta":{"next_token":""}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	connector := NewUISPConnector(server.URL, "uisp-token", "/nms/api/v2.1/devices")
+	connector.SetPagination(PaginationConfig{Mode: "cursor", CursorPath: "$.meta.next_token"})
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("cursor poll: %v", err)
+	}
+	if batch.Response.Pages != 2 || batch.Response.Fetched != 4 || batch.Response.Truncated {
+		t.Fatalf("expected 2 pages and 4 records, got=%#v", batch.Response)
+	}
+}
+
+func TestParseLinkHeaderNext(t *testing.T) {
+	header := `<https://api.example.net/v1/devices?page=1>; rel="first", </v1/devices?page=3>; rel="prev next"`
+	if got := parseLinkHeaderNext(header, "https://api.example.net/v1/devices?page=2"); got != "https://api.example.net/v1/devices?page=3" {
+		t.Fatalf("expected resolved next link, got=%q", got)
+	}
+	if got := parseLinkHeaderNext(`<https://x/y>; rel="last"`, "https://x/z"); got != "" {
+		t.Fatalf("expected no next link, got=%q", got)
+	}
+}
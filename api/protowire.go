@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Protobuf wire types used by the OTLP and remote_write decoders.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+var ErrProtoMalformed = errors.New("malformed_protobuf")
+
+// protoReader walks one protobuf message without generated code. The
+// receivers only need a handful of fields, so unknown fields are skipped
+// instead of pulling in the protobuf runtime.
+type protoReader struct {
+	buf []byte
+	pos int
+}
+
+func newProtoReader(buf []byte) *protoReader {
+	return &protoReader{buf: buf}
+}
+
+func (r *protoReader) done() bool {
+	return r.pos >= len(r.buf)
+}
+
+// next reads a field tag.
+func (r *protoReader) next() (int, int, error) {
+	tag, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	field, wireType := int(tag>>3), int(tag&7)
+	if field <= 0 {
+		return 0, 0, ErrProtoMalformed
+	}
+	return field, wireType, nil
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, ErrProtoMalformed
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *protoReader) fixed64() (uint64, error) {
+	if len(r.buf)-r.pos < 8 {
+		return 0, ErrProtoMalformed
+	}
+	v := binary.LittleEndian.Uint64(r.buf[r.pos:])
+	r.pos += 8
+	return v, nil
+}
+
+func (r *protoReader) double() (float64, error) {
+	v, err := r.fixed64()
+	return math.Float64frombits(v), err
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	size, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(len(r.buf)-r.pos) {
+		return nil, ErrProtoMalformed
+	}
+	out := r.buf[r.pos : r.pos+int(size)]
+	r.pos += int(size)
+	return out, nil
+}
+
+func (r *protoReader) string() (string, error) {
+	b, err := r.bytes()
+	return string(b), err
+}
+
+func (r *protoReader) skip(wireType int) error {
+	switch wireType {
+	case protoVarint:
+		_, err := r.varint()
+		return err
+	case protoFixed64:
+		_, err := r.fixed64()
+		return err
+	case protoBytes:
+		_, err := r.bytes()
+		return err
+	case protoFixed32:
+		if len(r.buf)-r.pos < 4 {
+			return ErrProtoMalformed
+		}
+		r.pos += 4
+		return nil
+	default:
+		return ErrProtoMalformed
+	}
+}
+
+// protoWriter builds the small responses the receivers send back.
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) varintField(field int, v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field<<3|protoVarint))
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *protoWriter) bytesField(field int, b []byte) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field<<3|protoBytes))
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *protoWriter) doubleField(field int, v float64) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field<<3|protoFixed64))
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+}
+
+func (w *protoWriter) fixed64Field(field int, v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field<<3|protoFixed64))
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, v)
+}
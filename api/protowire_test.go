@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProtoReaderRoundTripAndTruncation(t *testing.T) {
+	var inner protoWriter
+	inner.varintField(1, 300)
+	var msg protoWriter
+	msg.bytesField(1, []byte("edge-1"))
+	msg.doubleField(2, 12.5)
+	msg.bytesField(3, inner.buf)
+	msg.fixed64Field(4, 7)
+
+	r := newProtoReader(msg.buf)
+	seen := map[int]bool{}
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		seen[field] = true
+		switch field {
+		case 1:
+			if s, err := r.string(); err != nil || s != "edge-1" {
+				t.Fatalf("string field: %q %v", s, err)
+			}
+		case 2:
+			if v, err := r.double(); err != nil || v != 12.5 {
+				t.Fatalf("double field: %v %v", v, err)
+			}
+		default:
+			if err := r.skip(wireType); err != nil {
+				t.Fatalf("skip field %d: %v", field, err)
+			}
+		}
+	}
+	if len(seen) != 4 {
+		t.Fatalf("expected four fields, got=%v", seen)
+	}
+
+	truncated := newProtoReader(msg.buf[:4])
+	if _, _, err := truncated.next(); err != nil {
+		t.Fatalf("tag should still read: %v", err)
+	}
+	if _, err := truncated.string(); !errors.Is(err, ErrProtoMalformed) {
+		t.Fatalf("expected malformed error for truncated length, got=%v", err)
+	}
+}
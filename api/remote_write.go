@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+const remoteWriteSource = "prometheus"
+
+var (
+	ErrRemoteWriteMapping     = errors.New("invalid_remote_write_mapping")
+	ErrRemoteWriteContentType = errors.New("unsupported_remote_write_content_type")
+	ErrRemoteWriteVersion     = errors.New("unsupported_remote_write_version")
+)
+
+// RemoteWriteMapping says which labels place a series on a device and
+// which series feed which telemetry field. Series keys use the same
+// "name{label=value}" form and targets as the OTLP mapping.
+type RemoteWriteMapping struct {
+	DeviceLabels    []string          `json:"device_labels"`
+	NameLabels      []string          `json:"name_labels"`
+	SiteLabels      []string          `json:"site_labels"`
+	RoleLabels      []string          `json:"role_labels"`
+	InterfaceLabels []string          `json:"interface_labels"`
+	Series          map[string]string `json:"series"`
+}
+
+func defaultRemoteWriteMapping() RemoteWriteMapping {
+	return RemoteWriteMapping{
+		DeviceLabels:    []string{"device_id", "instance"},
+		NameLabels:      []string{"device", "sysName"},
+		SiteLabels:      []string{"site_id", "site"},
+		RoleLabels:      []string{"role", "device_role"},
+		InterfaceLabels: []string{"ifName", "ifDescr", "interface"},
+		Series: map[string]string{
+			"probe_success":          metricTargetOnline,
+			"probe_duration_seconds": metricTargetLatency,
+			"ifOperStatus":           metricTargetOperUp,
+			"ifAdminStatus":          metricTargetAdminUp,
+			"ifHCInOctets":           metricTargetRxBytes,
+			"ifHCOutOctets":          metricTargetTxBytes,
+		},
+	}
+}
+
+// loadRemoteWriteMapping reads a mapping from an inline JSON value or a file
+// path. Label lists left empty keep their defaults; series rules replace the
+// defaults.
+func loadRemoteWriteMapping(inline, filePath string) (RemoteWriteMapping, error) {
+	raw, err := readMappingSource(inline, filePath)
+	if err != nil {
+		return RemoteWriteMapping{}, err
+	}
+	mapping := defaultRemoteWriteMapping()
+	if len(raw) == 0 {
+		return mapping, nil
+	}
+	var custom RemoteWriteMapping
+	if err := json.Unmarshal(raw, &custom); err != nil {
+		return RemoteWriteMapping{}, fmt.Errorf("%w: %v", ErrRemoteWriteMapping, err)
+	}
+	if keys := trimLabelKeys(custom.DeviceLabels); len(keys) > 0 {
+		mapping.DeviceLabels = keys
+	}
+	if keys := trimLabelKeys(custom.NameLabels); len(keys) > 0 {
+		mapping.NameLabels = keys
+	}
+	if keys := trimLabelKeys(custom.SiteLabels); len(keys) > 0 {
+		mapping.SiteLabels = keys
+	}
+	if keys := trimLabelKeys(custom.RoleLabels); len(keys) > 0 {
+		mapping.RoleLabels = keys
+	}
+	if keys := trimLabelKeys(custom.InterfaceLabels); len(keys) > 0 {
+		mapping.InterfaceLabels = keys
+	}
+	if len(custom.Series) > 0 {
+		mapping.Series = custom.Series
+	}
+	if _, err := compileMetricRules(mapping.Series); err != nil {
+		return RemoteWriteMapping{}, fmt.Errorf("%w: %v", ErrRemoteWriteMapping, err)
+	}
+	return mapping, nil
+}
+
+type promSample struct {
+	Value       float64
+	TimestampMs int64
+}
+
+type promSeries struct {
+	Labels  map[string]string
+	Samples []promSample
+}
+
+type RemoteWriteResult struct {
+	Source          string           `json:"source"`
+	Series          int              `json:"series"`
+	Samples         int              `json:"samples"`
+	MappedSamples   int              `json:"mapped_samples"`
+	UnmappedSamples int              `json:"unmapped_samples"`
+	RejectedSamples int              `json:"rejected_samples"`
+	StaleSamples    int              `json:"stale_samples"`
+	Unmapped        map[string]int64 `json:"unmapped,omitempty"`
+	Devices         int              `json:"devices"`
+	Events          int              `json:"events"`
+	Ingested        int              `json:"ingested"`
+	Dropped         int              `json:"dropped"`
+	Incidents       int              `json:"incidents"`
+}
+
+// decodeRemoteWrite reads a snappy-compressed prometheus.WriteRequest
+// (remote_write 1.0). Remote write 2.0 bodies are refused so the sender
+// falls back to 1.0.
+func decodeRemoteWrite(contentType, encoding string, body []byte) ([]promSeries, error) {
+	mediaType, params, _ := strings.Cut(strings.ToLower(contentType), ";")
+	if mediaType = strings.TrimSpace(mediaType); mediaType != "" && mediaType != "application/x-protobuf" {
+		return nil, ErrRemoteWriteContentType
+	}
+	if proto := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(params), "proto=")); proto != "" && proto != "prometheus.writerequest" {
+		return nil, ErrRemoteWriteVersion
+	}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "snappy":
+		size, err := snappy.DecodedLen(body)
+		if err != nil {
+			return nil, err
+		}
+		if size > maxIngestBodyBytes {
+			return nil, errors.New("body_too_large")
+		}
+		if body, err = snappy.Decode(nil, body); err != nil {
+			return nil, err
+		}
+	case "", "identity":
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	var series []promSeries
+	r := newProtoReader(body)
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if field != 1 || wireType != protoBytes {
+			if err := r.skip(wireType); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		msg, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		ts, err := decodePromTimeSeries(msg)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, ts)
+	}
+	return series, nil
+}
+
+// decodePromTimeSeries reads labels (field 1) and float samples (field 2);
+// exemplars and native histograms are skipped.
+func decodePromTimeSeries(msg []byte) (promSeries, error) {
+	ts := promSeries{Labels: map[string]string{}}
+	r := newProtoReader(msg)
+	for !r.done() {
+		field, wireType, err := r.next()
+		if err != nil {
+			return ts, err
+		}
+		if wireType != protoBytes || (field != 1 && field != 2) {
+			if err := r.skip(wireType); err != nil {
+				return ts, err
+			}
+			continue
+		}
+		sub, err := r.bytes()
+		if err != nil {
+			return ts, err
+		}
+		sr := newProtoReader(sub)
+		var name, value string
+		var sample promSample
+		for !sr.done() {
+			f, wt, err := sr.next()
+			if err != nil {
+				return ts, err
+			}
+			switch {
+			case field == 1 && f == 1 && wt == protoBytes:
+				name, err = sr.string()
+			case field == 1 && f == 2 && wt == protoBytes:
+				value, err = sr.string()
+			case field == 2 && f == 1 && wt == protoFixed64:
+				sample.Value, err = sr.double()
+			case field == 2 && f == 2 && wt == protoVarint:
+				var v uint64
+				v, err = sr.varint()
+				sample.TimestampMs = int64(v)
+			default:
+				err = sr.skip(wt)
+			}
+			if err != nil {
+				return ts, err
+			}
+		}
+		if field == 1 {
+			ts.Labels[name] = value
+		} else {
+			ts.Samples = append(ts.Samples, sample)
+		}
+	}
+	return ts, nil
+}
+
+// RemoteWriteReceiver converts remote_write series into telemetry samples.
+type RemoteWriteReceiver struct {
+	source   string
+	mapping  RemoteWriteMapping
+	rules    map[string][]metricRule
+	counters *counterRates
+}
+
+func NewRemoteWriteReceiver(source string, mapping RemoteWriteMapping) *RemoteWriteReceiver {
+	rules, err := compileMetricRules(mapping.Series)
+	if err != nil {
+		rules = map[string][]metricRule{}
+	}
+	return &RemoteWriteReceiver{
+		source:   firstNonEmpty(strings.ToLower(strings.TrimSpace(source)), remoteWriteSource),
+		mapping:  mapping,
+		rules:    rules,
+		counters: newCounterRates(),
+	}
+}
+
+func (r *RemoteWriteReceiver) Name() string {
+	return r.source
+}
+
+func (r *RemoteWriteReceiver) Mapping() RemoteWriteMapping {
+	return r.mapping
+}
+
+// Convert maps each sample, then merges them per device and timestamp.
+func (r *RemoteWriteReceiver) Convert(series []promSeries, nowMs int64) ([]TelemetryIngestRequest, RemoteWriteResult) {
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+	result := RemoteWriteResult{Source: r.source, Series: len(series), Unmapped: map[string]int64{}}
+	samples := make([]metricSample, 0, len(series))
+	for _, ts := range series {
+		result.Samples += len(ts.Samples)
+		name := ts.Labels["__name__"]
+		target, ok := matchMetricRule(r.rules, name, ts.Labels)
+		if !ok {
+			result.UnmappedSamples += len(ts.Samples)
+			result.Unmapped[name] += int64(len(ts.Samples))
+			continue
+		}
+		deviceID := firstAttribute(ts.Labels, r.mapping.DeviceLabels)
+		if deviceID == "" {
+			result.RejectedSamples += len(ts.Samples)
+			continue
+		}
+		deviceID = alertTargetHost(deviceID)
+		for _, sample := range ts.Samples {
+			// NaN carries Prometheus staleness markers.
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				result.StaleSamples++
+				continue
+			}
+			at := sample.TimestampMs
+			if at <= 0 {
+				at = nowMs
+			}
+			samples = append(samples, metricSample{deviceID: deviceID, labels: ts.Labels, name: name, unit: promUnit(name), target: target, value: sample.Value, atMs: at})
+		}
+	}
+	keys := metricLabelKeys{name: r.mapping.NameLabels, site: r.mapping.SiteLabels, role: r.mapping.RoleLabels, iface: r.mapping.InterfaceLabels}
+	events, grouped := groupMetricSamples(r.source, samples, keys, r.counters)
+	result.MappedSamples = grouped.mapped
+	for name, count := range grouped.unmapped {
+		result.UnmappedSamples += int(count)
+		result.Unmapped[name] += count
+	}
+	result.Devices = grouped.devices
+	result.Events = len(events)
+	if len(result.Unmapped) == 0 {
+		result.Unmapped = nil
+	}
+	return events, result
+}
+
+// promUnit reads the unit Prometheus naming conventions put in the suffix.
+func promUnit(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(name, "_microseconds"):
+		return "us"
+	case strings.HasSuffix(name, "_bytes_per_second"), strings.HasSuffix(name, "_bytes"):
+		return "By/s"
+	case strings.HasSuffix(name, "_bits"), strings.Contains(name, "_bits_"):
+		return "bit"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+type promSampleSpec struct {
+	value float64
+	atMs  int64
+}
+
+// promTimeSeries encodes a TimeSeries; labels are name/value pairs.
+func promTimeSeries(labels []string, samples ...promSampleSpec) []byte {
+	var ts protoWriter
+	for i := 0; i+1 < len(labels); i += 2 {
+		var l protoWriter
+		l.bytesField(1, []byte(labels[i]))
+		l.bytesField(2, []byte(labels[i+1]))
+		ts.bytesField(1, l.buf)
+	}
+	for _, s := range samples {
+		var sample protoWriter
+		sample.doubleField(1, s.value)
+		sample.varintField(2, uint64(s.atMs))
+		ts.bytesField(2, sample.buf)
+	}
+	return ts.buf
+}
+
+func promWriteRequest(series ...[]byte) []byte {
+	var req protoWriter
+	for _, ts := range series {
+		req.bytesField(1, ts)
+	}
+	return snappy.Encode(nil, req.buf)
+}
+
+func TestRemoteWriteMapsProbesAndCounters(t *testing.T) {
+	base := int64(1_767_225_600_000)
+	body := promWriteRequest(
+		promTimeSeries([]string{"__name__", "probe_success", "instance", "10.0.0.5:9115", "site", "tower-3", "job", "blackbox"},
+			promSampleSpec{1, base}, promSampleSpec{0, base + 15_000}),
+		promTimeSeries([]string{"__name__", "probe_duration_seconds", "instance", "10.0.0.5:9115"},
+			promSampleSpec{0.012, base}, promSampleSpec{math.NaN(), base + 15_000}),
+		promTimeSeries([]string{"__name__", "ifHCInOctets", "instance", "10.0.0.5", "ifName", "ether1"},
+			promSampleSpec{1_000, base}, promSampleSpec{16_000, base + 15_000}),
+		promTimeSeries([]string{"__name__", "ifOperStatus", "instance", "10.0.0.5", "ifName", "ether1"},
+			promSampleSpec{2, base + 15_000}),
+		promTimeSeries([]string{"__name__", "node_load1", "instance", "10.0.0.5"}, promSampleSpec{0.4, base}),
+		promTimeSeries([]string{"__name__", "probe_success", "job", "blackbox"}, promSampleSpec{1, base}),
+	)
+	series, err := decodeRemoteWrite("application/x-protobuf", "snappy", body)
+	if err != nil || len(series) != 6 {
+		t.Fatalf("decode: series=%d err=%v", len(series), err)
+	}
+
+	receiver := NewRemoteWriteReceiver("", defaultRemoteWriteMapping())
+	events, result := receiver.Convert(series, base+20_000)
+	if result.Samples != 9 || result.UnmappedSamples != 1 || result.Unmapped["node_load1"] != 1 || result.RejectedSamples != 1 || result.StaleSamples != 1 {
+		t.Fatalf("unexpected counts: %#v", result)
+	}
+	if len(events) != 2 || result.Devices != 1 {
+		t.Fatalf("expected one event per timestamp for one device, got=%#v", events)
+	}
+	first, second := events[0], events[1]
+	if first.DeviceID != "10.0.0.5" || first.SiteID != "tower-3" || first.ObservedAtMs != base || first.Online == nil || !*first.Online {
+		t.Fatalf("unexpected first event: %#v", first)
+	}
+	if first.LatencyMs == nil || math.Abs(*first.LatencyMs-12) > 0.001 {
+		t.Fatalf("expected probe seconds converted to ms, got=%v", first.LatencyMs)
+	}
+	if second.Online == nil || *second.Online || second.LatencyMs != nil {
+		t.Fatalf("expected failed probe without latency, got=%#v", second)
+	}
+	if len(second.Interfaces) != 1 || second.Interfaces[0].RxBps == nil || *second.Interfaces[0].RxBps != 8_000 || second.Interfaces[0].OperUp == nil || *second.Interfaces[0].OperUp {
+		t.Fatalf("expected octet counter rate and down oper status, got=%#v", second.Interfaces)
+	}
+
+	store := LoadStore("")
+	if ingested, _, _ := ingestSourceEvents(store, events); ingested != 2 {
+		t.Fatalf("expected both samples through the governor, got=%d", ingested)
+	}
+	store.RecordUnmappedMetrics(receiver.Name(), result.Unmapped, base)
+	if health := store.TelemetryIngestionHealth(); health.UnmappedMetricPoints != 1 {
+		t.Fatalf("expected unmapped series in ingestion health, got=%#v", health)
+	}
+
+	// Series without name or role labels keep what the device already has.
+	named := LoadStore("")
+	online := true
+	named.IngestTelemetry(TelemetryIngestRequest{Source: "uisp", DeviceID: "10.0.0.5", Device: "edge-1", Role: "router", SiteID: "tower-3", Online: &online})
+	ingestSourceEvents(named, events)
+	for _, device := range named.ListDevices() {
+		if device.ID == "10.0.0.5" && (device.Name != "edge-1" || device.Role != "router") {
+			t.Fatalf("expected unlabeled samples to keep name and role, got=%#v", device)
+		}
+	}
+}
+
+func TestRemoteWriteRejectsV2AndBadBodies(t *testing.T) {
+	if _, err := decodeRemoteWrite("application/x-protobuf;proto=io.prometheus.write.v2.Request", "snappy", nil); !errors.Is(err, ErrRemoteWriteVersion) {
+		t.Fatalf("expected 2.0 body to be refused, got=%v", err)
+	}
+	if _, err := decodeRemoteWrite("application/x-protobuf", "snappy", []byte("not snappy")); err == nil {
+		t.Fatalf("expected invalid snappy to fail")
+	}
+	if _, err := decodeRemoteWrite("application/json", "", nil); !errors.Is(err, ErrRemoteWriteContentType) {
+		t.Fatalf("expected json to be refused, got=%v", err)
+	}
+
+	if _, err := loadRemoteWriteMapping(`{"series":{"up":"cpu_percent"}}`, ""); !errors.Is(err, ErrRemoteWriteMapping) || errors.Is(err, ErrOTLPMapping) {
+		t.Fatalf("expected a remote_write mapping error, got=%v", err)
+	}
+
+	mapping, err := loadRemoteWriteMapping(`{"device_labels":["device_id"],"series":{"up{job=\"snmp\"}":"online"}}`, "")
+	if err != nil {
+		t.Fatalf("load mapping: %v", err)
+	}
+	if len(mapping.InterfaceLabels) == 0 || mapping.DeviceLabels[0] != "device_id" {
+		t.Fatalf("expected empty lists to keep defaults, got=%#v", mapping)
+	}
+	series, _ := decodeRemoteWrite("", "snappy", promWriteRequest(
+		promTimeSeries([]string{"__name__", "up", "job", "snmp", "device_id", "dev-7"}, promSampleSpec{1, 0}),
+		promTimeSeries([]string{"__name__", "up", "job", "node", "device_id", "dev-7"}, promSampleSpec{1, 0}),
+	))
+	events, result := NewRemoteWriteReceiver("prom-dc1", mapping).Convert(series, 1_000)
+	if len(events) != 1 || events[0].Source != "prom-dc1" || events[0].ObservedAtMs != 1_000 || result.UnmappedSamples != 1 {
+		t.Fatalf("expected label-matched rule only, events=%#v result=%#v", events, result)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+)
+
+const (
+	sflowSource = "sflow"
+
+	sflowFlowSample            = 1
+	sflowCounterSample         = 2
+	sflowFlowSampleExpanded    = 3
+	sflowCounterSampleExpanded = 4
+
+	sflowRecordRawHeader  = 1
+	sflowRecordIPv4       = 3
+	sflowRecordIPv6       = 4
+	sflowRecordIfCounters = 1
+
+	sflowIfCountersLen = 88
+	sflowIfUnknown     = 0x3fffffff
+)
+
+// sflowIfCounters is the generic interface counter record (if_counters).
+type sflowIfCounters struct {
+	IfIndex   uint32
+	IfStatus  uint32
+	InOctets  uint64
+	OutOctets uint64
+	Packets   uint64
+	Errors    uint64
+}
+
+type sflowDatagram struct {
+	Agent    string
+	Flows    []FlowRecord
+	Counters []sflowIfCounters
+}
+
+// sflowCounter is the previous counter sample of one agent interface.
+type sflowCounter struct {
+	atMs    int64
+	rxBytes uint64
+	txBytes uint64
+	packets uint64
+	errors  uint64
+}
+
+// sflowReader walks XDR-encoded sFlow structures; opaque data is padded to
+// four bytes.
+type sflowReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *sflowReader) u32() uint32 {
+	if r.err != nil || len(r.buf)-r.pos < 4 {
+		r.err = ErrFlowPacket
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.buf[r.pos:])
+	r.pos += 4
+	return v
+}
+
+func (r *sflowReader) u64() uint64 {
+	return uint64(r.u32())<<32 | uint64(r.u32())
+}
+
+func (r *sflowReader) bytes(n int) []byte {
+	padded := (n + 3) &^ 3
+	if r.err != nil || n < 0 || len(r.buf)-r.pos < padded {
+		r.err = ErrFlowPacket
+		return nil
+	}
+	out := r.buf[r.pos : r.pos+n]
+	r.pos += padded
+	return out
+}
+
+// opaque reads a length-prefixed structure as its own reader.
+func (r *sflowReader) opaque() (uint32, *sflowReader) {
+	format := r.u32()
+	body := r.bytes(int(r.u32()))
+	return format, &sflowReader{buf: body, err: r.err}
+}
+
+func decodeSFlow(data []byte) (sflowDatagram, error) {
+	var dg sflowDatagram
+	r := &sflowReader{buf: data}
+	if version := r.u32(); r.err == nil && version != 5 {
+		return dg, fmt.Errorf("%w: sflow %d", ErrFlowVersion, version)
+	}
+	switch r.u32() {
+	case 1:
+		dg.Agent = netip.AddrFrom4([4]byte(padAddr(r.bytes(4), 4))).String()
+	case 2:
+		dg.Agent = netip.AddrFrom16([16]byte(padAddr(r.bytes(16), 16))).Unmap().String()
+	default:
+		if r.err == nil {
+			return dg, ErrFlowPacket
+		}
+	}
+	r.u32() // sub agent id
+	r.u32() // sequence number
+	r.u32() // uptime
+	samples := r.u32()
+	for i := uint32(0); i < samples && r.err == nil; i++ {
+		format, sample := r.opaque()
+		if r.err != nil {
+			break
+		}
+		// Only standard (enterprise 0) sample formats are read.
+		if format>>12 != 0 {
+			continue
+		}
+		switch format & 0xfff {
+		case sflowFlowSample, sflowFlowSampleExpanded:
+			if rec, ok := decodeSFlowFlowSample(sample, format&0xfff == sflowFlowSampleExpanded); ok {
+				dg.Flows = append(dg.Flows, rec)
+			}
+		case sflowCounterSample, sflowCounterSampleExpanded:
+			dg.Counters = append(dg.Counters, decodeSFlowCounterSample(sample, format&0xfff == sflowCounterSampleExpanded)...)
+		}
+		if sample.err != nil {
+			return dg, sample.err
+		}
+	}
+	return dg, r.err
+}
+
+func padAddr(b []byte, n int) []byte {
+	if len(b) == n {
+		return b
+	}
+	return make([]byte, n)
+}
+
+// decodeSFlowFlowSample scales one sampled packet by the sampling rate. A
+// decoded IPv4/IPv6 record wins over parsing the raw header.
+func decodeSFlowFlowSample(r *sflowReader, expanded bool) (FlowRecord, bool) {
+	r.u32() // sequence number
+	if expanded {
+		r.u32() // source id type
+		r.u32() // source id index
+	} else {
+		r.u32()
+	}
+	rate := uint64(r.u32())
+	r.u32() // sample pool
+	r.u32() // drops
+	var input, output uint32
+	if expanded {
+		if format := r.u32(); format == 0 {
+			input = r.u32()
+		} else {
+			r.u32()
+		}
+		if format := r.u32(); format == 0 {
+			output = r.u32()
+		} else {
+			r.u32()
+		}
+	} else {
+		// The top two bits carry the format; only plain ifIndex is kept.
+		if in := r.u32(); in>>30 == 0 {
+			input = in
+		}
+		if out := r.u32(); out>>30 == 0 {
+			output = out
+		}
+	}
+	if input == sflowIfUnknown {
+		input = 0
+	}
+	if output == sflowIfUnknown {
+		output = 0
+	}
+	if rate == 0 {
+		rate = 1
+	}
+	rec := FlowRecord{InputIf: input, OutputIf: output, Packets: rate}
+	var frameLen uint64
+	decoded := false
+	records := r.u32()
+	for i := uint32(0); i < records && r.err == nil; i++ {
+		format, body := r.opaque()
+		if r.err != nil || format>>12 != 0 {
+			continue
+		}
+		switch format & 0xfff {
+		case sflowRecordRawHeader:
+			body.u32() // header protocol
+			frameLen = uint64(body.u32())
+			body.u32() // stripped
+			header := body.bytes(int(body.u32()))
+			if !decoded && body.err == nil {
+				parseSFlowEthernet(header, &rec)
+			}
+		case sflowRecordIPv4, sflowRecordIPv6:
+			size := 4
+			if format&0xfff == sflowRecordIPv6 {
+				size = 16
+			}
+			length := uint64(body.u32())
+			rec.Protocol = uint8(body.u32())
+			rec.SrcAddr = flowAddr(body.bytes(size))
+			rec.DstAddr = flowAddr(body.bytes(size))
+			rec.SrcPort = uint16(body.u32())
+			rec.DstPort = uint16(body.u32())
+			if body.err == nil {
+				decoded = true
+				if frameLen == 0 {
+					frameLen = length
+				}
+			}
+		}
+	}
+	if r.err != nil || frameLen == 0 {
+		return FlowRecord{}, false
+	}
+	rec.Bytes = frameLen * rate
+	return rec, true
+}
+
+// parseSFlowEthernet reads addresses, protocol and ports from a sampled
+// Ethernet header, skipping VLAN tags.
+func parseSFlowEthernet(b []byte, rec *FlowRecord) {
+	if len(b) < 14 {
+		return
+	}
+	etherType, pos := binary.BigEndian.Uint16(b[12:]), 14
+	for (etherType == 0x8100 || etherType == 0x88a8) && len(b) >= pos+4 {
+		etherType, pos = binary.BigEndian.Uint16(b[pos+2:]), pos+4
+	}
+	ip := b[pos:]
+	var ports []byte
+	switch etherType {
+	case 0x0800:
+		if len(ip) < 20 {
+			return
+		}
+		ihl := int(ip[0]&0x0f) * 4
+		rec.Protocol, rec.SrcAddr, rec.DstAddr = ip[9], flowAddr(ip[12:16]), flowAddr(ip[16:20])
+		if ihl >= 20 && len(ip) >= ihl+4 {
+			ports = ip[ihl:]
+		}
+	case 0x86dd:
+		if len(ip) < 40 {
+			return
+		}
+		rec.Protocol, rec.SrcAddr, rec.DstAddr = ip[6], flowAddr(ip[8:24]), flowAddr(ip[24:40])
+		if len(ip) >= 44 {
+			ports = ip[40:]
+		}
+	default:
+		return
+	}
+	if ports != nil && (rec.Protocol == 6 || rec.Protocol == 17) {
+		rec.SrcPort, rec.DstPort = binary.BigEndian.Uint16(ports), binary.BigEndian.Uint16(ports[2:])
+	}
+}
+
+func decodeSFlowCounterSample(r *sflowReader, expanded bool) []sflowIfCounters {
+	r.u32() // sequence number
+	r.u32() // source id (type and index)
+	if expanded {
+		r.u32()
+	}
+	var out []sflowIfCounters
+	records := r.u32()
+	for i := uint32(0); i < records && r.err == nil; i++ {
+		format, body := r.opaque()
+		if r.err != nil || format != sflowRecordIfCounters || len(body.buf) < sflowIfCountersLen {
+			continue
+		}
+		c := sflowIfCounters{IfIndex: body.u32()}
+		body.u32() // ifType
+		body.u64() // ifSpeed
+		body.u32() // ifDirection
+		c.IfStatus = body.u32()
+		c.InOctets = body.u64()
+		c.Packets = uint64(body.u32()) + uint64(body.u32()) + uint64(body.u32())
+		body.u32() // ifInDiscards
+		c.Errors = uint64(body.u32())
+		body.u32() // ifInUnknownProtos
+		c.OutOctets = body.u64()
+		c.Packets += uint64(body.u32()) + uint64(body.u32()) + uint64(body.u32())
+		body.u32() // ifOutDiscards
+		c.Errors += uint64(body.u32())
+		if body.err == nil {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// HandleSFlow decodes one sFlow v5 datagram. Flow samples join the flow
+// buckets; counter samples become interface facts keyed by the agent
+// address, which can differ from the UDP source behind NAT or relays.
+func (c *FlowCollector) HandleSFlow(sender string, data []byte, nowMs int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dg, err := decodeSFlow(data)
+	agent := dg.Agent
+	if addr, parseErr := netip.ParseAddr(agent); parseErr != nil || addr.IsUnspecified() {
+		agent = sender
+	}
+	version := 5
+	if err != nil {
+		version = 0
+	}
+	stats := c.exporterLocked(agent, sflowSource, version, nowMs)
+	if err != nil {
+		stats.DecodeErrors++
+		stats.LastError = err.Error()
+	}
+	c.addRecordsLocked(agent, dg.Flows, nowMs)
+	for _, counters := range dg.Counters {
+		c.applyIfCountersLocked(agent, counters, nowMs)
+	}
+	stats.CounterSamples += int64(len(dg.Counters))
+	return err
+}
+
+// applyIfCountersLocked turns a counter sample into rates against the
+// previous sample. Counter resets and 32-bit error wraps skip that rate.
+func (c *FlowCollector) applyIfCountersLocked(agent string, counters sflowIfCounters, nowMs int64) {
+	key := flowIfaceKey{exporter: agent, ifIndex: counters.IfIndex}
+	if _, ok := c.counters[key]; !ok {
+		if c.counterIfaces[agent] >= maxFlowIfacesPerExporter {
+			return
+		}
+		c.counterIfaces[agent]++
+	}
+	adminUp := counters.IfStatus&1 != 0
+	operUp := counters.IfStatus&2 != 0
+	fact := TelemetryInterfaceFact{Name: c.interfaceNameLocked(agent, counters.IfIndex), AdminUp: &adminUp, OperUp: &operUp}
+
+	sample := sflowCounter{atMs: nowMs, rxBytes: counters.InOctets, txBytes: counters.OutOctets, packets: counters.Packets, errors: counters.Errors}
+	if prev, ok := c.counters[key]; ok {
+		elapsed := float64(nowMs-prev.atMs) / 1000
+		if elapsed > 0 && sample.rxBytes >= prev.rxBytes && sample.txBytes >= prev.txBytes {
+			rx := float64(sample.rxBytes-prev.rxBytes) * 8 / elapsed
+			tx := float64(sample.txBytes-prev.txBytes) * 8 / elapsed
+			fact.RxBps, fact.TxBps = &rx, &tx
+			if sample.packets > prev.packets && sample.errors >= prev.errors {
+				rate := float64(sample.errors-prev.errors) / float64(sample.packets-prev.packets)
+				fact.ErrorRate = &rate
+			}
+		}
+	}
+	c.counters[key] = sample
+	c.counterSeen[key] = nowMs
+
+	p := c.pending[agent]
+	if p == nil {
+		p = &flowPendingCounters{facts: map[uint32]TelemetryInterfaceFact{}}
+		c.pending[agent] = p
+	}
+	p.atMs = nowMs
+	p.facts[counters.IfIndex] = fact
+}
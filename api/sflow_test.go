@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func be64(v uint64) []byte { return joinBytes(be32(int(v>>32)), be32(int(v&0xffffffff))) }
+
+// sflowOpaque encodes a format/length-prefixed XDR structure.
+func sflowOpaque(format int, body ...[]byte) []byte {
+	b := joinBytes(body...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return joinBytes(be32(format), be32(len(b)), b)
+}
+
+func sflowDatagramBytes(agent [4]byte, samples ...[]byte) []byte {
+	return joinBytes(append([][]byte{be32(5), be32(1), agent[:], be32(0), be32(1), be32(1000), be32(len(samples))}, samples...)...)
+}
+
+func sflowIfCountersRecord(ifIndex, status int, inOctets, outOctets uint64, inPkts, inErrors int) []byte {
+	return sflowOpaque(sflowRecordIfCounters,
+		be32(ifIndex), be32(6), be64(1_000_000_000), be32(1), be32(status),
+		be64(inOctets), be32(inPkts), be32(0), be32(0), be32(0), be32(inErrors), be32(0),
+		be64(outOctets), be32(0), be32(0), be32(0), be32(0), be32(0), be32(0))
+}
+
+func TestSFlowDecodesFlowAndCounterSamples(t *testing.T) {
+	// VLAN-tagged Ethernet frame carrying IPv4 TCP 10.1.1.5:40000 -> 93.184.216.34:443.
+	frame := joinBytes(make([]byte, 12), be16(0x8100), be16(20), be16(0x0800),
+		[]byte{0x45, 0, 0, 40, 0, 0, 0, 0, 64, 6, 0, 0, 10, 1, 1, 5, 93, 184, 216, 34}, be16(40000), be16(443))
+	raw := sflowOpaque(sflowRecordRawHeader, be32(1), be32(1500), be32(4), be32(len(frame)), frame)
+	compact := sflowOpaque(sflowFlowSample, be32(1), be32(3), be32(512), be32(0), be32(0), be32(3), be32(7), be32(1), raw)
+	ipv4 := sflowOpaque(sflowRecordIPv4, be32(100), be32(17), []byte{10, 1, 1, 6}, []byte{8, 8, 4, 4}, be32(5353), be32(53), be32(0), be32(0))
+	expanded := sflowOpaque(sflowFlowSampleExpanded, be32(2), be32(0), be32(5), be32(256), be32(0), be32(0), be32(0), be32(5), be32(0), be32(7), be32(1), ipv4)
+	counters := sflowOpaque(sflowCounterSample, be32(1), be32(3), be32(1), sflowIfCountersRecord(3, 3, 1_000, 2_000, 10, 0))
+	vendor := sflowOpaque(4413<<12|5, be32(1))
+
+	dg, err := decodeSFlow(sflowDatagramBytes([4]byte{10, 0, 0, 9}, compact, expanded, counters, vendor))
+	if err != nil || dg.Agent != "10.0.0.9" || len(dg.Flows) != 2 || len(dg.Counters) != 1 {
+		t.Fatalf("decode: dg=%#v err=%v", dg, err)
+	}
+	tcp := dg.Flows[0]
+	if tcp.SrcAddr != "10.1.1.5" || tcp.DstAddr != "93.184.216.34" || tcp.DstPort != 443 || tcp.InputIf != 3 || tcp.OutputIf != 7 || tcp.Bytes != 1500*512 || tcp.Packets != 512 {
+		t.Fatalf("unexpected raw header flow: %#v", tcp)
+	}
+	if dns := dg.Flows[1]; dns.DstAddr != "8.8.4.4" || dns.Protocol != 17 || dns.InputIf != 5 || dns.Bytes != 25_600 {
+		t.Fatalf("unexpected expanded flow: %#v", dns)
+	}
+	if c := dg.Counters[0]; c.IfIndex != 3 || c.InOctets != 1_000 || c.OutOctets != 2_000 || c.Packets != 10 {
+		t.Fatalf("unexpected counters: %#v", c)
+	}
+
+	if _, err := decodeSFlow(joinBytes(be32(4), be32(1))); !errors.Is(err, ErrFlowVersion) {
+		t.Fatalf("expected v4 to be unsupported, got=%v", err)
+	}
+	if _, err := decodeSFlow(sflowDatagramBytes([4]byte{10, 0, 0, 9}, compact)[:60]); !errors.Is(err, ErrFlowPacket) {
+		t.Fatalf("expected truncated datagram to fail, got=%v", err)
+	}
+}
+
+func TestSFlowCountersDriveInterfaceRates(t *testing.T) {
+	store := LoadStore("")
+	online := true
+	store.IngestTelemetry(TelemetryIngestRequest{Source: "uisp", DeviceID: "dev-sw-1", Device: "sw-1", SiteID: "dc-1", Online: &online})
+	store.mu.Lock()
+	for i := range store.DeviceIdentities {
+		if store.DeviceIdentities[i].PrimaryDeviceID == "dev-sw-1" {
+			store.DeviceIdentities[i].PrimaryIP = "10.0.0.9"
+		}
+	}
+	store.mu.Unlock()
+
+	collector := NewFlowCollector(time.Hour, map[string]map[uint32]string{"10.0.0.9": {3: "xe-0/0/3"}})
+	base := int64(1_767_225_600_000)
+	ipv4 := sflowOpaque(sflowRecordIPv4, be32(1000), be32(6), []byte{10, 1, 1, 5}, []byte{10, 2, 2, 2}, be32(40000), be32(22), be32(0), be32(0))
+	flow := sflowOpaque(sflowFlowSample, be32(1), be32(3), be32(100), be32(0), be32(0), be32(3), be32(4), be32(1), ipv4)
+	first := sflowOpaque(sflowCounterSample, be32(1), be32(3), be32(1), sflowIfCountersRecord(3, 3, 1_000_000, 500_000, 1_000, 0))
+	second := sflowOpaque(sflowCounterSample, be32(2), be32(3), be32(1), sflowIfCountersRecord(3, 1, 1_750_000, 500_000, 2_000, 10))
+
+	// The UDP sender is a relay; the agent address names the switch.
+	if err := collector.HandleSFlow("192.0.2.50", sflowDatagramBytes([4]byte{10, 0, 0, 9}, flow, first), base+1_000); err != nil {
+		t.Fatalf("handle first: %v", err)
+	}
+	events := collector.FlushRates(base + 2_000)
+	if len(events) != 1 || events[0].Source != sflowSource || events[0].Exporter != "10.0.0.9" || events[0].Interfaces[0].RxBps != nil || !*events[0].Interfaces[0].OperUp {
+		t.Fatalf("expected first counter sample to seed state only, got=%#v", events)
+	}
+	if err := collector.HandleSFlow("192.0.2.50", sflowDatagramBytes([4]byte{10, 0, 0, 9}, second), base+31_000); err != nil {
+		t.Fatalf("handle second: %v", err)
+	}
+	events = collector.FlushRates(base + flowBucketMs)
+	var counterFact, flowFact *TelemetryInterfaceFact
+	for i := range events {
+		for j := range events[i].Interfaces {
+			fact := &events[i].Interfaces[j]
+			switch fact.Name {
+			case "xe-0/0/3":
+				counterFact = fact
+			case "if4":
+				flowFact = fact
+			}
+		}
+	}
+	if counterFact == nil || *counterFact.RxBps != 200_000 || *counterFact.TxBps != 0 || *counterFact.ErrorRate != 0.01 || *counterFact.OperUp {
+		t.Fatalf("expected counter delta rates and oper down, got=%#v", counterFact)
+	}
+	// ifIndex 3 has counters, so only the flow-only egress interface gets a sampled rate.
+	if flowFact == nil || *flowFact.TxBps != float64(1000*100*8)/60 {
+		t.Fatalf("expected flow-derived rate on the egress interface, got=%#v", flowFact)
+	}
+	for _, ev := range events {
+		if ev.ObservedAtMs == base+flowBucketMs {
+			for _, fact := range ev.Interfaces {
+				if fact.Name == "xe-0/0/3" {
+					t.Fatalf("expected counters to replace sampled rates on xe-0/0/3")
+				}
+			}
+		}
+	}
+
+	if applied, _ := store.ApplyFlowRates(events); applied != len(events) {
+		t.Fatalf("expected counter and flow facts on the switch, applied=%d", applied)
+	}
+	for _, device := range store.ListDevices() {
+		if device.ID == "dev-sw-1" && (device.Name != "sw-1" || device.Role != "device" || device.Source != "uisp" || !device.Online) {
+			t.Fatalf("expected counter facts to leave name, role, source and state alone, got=%#v", device)
+		}
+	}
+
+	talkers := collector.TopTalkers(FlowTopQuery{DeviceID: "dev-sw-1"}, base+flowBucketMs, store.ResolveDeviceRef)
+	if talkers.Count != 2 || talkers.TotalBytes != 100_000 {
+		t.Fatalf("expected sampled flow in top talkers, got=%#v", talkers)
+	}
+	if exporters := collector.Exporters(); len(exporters) != 1 || exporters[0].Address != "10.0.0.9" || exporters[0].Protocol != sflowSource || exporters[0].CounterSamples != 2 {
+		t.Fatalf("unexpected exporter stats: %#v", exporters)
+	}
+}
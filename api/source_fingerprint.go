@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Deltas a volatile reading has to move before a poll emits device_metrics.
+const (
+	sourceShiftDb        = 3.0
+	sourceShiftPct       = 5.0
+	sourceShiftTempC     = 3.0
+	sourceShiftDistanceM = 100.0
+	sourceShiftRatio     = 0.2
+	sourceShiftMinBps    = 1e6
+)
+
+// sourceRecordFingerprint captures the mapped attributes of one polled
+// record. Volatile values (online state, latency, interface rates, RF) are
+// left out so only inventory and topology drift changes the hash.
+type sourceRecordFingerprint struct {
+	Hash  string
+	Attrs map[string]string
+}
+
+func fingerprintSourceRecord(rec uiSPDeviceRecord) sourceRecordFingerprint {
+	attrs := map[string]string{
+		"name":     strings.TrimSpace(rec.Name),
+		"role":     strings.TrimSpace(rec.Role),
+		"site":     strings.TrimSpace(rec.SiteID),
+		"hostname": strings.TrimSpace(rec.Host),
+		"mac":      strings.ToLower(strings.TrimSpace(rec.Mac)),
+		"serial":   strings.TrimSpace(rec.Serial),
+		"model":    strings.TrimSpace(rec.Model),
+		"vendor":   strings.TrimSpace(rec.Vendor),
+	}
+
+	if rec.Wireless != nil {
+		// Association only; RF values are volatile like latency.
+		attrs["wireless_ap"] = strings.TrimSpace(rec.Wireless.APDeviceID)
+	}
+
+	ifaces := make([]string, 0, len(rec.Ifaces))
+	for _, iface := range rec.Ifaces {
+		ifaces = append(ifaces, strings.Join([]string{
+			strings.TrimSpace(iface.Name),
+			fingerprintBool(iface.AdminUp),
+			fingerprintBool(iface.OperUp),
+		}, "/"))
+	}
+	sort.Strings(ifaces)
+	attrs["interfaces"] = strings.Join(ifaces, ",")
+
+	neighbors := make([]string, 0, len(rec.Neighs))
+	for _, n := range rec.Neighs {
+		neighbors = append(neighbors, strings.Join([]string{
+			strings.TrimSpace(n.LocalInterface),
+			strings.TrimSpace(n.NeighborIdentityHint),
+			strings.TrimSpace(n.NeighborDeviceName),
+			strings.TrimSpace(n.NeighborInterface),
+			strings.TrimSpace(n.Protocol),
+		}, "/"))
+	}
+	sort.Strings(neighbors)
+	attrs["neighbors"] = strings.Join(neighbors, ",")
+
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%s\n", key, attrs[key])
+	}
+	return sourceRecordFingerprint{Hash: hex.EncodeToString(h.Sum(nil))[:16], Attrs: attrs}
+}
+
+func fingerprintBool(v *bool) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.FormatBool(*v)
+}
+
+func (f sourceRecordFingerprint) changedFields(next sourceRecordFingerprint) []string {
+	if f.Hash == next.Hash {
+		return nil
+	}
+	changed := make([]string, 0, 2)
+	for key, value := range next.Attrs {
+		if f.Attrs[key] != value {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// classifySourceRecord picks the event for one polled record: online
+// transitions win, then attribute changes (device_update), then device_sync
+// when a full sync was requested, then device_metrics when RF, health or
+// interface rate readings moved away from the last emitted record. An empty
+// type means nothing to emit.
+func classifySourceRecord(prevOnline, seen bool, rec uiSPDeviceRecord, prevFP sourceRecordFingerprint, hadFP bool, fp sourceRecordFingerprint, last *uiSPDeviceRecord, fullSync bool) (string, []string) {
+	eventType := ""
+	if !seen {
+		if !rec.Online {
+			eventType = "device_down"
+		}
+	} else if prevOnline != rec.Online {
+		if rec.Online {
+			eventType = "device_up"
+		} else {
+			eventType = "device_down"
+		}
+	}
+	var changed []string
+	if hadFP {
+		changed = prevFP.changedFields(fp)
+	}
+	if eventType == "" && len(changed) > 0 {
+		eventType = "device_update"
+	}
+	if eventType == "" && fullSync {
+		eventType = "device_sync"
+	}
+	if eventType == "" && last != nil {
+		if moved := sourceReadingsMoved(*last, rec); len(moved) > 0 {
+			eventType, changed = "device_metrics", moved
+		}
+	}
+	return eventType, changed
+}
+
+// sourceReadingsMoved lists the volatile readings (wireless, metrics,
+// interfaces) that drifted past their delta since the last emitted record.
+// Comparing against what was emitted rather than the previous poll keeps
+// the stored values within one delta of the device however slowly they
+// drift.
+func sourceReadingsMoved(last, rec uiSPDeviceRecord) []string {
+	var moved []string
+	if wirelessReadingsMoved(last.Wireless, rec.Wireless) {
+		moved = append(moved, "wireless")
+	}
+	if sourceMetricsMoved(last.Metrics, rec.Metrics) {
+		moved = append(moved, "metrics")
+	}
+	if interfaceRatesMoved(last.Ifaces, rec.Ifaces) {
+		moved = append(moved, "interfaces")
+	}
+	return moved
+}
+
+func wirelessReadingsMoved(prev, next *TelemetryWirelessFact) bool {
+	if prev == nil || next == nil {
+		return (prev == nil) != (next == nil)
+	}
+	return readingMoved(prev.FrequencyMHz, next.FrequencyMHz, 0, 0) ||
+		readingMoved(prev.SignalDbm, next.SignalDbm, sourceShiftDb, 0) ||
+		readingMoved(prev.RemoteSignalDbm, next.RemoteSignalDbm, sourceShiftDb, 0) ||
+		readingMoved(prev.NoiseDbm, next.NoiseDbm, sourceShiftDb, 0) ||
+		readingMoved(prev.CCQPct, next.CCQPct, sourceShiftPct, 0) ||
+		readingMoved(prev.DownlinkCapacityBps, next.DownlinkCapacityBps, sourceShiftMinBps, sourceShiftRatio) ||
+		readingMoved(prev.UplinkCapacityBps, next.UplinkCapacityBps, sourceShiftMinBps, sourceShiftRatio) ||
+		readingMoved(prev.DistanceM, next.DistanceM, sourceShiftDistanceM, 0)
+}
+
+func sourceMetricsMoved(prev, next *TelemetryMetrics) bool {
+	if prev == nil || next == nil {
+		return (prev == nil) != (next == nil)
+	}
+	if prev.UptimeS != nil && next.UptimeS != nil && *next.UptimeS < *prev.UptimeS {
+		return true
+	}
+	if readingMoved(prev.CPUPct, next.CPUPct, sourceShiftPct, 0) ||
+		readingMoved(prev.MemPct, next.MemPct, sourceShiftPct, 0) ||
+		readingMoved(prev.TempC, next.TempC, sourceShiftTempC, 0) {
+		return true
+	}
+	if len(prev.Gauges) != len(next.Gauges) {
+		return true
+	}
+	for name, v := range next.Gauges {
+		p, ok := prev.Gauges[name]
+		if !ok || readingMoved(&p, &v, 0, sourceShiftRatio) {
+			return true
+		}
+	}
+	return false
+}
+
+func interfaceRatesMoved(prev, next []TelemetryInterfaceFact) bool {
+	byName := make(map[string]TelemetryInterfaceFact, len(prev))
+	for _, iface := range prev {
+		byName[strings.TrimSpace(iface.Name)] = iface
+	}
+	for _, iface := range next {
+		p, ok := byName[strings.TrimSpace(iface.Name)]
+		if !ok {
+			continue
+		}
+		if readingMoved(rateOrZero(p.RxBps), rateOrZero(iface.RxBps), sourceShiftMinBps, sourceShiftRatio) ||
+			readingMoved(rateOrZero(p.TxBps), rateOrZero(iface.TxBps), sourceShiftMinBps, sourceShiftRatio) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateOrZero reads a missing rate as idle: counter-based connectors only
+// have rates from their second sample on.
+func rateOrZero(v *float64) *float64 {
+	if v == nil {
+		zero := 0.0
+		return &zero
+	}
+	return v
+}
+
+// readingMoved reports a reading that appeared, disappeared or moved by at
+// least floor and, when ratio is set, by ratio of the larger value.
+func readingMoved(prev, next *float64, floor, ratio float64) bool {
+	if prev == nil || next == nil {
+		return (prev == nil) != (next == nil)
+	}
+	delta := math.Abs(*next - *prev)
+	if delta == 0 {
+		return false
+	}
+	return delta >= floor && delta >= ratio*math.Max(math.Abs(*prev), math.Abs(*next))
+}
+
+func sourceEventMessage(label, eventType string, online bool, changed []string) string {
+	switch {
+	case eventType == "device_update":
+		return fmt.Sprintf("%s attributes changed: %s", label, strings.Join(changed, ","))
+	case eventType == "device_sync":
+		return fmt.Sprintf("%s full sync state=%t", label, online)
+	case eventType == "device_metrics":
+		return fmt.Sprintf("%s readings moved: %s", label, strings.Join(changed, ","))
+	case len(changed) > 0:
+		return fmt.Sprintf("%s poll state=%t changed=%s", label, online, strings.Join(changed, ","))
+	default:
+		return fmt.Sprintf("%s poll state=%t", label, online)
+	}
+}
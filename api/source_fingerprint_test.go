@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestVendorConnectorEmitsAttributeChangeEvents(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		payload = `[{"id":"sw-1","name":"Core 1","role":"switch","site":"hq","status":"online","interfaces":[{"name":"ge-0/0/1","operUp":true,"rxBps":100}]},{"id":"sw-2","name":"Edge 2","role":"switch","site":"hq","status":"online"}]`
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write([]byte(payload))
+	}))
+	defer server.Close()
+	setPayload := func(body string) {
+		mu.Lock()
+		payload = body
+		mu.Unlock()
+	}
+
+	connector := NewVendorConnector("juniper", "Juniper", server.URL, "token", "/devices", "bearer")
+	first, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("first poll: %v", err)
+	}
+	if len(first.Events) != 0 {
+		t.Fatalf("expected no events for online first sighting, got=%#v", first.Events)
+	}
+
+	// Rate counters alone are volatile and must not count as drift.
+	setPayload(`[{"id":"sw-1","name":"Core 1","role":"switch","site":"hq","status":"online","interfaces":[{"name":"ge-0/0/1","operUp":true,"rxBps":900}]},{"id":"sw-2","name":"Edge 2","role":"switch","site":"hq","status":"online"}]`)
+	if batch, _ := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); len(batch.Events) != 0 {
+		t.Fatalf("expected no events for counter-only change, got=%#v", batch.Events)
+	}
+
+	// A port rate that moves past its delta is sent without attribute drift.
+	setPayload(`[{"id":"sw-1","name":"Core 1","role":"switch","site":"hq","status":"online","interfaces":[{"name":"ge-0/0/1","operUp":true,"rxBps":50000000}]},{"id":"sw-2","name":"Edge 2","role":"switch","site":"hq","status":"online"}]`)
+	if batch, _ := connector.Poll(context.Background(), SourcePollRequest{Limit: 10, Cursor: "rates"}); len(batch.Events) != 1 || batch.Events[0].EventType != "device_metrics" || batch.Response.Updated != 0 {
+		t.Fatalf("expected device_metrics for the rate jump, got=%#v", batch.Events)
+	}
+
+	setPayload(`[{"id":"sw-1","name":"Core 1A","role":"router","site":"hq","status":"online","interfaces":[{"name":"ge-0/0/1","operUp":false}]},{"id":"sw-2","name":"Edge 2","role":"switch","site":"hq","status":"online"}]`)
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("drift poll: %v", err)
+	}
+	if len(batch.Events) != 1 || batch.Events[0].EventType != "device_update" || batch.Events[0].DeviceID != "sw-1" {
+		t.Fatalf("expected one device_update for sw-1, got=%#v", batch.Events)
+	}
+	if batch.Response.Updated != 1 || batch.Events[0].Message != "JUNIPER attributes changed: interfaces,name,role" {
+		t.Fatalf("unexpected update summary: updated=%d message=%q", batch.Response.Updated, batch.Events[0].Message)
+	}
+
+	full, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10, FullSync: true})
+	if err != nil {
+		t.Fatalf("full sync poll: %v", err)
+	}
+	if !full.Response.FullSync || len(full.Events) != 2 || full.Events[0].EventType != "device_sync" {
+		t.Fatalf("expected device_sync for every record, got=%#v", full.Events)
+	}
+}
+
+func TestDeviceUpdateEventsReachInventory(t *testing.T) {
+	store := LoadStore("")
+	online := true
+	store.IngestTelemetryWithDecision(TelemetryIngestRequest{Source: "juniper", EventType: "device_down", DeviceID: "sw-9", Device: "Old Name", Role: "switch", SiteID: "hq", Online: &online})
+
+	ingested, _, dropped := ingestSourceEvents(store, []TelemetryIngestRequest{{
+		Source:    "juniper",
+		EventType: "device_update",
+		DeviceID:  "sw-9",
+		Device:    "New Name",
+		Role:      "router",
+		SiteID:    "dc-2",
+		Online:    &online,
+	}})
+	if ingested != 1 || dropped != 0 {
+		t.Fatalf("expected update to bypass sampling, ingested=%d dropped=%d", ingested, dropped)
+	}
+	for _, device := range store.ListDevices() {
+		if device.ID == "sw-9" {
+			if device.Name != "New Name" || device.Role != "router" || device.SiteID != "dc-2" {
+				t.Fatalf("expected inventory to follow update, got=%#v", device)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected device sw-9 in inventory")
+}
+
+func TestFingerprintIgnoresInterfaceOrder(t *testing.T) {
+	up := true
+	a := uiSPDeviceRecord{ID: "x", Name: "X", Ifaces: []TelemetryInterfaceFact{{Name: "eth0", OperUp: &up}, {Name: "eth1"}}}
+	b := uiSPDeviceRecord{ID: "x", Name: "X", Ifaces: []TelemetryInterfaceFact{{Name: "eth1"}, {Name: "eth0", OperUp: &up}}}
+	if fingerprintSourceRecord(a).Hash != fingerprintSourceRecord(b).Hash {
+		t.Fatalf("expected interface order not to change the fingerprint")
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailures    = 5
+	defaultBreakerCooldownSec = 60
+	maxBreakerCooldown        = 15 * time.Minute
+	defaultMaxIntervalFactor  = 8
+	maxSourceGuardWait        = 30 * time.Second
+)
+
+var (
+	ErrSourceCircuitOpen   = errors.New("circuit_open")
+	ErrSourceRateLimited   = errors.New("rate_limited")
+	ErrSourceBudgetExhaust = errors.New("request_budget_exhausted")
+)
+
+type SourceGuardConfig struct {
+	RequestsPerMinute int
+	FailureThreshold  int
+	Cooldown          time.Duration
+	MaxIntervalFactor int
+}
+
+// SourceBreakerStatus is the guard snapshot exposed on SourceStatus.
+type SourceBreakerStatus struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenedAt            string `json:"opened_at,omitempty"`
+	NextProbeAt         string `json:"next_probe_at,omitempty"`
+	OpenCount           int64  `json:"open_count"`
+	RetryAfterUntil     string `json:"retry_after_until,omitempty"`
+	ThrottledResponses  int64  `json:"throttled_responses"`
+	BudgetPerMinute     int    `json:"budget_per_minute,omitempty"`
+	BudgetRemaining     int    `json:"budget_remaining,omitempty"`
+	PollIntervalSec     int    `json:"poll_interval_sec,omitempty"`
+}
+
+// SourceGuard protects one upstream controller: a per-minute request
+// budget, Retry-After backoff, and a circuit breaker with a single
+// half-open probe. It also derives the adaptive background poll interval.
+type SourceGuard struct {
+	cfg SourceGuardConfig
+	now func() time.Time
+
+	mu              sync.Mutex
+	state           string
+	failures        int
+	openedAt        time.Time
+	nextProbeAt     time.Time
+	cooldown        time.Duration
+	probing         bool
+	openCount       int64
+	retryAfterUntil time.Time
+	throttled       int64
+	tokens          float64
+	refilledAt      time.Time
+	interval        time.Duration
+}
+
+func NewSourceGuard(cfg SourceGuardConfig) *SourceGuard {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultBreakerFailures
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultBreakerCooldownSec * time.Second
+	}
+	if cfg.MaxIntervalFactor <= 0 {
+		cfg.MaxIntervalFactor = defaultMaxIntervalFactor
+	}
+	if cfg.RequestsPerMinute < 0 {
+		cfg.RequestsPerMinute = 0
+	}
+	return &SourceGuard{
+		cfg:      cfg,
+		now:      time.Now,
+		state:    "closed",
+		cooldown: cfg.Cooldown,
+		tokens:   float64(cfg.RequestsPerMinute),
+	}
+}
+
+// sourceGuardConfigFromEnv reads <PREFIX>_REQUESTS_PER_MIN,
+// <PREFIX>_BREAKER_FAILURES, <PREFIX>_BREAKER_COOLDOWN_SEC and
+// <PREFIX>_MAX_INTERVAL_FACTOR.
+func sourceGuardConfigFromEnv(prefix string) SourceGuardConfig {
+	return SourceGuardConfig{
+		RequestsPerMinute: getenvInt(prefix+"_REQUESTS_PER_MIN", 0),
+		FailureThreshold:  getenvInt(prefix+"_BREAKER_FAILURES", defaultBreakerFailures),
+		Cooldown:          time.Duration(getenvInt(prefix+"_BREAKER_COOLDOWN_SEC", defaultBreakerCooldownSec)) * time.Second,
+		MaxIntervalFactor: getenvInt(prefix+"_MAX_INTERVAL_FACTOR", defaultMaxIntervalFactor),
+	}
+}
+
+// Allow gates a poll. An open breaker rejects polls until the cooldown
+// passes, then lets exactly one probe through in the half_open state.
+func (g *SourceGuard) Allow() error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch g.state {
+	case "open":
+		if g.now().Before(g.nextProbeAt) {
+			return fmt.Errorf("%w until %s", ErrSourceCircuitOpen, g.nextProbeAt.UTC().Format(time.RFC3339))
+		}
+		g.state = "half_open"
+		g.probing = true
+		return nil
+	case "half_open":
+		if g.probing {
+			return fmt.Errorf("%w: probe in flight", ErrSourceCircuitOpen)
+		}
+		g.probing = true
+	}
+	return nil
+}
+
+// RecordPoll feeds a poll outcome into the breaker and the adaptive
+// interval. Polls rejected by the breaker or our own budget do not count
+// as upstream failures, but a half-open probe stopped by the budget hands
+// the probe back: the breaker reopens and probes again after the cooldown.
+func (g *SourceGuard) RecordPoll(err error) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	if errors.Is(err, ErrSourceCircuitOpen) {
+		return
+	}
+	if errors.Is(err, ErrSourceBudgetExhaust) {
+		if g.state == "half_open" && g.probing {
+			g.probing = false
+			g.state = "open"
+			g.nextProbeAt = now.Add(g.cooldown)
+			if g.retryAfterUntil.After(g.nextProbeAt) {
+				g.nextProbeAt = g.retryAfterUntil
+			}
+		}
+		return
+	}
+	wasProbe := g.state == "half_open"
+	g.probing = false
+	if err == nil {
+		g.state = "closed"
+		g.failures = 0
+		g.cooldown = g.cfg.Cooldown
+		g.openedAt = time.Time{}
+		g.nextProbeAt = time.Time{}
+		return
+	}
+	g.failures++
+	if wasProbe {
+		g.cooldown *= 2
+		if g.cooldown > maxBreakerCooldown {
+			g.cooldown = maxBreakerCooldown
+		}
+		g.openLocked(now)
+		return
+	}
+	if g.state == "closed" && g.failures >= g.cfg.FailureThreshold {
+		g.openLocked(now)
+	}
+}
+
+func (g *SourceGuard) openLocked(now time.Time) {
+	g.state = "open"
+	g.openedAt = now
+	g.openCount++
+	probeAt := now.Add(g.cooldown)
+	if g.retryAfterUntil.After(probeAt) {
+		probeAt = g.retryAfterUntil
+	}
+	g.nextProbeAt = probeAt
+}
+
+// Acquire takes one request from the budget, waiting (bounded) for a
+// pending Retry-After window or the next budget refill.
+func (g *SourceGuard) Acquire(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	for {
+		g.mu.Lock()
+		now := g.now()
+		wait := time.Duration(0)
+		var waitErr error
+		if now.Before(g.retryAfterUntil) {
+			wait = g.retryAfterUntil.Sub(now)
+			waitErr = ErrSourceRateLimited
+		} else if g.cfg.RequestsPerMinute > 0 {
+			g.refillLocked(now)
+			if g.tokens >= 1 {
+				g.tokens--
+				g.mu.Unlock()
+				return nil
+			}
+			perToken := time.Minute / time.Duration(g.cfg.RequestsPerMinute)
+			wait = time.Duration((1 - g.tokens) * float64(perToken))
+			waitErr = ErrSourceBudgetExhaust
+		}
+		g.mu.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+		if wait > maxSourceGuardWait {
+			return fmt.Errorf("%w (retry in %ds)", waitErr, int(wait.Seconds()+0.5))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (g *SourceGuard) refillLocked(now time.Time) {
+	capacity := float64(g.cfg.RequestsPerMinute)
+	if g.refilledAt.IsZero() {
+		g.refilledAt = now
+		return
+	}
+	elapsed := now.Sub(g.refilledAt)
+	if elapsed <= 0 {
+		return
+	}
+	g.tokens += capacity * elapsed.Minutes()
+	if g.tokens > capacity {
+		g.tokens = capacity
+	}
+	g.refilledAt = now
+}
+
+// NoteThrottle records a 429/503 and the server-requested pause.
+func (g *SourceGuard) NoteThrottle(retryAfter time.Duration) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.throttled++
+	if retryAfter <= 0 {
+		return
+	}
+	until := g.now().Add(retryAfter)
+	if until.After(g.retryAfterUntil) {
+		g.retryAfterUntil = until
+	}
+}
+
+// NextInterval returns the background poll delay: doubled per failed or
+// throttled poll up to MaxIntervalFactor x base, halved back toward base on
+// success, and never earlier than an open breaker's next probe.
+func (g *SourceGuard) NextInterval(base time.Duration) time.Duration {
+	if g == nil || base <= 0 {
+		return base
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	if g.interval < base {
+		g.interval = base
+	}
+	maxInterval := base * time.Duration(g.cfg.MaxIntervalFactor)
+	if g.failures > 0 || now.Before(g.retryAfterUntil) {
+		g.interval *= 2
+	} else {
+		g.interval /= 2
+	}
+	if g.interval < base {
+		g.interval = base
+	}
+	if g.interval > maxInterval {
+		g.interval = maxInterval
+	}
+	next := g.interval
+	if g.state == "open" {
+		if untilProbe := g.nextProbeAt.Sub(now); untilProbe > next {
+			next = untilProbe
+		}
+	}
+	if untilRetry := g.retryAfterUntil.Sub(now); untilRetry > next {
+		next = untilRetry
+	}
+	return next
+}
+
+func (g *SourceGuard) Snapshot() *SourceBreakerStatus {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	out := &SourceBreakerStatus{
+		State:               g.state,
+		ConsecutiveFailures: g.failures,
+		OpenCount:           g.openCount,
+		ThrottledResponses:  g.throttled,
+		BudgetPerMinute:     g.cfg.RequestsPerMinute,
+		PollIntervalSec:     int(g.interval.Seconds()),
+	}
+	if !g.openedAt.IsZero() {
+		out.OpenedAt = g.openedAt.UTC().Format(time.RFC3339)
+	}
+	if !g.nextProbeAt.IsZero() {
+		out.NextProbeAt = g.nextProbeAt.UTC().Format(time.RFC3339)
+	}
+	if now.Before(g.retryAfterUntil) {
+		out.RetryAfterUntil = g.retryAfterUntil.UTC().Format(time.RFC3339)
+	}
+	if g.cfg.RequestsPerMinute > 0 {
+		g.refillLocked(now)
+		out.BudgetRemaining = int(g.tokens)
+	}
+	return out
+}
+
+func isThrottleStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter accepts delta-seconds or an HTTP date.
+func parseRetryAfter(raw string, now time.Time) time.Duration {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(raw); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(raw); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
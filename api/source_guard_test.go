@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchHonoursRetryAfterOn429(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		firstAt  time.Time
+		secondAt time.Time
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		attempt := attempts
+		if attempt == 1 {
+			firstAt = time.Now()
+		} else {
+			secondAt = time.Now()
+		}
+		mu.Unlock()
+		if attempt == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(pagedTestDevices(0, 2)))
+	}))
+	defer server.Close()
+
+	connector := NewVendorConnector("cisco", "Cisco", server.URL, "token", "/devices", "bearer")
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10, Retries: 1})
+	if err != nil {
+		t.Fatalf("expected retry after 429 to succeed, got=%v", err)
+	}
+	if batch.Response.Fetched != 2 || attempts != 2 {
+		t.Fatalf("expected two attempts and 2 records, attempts=%d fetched=%d", attempts, batch.Response.Fetched)
+	}
+	if gap := secondAt.Sub(firstAt); gap < 900*time.Millisecond {
+		t.Fatalf("expected Retry-After wait of ~1s, got=%s", gap)
+	}
+	status := connector.Status()
+	if status.Breaker == nil || status.Breaker.ThrottledResponses != 1 || status.Breaker.State != "closed" {
+		t.Fatalf("expected throttle recorded on closed breaker, got=%#v", status.Breaker)
+	}
+}
+
+func TestSourceGuardBreakerOpensAndProbesHalfOpen(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		calls   int
+		healthy bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if !healthy {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(pagedTestDevices(0, 1)))
+	}))
+	defer server.Close()
+
+	connector := NewUISPConnector(server.URL, "uisp-token", "/devices")
+	connector.SetGuard(SourceGuardConfig{FailureThreshold: 2, Cooldown: time.Minute})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	connector.Guard().now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); err == nil {
+			t.Fatalf("expected poll %d to fail", i)
+		}
+	}
+	if state := connector.Status().Breaker.State; state != "open" {
+		t.Fatalf("expected breaker open after threshold, got=%s", state)
+	}
+	if _, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); !errors.Is(err, ErrSourceCircuitOpen) {
+		t.Fatalf("expected open breaker to reject poll, got=%v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected no upstream call while open, calls=%d", calls)
+	}
+
+	// Failed probe reopens with a doubled cooldown.
+	now = now.Add(61 * time.Second)
+	if _, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); err == nil || errors.Is(err, ErrSourceCircuitOpen) {
+		t.Fatalf("expected half-open probe to reach upstream and fail, got=%v", err)
+	}
+	breaker := connector.Status().Breaker
+	if breaker.State != "open" || breaker.OpenCount != 2 || breaker.NextProbeAt != now.Add(2*time.Minute).Format(time.RFC3339) {
+		t.Fatalf("expected reopen with doubled cooldown, got=%#v", breaker)
+	}
+
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	now = now.Add(2 * time.Minute)
+	if _, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10}); err != nil {
+		t.Fatalf("expected successful probe, got=%v", err)
+	}
+	if breaker := connector.Status().Breaker; breaker.State != "closed" || breaker.ConsecutiveFailures != 0 {
+		t.Fatalf("expected breaker closed after probe, got=%#v", breaker)
+	}
+}
+
+func TestSourceGuardProbeStoppedByBudgetReopens(t *testing.T) {
+	guard := NewSourceGuard(SourceGuardConfig{RequestsPerMinute: 1, FailureThreshold: 1, Cooldown: time.Minute})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	guard.now = func() time.Time { return now }
+
+	if err := guard.Acquire(context.Background()); err != nil {
+		t.Fatalf("expected first request within budget, got=%v", err)
+	}
+	guard.RecordPoll(errors.New("status 502"))
+	now = now.Add(61 * time.Second)
+	if err := guard.Allow(); err != nil {
+		t.Fatalf("expected half-open probe, got=%v", err)
+	}
+	// Spend the refilled token so the probe itself hits the budget.
+	_ = guard.Acquire(context.Background())
+	err := guard.Acquire(context.Background())
+	if !errors.Is(err, ErrSourceBudgetExhaust) {
+		t.Fatalf("expected probe to exhaust the budget, got=%v", err)
+	}
+	guard.RecordPoll(err)
+
+	breaker := guard.Snapshot()
+	if breaker.State != "open" || breaker.OpenCount != 1 || breaker.ConsecutiveFailures != 1 || breaker.NextProbeAt != now.Add(time.Minute).Format(time.RFC3339) {
+		t.Fatalf("expected breaker to reopen without counting a failure, got=%#v", breaker)
+	}
+	if err := guard.Allow(); !errors.Is(err, ErrSourceCircuitOpen) {
+		t.Fatalf("expected breaker to hold until the next probe, got=%v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := guard.Allow(); err != nil {
+		t.Fatalf("expected a new probe after the cooldown, got=%v", err)
+	}
+}
+
+func TestSourceGuardBudgetAndAdaptiveInterval(t *testing.T) {
+	guard := NewSourceGuard(SourceGuardConfig{RequestsPerMinute: 1, MaxIntervalFactor: 4})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	guard.now = func() time.Time { return now }
+
+	if err := guard.Acquire(context.Background()); err != nil {
+		t.Fatalf("expected first request within budget, got=%v", err)
+	}
+	if err := guard.Acquire(context.Background()); !errors.Is(err, ErrSourceBudgetExhaust) {
+		t.Fatalf("expected budget exhaustion, got=%v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := guard.Acquire(context.Background()); err != nil {
+		t.Fatalf("expected budget refill after a minute, got=%v", err)
+	}
+
+	base := 30 * time.Second
+	guard.RecordPoll(errors.New("status 500"))
+	if got := guard.NextInterval(base); got != time.Minute {
+		t.Fatalf("expected interval to double on failure, got=%s", got)
+	}
+	guard.RecordPoll(errors.New("status 500"))
+	guard.NextInterval(base)
+	if got := guard.NextInterval(base); got != 2*time.Minute {
+		t.Fatalf("expected interval capped at 4x base, got=%s", got)
+	}
+	guard.RecordPoll(nil)
+	if got := guard.NextInterval(base); got != time.Minute {
+		t.Fatalf("expected interval to shrink after success, got=%s", got)
+	}
+
+	guard.NoteThrottle(5 * time.Minute)
+	if got := guard.NextInterval(base); got != 5*time.Minute {
+		t.Fatalf("expected Retry-After to defer next poll, got=%s", got)
+	}
+	if got := parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now); got != 90*time.Second {
+		t.Fatalf("expected HTTP-date Retry-After, got=%s", got)
+	}
+}
+
+func TestQualityScorecardReflectsBreakerState(t *testing.T) {
+	store := LoadStore("")
+	nowMs := time.Now().UnixMilli()
+	retryAfterUntil := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	store.RecordSourcePollOutcome("breaker_test", false, "status 502", nowMs)
+	store.RecordSourceBreakerState("breaker_test", SourceBreakerStatus{
+		State:              "open",
+		OpenCount:          1,
+		ThrottledResponses: 3,
+		RetryAfterUntil:    retryAfterUntil,
+	}, nowMs)
+
+	store.RecordSourceBreakerState("breaker_test", SourceBreakerStatus{
+		State:              "open",
+		OpenCount:          1,
+		ThrottledResponses: 3,
+		RetryAfterUntil:    retryAfterUntil,
+	}, nowMs+60_000)
+	if stats := store.TelemetryQualityBySource["breaker_test"]; stats.UpdatedAtMs != nowMs {
+		t.Fatalf("expected an unchanged breaker snapshot to leave stats alone, got updated_at=%d", stats.UpdatedAtMs)
+	}
+
+	card, ok := findQualityCard(store.TelemetryQualityReport().Scorecards, "breaker_test")
+	if !ok {
+		t.Fatalf("expected scorecard for breaker_test")
+	}
+	if card.Status != "failing" || card.Stats.BreakerState != "open" || card.Stats.ThrottledResponses != 3 {
+		t.Fatalf("expected failing card with breaker stats, got status=%s stats=%#v", card.Status, card.Stats)
+	}
+	hasOpen, hasLimited := false, false
+	for _, warning := range card.Warnings {
+		hasOpen = hasOpen || warning == "circuit_open"
+		hasLimited = hasLimited || warning == "rate_limited"
+	}
+	if !hasOpen || !hasLimited {
+		t.Fatalf("expected circuit_open and rate_limited warnings, got=%v", card.Warnings)
+	}
+}
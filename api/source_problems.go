@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// SourceProblem is an active alert imported from a monitoring system that
+// already watches the device. ExternalID stays stable while the problem is
+// open, so repeated polls update one incident instead of opening new ones.
+type SourceProblem struct {
+	ExternalID  string `json:"external_id"`
+	DeviceID    string `json:"device_id"`
+	Type        string `json:"type,omitempty"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message,omitempty"`
+	StartedAtMs int64  `json:"started_at_ms,omitempty"`
+}
+
+type SourceProblemSyncResult struct {
+	Source   string   `json:"source"`
+	Active   int      `json:"active"`
+	Opened   []string `json:"opened,omitempty"`
+	Resolved []string `json:"resolved,omitempty"`
+}
+
+// SyncSourceProblems mirrors a source's active problem list into incidents.
+// New problems open an incident, known ones refresh severity and message,
+// and open incidents whose problem is no longer listed are resolved.
+func (s *Store) SyncSourceProblems(source string, problems []SourceProblem, nowMs int64) SourceProblemSyncResult {
+	source = strings.TrimSpace(source)
+	result := SourceProblemSyncResult{Source: source}
+	if source == "" {
+		return result
+	}
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+	nowISO := time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	open := map[string]int{}
+	for i := range s.Incidents {
+		inc := s.Incidents[i]
+		if inc.Source == source && inc.ExternalID != "" && inc.Resolved == nil {
+			open[inc.ExternalID] = i
+		}
+	}
+	active := map[string]bool{}
+	for _, problem := range problems {
+		externalID := strings.TrimSpace(problem.ExternalID)
+		deviceID := strings.TrimSpace(problem.DeviceID)
+		if externalID == "" || deviceID == "" || active[externalID] {
+			continue
+		}
+		active[externalID] = true
+		severity := firstNonEmpty(strings.ToLower(strings.TrimSpace(problem.Severity)), "warning")
+		message := strings.TrimSpace(problem.Message)
+		if idx, ok := open[externalID]; ok {
+			s.Incidents[idx].Severity = severity
+			s.Incidents[idx].Message = message
+			continue
+		}
+		started := nowISO
+		if problem.StartedAtMs > 0 {
+			started = time.UnixMilli(problem.StartedAtMs).UTC().Format(time.RFC3339)
+		}
+		s.Incidents = append(s.Incidents, Incident{
+			ID:         "inc-" + randomID(),
+			DeviceID:   deviceID,
+			Type:       firstNonEmpty(strings.TrimSpace(problem.Type), "external_problem"),
+			Severity:   severity,
+			Started:    started,
+			Message:    message,
+			Source:     source,
+			ExternalID: externalID,
+		})
+		s.appendIncidentTimelineEntryLocked(len(s.Incidents)-1, "opened", "", "Problem opened in "+source+": "+firstNonEmpty(message, externalID), nowISO)
+		result.Opened = append(result.Opened, s.Incidents[len(s.Incidents)-1].ID)
+	}
+	for externalID, idx := range open {
+		if active[externalID] {
+			continue
+		}
+		resolvedAt := nowISO
+		s.Incidents[idx].Resolved = &resolvedAt
+		s.appendIncidentTimelineEntryLocked(idx, "resolved", "", "Problem cleared in "+source+"; incident resolved.", nowISO)
+		result.Resolved = append(result.Resolved, s.Incidents[idx].ID)
+	}
+	result.Active = len(active)
+	s.mu.Unlock()
+
+	if len(result.Opened) > 0 || len(result.Resolved) > 0 || len(active) > 0 {
+		s.save()
+	}
+	return result
+}
+
+// syncSourceProblemsBatch applies the problem list from a poll that read
+// one; polls that did not leave existing problem incidents untouched.
+func syncSourceProblemsBatch(store *Store, source string, batch sourcePollBatch) SourceProblemSyncResult {
+	if !batch.ProblemsFetched {
+		return SourceProblemSyncResult{Source: source}
+	}
+	return store.SyncSourceProblems(source, batch.Problems, time.Now().UnixMilli())
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestSyncSourceProblemsKeepsOfflineIncidentsSeparate(t *testing.T) {
+	store := LoadStore("")
+	online := false
+	if _, created, ok := store.IngestTelemetry(TelemetryIngestRequest{Source: "zabbix", DeviceID: "sw-1", Device: "sw-1", Online: &online}); !ok || created == nil {
+		t.Fatalf("expected offline incident from ingest")
+	}
+
+	result := store.SyncSourceProblems("zabbix", []SourceProblem{
+		{ExternalID: "e1", DeviceID: "sw-1", Severity: "high", Message: "High CPU", StartedAtMs: 1767225600000},
+		{ExternalID: "e1", DeviceID: "sw-1", Severity: "high", Message: "duplicate"},
+		{ExternalID: "", DeviceID: "sw-1"},
+	}, 0)
+	if result.Active != 1 || len(result.Opened) != 1 {
+		t.Fatalf("expected one problem incident, got=%#v", result)
+	}
+
+	// Coming back online resolves the offline incident but not the problem.
+	online = true
+	store.IngestTelemetry(TelemetryIngestRequest{Source: "zabbix", DeviceID: "sw-1", Device: "sw-1", Online: &online})
+	var problem, offline *Incident
+	for _, inc := range store.ListIncidents() {
+		inc := inc
+		if inc.DeviceID != "sw-1" {
+			continue
+		}
+		if inc.ExternalID == "e1" {
+			problem = &inc
+		} else {
+			offline = &inc
+		}
+	}
+	if problem == nil || problem.Resolved != nil || problem.Started != "2026-01-01T00:00:00Z" || problem.Type != "external_problem" {
+		t.Fatalf("expected problem incident to stay open, got=%#v", problem)
+	}
+	if offline == nil || offline.Resolved == nil {
+		t.Fatalf("expected offline incident resolved by telemetry, got=%#v", offline)
+	}
+
+	result = store.SyncSourceProblems("zabbix", []SourceProblem{{ExternalID: "e1", DeviceID: "sw-1", Severity: "critical", Message: "CPU pegged"}}, 0)
+	if len(result.Opened) != 0 || len(result.Resolved) != 0 {
+		t.Fatalf("expected known problem to update in place, got=%#v", result)
+	}
+	if other := store.SyncSourceProblems("librenms", nil, 0); len(other.Resolved) != 0 {
+		t.Fatalf("expected another source not to resolve zabbix problems, got=%#v", other)
+	}
+	if cleared := store.SyncSourceProblems("zabbix", []SourceProblem{}, 0); len(cleared.Resolved) != 1 {
+		t.Fatalf("expected empty list to resolve the problem, got=%#v", cleared)
+	}
+}
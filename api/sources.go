@@ -3,8 +3,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -19,9 +19,31 @@ type SourceConnector interface {
 	Status() SourceStatus
 }
 
+// guardedSourceConnector is implemented by connectors with a rate-limit and
+// circuit breaker guard; the background poller adapts its interval to it.
+type guardedSourceConnector interface {
+	Guard() *SourceGuard
+}
+
+// transportSourceConnector is implemented by HTTP connectors whose
+// transport can be swapped for fixture recording or replay.
+type transportSourceConnector interface {
+	SourceConnector
+	SetTransport(rt http.RoundTripper)
+}
+
 type sourcePollBatch struct {
 	Response SourcePollResponse
 	Events   []TelemetryIngestRequest
+	// SeenIDs lists every record ID fetched; Complete is set only when the
+	// fetch was live and not cut short, so removals can be inferred.
+	SeenIDs  []string
+	Complete bool
+	// Problems holds active alerts from monitoring-system sources.
+	// ProblemsFetched marks a live problem list, so an empty one resolves
+	// every open problem from the source.
+	Problems        []SourceProblem
+	ProblemsFetched bool
 }
 
 type uiSPDeviceRecord struct {
@@ -38,6 +60,8 @@ type uiSPDeviceRecord struct {
 	Neighs       []TelemetryNeighborFact
 	Online       bool
 	Latency      *float64
+	Metrics      *TelemetryMetrics
+	Wireless     *TelemetryWirelessFact
 	ObservedAtMs int64
 }
 
@@ -45,12 +69,16 @@ type UISPConnector struct {
 	baseURL     string
 	token       string
 	devicesPath string
+	pagination  PaginationConfig
+	guard       *SourceGuard
 	client      *http.Client
 
-	mu        sync.RWMutex
-	status    SourceStatus
-	lastKnown map[string]bool
-	seen      map[string]int64
+	mu           sync.RWMutex
+	status       SourceStatus
+	lastKnown    map[string]bool
+	fingerprints map[string]sourceRecordFingerprint
+	readings     map[string]uiSPDeviceRecord // last emitted record per device
+	seen         map[string]int64
 }
 
 func NewUISPConnector(baseURL, token, devicesPath string) *UISPConnector {
@@ -68,9 +96,13 @@ func NewUISPConnector(baseURL, token, devicesPath string) *UISPConnector {
 		client: &http.Client{
 			Timeout: 12 * time.Second,
 		},
-		status:    SourceStatus{Source: "uisp", Stub: true},
-		lastKnown: map[string]bool{},
-		seen:      map[string]int64{},
+		pagination:   normalizePaginationConfig(PaginationConfig{}),
+		guard:        NewSourceGuard(SourceGuardConfig{}),
+		status:       SourceStatus{Source: "uisp", Stub: true},
+		lastKnown:    map[string]bool{},
+		fingerprints: map[string]sourceRecordFingerprint{},
+		readings:     map[string]uiSPDeviceRecord{},
+		seen:         map[string]int64{},
 	}
 }
 
@@ -80,15 +112,34 @@ func (u *UISPConnector) Name() string {
 
 func (u *UISPConnector) Status() SourceStatus {
 	u.mu.RLock()
-	defer u.mu.RUnlock()
-	return u.status
+	status := u.status
+	u.mu.RUnlock()
+	status.Breaker = u.guard.Snapshot()
+	return status
+}
+
+func (u *UISPConnector) Guard() *SourceGuard {
+	return u.guard
+}
+
+// SetGuard replaces the rate-limit/breaker guard; call before polling starts.
+func (u *UISPConnector) SetGuard(cfg SourceGuardConfig) {
+	u.guard = NewSourceGuard(cfg)
+}
+
+// SetTransport swaps the HTTP transport, e.g. for fixture record/replay.
+func (u *UISPConnector) SetTransport(rt http.RoundTripper) {
+	u.client.Transport = rt
 }
 
 func (u *UISPConnector) Poll(ctx context.Context, req SourcePollRequest) (sourcePollBatch, error) {
 	start := time.Now()
-	if req.Limit <= 0 || req.Limit > 500 {
+	if req.Limit <= 0 {
 		req.Limit = 200
 	}
+	if req.Limit > maxSourcePollRecords {
+		req.Limit = maxSourcePollRecords
+	}
 	if req.Retries < 0 {
 		req.Retries = 0
 	}
@@ -101,13 +152,18 @@ func (u *UISPConnector) Poll(ctx context.Context, req SourcePollRequest) (source
 	backfill := strings.TrimSpace(req.Cursor) != ""
 
 	var (
-		records []uiSPDeviceRecord
-		err     error
+		records  []uiSPDeviceRecord
+		pages    int
+		complete bool
+		err      error
 	)
 	if demoMode {
 		records = u.demoRecords()
+		pages = 1
 	} else {
-		records, err = u.fetchUISPRecords(ctx, req.Retries)
+		var fetched pagedFetchResult
+		fetched, err = u.fetchUISPRecords(ctx, req.Retries)
+		records, pages, complete = fetched.Records, fetched.Pages, !fetched.Truncated
 		if err != nil {
 			u.setStatus(SourceStatus{
 				Source:     "uisp",
@@ -130,8 +186,17 @@ func (u *UISPConnector) Poll(ctx context.Context, req SourcePollRequest) (source
 			}, err
 		}
 	}
+	fetchedTotal := len(records)
+	seenIDs := make([]string, 0, len(records))
+	for _, rec := range records {
+		if rec.ID != "" {
+			seenIDs = append(seenIDs, rec.ID)
+		}
+	}
+	truncated := false
 	if len(records) > req.Limit {
 		records = records[:req.Limit]
+		truncated = true
 	}
 
 	nowMs := time.Now().UnixMilli()
@@ -139,6 +204,7 @@ func (u *UISPConnector) Poll(ctx context.Context, req SourcePollRequest) (source
 	normalized := 0
 	deduped := 0
 	emitted := 0
+	updated := 0
 
 	u.mu.Lock()
 	for id, ts := range u.seen {
@@ -155,20 +221,17 @@ func (u *UISPConnector) Poll(ctx context.Context, req SourcePollRequest) (source
 
 		prev, seen := u.lastKnown[rec.ID]
 		u.lastKnown[rec.ID] = rec.Online
-
-		eventType := ""
-		if !seen {
-			if !rec.Online {
-				eventType = "device_down"
-			}
-		} else if prev != rec.Online {
-			if rec.Online {
-				eventType = "device_up"
-			} else {
-				eventType = "device_down"
-			}
+		fp := fingerprintSourceRecord(rec)
+		prevFP, hadFP := u.fingerprints[rec.ID]
+		u.fingerprints[rec.ID] = fp
+		var last *uiSPDeviceRecord
+		if r, ok := u.readings[rec.ID]; ok {
+			last = &r
+		} else {
+			u.readings[rec.ID] = rec
 		}
 
+		eventType, changed := classifySourceRecord(prev, seen, rec, prevFP, hadFP, fp, last, req.FullSync)
 		if eventType == "" {
 			continue
 		}
@@ -196,22 +259,32 @@ func (u *UISPConnector) Poll(ctx context.Context, req SourcePollRequest) (source
 			SiteID:       rec.SiteID,
 			Online:       &online,
 			LatencyMs:    rec.Latency,
-			Message:      fmt.Sprintf("UISP poll state=%t", rec.Online),
+			Metrics:      rec.Metrics,
+			Wireless:     rec.Wireless,
+			Message:      sourceEventMessage("UISP", eventType, rec.Online, changed),
 			Interfaces:   rec.Ifaces,
 			Neighbors:    rec.Neighs,
 		})
+		u.readings[rec.ID] = rec
 		emitted++
+		if eventType == "device_update" {
+			updated++
+		}
 	}
 	u.mu.Unlock()
 
 	resp := SourcePollResponse{
 		Source:     "uisp",
 		Cursor:     cursor,
-		Fetched:    len(records),
+		Fetched:    fetchedTotal,
+		Pages:      pages,
+		Truncated:  truncated,
 		Normalized: normalized,
 		Emitted:    emitted,
+		Updated:    updated,
 		Deduped:    deduped,
 		Backfill:   backfill,
+		FullSync:   req.FullSync,
 		Demo:       demoMode,
 		DurationMs: time.Since(start).Milliseconds(),
 		Stub:       true,
@@ -222,74 +295,40 @@ func (u *UISPConnector) Poll(ctx context.Context, req SourcePollRequest) (source
 		LastPollAt:     time.Now().UTC().Format(time.RFC3339),
 		LastCursor:     cursor,
 		LastFetched:    resp.Fetched,
+		LastPages:      resp.Pages,
+		LastTruncated:  resp.Truncated,
 		LastNormalized: resp.Normalized,
 		LastEmitted:    resp.Emitted,
 		Demo:           demoMode,
 		Stub:           true,
 	})
 
-	return sourcePollBatch{Response: resp, Events: events}, nil
+	return sourcePollBatch{Response: resp, Events: events, SeenIDs: seenIDs, Complete: complete && !demoMode}, nil
 }
 
-func (u *UISPConnector) fetchUISPRecords(ctx context.Context, retries int) ([]uiSPDeviceRecord, error) {
-	url := u.baseURL + u.devicesPath
-	var lastErr error
-	for attempt := 0; attempt <= retries; attempt++ {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Accept", "application/json")
-		req.Header.Set("X-Auth-Token", u.token)
-		req.Header.Set("Authorization", "Bearer "+u.token)
-
-		resp, err := u.client.Do(req)
-		if err != nil {
-			lastErr = err
-			if attempt < retries {
-				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-				continue
-			}
-			break
-		}
-
-		body, readErr := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-		if readErr != nil {
-			lastErr = readErr
-			if attempt < retries {
-				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-				continue
-			}
-			break
-		}
-
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			lastErr = fmt.Errorf("uisp status %d", resp.StatusCode)
-			if attempt < retries {
-				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-				continue
-			}
-			break
-		}
+func (u *UISPConnector) fetchUISPRecords(ctx context.Context, retries int) (pagedFetchResult, error) {
+	u.mu.RLock()
+	pagination := u.pagination
+	u.mu.RUnlock()
+	if err := u.guard.Allow(); err != nil {
+		return pagedFetchResult{}, err
+	}
+	result, err := fetchPagedRecords(ctx, u.client, u.baseURL+u.devicesPath, pagination, retries, "uisp", headerAuth(u.applyAuthHeaders), u.guard, parseUISPDevices, countPageItems)
+	u.guard.RecordPoll(err)
+	return result, err
+}
 
-		recs, parseErr := parseUISPDevices(body)
-		if parseErr != nil {
-			lastErr = parseErr
-			if attempt < retries {
-				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-				continue
-			}
-			break
-		}
-		return recs, nil
-	}
+func (u *UISPConnector) applyAuthHeaders(req *http.Request) {
+	req.Header.Set("X-Auth-Token", u.token)
+	req.Header.Set("Authorization", "Bearer "+u.token)
+}
 
-	if lastErr == nil {
-		lastErr = fmt.Errorf("uisp poll failed")
-	}
-	return nil, lastErr
+func (u *UISPConnector) SetPagination(cfg PaginationConfig) {
+	u.mu.Lock()
+	u.pagination = normalizePaginationConfig(cfg)
+	u.mu.Unlock()
 }
+
 func parseUISPDevices(body []byte) ([]uiSPDeviceRecord, error) {
 	var payload any
 	if err := json.Unmarshal(body, &payload); err != nil {
@@ -346,6 +385,7 @@ func parseUISPDevices(body []byte) ([]uiSPDeviceRecord, error) {
 		siteID := pickString(item,
 			[]string{"site", "id"},
 			[]string{"siteId"},
+			[]string{"identification", "site", "id"},
 		)
 		if siteID == "" {
 			siteID = "uisp"
@@ -361,6 +401,12 @@ func parseUISPDevices(body []byte) ([]uiSPDeviceRecord, error) {
 			[]string{"overview", "latency"},
 			[]string{"overview", "ping"},
 		)
+		metrics := pickHealthMetrics(item, healthMetricPaths{
+			cpu:    [][]string{{"overview", "cpu"}},
+			mem:    [][]string{{"overview", "ram"}},
+			temp:   [][]string{{"overview", "temperature"}},
+			uptime: [][]string{{"overview", "uptime"}},
+		})
 		observedAtMs := pickTimestampMs(item,
 			[]string{"overview", "lastSeen"},
 			[]string{"overview", "lastUpdate"},
@@ -400,6 +446,8 @@ func parseUISPDevices(body []byte) ([]uiSPDeviceRecord, error) {
 			Neighs:       parseUISPNeighbors(item),
 			Online:       online,
 			Latency:      latency,
+			Metrics:      metrics,
+			Wireless:     parseUISPWireless(item),
 			ObservedAtMs: observedAtMs,
 		})
 	}
@@ -410,6 +458,82 @@ func parseUISPDevices(body []byte) ([]uiSPDeviceRecord, error) {
 	return records, nil
 }
 
+// parseUISPWireless reads the radio fields UISP reports for airMAX and LTU
+// devices. Only stations name their AP; APs come back with an empty
+// apDevice and are dropped at ingest.
+func parseUISPWireless(device map[string]any) *TelemetryWirelessFact {
+	fact := &TelemetryWirelessFact{
+		Mode: pickString(device,
+			[]string{"overview", "wirelessMode"},
+			[]string{"airmax", "wirelessMode"},
+			[]string{"ltu", "wirelessMode"},
+		),
+		Technology: uispWirelessTechnology(pickString(device,
+			[]string{"identification", "type"},
+			[]string{"type"},
+		)),
+		APDeviceID: pickString(device,
+			[]string{"attributes", "apDevice", "id"},
+			[]string{"apDevice", "id"},
+		),
+		APName: pickString(device,
+			[]string{"attributes", "apDevice", "name"},
+			[]string{"apDevice", "name"},
+		),
+		SSID: pickString(device,
+			[]string{"attributes", "ssid"},
+			[]string{"overview", "ssid"},
+		),
+		FrequencyMHz: pickFloat(device,
+			[]string{"overview", "frequency"},
+			[]string{"airmax", "frequency"},
+		),
+		SignalDbm: pickFloat(device,
+			[]string{"overview", "signal"},
+			[]string{"airmax", "signal"},
+		),
+		RemoteSignalDbm: pickFloat(device,
+			[]string{"airmax", "remoteSignal"},
+			[]string{"overview", "remoteSignal"},
+		),
+		NoiseDbm: pickFloat(device,
+			[]string{"airmax", "noiseFloor"},
+			[]string{"overview", "noiseFloor"},
+		),
+		CCQPct: pickFloat(device,
+			[]string{"airmax", "ccq"},
+			[]string{"overview", "ccq"},
+		),
+		DownlinkCapacityBps: pickFloat(device,
+			[]string{"overview", "downlinkCapacity"},
+			[]string{"airmax", "downlinkCapacity"},
+		),
+		UplinkCapacityBps: pickFloat(device,
+			[]string{"overview", "uplinkCapacity"},
+			[]string{"airmax", "uplinkCapacity"},
+		),
+		DistanceM: pickFloat(device,
+			[]string{"overview", "distance"},
+			[]string{"airmax", "distance"},
+		),
+	}
+	if fact.APDeviceID == "" && fact.SignalDbm == nil && fact.DownlinkCapacityBps == nil {
+		return nil
+	}
+	return fact
+}
+
+func uispWirelessTechnology(deviceType string) string {
+	t := strings.ToLower(strings.TrimSpace(deviceType))
+	switch {
+	case strings.Contains(t, "ltu"):
+		return "ltu"
+	case strings.Contains(t, "airmax"):
+		return "airmax"
+	}
+	return t
+}
+
 func parseUISPInterfaces(device map[string]any) []TelemetryInterfaceFact {
 	raw, ok := device["interfaces"]
 	if !ok {
@@ -680,6 +804,8 @@ func ingestSourceEvents(store *Store, events []TelemetryIngestRequest) (int, int
 	ingested := 0
 	incidents := 0
 	dropped := 0
+	store.beginImpactBatch()
+	defer store.endImpactBatch()
 	ordered := store.PrioritizeTelemetryQueue(events)
 	for _, ev := range ordered {
 		_, inc, decision, ok := store.IngestTelemetryWithDecision(ev)
@@ -698,15 +824,35 @@ func ingestSourceEvents(store *Store, events []TelemetryIngestRequest) (int, int
 	return ingested, incidents, dropped
 }
 
-func runSourcePoller(ctx context.Context, connector SourceConnector, store *Store, logger *slog.Logger, interval time.Duration, retries int) {
+// runSourcePoller polls on an interval. The first poll and then one poll
+// per fullSyncInterval run as full syncs so inventory attributes converge
+// even if a change event was dropped.
+func runSourcePoller(ctx context.Context, connector SourceConnector, store *Store, logger *slog.Logger, interval time.Duration, retries int, fullSyncInterval time.Duration) {
 	if interval <= 0 {
 		return
 	}
-	logger.Info("source_poller_started", "source", connector.Name(), "interval_sec", int(interval.Seconds()), "retries", retries)
+	logger.Info("source_poller_started", "source", connector.Name(), "interval_sec", int(interval.Seconds()), "retries", retries, "full_sync_interval_sec", int(fullSyncInterval.Seconds()))
 
+	var guard *SourceGuard
+	if guarded, ok := connector.(guardedSourceConnector); ok {
+		guard = guarded.Guard()
+	}
+
+	var lastFullSync time.Time
 	run := func() {
-		batch, err := connector.Poll(ctx, SourcePollRequest{Retries: retries})
+		fullSync := lastFullSync.IsZero() || (fullSyncInterval > 0 && time.Since(lastFullSync) >= fullSyncInterval)
+		batch, err := connector.Poll(ctx, SourcePollRequest{Limit: maxSourcePollRecords, Retries: retries, FullSync: fullSync})
 		if err != nil {
+			if errors.Is(err, ErrSourceCircuitOpen) {
+				gapsCreated, gapsResolved := store.DetectTelemetryGaps(time.Now().UnixMilli())
+				logger.Info("source_poller_circuit_open",
+					"source", connector.Name(),
+					"error", err.Error(),
+					"gap_incidents_created", gapsCreated,
+					"gap_incidents_resolved", gapsResolved,
+				)
+				return
+			}
 			store.RecordSourcePollOutcome(connector.Name(), false, err.Error(), time.Now().UnixMilli())
 			gapsCreated, gapsResolved := store.DetectTelemetryGaps(time.Now().UnixMilli())
 			logger.Warn("source_poller_poll_failed", "source", connector.Name(), "error", err.Error())
@@ -717,14 +863,30 @@ func runSourcePoller(ctx context.Context, connector SourceConnector, store *Stor
 			)
 			return
 		}
+		if fullSync {
+			lastFullSync = time.Now()
+		}
 		store.RecordSourcePollOutcome(connector.Name(), true, "", time.Now().UnixMilli())
 		ingested, incidents, dropped := ingestSourceEvents(store, batch.Events)
+		reconciled := reconcileSourceBatch(store, connector.Name(), batch)
+		problems := syncSourceProblemsBatch(store, connector.Name(), batch)
 		gapsCreated, gapsResolved := store.DetectTelemetryGaps(time.Now().UnixMilli())
 		logger.Info("source_poller_poll_ok",
 			"source", connector.Name(),
+			"full_sync", fullSync,
 			"fetched", batch.Response.Fetched,
+			"pages", batch.Response.Pages,
+			"truncated", batch.Response.Truncated,
 			"normalized", batch.Response.Normalized,
 			"emitted", batch.Response.Emitted,
+			"updated", batch.Response.Updated,
+			"complete", batch.Complete,
+			"missing", reconciled.Missing,
+			"removed", len(reconciled.Removed),
+			"restored", len(reconciled.Restored),
+			"problems_active", problems.Active,
+			"problems_opened", len(problems.Opened),
+			"problems_resolved", len(problems.Resolved),
 			"ingested", ingested,
 			"dropped_by_governor", dropped,
 			"incidents", incidents,
@@ -735,15 +897,23 @@ func runSourcePoller(ctx context.Context, connector SourceConnector, store *Stor
 	}
 
 	run()
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
 	for {
+		// The guard stretches the interval while the source fails or
+		// throttles and shrinks it back once polls succeed.
+		next := guard.NextInterval(interval)
+		if snapshot := guard.Snapshot(); snapshot != nil {
+			store.RecordSourceBreakerState(connector.Name(), *snapshot, time.Now().UnixMilli())
+			if next != interval {
+				logger.Info("source_poller_interval_adjusted", "source", connector.Name(), "interval_sec", int(next.Seconds()), "breaker", snapshot.State)
+			}
+		}
+		timer := time.NewTimer(next)
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			logger.Info("source_poller_stopped", "source", connector.Name())
 			return
-		case <-ticker.C:
+		case <-timer.C:
 			run()
 		}
 	}
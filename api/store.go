@@ -24,6 +24,7 @@ const (
 	maxHAFailoverEvents     = 4000
 	maxSamplingStateDevices = 20000
 	maxQualitySources       = 200
+	maxUnmappedMetricNames  = 20
 	defaultHotRetentionMs   = int64((6 * time.Hour) / time.Millisecond)
 	defaultWarmRetentionMs  = int64((7 * 24 * time.Hour) / time.Millisecond)
 	defaultColdRetentionMs  = int64((90 * 24 * time.Hour) / time.Millisecond)
@@ -76,21 +77,22 @@ type TelemetryRetentionPolicy struct {
 }
 
 type TelemetrySample struct {
-	SampleID            string   `json:"sample_id"`
-	DeviceID            string   `json:"device_id"`
-	IdentityID          string   `json:"identity_id,omitempty"`
-	Source              string   `json:"source"`
-	EventType           string   `json:"event_type"`
-	DeviceRole          string   `json:"device_role,omitempty"`
-	SiteID              string   `json:"site_id,omitempty"`
-	Online              *bool    `json:"online,omitempty"`
-	LatencyMs           *float64 `json:"latency_ms,omitempty"`
-	ObservedAt          int64    `json:"observed_at"`
-	SourceObservedAt    int64    `json:"source_observed_at,omitempty"`
-	ClockSkewMs         int64    `json:"clock_skew_ms,omitempty"`
-	TimestampConfidence float64  `json:"timestamp_confidence,omitempty"`
-	TimestampCorrected  bool     `json:"timestamp_corrected,omitempty"`
-	ObservedISO         string   `json:"observed_at_iso,omitempty"`
+	SampleID            string            `json:"sample_id"`
+	DeviceID            string            `json:"device_id"`
+	IdentityID          string            `json:"identity_id,omitempty"`
+	Source              string            `json:"source"`
+	EventType           string            `json:"event_type"`
+	DeviceRole          string            `json:"device_role,omitempty"`
+	SiteID              string            `json:"site_id,omitempty"`
+	Online              *bool             `json:"online,omitempty"`
+	LatencyMs           *float64          `json:"latency_ms,omitempty"`
+	Metrics             *TelemetryMetrics `json:"metrics,omitempty"`
+	ObservedAt          int64             `json:"observed_at"`
+	SourceObservedAt    int64             `json:"source_observed_at,omitempty"`
+	ClockSkewMs         int64             `json:"clock_skew_ms,omitempty"`
+	TimestampConfidence float64           `json:"timestamp_confidence,omitempty"`
+	TimestampCorrected  bool              `json:"timestamp_corrected,omitempty"`
+	ObservedISO         string            `json:"observed_at_iso,omitempty"`
 }
 
 type Store struct {
@@ -122,10 +124,26 @@ type Store struct {
 	TelemetryQualityBySource    map[string]TelemetrySourceQualityStats `json:"telemetry_quality_by_source,omitempty"`
 	IncidentHandoffs            []IncidentShiftHandoff                 `json:"incident_handoffs,omitempty"`
 	IncidentAuditEvents         []IncidentAuditEvent                   `json:"incident_audit_events,omitempty"`
-
-	filePath      string
-	identityIndex map[string]string
-	retentionLast TelemetryRetentionSummary
+	AgentConfigVersions         []AgentConfigVersion                   `json:"agent_config_versions,omitempty"`
+	AgentConfigRollouts         []AgentConfigRollout                   `json:"agent_config_rollouts,omitempty"`
+	DiagnosticJobs              []DiagnosticJob                        `json:"diagnostic_jobs,omitempty"`
+	AgentIngestCursors          map[string]AgentIngestCursor           `json:"agent_ingest_cursors,omitempty"`
+	DeviceReboots               []DeviceReboot                         `json:"device_reboots,omitempty"`
+	WirelessLinks               []WirelessLink                         `json:"wireless_links,omitempty"`
+	WirelessLinkSamples         []WirelessLinkSample                   `json:"wireless_link_samples,omitempty"`
+	WirelessLinkBaselines       map[string][]WirelessBaselineBucket    `json:"wireless_link_baselines,omitempty"`
+	Subscribers                 []Subscriber                           `json:"subscribers,omitempty"`
+	SubscribersSyncedAt         string                                 `json:"subscribers_synced_at,omitempty"`
+	NetBox                      NetBoxInventory                        `json:"netbox"`
+
+	filePath             string
+	identityIndex        map[string]string
+	retentionLast        TelemetryRetentionSummary
+	agentConfigSignal    chan struct{}
+	sourceRemovalGraceMs map[string]int64
+	impactBatches        int
+	impactGraph          *subscriberImpactGraph
+	lastUptimeS          map[string]int64
 }
 
 type storePersist struct {
@@ -155,6 +173,17 @@ type storePersist struct {
 	TelemetryQualityBySource    map[string]TelemetrySourceQualityStats `json:"telemetry_quality_by_source,omitempty"`
 	IncidentHandoffs            []IncidentShiftHandoff                 `json:"incident_handoffs,omitempty"`
 	IncidentAuditEvents         []IncidentAuditEvent                   `json:"incident_audit_events,omitempty"`
+	AgentConfigVersions         []AgentConfigVersion                   `json:"agent_config_versions,omitempty"`
+	AgentConfigRollouts         []AgentConfigRollout                   `json:"agent_config_rollouts,omitempty"`
+	DiagnosticJobs              []DiagnosticJob                        `json:"diagnostic_jobs,omitempty"`
+	AgentIngestCursors          map[string]AgentIngestCursor           `json:"agent_ingest_cursors,omitempty"`
+	DeviceReboots               []DeviceReboot                         `json:"device_reboots,omitempty"`
+	WirelessLinks               []WirelessLink                         `json:"wireless_links,omitempty"`
+	WirelessLinkSamples         []WirelessLinkSample                   `json:"wireless_link_samples,omitempty"`
+	WirelessLinkBaselines       map[string][]WirelessBaselineBucket    `json:"wireless_link_baselines,omitempty"`
+	Subscribers                 []Subscriber                           `json:"subscribers,omitempty"`
+	SubscribersSyncedAt         string                                 `json:"subscribers_synced_at,omitempty"`
+	NetBox                      NetBoxInventory                        `json:"netbox"`
 }
 
 func LoadStore(path string) *Store {
@@ -215,6 +244,17 @@ func (s *Store) save() {
 		TelemetryQualityBySource:    cloneTelemetrySourceQualityMap(s.TelemetryQualityBySource),
 		IncidentHandoffs:            cloneIncidentHandoffs(s.IncidentHandoffs),
 		IncidentAuditEvents:         cloneIncidentAuditEvents(s.IncidentAuditEvents),
+		AgentConfigVersions:         append([]AgentConfigVersion(nil), s.AgentConfigVersions...),
+		AgentConfigRollouts:         append([]AgentConfigRollout(nil), s.AgentConfigRollouts...),
+		DiagnosticJobs:              cloneDiagnosticJobs(s.DiagnosticJobs),
+		AgentIngestCursors:          cloneAgentIngestCursors(s.AgentIngestCursors),
+		DeviceReboots:               append([]DeviceReboot(nil), s.DeviceReboots...),
+		WirelessLinks:               cloneWirelessLinks(s.WirelessLinks),
+		WirelessLinkSamples:         append([]WirelessLinkSample(nil), s.WirelessLinkSamples...),
+		WirelessLinkBaselines:       cloneWirelessBaselines(s.WirelessLinkBaselines),
+		Subscribers:                 cloneSubscribers(s.Subscribers),
+		SubscribersSyncedAt:         s.SubscribersSyncedAt,
+		NetBox:                      s.NetBox,
 	}
 	s.mu.RUnlock()
 
@@ -293,6 +333,19 @@ func (s *Store) ensureDefaultsAndMigrateLocked() {
 	if len(s.IncidentHandoffs) > maxIncidentHandoffs {
 		s.IncidentHandoffs = append([]IncidentShiftHandoff(nil), s.IncidentHandoffs[len(s.IncidentHandoffs)-maxIncidentHandoffs:]...)
 	}
+	if len(s.DeviceReboots) > maxDeviceReboots {
+		s.DeviceReboots = append([]DeviceReboot(nil), s.DeviceReboots[len(s.DeviceReboots)-maxDeviceReboots:]...)
+	}
+	if len(s.WirelessLinkSamples) > maxWirelessLinkSamples {
+		s.WirelessLinkSamples = append([]WirelessLinkSample(nil), s.WirelessLinkSamples[len(s.WirelessLinkSamples)-maxWirelessLinkSamples:]...)
+	}
+	if s.WirelessLinkBaselines == nil {
+		// Stores from before rolling baselines seed them from the samples
+		// they kept.
+		for _, sample := range s.WirelessLinkSamples {
+			s.foldWirelessBaselineLocked(sample)
+		}
+	}
 	if len(s.IncidentAuditEvents) > maxIncidentAuditEvents {
 		s.IncidentAuditEvents = append([]IncidentAuditEvent(nil), s.IncidentAuditEvents[len(s.IncidentAuditEvents)-maxIncidentAuditEvents:]...)
 	}
@@ -380,6 +433,8 @@ func normalizeIncidentAuditAction(raw string) string {
 		return "incident_acked"
 	case "timeline_note":
 		return "timeline_note"
+	case "diagnostic_result":
+		return "diagnostic_result"
 	default:
 		return "incident_event"
 	}
@@ -756,7 +811,7 @@ func (s *Store) TelemetryQualityReport() TelemetryQualityResponse {
 		reliability := clampScore(int(math.Round(100 - errRate)))
 		overall := clampScore(int(math.Round((0.40 * float64(fresh)) + (0.35 * float64(complete)) + (0.25 * float64(reliability)))))
 		status := qualityStatusForScore(overall)
-		if stats.ConsecutivePollFailures >= 3 {
+		if stats.ConsecutivePollFailures >= 3 || stats.BreakerState == "open" {
 			status = "failing"
 		}
 
@@ -778,6 +833,18 @@ func (s *Store) TelemetryQualityReport() TelemetryQualityResponse {
 		if complete < 70 {
 			warnings = append(warnings, "low_completeness")
 		}
+		if stats.DuplicateSamples > 0 && stats.TotalSamples > 0 && (float64(stats.DuplicateSamples)/float64(stats.TotalSamples)) > 0.10 {
+			warnings = append(warnings, "high_duplicate_resend")
+		}
+		switch stats.BreakerState {
+		case "open":
+			warnings = append(warnings, "circuit_open")
+		case "half_open":
+			warnings = append(warnings, "circuit_half_open")
+		}
+		if stats.RateLimitedUntilMs > nowMs {
+			warnings = append(warnings, "rate_limited")
+		}
 
 		cards = append(cards, TelemetrySourceQualityScorecard{
 			Source:            source,
@@ -793,6 +860,7 @@ func (s *Store) TelemetryQualityReport() TelemetryQualityResponse {
 		})
 
 		health.PollAttempts += stats.PollAttempts
+		health.UnmappedMetricPoints += stats.UnmappedMetricPoints
 		health.PollFailures += stats.PollFailures
 		switch status {
 		case "healthy":
@@ -822,6 +890,10 @@ type baselineGroupAccumulator struct {
 	sampleCount  int
 	latencies    []float64
 	availability []float64
+	cpu          []float64
+	mem          []float64
+	temp         []float64
+	gauges       map[string][]float64
 	windows      map[string]*baselineWindowAccumulator
 }
 
@@ -895,6 +967,23 @@ func (s *Store) TelemetryBaselineReport(windowHours int) TelemetryBaselineReport
 			group.latencies = append(group.latencies, v)
 			latencyVal = &v
 		}
+		if m := sample.Metrics; m != nil {
+			if m.CPUPct != nil {
+				group.cpu = append(group.cpu, *m.CPUPct)
+			}
+			if m.MemPct != nil {
+				group.mem = append(group.mem, *m.MemPct)
+			}
+			if m.TempC != nil {
+				group.temp = append(group.temp, *m.TempC)
+			}
+			for name, v := range m.Gauges {
+				if group.gauges == nil {
+					group.gauges = map[string][]float64{}
+				}
+				group.gauges[name] = append(group.gauges[name], v)
+			}
+		}
 		var availabilityVal *float64
 		if sample.Online != nil {
 			if *sample.Online {
@@ -963,6 +1052,25 @@ func (s *Store) TelemetryBaselineReport(windowHours int) TelemetryBaselineReport
 		if metric, ok := baselineMetricFromValues("availability_pct", "pct", group.availability); ok {
 			metrics = append(metrics, metric)
 		}
+		if metric, ok := baselineMetricFromValues("cpu_pct", "pct", group.cpu); ok {
+			metrics = append(metrics, metric)
+		}
+		if metric, ok := baselineMetricFromValues("mem_pct", "pct", group.mem); ok {
+			metrics = append(metrics, metric)
+		}
+		if metric, ok := baselineMetricFromValues("temp_c", "c", group.temp); ok {
+			metrics = append(metrics, metric)
+		}
+		gaugeNames := make([]string, 0, len(group.gauges))
+		for name := range group.gauges {
+			gaugeNames = append(gaugeNames, name)
+		}
+		sort.Strings(gaugeNames)
+		for _, name := range gaugeNames {
+			if metric, ok := baselineMetricFromValues(metricTargetGauge+name, "", group.gauges[name]); ok {
+				metrics = append(metrics, metric)
+			}
+		}
 
 		windows := make([]TelemetryAnomalyWindow, 0, len(group.windows))
 		for _, acc := range group.windows {
@@ -1546,6 +1654,13 @@ func baselineMetricFromValues(metric, unit string, values []float64) (TelemetryB
 
 func baselineBounds(metric string, mean, stdDev float64) (float64, float64) {
 	sigma := stdDev
+	if metric == "temp_c" || strings.HasPrefix(metric, metricTargetGauge) {
+		// Temperatures and free-form gauges can legitimately go negative.
+		if sigma <= 0 {
+			sigma = maxFloat64(1, math.Abs(mean)*0.15)
+		}
+		return mean - (2 * sigma), mean + (2 * sigma)
+	}
 	switch metric {
 	case "availability_pct":
 		if sigma <= 0 {
@@ -1560,6 +1675,19 @@ func baselineBounds(metric string, mean, stdDev float64) (float64, float64) {
 			upper = 100
 		}
 		return lower, upper
+	case "cpu_pct", "mem_pct":
+		if sigma <= 0 {
+			sigma = maxFloat64(2.5, mean*0.15)
+		}
+		lower := mean - (2 * sigma)
+		upper := mean + (2 * sigma)
+		if lower < 0 {
+			lower = 0
+		}
+		if upper > 100 {
+			upper = 100
+		}
+		return lower, upper
 	default:
 		if sigma <= 0 {
 			sigma = maxFloat64(1, mean*0.15)
@@ -1616,6 +1744,82 @@ func (s *Store) RecordSourcePollOutcome(source string, success bool, errText str
 	s.save()
 }
 
+// RecordSourceBreakerState copies a connector guard snapshot into the
+// source quality stats so scorecards reflect throttling and open breakers.
+func (s *Store) RecordSourceBreakerState(source string, breaker SourceBreakerStatus, nowMs int64) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		source = defaultDeviceSourceName
+	}
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+	rateLimitedUntilMs := int64(0)
+	if breaker.RetryAfterUntil != "" {
+		if at, err := time.Parse(time.RFC3339, breaker.RetryAfterUntil); err == nil {
+			rateLimitedUntilMs = at.UnixMilli()
+		}
+	}
+
+	s.mu.Lock()
+	if s.TelemetryQualityBySource == nil {
+		s.TelemetryQualityBySource = map[string]TelemetrySourceQualityStats{}
+	}
+	stats, ok := s.TelemetryQualityBySource[source]
+	if ok && stats.BreakerState == breaker.State &&
+		stats.BreakerOpenCount == breaker.OpenCount &&
+		stats.ThrottledResponses == breaker.ThrottledResponses &&
+		stats.RateLimitedUntilMs == rateLimitedUntilMs &&
+		stats.PollIntervalSec == breaker.PollIntervalSec {
+		// Pollers report after every cycle; only a change is worth a save.
+		s.mu.Unlock()
+		return
+	}
+	stats.Source = source
+	stats.BreakerState = breaker.State
+	stats.BreakerOpenCount = breaker.OpenCount
+	stats.ThrottledResponses = breaker.ThrottledResponses
+	stats.RateLimitedUntilMs = rateLimitedUntilMs
+	stats.PollIntervalSec = breaker.PollIntervalSec
+	stats.UpdatedAtMs = nowMs
+	s.TelemetryQualityBySource[source] = stats
+	s.mu.Unlock()
+	s.save()
+}
+
+// RecordUnmappedMetrics counts pushed metric points that no mapping rule
+// covered, and keeps a short sorted list of their names so the ingestion
+// health output says which mappings are missing.
+func (s *Store) RecordUnmappedMetrics(source string, counts map[string]int64, nowMs int64) {
+	source = strings.TrimSpace(source)
+	if source == "" || len(counts) == 0 {
+		return
+	}
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+
+	s.mu.Lock()
+	if s.TelemetryQualityBySource == nil {
+		s.TelemetryQualityBySource = map[string]TelemetrySourceQualityStats{}
+	}
+	stats := s.TelemetryQualityBySource[source]
+	stats.Source = source
+	names := append([]string(nil), stats.UnmappedMetricNames...)
+	for name, count := range counts {
+		stats.UnmappedMetricPoints += count
+		if len(names) < maxUnmappedMetricNames {
+			names = appendUnique(names, name)
+		}
+	}
+	sort.Strings(names)
+	stats.UnmappedMetricNames = names
+	stats.UpdatedAtMs = nowMs
+	s.TelemetryQualityBySource[source] = stats
+	s.mu.Unlock()
+	s.save()
+}
+
 func (s *Store) PrioritizeTelemetryQueue(events []TelemetryIngestRequest) []TelemetryIngestRequest {
 	if len(events) <= 1 {
 		return append([]TelemetryIngestRequest(nil), events...)
@@ -1855,6 +2059,8 @@ func normalizeIncidentTimelineEventType(raw string) string {
 		return "commander_assigned"
 	case "commander_cleared":
 		return "commander_cleared"
+	case "diagnostic":
+		return "diagnostic"
 	case "note":
 		return "note"
 	default:
@@ -1874,6 +2080,8 @@ func defaultIncidentTimelineMessage(eventType string) string {
 		return "Commander assigned."
 	case "commander_cleared":
 		return "Commander cleared."
+	case "diagnostic":
+		return "Diagnostic result attached."
 	default:
 		return "Command timeline note."
 	}
@@ -2135,11 +2343,22 @@ func isTransitionEventType(eventType string) bool {
 	}
 }
 
+// isInventoryEventType covers connector attribute-change and full-sync
+// events, which must reach the inventory regardless of sampling.
+func isInventoryEventType(eventType string) bool {
+	switch strings.ToLower(strings.TrimSpace(eventType)) {
+	case "device_update", "device_sync":
+		return true
+	default:
+		return false
+	}
+}
+
 func shouldBypassSampling(eventType string, incomingOnline, currentOnline *bool, hasFactPayload bool) bool {
 	if hasFactPayload {
 		return true
 	}
-	if isTransitionEventType(eventType) {
+	if isTransitionEventType(eventType) || isInventoryEventType(eventType) {
 		return true
 	}
 	if incomingOnline != nil && currentOnline != nil && *incomingOnline != *currentOnline {
@@ -2230,6 +2449,7 @@ func normalizeTelemetrySample(sample TelemetrySample, nowMs int64) TelemetrySamp
 	sample.ObservedISO = time.UnixMilli(sample.ObservedAt).UTC().Format(time.RFC3339)
 	sample.Online = cloneBoolPtr(sample.Online)
 	sample.LatencyMs = cloneFloat64Ptr(sample.LatencyMs)
+	sample.Metrics = normalizeTelemetryMetrics(sample.Metrics)
 	return sample
 }
 
@@ -2466,7 +2686,9 @@ func (s *Store) recordTelemetryQualityFromIngestLocked(req TelemetryIngestReques
 	s.pruneTelemetrySourceQualityLocked(ingestAtMs)
 }
 
-func (s *Store) evaluateTelemetryIngestDecisionLocked(deviceID, deviceRole, eventType string, incomingOnline, currentOnline *bool, hasFactPayload bool, nowMs int64) TelemetryIngestDecision {
+// factReason, when set, accepts the sample regardless of interval sampling:
+// inventory facts or a health metric shift are not worth thinning out.
+func (s *Store) evaluateTelemetryIngestDecisionLocked(deviceID, deviceRole, eventType string, incomingOnline, currentOnline *bool, factReason string, nowMs int64) TelemetryIngestDecision {
 	rule := telemetryRuleForRole(deviceRole, s.TelemetryGovernorRules)
 	decision := TelemetryIngestDecision{
 		Accepted:            true,
@@ -2479,8 +2701,8 @@ func (s *Store) evaluateTelemetryIngestDecisionLocked(deviceID, deviceRole, even
 		s.TelemetryLastByDevice = map[string]int64{}
 	}
 
-	if hasFactPayload {
-		decision.Reason = "inventory_fact_payload"
+	if factReason != "" {
+		decision.Reason = factReason
 		s.TelemetryLastByDevice[deviceID] = nowMs
 		s.TelemetryAcceptedSamples++
 		s.TelemetryGovernorLastEvalMs = nowMs
@@ -2559,7 +2781,7 @@ func (s *Store) applyTelemetryGapDetectionLocked(nowMs int64) (int, int, bool) {
 	changed := false
 	nowISO := time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
 	for _, dev := range s.Devices {
-		if dev.LastSeen <= 0 {
+		if dev.LastSeen <= 0 || isRetiredDeviceLifecycle(dev.Lifecycle) {
 			continue
 		}
 		rule := telemetryRuleForRole(dev.Role, s.TelemetryGovernorRules)
@@ -2777,6 +2999,17 @@ func (s *Store) ListLifecycleScores(limit int, identityID string) ([]LifecycleSc
 	filterID := strings.TrimSpace(identityID)
 	scores := make([]LifecycleScore, 0, len(s.DeviceIdentities))
 	nowMs := time.Now().UnixMilli()
+	rebootsByIdentity := map[string]DeviceRebootSummary{}
+	for deviceID, counts := range s.rebootCountsLocked(nowMs) {
+		identID := s.identityIndex["device:"+normalizeKeyToken(deviceID)]
+		if identID == "" {
+			continue
+		}
+		merged := rebootsByIdentity[identID]
+		merged.Reboots24h += counts.Reboots24h
+		merged.Reboots7d += counts.Reboots7d
+		rebootsByIdentity[identID] = merged
+	}
 	for _, ident := range s.DeviceIdentities {
 		if filterID != "" && ident.IdentityID != filterID {
 			continue
@@ -2801,6 +3034,14 @@ func (s *Store) ListLifecycleScores(limit int, identityID string) ([]LifecycleSc
 			score -= 20
 			reasons = append(reasons, "stale_last_seen_7d")
 		}
+		reboots := rebootsByIdentity[ident.IdentityID]
+		if reboots.Reboots7d >= frequentRebootThreshold {
+			score -= 20
+			reasons = append(reasons, "frequent_reboots_7d")
+		} else if reboots.Reboots24h > 0 {
+			score -= 10
+			reasons = append(reasons, "rebooted_24h")
+		}
 
 		if score < 0 {
 			score = 0
@@ -2817,6 +3058,7 @@ func (s *Store) ListLifecycleScores(limit int, identityID string) ([]LifecycleSc
 			Score:      score,
 			Level:      level,
 			Reasons:    reasons,
+			Reboots7d:  reboots.Reboots7d,
 		})
 	}
 
@@ -3054,10 +3296,11 @@ func (s *Store) buildTopologyGraphLocked() ([]TopologyNode, []TopologyEdge, Topo
 	nodesByID := make(map[string]TopologyNode, len(s.DeviceIdentities))
 	tokenToNode := make(map[string]string, len(s.DeviceIdentities)*5)
 	managedNodeIDs := make([]string, 0, len(s.DeviceIdentities))
+	retired := s.retiredIdentitySetLocked()
 
 	for _, ident := range s.DeviceIdentities {
 		identityID := strings.TrimSpace(ident.IdentityID)
-		if identityID == "" {
+		if identityID == "" || retired[identityID] {
 			continue
 		}
 		nodeID := topologyNodeIDForIdentity(identityID)
@@ -3087,9 +3330,14 @@ func (s *Store) buildTopologyGraphLocked() ([]TopologyNode, []TopologyEdge, Topo
 	degree := make(map[string]int, len(nodesByID))
 	unknownNeighborEdges := 0
 
-	for _, link := range s.NeighborLinks {
+	wirelessStatus := make(map[string]string, len(s.WirelessLinks))
+	for _, link := range s.WirelessLinks {
+		wirelessStatus[link.LinkID] = link.Status
+	}
+	links := append(append([]NeighborLink(nil), s.NeighborLinks...), s.wirelessNeighborLinksLocked()...)
+	for _, link := range links {
 		sourceIdentity := strings.TrimSpace(link.IdentityID)
-		if sourceIdentity == "" {
+		if sourceIdentity == "" || retired[sourceIdentity] {
 			continue
 		}
 		fromNodeID := topologyNodeIDForIdentity(sourceIdentity)
@@ -3153,6 +3401,9 @@ func (s *Store) buildTopologyGraphLocked() ([]TopologyNode, []TopologyEdge, Topo
 			UpdatedAt:          strings.TrimSpace(link.UpdatedAt),
 			Resolved:           resolved,
 		}
+		if link.Protocol == wirelessLinkProtocol {
+			edge.LinkStatus = wirelessStatus[link.ID]
+		}
 		edgesByKey[key] = edge
 		degree[fromNodeID]++
 		degree[toNodeID]++
@@ -3567,6 +3818,7 @@ func (s *Store) InventorySchema() InventorySchemaResponse {
 			"identity_id", "primary_device_id", "name", "role", "site_id",
 			"hostname", "mac_address", "serial_number", "vendor", "model",
 			"source_refs", "last_seen", "created_at", "updated_at",
+			"authority", "netbox_id", "platform", "primary_ip",
 		},
 		DeviceInterface: []string{
 			"id", "identity_id", "name", "admin_up", "oper_up", "rx_bps", "tx_bps", "error_rate", "source", "updated_at",
@@ -3585,6 +3837,7 @@ func (s *Store) InventorySchema() InventorySchemaResponse {
 		Notes: map[string]string{
 			"stitching": "identity keys use mac, serial, hostname+site, and source+device_id hints",
 			"drift":     "drift snapshots hash identity attributes to detect config metadata changes",
+			"authority": "identities with authority=netbox keep NetBox role, site and serial over live observations",
 			"scope":     "phase-1 schema is foundational and intentionally minimal",
 		},
 	}
@@ -3734,18 +3987,47 @@ func (s *Store) IncidentWorkspace(activeLimit, recentLimit int) IncidentWorkspac
 
 	s.mu.RLock()
 	incidents := cloneIncidents(s.Incidents)
+	impact := s.subscriberImpactGraphLocked()
 	s.mu.RUnlock()
 
 	active := make([]Incident, 0, len(incidents))
 	recent := make([]Incident, 0, len(incidents))
+	affected := map[string]bool{}
+	affectedPaying := map[string]bool{}
+	paying := map[string]bool{}
+	for _, sub := range impact.subscribers {
+		paying[sub.SubscriberID] = sub.Paying
+	}
 	for _, inc := range incidents {
+		if inc.Resolved == nil && inc.DeviceID != "" && !incidentTakesDeviceDown(inc) {
+			inc.AffectedSubscribers, inc.AffectedPaying = 0, 0
+		} else if inc.Resolved == nil && inc.DeviceID != "" && len(impact.subscribers) > 0 {
+			// Active outages show live impact, not the count stamped
+			// when they opened.
+			var ids []string
+			inc.AffectedSubscribers, inc.AffectedPaying, ids = impact.affected(inc.DeviceID)
+			for _, id := range ids {
+				affected[id] = true
+				if paying[id] {
+					affectedPaying[id] = true
+				}
+			}
+		}
 		recent = append(recent, inc)
 		if inc.Resolved == nil {
 			active = append(active, inc)
 		}
 	}
 
+	// Most paying subscribers affected first, then most subscribers, then
+	// severity and recency.
 	sort.SliceStable(active, func(i, j int) bool {
+		if active[i].AffectedPaying != active[j].AffectedPaying {
+			return active[i].AffectedPaying > active[j].AffectedPaying
+		}
+		if active[i].AffectedSubscribers != active[j].AffectedSubscribers {
+			return active[i].AffectedSubscribers > active[j].AffectedSubscribers
+		}
 		iSeverity := incidentSeverityRank(active[i].Severity)
 		jSeverity := incidentSeverityRank(active[j].Severity)
 		if iSeverity == jSeverity {
@@ -3772,14 +4054,16 @@ func (s *Store) IncidentWorkspace(activeLimit, recentLimit int) IncidentWorkspac
 	}
 
 	return IncidentWorkspaceResponse{
-		LastUpdatedMs:   nowMs,
-		ActiveCount:     len(active),
-		AssignedCount:   assigned,
-		UnassignedCount: max(0, len(active)-assigned),
-		RecentCount:     len(recent),
-		Active:          active,
-		Recent:          recent,
-		Stub:            true,
+		LastUpdatedMs:       nowMs,
+		ActiveCount:         len(active),
+		AssignedCount:       assigned,
+		UnassignedCount:     max(0, len(active)-assigned),
+		RecentCount:         len(recent),
+		AffectedSubscribers: len(affected),
+		AffectedPaying:      len(affectedPaying),
+		Active:              active,
+		Recent:              recent,
+		Stub:                true,
 	}
 }
 
@@ -3824,6 +4108,7 @@ func (s *Store) RegisterAgent(req AgentRegisterRequest) Agent {
 	if !updated {
 		s.Agents = append(s.Agents, incoming)
 	}
+	s.markAgentConfigRolloutsPendingLocked()
 	s.mu.Unlock()
 
 	s.save()
@@ -3886,6 +4171,25 @@ func (s *Store) IngestTelemetryWithDecision(req TelemetryIngestRequest) (Device,
 		}
 	}
 
+	if idx >= 0 {
+		// Metric receivers send name and role only when the labels carry
+		// them; an unlabeled sample keeps what the device already has.
+		if strings.TrimSpace(req.Device) == "" && s.Devices[idx].Name != "" {
+			deviceName = s.Devices[idx].Name
+		}
+		if strings.TrimSpace(req.Role) == "" && s.Devices[idx].Role != "" {
+			deviceRole = s.Devices[idx].Role
+		}
+	}
+
+	if idx >= 0 && s.Devices[idx].Lifecycle == deviceLifecycleDecommissioned {
+		// Sources may keep listing a retired device; its samples must not
+		// open incidents or rebuild its identity, links or topology.
+		deviceCopy := s.Devices[idx]
+		s.mu.Unlock()
+		return deviceCopy, nil, TelemetryIngestDecision{Reason: deviceLifecycleDecommissioned}, true
+	}
+
 	if idx == -1 {
 		s.Devices = append(s.Devices, Device{
 			ID:       deviceID,
@@ -3899,16 +4203,42 @@ func (s *Store) IngestTelemetryWithDecision(req TelemetryIngestRequest) (Device,
 		idx = len(s.Devices) - 1
 	}
 
+	placedRole, placedSite := s.authoritativePlacementLocked(s.identityIndex["device:"+normalizeKeyToken(deviceID)], deviceRole, siteID)
 	s.Devices[idx].Name = deviceName
-	s.Devices[idx].Role = deviceRole
-	s.Devices[idx].SiteID = siteID
+	s.Devices[idx].Role = placedRole
+	s.Devices[idx].SiteID = placedSite
 	s.Devices[idx].Online = online
 	s.Devices[idx].LatencyMs = req.LatencyMs
+	prevMetrics := s.Devices[idx].Metrics
+	metrics := normalizeTelemetryMetrics(req.Metrics)
+	if metrics != nil {
+		s.Devices[idx].Metrics = metrics
+	} else if !online {
+		s.Devices[idx].Metrics = nil
+	}
 	s.Devices[idx].Source = source
 	s.Devices[idx].LastSeen = observedAtMs
-
-	hasFactPayload := len(req.Interfaces) > 0 || len(req.Neighbors) > 0
-	decision := s.evaluateTelemetryIngestDecisionLocked(deviceID, deviceRole, eventType, req.Online, existingOnline, hasFactPayload, nowMs)
+	if s.Devices[idx].Lifecycle == deviceLifecycleRemoved {
+		// Fresh telemetry means the device is back; decommissioning sticks.
+		s.Devices[idx].Lifecycle = ""
+		s.Devices[idx].RemovedAt = ""
+	}
+	s.Devices[idx].MissingSinceMs = 0
+	wasOffline := existingOnline != nil && !*existingOnline
+	reboot := s.detectDeviceRebootLocked(idx, metrics, source, wasOffline, observedAtMs, nowMs)
+
+	factReason := ""
+	if reboot != nil {
+		factReason = deviceRebootIncidentType
+	} else if len(req.Interfaces) > 0 || len(req.Neighbors) > 0 || req.Wireless != nil {
+		factReason = "inventory_fact_payload"
+	} else if healthMetricsShifted(prevMetrics, metrics) {
+		factReason = "health_metric_shift"
+	} else if eventType == "device_metrics" {
+		// Pollers only send these once a reading moved past its delta.
+		factReason = "source_metric_shift"
+	}
+	decision := s.evaluateTelemetryIngestDecisionLocked(deviceID, deviceRole, eventType, req.Online, existingOnline, factReason, nowMs)
 	s.recordTelemetryQualityFromIngestLocked(req, source, nowMs, decision, tsNorm)
 	if !decision.Accepted {
 		s.updateHAPairWatcherLocked(nowMs)
@@ -3919,16 +4249,28 @@ func (s *Store) IngestTelemetryWithDecision(req TelemetryIngestRequest) (Device,
 		return deviceCopy, nil, decision, true
 	}
 
+	impactKey := ""
+	if s.impactGraph != nil {
+		impactKey = s.impactTopologyKeyLocked(deviceID)
+	}
 	onlineState := online
 	identityID := s.upsertIdentityFromTelemetryLocked(req, source, deviceName, deviceRole, siteID, observedAtMs, &onlineState, tsNorm)
-	s.appendTelemetrySampleLocked(req, source, deviceID, identityID, deviceRole, siteID, onlineState, observedAtMs, tsNorm)
+	placedRole, placedSite = s.authoritativePlacementLocked(identityID, deviceRole, siteID)
+	s.Devices[idx].Role = placedRole
+	s.Devices[idx].SiteID = placedSite
+	s.appendTelemetrySampleLocked(req, source, deviceID, identityID, placedRole, placedSite, onlineState, observedAtMs, tsNorm)
 	s.applyTelemetryRetentionLocked(nowMs)
+	s.updateWirelessLinkLocked(deviceID, deviceName, placedSite, source, onlineState, req.Wireless, observedAtMs, nowMs)
+	if s.impactGraph != nil && s.impactTopologyKeyLocked(deviceID) != impactKey {
+		// The sample moved the topology the batch graph was built from.
+		s.impactGraph = nil
+	}
 
 	var created *Incident
 	if !online || eventType == "device_down" || eventType == "offline" {
 		var active *Incident
 		for i := range s.Incidents {
-			if s.Incidents[i].DeviceID == deviceID && s.Incidents[i].Resolved == nil {
+			if s.Incidents[i].DeviceID == deviceID && s.Incidents[i].Resolved == nil && s.Incidents[i].ExternalID == "" {
 				active = &s.Incidents[i]
 				break
 			}
@@ -3949,6 +4291,7 @@ func (s *Store) IngestTelemetryWithDecision(req TelemetryIngestRequest) (Device,
 				note = "Device reported offline: " + msg
 			}
 			s.appendIncidentTimelineEntryLocked(len(s.Incidents)-1, "opened", "", note, now.UTC().Format(time.RFC3339))
+			s.enrichIncidentImpactLocked(len(s.Incidents) - 1)
 			createdCopy := cloneIncident(s.Incidents[len(s.Incidents)-1])
 			created = &createdCopy
 		}
@@ -3957,7 +4300,7 @@ func (s *Store) IngestTelemetryWithDecision(req TelemetryIngestRequest) (Device,
 	if online || eventType == "device_up" || eventType == "online" {
 		resolvedAt := now.UTC().Format(time.RFC3339)
 		for i := range s.Incidents {
-			if s.Incidents[i].DeviceID == deviceID && s.Incidents[i].Resolved == nil {
+			if s.Incidents[i].DeviceID == deviceID && s.Incidents[i].Resolved == nil && s.Incidents[i].ExternalID == "" {
 				s.Incidents[i].Resolved = &resolvedAt
 				note := "Device reported online; incident resolved."
 				if msg := strings.TrimSpace(req.Message); msg != "" {
@@ -4016,6 +4359,7 @@ func (s *Store) appendTelemetrySampleLocked(req TelemetryIngestRequest, source,
 	if req.LatencyMs != nil {
 		sample.LatencyMs = cloneFloat64Ptr(req.LatencyMs)
 	}
+	sample.Metrics = normalizeTelemetryMetrics(req.Metrics)
 	sample.ObservedISO = time.UnixMilli(observedAtMs).UTC().Format(time.RFC3339)
 	s.TelemetryHot = append(s.TelemetryHot, sample)
 }
@@ -4098,10 +4442,11 @@ func (s *Store) upsertIdentityFromTelemetryLocked(req TelemetryIngestRequest, so
 	if obs.Name != "" && identity.Name != obs.Name {
 		identity.Name = obs.Name
 	}
-	if obs.Role != "" && identity.Role != obs.Role {
+	authoritative := identity.Authority != ""
+	if !authoritative && obs.Role != "" && identity.Role != obs.Role {
 		identity.Role = obs.Role
 	}
-	if obs.SiteID != "" && identity.SiteID != obs.SiteID {
+	if !authoritative && obs.SiteID != "" && identity.SiteID != obs.SiteID {
 		identity.SiteID = obs.SiteID
 	}
 	if obs.Hostname != "" && identity.Hostname != obs.Hostname {
@@ -4110,7 +4455,7 @@ func (s *Store) upsertIdentityFromTelemetryLocked(req TelemetryIngestRequest, so
 	if obs.MacAddress != "" && identity.MacAddress != obs.MacAddress {
 		identity.MacAddress = obs.MacAddress
 	}
-	if obs.SerialNumber != "" && identity.SerialNumber != obs.SerialNumber {
+	if !authoritative && obs.SerialNumber != "" && identity.SerialNumber != obs.SerialNumber {
 		identity.SerialNumber = obs.SerialNumber
 	}
 	if obs.Vendor != "" && identity.Vendor != obs.Vendor {
@@ -4203,6 +4548,15 @@ func (s *Store) mergeIdentitiesLocked(primaryID, secondaryID string) string {
 	if primary.Model == "" {
 		primary.Model = secondary.Model
 	}
+	if primary.Authority == "" && secondary.Authority != "" {
+		primary.Authority = secondary.Authority
+		primary.NetBoxID = secondary.NetBoxID
+		primary.Platform = secondary.Platform
+		primary.PrimaryIP = secondary.PrimaryIP
+		primary.Role = firstNonEmpty(secondary.Role, primary.Role)
+		primary.SiteID = firstNonEmpty(secondary.SiteID, primary.SiteID)
+		primary.SerialNumber = firstNonEmpty(secondary.SerialNumber, primary.SerialNumber)
+	}
 	if secondary.LastSeen > primary.LastSeen {
 		primary.LastSeen = secondary.LastSeen
 	}
@@ -4344,6 +4698,61 @@ func (s *Store) upsertInterfaceFactsLocked(identityID, source string, facts []Te
 	s.DeviceInterfaces = next
 }
 
+// mergeInterfaceFactsLocked updates the named interfaces of one identity
+// and source in place and keeps the rest, for sources such as flow rates
+// that only report the interfaces active in a sample. Nil fields keep
+// their previous value.
+func (s *Store) mergeInterfaceFactsLocked(identityID, source string, facts []TelemetryInterfaceFact) {
+	identityID = strings.TrimSpace(identityID)
+	source = strings.TrimSpace(source)
+	if identityID == "" || source == "" || len(facts) == 0 {
+		return
+	}
+	nowISO := time.Now().UTC().Format(time.RFC3339)
+	rows := map[string]int{}
+	for i, row := range s.DeviceInterfaces {
+		if row.IdentityID == identityID && row.Source == source {
+			rows[row.ID] = i
+		}
+	}
+	for _, fact := range facts {
+		name := strings.TrimSpace(fact.Name)
+		if name == "" {
+			continue
+		}
+		id := "if-" + normalizeKeyToken(identityID+"|"+source+"|"+name)
+		i, ok := rows[id]
+		if !ok {
+			if len(rows) >= 512 {
+				continue
+			}
+			s.DeviceInterfaces = append(s.DeviceInterfaces, DeviceInterface{ID: id, IdentityID: identityID, Name: name, Source: source})
+			i = len(s.DeviceInterfaces) - 1
+			rows[id] = i
+		}
+		row := &s.DeviceInterfaces[i]
+		if fact.AdminUp != nil {
+			row.AdminUp = fact.AdminUp
+		}
+		if fact.OperUp != nil {
+			row.OperUp = fact.OperUp
+		}
+		if fact.RxBps != nil {
+			row.RxBps = fact.RxBps
+		}
+		if fact.TxBps != nil {
+			row.TxBps = fact.TxBps
+		}
+		if fact.ErrorRate != nil {
+			row.ErrorRate = fact.ErrorRate
+		}
+		row.UpdatedAt = nowISO
+	}
+	if len(s.DeviceInterfaces) > maxDeviceInterfaces {
+		s.DeviceInterfaces = append([]DeviceInterface(nil), s.DeviceInterfaces[len(s.DeviceInterfaces)-maxDeviceInterfaces:]...)
+	}
+}
+
 func (s *Store) upsertNeighborFactsLocked(identityID, source string, facts []TelemetryNeighborFact) {
 	identityID = strings.TrimSpace(identityID)
 	source = strings.TrimSpace(source)
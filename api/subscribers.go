@@ -0,0 +1,813 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	subscriberSource         = "uisp_crm"
+	defaultUISPSitesPath     = "/nms/api/v2.1/sites?type=endpoint"
+	crmPageSize              = 500
+	maxCRMPages              = 200
+	maxImpactSubscriberIDs   = 200
+	subscriberStatusActive   = "active"
+	subscriberStatusUnknown  = "unknown"
+	subscriberStatusEnded    = "ended"
+	subscriberStatusInactive = "inactive"
+)
+
+var (
+	ErrSubscribersNotConfigured = errors.New("subscribers_not_configured")
+	ErrSubscribersEmpty         = errors.New("subscriber_inventory_empty")
+)
+
+// Subscriber is one UISP client site: the customer, the CPEs installed there
+// and, when CRM data is available, the state of their service.
+type Subscriber struct {
+	SubscriberID string   `json:"subscriber_id"`
+	Name         string   `json:"name"`
+	ClientID     string   `json:"client_id,omitempty"`
+	ServiceID    string   `json:"service_id,omitempty"`
+	ServiceName  string   `json:"service_name,omitempty"`
+	SiteID       string   `json:"site_id,omitempty"`
+	CPEDeviceIDs []string `json:"cpe_device_ids,omitempty"`
+	APDeviceID   string   `json:"ap_device_id,omitempty"`
+	Status       string   `json:"status"`
+	Paying       bool     `json:"paying"`
+	Price        *float64 `json:"price,omitempty"`
+	UpdatedAt    string   `json:"updated_at,omitempty"`
+}
+
+type SubscriberInventory struct {
+	Subscribers       []Subscriber `json:"subscribers"`
+	UnmatchedServices int          `json:"unmatched_services,omitempty"`
+}
+
+type SubscriberSyncResult struct {
+	SyncedAt          string `json:"synced_at"`
+	Subscribers       int    `json:"subscribers"`
+	Active            int    `json:"active"`
+	Paying            int    `json:"paying"`
+	WithCPE           int    `json:"with_cpe"`
+	UnmatchedServices int    `json:"unmatched_services"`
+	IncidentsUpdated  int    `json:"incidents_updated"`
+}
+
+type SubscribersResponse struct {
+	LastUpdated int64        `json:"last_updated"`
+	SyncedAt    string       `json:"synced_at,omitempty"`
+	Count       int          `json:"count"`
+	Subscribers []Subscriber `json:"subscribers"`
+	Truncated   bool         `json:"truncated"`
+	Limit       int          `json:"limit"`
+	Stub        bool         `json:"stub"`
+}
+
+type SubscriberCount struct {
+	DeviceID    string `json:"device_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	SiteID      string `json:"site_id,omitempty"`
+	Subscribers int    `json:"subscribers"`
+	Paying      int    `json:"paying"`
+}
+
+type SubscriberCountsResponse struct {
+	LastUpdated int64             `json:"last_updated"`
+	SyncedAt    string            `json:"synced_at,omitempty"`
+	Subscribers int               `json:"subscribers"`
+	Paying      int               `json:"paying"`
+	Devices     []SubscriberCount `json:"devices"`
+	Sites       []SubscriberCount `json:"sites"`
+	Stub        bool              `json:"stub"`
+}
+
+type SubscriberImpact struct {
+	DeviceID      string   `json:"device_id"`
+	Affected      int      `json:"affected_subscribers"`
+	Paying        int      `json:"affected_paying_subscribers"`
+	SubscriberIDs []string `json:"subscriber_ids"`
+	Truncated     bool     `json:"truncated"`
+	Stub          bool     `json:"stub"`
+}
+
+// UISPSubscriberClient reads client sites and device placement from UISP
+// NMS and, when configured, service state and price from UISP CRM.
+type UISPSubscriberClient struct {
+	baseURL     string
+	token       string
+	sitesPath   string
+	devicesPath string
+	crmURL      string
+	crmToken    string
+	client      *http.Client
+}
+
+func NewUISPSubscriberClient(baseURL, token, sitesPath, devicesPath, crmURL, crmToken string) *UISPSubscriberClient {
+	if strings.TrimSpace(sitesPath) == "" {
+		sitesPath = defaultUISPSitesPath
+	}
+	if strings.TrimSpace(devicesPath) == "" {
+		devicesPath = "/nms/api/v2.1/devices"
+	}
+	return &UISPSubscriberClient{
+		baseURL:     strings.TrimRight(strings.TrimSpace(baseURL), "/"),
+		token:       strings.TrimSpace(token),
+		sitesPath:   "/" + strings.TrimLeft(strings.TrimSpace(sitesPath), "/"),
+		devicesPath: "/" + strings.TrimLeft(strings.TrimSpace(devicesPath), "/"),
+		crmURL:      strings.TrimRight(strings.TrimSpace(crmURL), "/"),
+		crmToken:    strings.TrimSpace(crmToken),
+		client:      &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (u *UISPSubscriberClient) Configured() bool {
+	return u != nil && u.baseURL != "" && u.token != ""
+}
+
+func (u *UISPSubscriberClient) crmConfigured() bool {
+	return u.crmURL != "" && u.crmToken != ""
+}
+
+// crmService is the slice of a UISP CRM service the impact model needs.
+type crmService struct {
+	ID         string
+	ClientID   string
+	Name       string
+	SiteID     string
+	StatusCode int
+	Price      *float64
+}
+
+func (u *UISPSubscriberClient) Fetch(ctx context.Context, retries int) (SubscriberInventory, error) {
+	if !u.Configured() {
+		return SubscriberInventory{}, ErrSubscribersNotConfigured
+	}
+	token := u.token
+	nmsAuth := headerAuth(func(req *http.Request) {
+		req.Header.Set("X-Auth-Token", token)
+	})
+	sitesBody, _, err := fetchPageBody(ctx, u.client, u.baseURL+u.sitesPath, retries, subscriberSource, nmsAuth, nil, nil)
+	if err != nil {
+		return SubscriberInventory{}, fmt.Errorf("uisp sites: %w", err)
+	}
+	var sites []map[string]any
+	if err := json.Unmarshal(sitesBody, &sites); err != nil {
+		return SubscriberInventory{}, fmt.Errorf("uisp sites invalid json: %w", err)
+	}
+	devicesBody, _, err := fetchPageBody(ctx, u.client, u.baseURL+u.devicesPath, retries, subscriberSource, nmsAuth, nil, nil)
+	if err != nil {
+		return SubscriberInventory{}, fmt.Errorf("uisp devices: %w", err)
+	}
+	devices, err := parseUISPDevices(devicesBody)
+	if err != nil {
+		return SubscriberInventory{}, fmt.Errorf("uisp devices: %w", err)
+	}
+	var services []crmService
+	if u.crmConfigured() {
+		if services, err = u.fetchCRMServices(ctx, retries); err != nil {
+			return SubscriberInventory{}, fmt.Errorf("uisp crm services: %w", err)
+		}
+	}
+	return buildSubscriberInventory(sites, devices, services), nil
+}
+
+// fetchCRMServices pages through /clients/services with limit and offset
+// until a short page comes back.
+func (u *UISPSubscriberClient) fetchCRMServices(ctx context.Context, retries int) ([]crmService, error) {
+	token := u.crmToken
+	auth := headerAuth(func(req *http.Request) {
+		req.Header.Set("X-Auth-App-Key", token)
+	})
+	var out []crmService
+	for page := 0; page < maxCRMPages; page++ {
+		pageURL := u.crmURL + "/clients/services?limit=" + strconv.Itoa(crmPageSize) + "&offset=" + strconv.Itoa(page*crmPageSize)
+		body, _, err := fetchPageBody(ctx, u.client, pageURL, retries, subscriberSource, auth, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var items []map[string]any
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, fmt.Errorf("crm invalid json: %w", err)
+		}
+		for _, item := range items {
+			out = append(out, parseCRMService(item))
+		}
+		if len(items) < crmPageSize {
+			break
+		}
+	}
+	return out, nil
+}
+
+func parseCRMService(item map[string]any) crmService {
+	svc := crmService{
+		ID:         pickID(item, []string{"id"}),
+		ClientID:   pickID(item, []string{"clientId"}),
+		Name:       pickString(item, []string{"name"}, []string{"servicePlanName"}),
+		SiteID:     pickString(item, []string{"unmsClientSiteId"}),
+		StatusCode: -1,
+		Price:      pickFloat(item, []string{"totalPrice"}, []string{"price"}),
+	}
+	if code := pickFloat(item, []string{"status"}); code != nil {
+		svc.StatusCode = int(*code)
+	}
+	return svc
+}
+
+// pickID reads an identifier that may be a JSON number or a string.
+func pickID(item map[string]any, paths ...[]string) string {
+	if v := pickString(item, paths...); v != "" {
+		return v
+	}
+	if v := pickFloat(item, paths...); v != nil {
+		return strconv.FormatInt(int64(*v), 10)
+	}
+	return ""
+}
+
+// crmServiceStatus maps UISP CRM service status codes. Only 1 is a live
+// service; 3 is suspended for non-payment and 2 and 5 are ended.
+func crmServiceStatus(code int) string {
+	switch code {
+	case 1:
+		return subscriberStatusActive
+	case 3:
+		return "suspended"
+	case 2, 5:
+		return subscriberStatusEnded
+	case -1:
+		return subscriberStatusUnknown
+	}
+	return subscriberStatusInactive
+}
+
+// buildSubscriberInventory joins client sites with the devices placed on
+// them and with CRM services. A site with a CRM service takes its state
+// from the service; without CRM data the NMS ucrm block is used, and a site
+// with neither keeps the NMS site status.
+func buildSubscriberInventory(sites []map[string]any, devices []uiSPDeviceRecord, services []crmService) SubscriberInventory {
+	cpesBySite := map[string][]string{}
+	apByDevice := map[string]string{}
+	for _, rec := range devices {
+		cpesBySite[rec.SiteID] = append(cpesBySite[rec.SiteID], rec.ID)
+		if fact := normalizeWirelessFact(rec.Wireless); fact != nil {
+			apByDevice[rec.ID] = fact.APDeviceID
+		}
+	}
+	servicesBySite := map[string][]crmService{}
+	for _, svc := range services {
+		servicesBySite[svc.SiteID] = append(servicesBySite[svc.SiteID], svc)
+	}
+
+	inv := SubscriberInventory{}
+	matched := map[string]bool{}
+	for _, site := range sites {
+		siteType := strings.ToLower(pickString(site, []string{"identification", "type"}, []string{"type"}))
+		if siteType != "" && siteType != "endpoint" {
+			continue
+		}
+		id := pickString(site, []string{"id"}, []string{"identification", "id"})
+		if id == "" {
+			continue
+		}
+		sub := Subscriber{
+			SubscriberID: id,
+			Name:         firstNonEmpty(pickString(site, []string{"ucrm", "client", "name"}), pickString(site, []string{"identification", "name"}, []string{"name"}), id),
+			ClientID:     pickID(site, []string{"ucrm", "client", "id"}),
+			ServiceID:    pickID(site, []string{"ucrm", "service", "id"}),
+			ServiceName:  pickString(site, []string{"ucrm", "service", "name"}),
+			SiteID:       pickString(site, []string{"identification", "parent", "id"}, []string{"parentId"}),
+			CPEDeviceIDs: append([]string(nil), cpesBySite[id]...),
+			Status:       strings.ToLower(firstNonEmpty(pickString(site, []string{"identification", "status"}, []string{"status"}), subscriberStatusUnknown)),
+		}
+		if code := pickFloat(site, []string{"ucrm", "service", "status"}); code != nil {
+			sub.Status = crmServiceStatus(int(*code))
+			sub.Paying = sub.Status == subscriberStatusActive
+		}
+		if svcs := servicesBySite[id]; len(svcs) > 0 {
+			matched[id] = true
+			applyCRMServices(&sub, svcs)
+		}
+		sort.Strings(sub.CPEDeviceIDs)
+		for _, cpe := range sub.CPEDeviceIDs {
+			if ap := apByDevice[cpe]; ap != "" {
+				sub.APDeviceID = ap
+				break
+			}
+		}
+		inv.Subscribers = append(inv.Subscribers, sub)
+	}
+	for siteID, svcs := range servicesBySite {
+		if !matched[siteID] {
+			inv.UnmatchedServices += len(svcs)
+		}
+	}
+	return inv
+}
+
+// applyCRMServices uses the best service on the site: a live one if any.
+// A subscriber pays when a live service has a price above zero.
+func applyCRMServices(sub *Subscriber, svcs []crmService) {
+	best := svcs[0]
+	for _, svc := range svcs[1:] {
+		if svc.StatusCode == 1 && best.StatusCode != 1 {
+			best = svc
+		}
+	}
+	sub.ClientID = firstNonEmpty(best.ClientID, sub.ClientID)
+	sub.ServiceID = firstNonEmpty(best.ID, sub.ServiceID)
+	sub.ServiceName = firstNonEmpty(best.Name, sub.ServiceName)
+	sub.Status = crmServiceStatus(best.StatusCode)
+	sub.Price = cloneFloat64Ptr(best.Price)
+	sub.Paying = sub.Status == subscriberStatusActive && best.Price != nil && *best.Price > 0
+}
+
+// subscriberCountsTowardImpact leaves out customers whose service is not
+// live: an outage does not affect a suspended or ended account.
+func subscriberCountsTowardImpact(sub Subscriber) bool {
+	return sub.Status == subscriberStatusActive || sub.Status == subscriberStatusUnknown
+}
+
+// ApplySubscriberInventory replaces the subscriber set and refreshes the
+// impact counts on open incidents. An empty inventory is rejected so a
+// blank response cannot wipe every subscriber.
+func (s *Store) ApplySubscriberInventory(inv SubscriberInventory, nowMs int64) (SubscriberSyncResult, error) {
+	if len(inv.Subscribers) == 0 {
+		return SubscriberSyncResult{}, ErrSubscribersEmpty
+	}
+	if nowMs <= 0 {
+		nowMs = time.Now().UnixMilli()
+	}
+	nowISO := time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
+	result := SubscriberSyncResult{SyncedAt: nowISO, UnmatchedServices: inv.UnmatchedServices}
+
+	s.mu.Lock()
+	s.Subscribers = make([]Subscriber, 0, len(inv.Subscribers))
+	for _, sub := range inv.Subscribers {
+		sub.UpdatedAt = nowISO
+		sub.CPEDeviceIDs = append([]string(nil), sub.CPEDeviceIDs...)
+		s.Subscribers = append(s.Subscribers, sub)
+		result.Subscribers++
+		if sub.Status == subscriberStatusActive {
+			result.Active++
+		}
+		if sub.Paying {
+			result.Paying++
+		}
+		if len(sub.CPEDeviceIDs) > 0 {
+			result.WithCPE++
+		}
+	}
+	s.SubscribersSyncedAt = nowISO
+	s.impactGraph = nil
+
+	impact := s.subscriberImpactGraphLocked()
+	for i := range s.Incidents {
+		if s.Incidents[i].Resolved != nil || s.Incidents[i].DeviceID == "" {
+			continue
+		}
+		if !incidentTakesDeviceDown(s.Incidents[i]) {
+			s.Incidents[i].AffectedSubscribers, s.Incidents[i].AffectedPaying = 0, 0
+			continue
+		}
+		s.Incidents[i].AffectedSubscribers, s.Incidents[i].AffectedPaying, _ = impact.affected(s.Incidents[i].DeviceID)
+		result.IncidentsUpdated++
+	}
+	s.mu.Unlock()
+
+	s.save()
+	return result, nil
+}
+
+// subscriberImpactGraph answers "who loses service if this device fails"
+// from the topology graph, wireless links included.
+type subscriberImpactGraph struct {
+	adj          map[string][]string
+	nodeByDevice map[string]string
+	cpeNodes     map[string]bool
+	anchorNodes  map[string]bool
+	subscribers  []Subscriber
+	apByCPE      map[string]string
+}
+
+func (s *Store) subscriberImpactGraphLocked() *subscriberImpactGraph {
+	g := &subscriberImpactGraph{
+		adj:          map[string][]string{},
+		nodeByDevice: map[string]string{},
+		cpeNodes:     map[string]bool{},
+		anchorNodes:  map[string]bool{},
+		apByCPE:      map[string]string{},
+	}
+	for _, sub := range s.Subscribers {
+		if subscriberCountsTowardImpact(sub) {
+			g.subscribers = append(g.subscribers, sub)
+		}
+	}
+	if len(g.subscribers) == 0 {
+		return g
+	}
+	nodes, edges, _ := s.buildTopologyGraphLocked()
+	for _, node := range nodes {
+		if isUpstreamRole(node.Role) {
+			g.anchorNodes[node.NodeID] = true
+		}
+	}
+	for _, edge := range edges {
+		g.adj[edge.FromNodeID] = append(g.adj[edge.FromNodeID], edge.ToNodeID)
+		g.adj[edge.ToNodeID] = append(g.adj[edge.ToNodeID], edge.FromNodeID)
+	}
+	for _, link := range s.WirelessLinks {
+		g.apByCPE[link.StationDeviceID] = link.APDeviceID
+	}
+	for _, dev := range s.Devices {
+		if identityID := s.identityIndex["device:"+normalizeKeyToken(dev.ID)]; identityID != "" {
+			g.nodeByDevice[dev.ID] = topologyNodeIDForIdentity(identityID)
+		}
+	}
+	for _, sub := range g.subscribers {
+		for _, cpe := range sub.CPEDeviceIDs {
+			if node := g.nodeByDevice[cpe]; node != "" {
+				g.cpeNodes[node] = true
+			}
+		}
+	}
+	return g
+}
+
+// incidentTakesDeviceDown reports whether an incident means its device is
+// out of service. Only these carry subscriber impact: a degraded wireless
+// link or a Zabbix or LibreNMS problem leaves the device passing traffic.
+func incidentTakesDeviceDown(inc Incident) bool {
+	return inc.Type == "offline"
+}
+
+// impactTopologyKeyLocked summarizes what the impact graph reads about one
+// device: the identity count, the device's identity tokens and role, its
+// neighbor rows and the AP its wireless link points at. Ingest drops a
+// cached graph when a sample changes the key.
+func (s *Store) impactTopologyKeyLocked(deviceID string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d|%d|%d", len(s.DeviceIdentities), len(s.NeighborLinks), len(s.WirelessLinks))
+	if identityID := s.identityIndex["device:"+normalizeKeyToken(deviceID)]; identityID != "" {
+		if idx := s.findIdentityIndexLocked(identityID); idx >= 0 {
+			ident := s.DeviceIdentities[idx]
+			b.WriteString("|" + ident.Role + "|" + ident.RetiredAt + "|" + strings.Join(topologyIdentityTokens(ident), ","))
+		}
+		for _, link := range s.NeighborLinks {
+			if link.IdentityID == identityID {
+				b.WriteString("|" + link.NeighborIdentityHint + "/" + link.NeighborDeviceName)
+			}
+		}
+	}
+	for _, link := range s.WirelessLinks {
+		if link.StationDeviceID == deviceID {
+			b.WriteString("|ap:" + link.APDeviceID)
+		}
+	}
+	return b.String()
+}
+
+// isUpstreamRole marks roles that sit toward the internet edge.
+func isUpstreamRole(role string) bool {
+	role = strings.ToLower(role)
+	for _, hint := range []string{"router", "gateway", "core", "firewall"} {
+		if strings.Contains(role, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// cutOffNodes returns the nodes that lose their path to the rest of the
+// network when failed goes away. Removing failed splits its component into
+// pieces. Links carry no direction, so the upstream piece is the one with
+// the most router/gateway/core nodes, then the most infrastructure (nodes
+// that are not subscriber CPEs). Every other piece is cut off. When failed
+// was the last upstream node, or no piece holds infrastructure, everything
+// behind it is.
+func (g *subscriberImpactGraph) cutOffNodes(failed string) map[string]bool {
+	seen := map[string]bool{failed: true}
+	var pieces [][]string
+	for _, start := range g.adj[failed] {
+		if seen[start] {
+			continue
+		}
+		seen[start] = true
+		piece := []string{start}
+		for i := 0; i < len(piece); i++ {
+			for _, next := range g.adj[piece[i]] {
+				if !seen[next] {
+					seen[next] = true
+					piece = append(piece, next)
+				}
+			}
+		}
+		pieces = append(pieces, piece)
+	}
+	root, rootAnchors, rootInfra := -1, 0, 0
+	for i, piece := range pieces {
+		anchors, infra := 0, 0
+		for _, node := range piece {
+			if g.anchorNodes[node] {
+				anchors++
+			}
+			if !g.cpeNodes[node] {
+				infra++
+			}
+		}
+		if infra == 0 {
+			continue
+		}
+		if root == -1 || anchors > rootAnchors || (anchors == rootAnchors && infra > rootInfra) {
+			root, rootAnchors, rootInfra = i, anchors, infra
+		}
+	}
+	if g.anchorNodes[failed] && rootAnchors == 0 {
+		// The only way out of this part of the network just failed.
+		root = -1
+	}
+	out := map[string]bool{}
+	for i, piece := range pieces {
+		if i == root {
+			continue
+		}
+		for _, node := range piece {
+			out[node] = true
+		}
+	}
+	return out
+}
+
+// affected counts live subscribers that lose service when deviceID fails:
+// its own customers, the customers of an AP it is, and everyone whose CPE
+// (or, for a CPE missing from the graph, whose AP) ends up cut off.
+func (g *subscriberImpactGraph) affected(deviceID string) (int, int, []string) {
+	if len(g.subscribers) == 0 {
+		return 0, 0, nil
+	}
+	cut := map[string]bool{}
+	if node := g.nodeByDevice[deviceID]; node != "" {
+		cut = g.cutOffNodes(node)
+	}
+	total, paying := 0, 0
+	ids := make([]string, 0)
+	for _, sub := range g.subscribers {
+		hit := false
+		for _, cpe := range sub.CPEDeviceIDs {
+			ap := firstNonEmpty(sub.APDeviceID, g.apByCPE[cpe])
+			node := g.nodeByDevice[cpe]
+			if cpe == deviceID || ap == deviceID || cut[node] || (node == "" && cut[g.nodeByDevice[ap]]) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			continue
+		}
+		total++
+		if sub.Paying {
+			paying++
+		}
+		ids = append(ids, sub.SubscriberID)
+	}
+	return total, paying, ids
+}
+
+// enrichIncidentImpactLocked stamps an incident with the subscribers its
+// device takes down. Subscriber syncs refresh the counts on open incidents.
+// Inside an ingest batch every new incident shares the graph built for the
+// first one, until a sample changes the topology it was built from.
+func (s *Store) enrichIncidentImpactLocked(idx int) {
+	if len(s.Subscribers) == 0 || s.Incidents[idx].DeviceID == "" || !incidentTakesDeviceDown(s.Incidents[idx]) {
+		return
+	}
+	impact := s.impactGraph
+	if impact == nil {
+		impact = s.subscriberImpactGraphLocked()
+		if s.impactBatches > 0 {
+			s.impactGraph = impact
+		}
+	}
+	s.Incidents[idx].AffectedSubscribers, s.Incidents[idx].AffectedPaying, _ = impact.affected(s.Incidents[idx].DeviceID)
+}
+
+// beginImpactBatch opens an ingest batch: an outage storm then builds the
+// topology graph once rather than per offline incident under the write
+// lock. A new batch drops the cached graph, so a graph is only shared by
+// batches that were open when it was built. Counts stamped at open are a
+// snapshot; the workspace recomputes them live.
+func (s *Store) beginImpactBatch() {
+	s.mu.Lock()
+	s.impactBatches++
+	s.impactGraph = nil
+	s.mu.Unlock()
+}
+
+func (s *Store) endImpactBatch() {
+	s.mu.Lock()
+	if s.impactBatches--; s.impactBatches <= 0 {
+		s.impactBatches = 0
+		s.impactGraph = nil
+	}
+	s.mu.Unlock()
+}
+
+// SubscriberImpact reports who would lose service if deviceID failed.
+func (s *Store) SubscriberImpact(deviceID string) SubscriberImpact {
+	deviceID = strings.TrimSpace(deviceID)
+	s.mu.RLock()
+	total, paying, ids := s.subscriberImpactGraphLocked().affected(deviceID)
+	s.mu.RUnlock()
+	sort.Strings(ids)
+	truncated := len(ids) > maxImpactSubscriberIDs
+	if truncated {
+		ids = ids[:maxImpactSubscriberIDs]
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return SubscriberImpact{DeviceID: deviceID, Affected: total, Paying: paying, SubscriberIDs: ids, Truncated: truncated, Stub: true}
+}
+
+// ListSubscribers filters by parent site, by device (a CPE or the AP) and
+// by status.
+func (s *Store) ListSubscribers(limit int, siteID, deviceID, status string) ([]Subscriber, bool, int, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	siteFilter := strings.TrimSpace(siteID)
+	deviceFilter := strings.TrimSpace(deviceID)
+	statusFilter := strings.ToLower(strings.TrimSpace(status))
+	out := make([]Subscriber, 0, min(limit, len(s.Subscribers)))
+	total := 0
+	for _, sub := range s.Subscribers {
+		if siteFilter != "" && sub.SiteID != siteFilter {
+			continue
+		}
+		if statusFilter != "" && sub.Status != statusFilter {
+			continue
+		}
+		if deviceFilter != "" && sub.APDeviceID != deviceFilter && !containsString(sub.CPEDeviceIDs, deviceFilter) {
+			continue
+		}
+		total++
+		if len(out) >= limit {
+			continue
+		}
+		sub.CPEDeviceIDs = append([]string(nil), sub.CPEDeviceIDs...)
+		out = append(out, sub)
+	}
+	return out, total > len(out), limit, s.SubscribersSyncedAt
+}
+
+func cloneSubscribers(in []Subscriber) []Subscriber {
+	out := make([]Subscriber, len(in))
+	for i, sub := range in {
+		sub.CPEDeviceIDs = append([]string(nil), sub.CPEDeviceIDs...)
+		sub.Price = cloneFloat64Ptr(sub.Price)
+		out[i] = sub
+	}
+	return out
+}
+
+func containsString(items []string, want string) bool {
+	for _, item := range items {
+		if item == want {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscriberCounts counts live subscribers per device and per site. A
+// subscriber counts for each of its CPEs and for the AP serving them; the
+// site is the parent (tower) site of the client site.
+func (s *Store) SubscriberCounts() SubscriberCountsResponse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	apByCPE := map[string]string{}
+	for _, link := range s.WirelessLinks {
+		apByCPE[link.StationDeviceID] = link.APDeviceID
+	}
+	byDevice := map[string]*SubscriberCount{}
+	bySite := map[string]*SubscriberCount{}
+	bump := func(m map[string]*SubscriberCount, key string, paying bool, device bool) {
+		if key == "" {
+			return
+		}
+		c := m[key]
+		if c == nil {
+			c = &SubscriberCount{}
+			if device {
+				c.DeviceID = key
+			} else {
+				c.SiteID = key
+			}
+			m[key] = c
+		}
+		c.Subscribers++
+		if paying {
+			c.Paying++
+		}
+	}
+	resp := SubscriberCountsResponse{LastUpdated: time.Now().UnixMilli(), SyncedAt: s.SubscribersSyncedAt, Stub: true}
+	for _, sub := range s.Subscribers {
+		if !subscriberCountsTowardImpact(sub) {
+			continue
+		}
+		resp.Subscribers++
+		if sub.Paying {
+			resp.Paying++
+		}
+		devices := map[string]bool{}
+		for _, cpe := range sub.CPEDeviceIDs {
+			devices[cpe] = true
+			if ap := firstNonEmpty(sub.APDeviceID, apByCPE[cpe]); ap != "" {
+				devices[ap] = true
+			}
+		}
+		for id := range devices {
+			bump(byDevice, id, sub.Paying, true)
+		}
+		bump(bySite, sub.SiteID, sub.Paying, false)
+	}
+	for _, dev := range s.Devices {
+		if c := byDevice[dev.ID]; c != nil {
+			c.Name, c.SiteID = dev.Name, dev.SiteID
+		}
+	}
+	resp.Devices = sortedSubscriberCounts(byDevice)
+	resp.Sites = sortedSubscriberCounts(bySite)
+	return resp
+}
+
+func sortedSubscriberCounts(m map[string]*SubscriberCount) []SubscriberCount {
+	out := make([]SubscriberCount, 0, len(m))
+	for _, c := range m {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Subscribers != out[j].Subscribers {
+			return out[i].Subscribers > out[j].Subscribers
+		}
+		return out[i].DeviceID+out[i].SiteID < out[j].DeviceID+out[j].SiteID
+	})
+	return out
+}
+
+// SyncSubscribers fetches UISP client sites and CRM services and applies
+// them to the store.
+func SyncSubscribers(ctx context.Context, client *UISPSubscriberClient, store *Store, retries int) (SubscriberSyncResult, error) {
+	inv, err := client.Fetch(ctx, retries)
+	if err != nil {
+		return SubscriberSyncResult{}, err
+	}
+	return store.ApplySubscriberInventory(inv, time.Now().UnixMilli())
+}
+
+func runSubscriberSync(ctx context.Context, client *UISPSubscriberClient, store *Store, logger *slog.Logger, interval time.Duration, retries int) {
+	if interval <= 0 || !client.Configured() {
+		return
+	}
+	logger.Info("subscriber_sync_started", "interval_sec", int(interval.Seconds()), "retries", retries, "crm", client.crmConfigured())
+	run := func() {
+		result, err := SyncSubscribers(ctx, client, store, retries)
+		if err != nil {
+			logger.Warn("subscriber_sync_failed", "error", err.Error())
+			return
+		}
+		logger.Info("subscriber_sync_ok",
+			"subscribers", result.Subscribers,
+			"active", result.Active,
+			"paying", result.Paying,
+			"with_cpe", result.WithCPE,
+			"unmatched_services", result.UnmatchedServices,
+			"incidents_updated", result.IncidentsUpdated,
+		)
+	}
+
+	run()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
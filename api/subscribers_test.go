@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newUISPSubscriberStandIn serves three client sites (one CRM-linked through
+// the NMS ucrm block only), the devices placed on them and two pages of CRM
+// services.
+func newUISPSubscriberStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	nms := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Auth-Token") != "nms-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/nms/api/v2.1/sites", nms(`[
+		{"id":"site-smith","identification":{"type":"endpoint","name":"Smith Residence","status":"active","parent":{"id":"tower-1"}},"ucrm":{"client":{"id":"101","name":"Jane Smith"}}},
+		{"id":"site-jones","identification":{"type":"endpoint","name":"Jones Farm","status":"active","parent":{"id":"tower-1"}}},
+		{"id":"site-cafe","identification":{"type":"endpoint","name":"Corner Cafe","status":"active","parent":{"id":"tower-1"}},"ucrm":{"client":{"id":103,"name":"Corner Cafe LLC"},"service":{"id":9,"name":"Business 100","status":1}}},
+		{"id":"tower-1","identification":{"type":"site","name":"Tower 1"}}
+	]`))
+	mux.HandleFunc("/nms/api/v2.1/devices", nms(`[
+		{"identification":{"id":"ap-1","name":"Tower AP","site":{"id":"tower-1"}},"overview":{"status":"active","wirelessMode":"ap-ptmp"}},
+		{"identification":{"id":"cpe-smith","name":"Smith CPE","site":{"id":"site-smith"}},"overview":{"status":"active","wirelessMode":"sta-ptmp","signal":-60},"attributes":{"apDevice":{"id":"ap-1"}}},
+		{"identification":{"id":"cpe-jones","name":"Jones CPE"},"site":{"id":"site-jones"},"overview":{"status":"active"}},
+		{"identification":{"id":"cpe-cafe","name":"Cafe CPE","site":{"id":"site-cafe"}},"overview":{"status":"active"}}
+	]`))
+	mux.HandleFunc("/crm/api/v1.0/clients/services", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-App-Key") != "crm-key" || r.URL.Query().Get("limit") != "500" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("offset") != "0" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[
+			{"id":1,"clientId":101,"name":"Home 25","status":2,"price":40,"unmsClientSiteId":"site-smith"},
+			{"id":2,"clientId":101,"name":"Home 50","status":1,"totalPrice":55.5,"unmsClientSiteId":"site-smith"},
+			{"id":3,"clientId":102,"name":"Farm","status":3,"price":60,"unmsClientSiteId":"site-jones"},
+			{"id":4,"clientId":104,"name":"Orphan","status":1,"price":10,"unmsClientSiteId":"site-gone"}
+		]`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSubscriberSyncJoinsUISPSitesAndCRM(t *testing.T) {
+	server := newUISPSubscriberStandIn(t)
+	defer server.Close()
+
+	store := LoadStore("")
+	client := NewUISPSubscriberClient(server.URL, "nms-token", "/nms/api/v2.1/sites", "", server.URL+"/crm/api/v1.0", "crm-key")
+	result, err := SyncSubscribers(context.Background(), client, store, 0)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if result.Subscribers != 3 || result.Active != 2 || result.Paying != 2 || result.WithCPE != 3 || result.UnmatchedServices != 1 {
+		t.Fatalf("unexpected sync result: %#v", result)
+	}
+
+	subs, _, _, syncedAt := store.ListSubscribers(50, "tower-1", "", "")
+	if len(subs) != 3 || syncedAt == "" {
+		t.Fatalf("expected three tower-1 subscribers, got=%#v", subs)
+	}
+	byID := map[string]Subscriber{}
+	for _, sub := range subs {
+		byID[sub.SubscriberID] = sub
+	}
+	smith := byID["site-smith"]
+	if smith.Name != "Jane Smith" || smith.ServiceName != "Home 50" || !smith.Paying || *smith.Price != 55.5 || smith.APDeviceID != "ap-1" || smith.ClientID != "101" {
+		t.Fatalf("expected the live CRM service to win, got=%#v", smith)
+	}
+	if jones := byID["site-jones"]; jones.Status != "suspended" || jones.Paying {
+		t.Fatalf("expected suspended subscriber, got=%#v", jones)
+	}
+	if cafe := byID["site-cafe"]; cafe.Status != subscriberStatusActive || !cafe.Paying || cafe.ClientID != "103" {
+		t.Fatalf("expected NMS ucrm block to carry state without a CRM match, got=%#v", cafe)
+	}
+	if onAP, _, _, _ := store.ListSubscribers(50, "", "ap-1", ""); len(onAP) != 1 {
+		t.Fatalf("expected device filter to match the AP, got=%#v", onAP)
+	}
+}
+
+func TestSubscriberSyncRejectsEmptyAndUnconfigured(t *testing.T) {
+	store := LoadStore("")
+	if _, err := SyncSubscribers(context.Background(), NewUISPSubscriberClient("", "", "", "", "", ""), store, 0); !errors.Is(err, ErrSubscribersNotConfigured) {
+		t.Fatalf("expected not configured error, got=%v", err)
+	}
+	if _, err := store.ApplySubscriberInventory(SubscriberInventory{}, 0); !errors.Is(err, ErrSubscribersEmpty) {
+		t.Fatalf("expected empty inventory to be rejected, got=%v", err)
+	}
+}
+
+// The tree: router tw-r1 - switch tw-sw1 - {tw-ap-1, tw-ap-2}; tw-cpe-a and
+// tw-cpe-b hang off tw-ap-1 by wireless, tw-cpe-c off tw-ap-2.
+func seedSubscriberTopology(t *testing.T, s *Store) {
+	t.Helper()
+	online := true
+	base := time.Now().Add(-time.Minute)
+	neighbor := func(hint string) []TelemetryNeighborFact {
+		return []TelemetryNeighborFact{{LocalInterface: "eth0", NeighborIdentityHint: hint, Protocol: "lldp"}}
+	}
+	signal := -60.0
+	station := func(id, ap string) TelemetryIngestRequest {
+		return TelemetryIngestRequest{Source: "uisp", DeviceID: id, Role: "station", SiteID: id, Online: &online, Wireless: &TelemetryWirelessFact{APDeviceID: ap, SignalDbm: &signal}}
+	}
+	reqs := []TelemetryIngestRequest{
+		{Source: "uisp", DeviceID: "tw-r1", Role: "router", SiteID: "tower-1", Online: &online},
+		{Source: "uisp", DeviceID: "tw-sw1", Role: "switch", SiteID: "tower-1", Online: &online, Neighbors: neighbor("tw-r1")},
+		{Source: "uisp", DeviceID: "tw-ap-1", Role: "ap", SiteID: "tower-1", Online: &online, Neighbors: neighbor("tw-sw1")},
+		{Source: "uisp", DeviceID: "tw-ap-2", Role: "ap", SiteID: "tower-1", Online: &online, Neighbors: neighbor("tw-sw1")},
+		station("tw-cpe-a", "tw-ap-1"),
+		station("tw-cpe-b", "tw-ap-1"),
+		station("tw-cpe-c", "tw-ap-2"),
+	}
+	for i, req := range reqs {
+		req.ObservedAtMs = base.Add(time.Duration(i) * time.Second).UnixMilli()
+		if _, _, ok := s.IngestTelemetry(req); !ok {
+			t.Fatalf("ingest failed for %s", req.DeviceID)
+		}
+	}
+	_, err := s.ApplySubscriberInventory(SubscriberInventory{Subscribers: []Subscriber{
+		{SubscriberID: "sub-a", Name: "A", SiteID: "tower-1", CPEDeviceIDs: []string{"tw-cpe-a"}, Status: subscriberStatusActive, Paying: true},
+		{SubscriberID: "sub-b", Name: "B", SiteID: "tower-1", CPEDeviceIDs: []string{"tw-cpe-b"}, Status: subscriberStatusActive},
+		{SubscriberID: "sub-c", Name: "C", SiteID: "tower-1", CPEDeviceIDs: []string{"tw-cpe-c"}, Status: subscriberStatusActive, Paying: true},
+		{SubscriberID: "sub-d", Name: "D", SiteID: "tower-1", CPEDeviceIDs: []string{"tw-cpe-c"}, Status: "suspended"},
+	}}, time.Now().UnixMilli())
+	if err != nil {
+		t.Fatalf("apply subscribers: %v", err)
+	}
+}
+
+func TestSubscriberImpactFollowsTopology(t *testing.T) {
+	s := LoadStore("")
+	seedSubscriberTopology(t, s)
+
+	cases := []struct {
+		device         string
+		total, paying  int
+		subscriberIDs0 string
+	}{
+		{"tw-cpe-a", 1, 1, "sub-a"},
+		{"tw-ap-1", 2, 1, "sub-a"},
+		{"tw-sw1", 3, 2, "sub-a"},
+		{"tw-r1", 3, 2, "sub-a"},
+		{"not-a-device", 0, 0, ""},
+	}
+	for _, tc := range cases {
+		impact := s.SubscriberImpact(tc.device)
+		if impact.Affected != tc.total || impact.Paying != tc.paying || (tc.total > 0 && impact.SubscriberIDs[0] != tc.subscriberIDs0) {
+			t.Fatalf("unexpected impact for %s: %#v", tc.device, impact)
+		}
+	}
+
+	counts := s.SubscriberCounts()
+	if counts.Subscribers != 3 || counts.Paying != 2 || len(counts.Sites) != 1 || counts.Sites[0].Subscribers != 3 {
+		t.Fatalf("unexpected subscriber counts: %#v", counts)
+	}
+	if counts.Devices[0].DeviceID != "tw-ap-1" || counts.Devices[0].Subscribers != 2 || counts.Devices[0].Paying != 1 {
+		t.Fatalf("expected ap-1 to serve the most subscribers, got=%#v", counts.Devices)
+	}
+}
+
+func TestIncidentWorkspaceRanksByAffectedSubscribers(t *testing.T) {
+	s := LoadStore("")
+	seedSubscriberTopology(t, s)
+
+	offline := false
+	roles := map[string]string{"tw-ap-1": "ap", "tw-cpe-c": "station", "tw-r1": "router"}
+	for _, deviceID := range []string{"tw-ap-1", "tw-cpe-c", "tw-r1"} {
+		_, created, ok := s.IngestTelemetry(TelemetryIngestRequest{Source: "uisp", DeviceID: deviceID, Role: roles[deviceID], Online: &offline})
+		if !ok || created == nil {
+			t.Fatalf("expected offline incident for %s", deviceID)
+		}
+		if deviceID == "tw-ap-1" && (created.AffectedSubscribers != 2 || created.AffectedPaying != 1) {
+			t.Fatalf("expected new incident to carry its impact, got=%#v", created)
+		}
+	}
+
+	// A vendor problem on the switch leaves it passing traffic.
+	s.mu.Lock()
+	s.Incidents = append(s.Incidents, Incident{ID: "inc-zbx", DeviceID: "tw-sw1", Type: "zabbix_problem", Severity: "critical", Started: time.Now().UTC().Format(time.RFC3339), AffectedSubscribers: 3})
+	s.mu.Unlock()
+
+	workspace := s.IncidentWorkspace(20, 20)
+	order := []string{}
+	for _, inc := range workspace.Active {
+		if inc.ID == "inc-zbx" {
+			if inc.AffectedSubscribers != 0 || inc.AffectedPaying != 0 {
+				t.Fatalf("expected no subscriber impact on a problem incident, got=%#v", inc)
+			}
+			continue
+		}
+		if strings.HasPrefix(inc.DeviceID, "tw-") {
+			order = append(order, inc.DeviceID)
+		}
+	}
+	if len(order) != 3 || order[0] != "tw-r1" || order[1] != "tw-ap-1" || order[2] != "tw-cpe-c" {
+		t.Fatalf("expected impact ranking tw-r1, tw-ap-1, tw-cpe-c; got=%v", order)
+	}
+	if workspace.AffectedSubscribers != 3 || workspace.AffectedPaying != 2 {
+		t.Fatalf("expected distinct affected subscribers across incidents, got=%d/%d", workspace.AffectedSubscribers, workspace.AffectedPaying)
+	}
+}
+
+func TestIngestBatchSharesOneImpactGraph(t *testing.T) {
+	s := LoadStore("")
+	seedSubscriberTopology(t, s)
+
+	offline := false
+	events := []TelemetryIngestRequest{
+		{Source: "uisp", DeviceID: "tw-ap-1", Role: "ap", Online: &offline},
+		{Source: "uisp", DeviceID: "tw-cpe-c", Role: "station", Online: &offline},
+	}
+	s.beginImpactBatch()
+	for _, ev := range events {
+		if _, created, ok := s.IngestTelemetry(ev); !ok || created == nil {
+			t.Fatalf("expected offline incident for %s", ev.DeviceID)
+		}
+	}
+	graph := s.impactGraph
+	if graph == nil {
+		t.Fatalf("expected the batch to keep its impact graph")
+	}
+	s.endImpactBatch()
+	if s.impactGraph != nil {
+		t.Fatalf("expected the graph to be dropped when the batch ends")
+	}
+	for _, inc := range s.ListIncidents() {
+		if inc.Resolved != nil {
+			continue
+		}
+		if (inc.DeviceID == "tw-ap-1" && inc.AffectedSubscribers != 2) || (inc.DeviceID == "tw-cpe-c" && (inc.AffectedSubscribers != 1 || inc.AffectedPaying != 1)) {
+			t.Fatalf("unexpected impact on shared graph: %#v", inc)
+		}
+	}
+
+	// A subscriber sync replaces the graph even mid-batch.
+	s.beginImpactBatch()
+	defer s.endImpactBatch()
+	s.impactGraph = graph
+	result, err := s.ApplySubscriberInventory(SubscriberInventory{Subscribers: []Subscriber{
+		{SubscriberID: "sub-a", CPEDeviceIDs: []string{"tw-cpe-a"}, Status: subscriberStatusActive},
+	}}, 0)
+	if err != nil || s.impactGraph != nil {
+		t.Fatalf("expected sync to drop the cached graph, err=%v", err)
+	}
+	if synced, _ := time.Parse(time.RFC3339, result.SyncedAt); time.Since(synced) > time.Minute {
+		t.Fatalf("expected a zero timestamp to default to now, got=%s", result.SyncedAt)
+	}
+}
+
+func TestImpactGraphCacheFollowsBatchesAndTopology(t *testing.T) {
+	s := LoadStore("")
+	seedSubscriberTopology(t, s)
+
+	online, offline := true, false
+	ingest := func(req TelemetryIngestRequest) {
+		t.Helper()
+		if _, _, ok := s.IngestTelemetry(req); !ok {
+			t.Fatalf("ingest failed for %s", req.DeviceID)
+		}
+	}
+	s.beginImpactBatch()
+	defer s.endImpactBatch()
+	ingest(TelemetryIngestRequest{Source: "uisp", DeviceID: "tw-ap-2", Role: "ap", Online: &offline})
+	if s.impactGraph == nil {
+		t.Fatalf("expected the batch to cache its graph")
+	}
+	// A batch that opens later builds its own graph.
+	s.beginImpactBatch()
+	defer s.endImpactBatch()
+	if s.impactGraph != nil {
+		t.Fatalf("expected a new batch to drop the cached graph")
+	}
+
+	ingest(TelemetryIngestRequest{Source: "uisp", DeviceID: "tw-cpe-a", Role: "station", Online: &offline})
+	graph := s.impactGraph
+	ingest(TelemetryIngestRequest{Source: "uisp", DeviceID: "tw-r1", Role: "router", Online: &online})
+	if graph == nil || s.impactGraph != graph {
+		t.Fatalf("expected a sample that leaves the topology alone to keep the graph")
+	}
+	// tw-cpe-b moves to tw-ap-2.
+	signal := -60.0
+	ingest(TelemetryIngestRequest{Source: "uisp", DeviceID: "tw-cpe-b", Role: "station", Online: &online, Wireless: &TelemetryWirelessFact{APDeviceID: "tw-ap-2", SignalDbm: &signal}})
+	if s.impactGraph != nil {
+		t.Fatalf("expected a wireless re-association to drop the cached graph")
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// UniFi Network device states from stat/device. Pending, upgrading,
+// provisioning and adopting devices still answer the controller.
+var uniFiOnlineStates = map[int]bool{1: true, 2: true, 4: true, 5: true, 7: true}
+
+type UniFiConfig struct {
+	BaseURL  string
+	Username string
+	Password string
+	APIKey   string
+	// UniFiOS selects the console layout (UDM, Cloud Key Gen2+, UniFi OS
+	// Server): /api/auth/login and the /proxy/network API prefix.
+	UniFiOS bool
+	Sites   []string
+	// CAFile trusts a PEM bundle for the controller's self-signed
+	// certificate; InsecureSkipVerify turns verification off instead.
+	CAFile             string
+	InsecureSkipVerify bool
+}
+
+// UniFiConnector polls a UniFi Network controller. It reuses the vendor
+// connector's polling, event and status machinery and only swaps the fetch
+// for a login, site enumeration and per-site stat/device walk.
+type UniFiConnector struct {
+	*VendorConnector
+	apiPrefix string
+	sites     map[string]bool
+}
+
+func NewUniFiConnector(cfg UniFiConfig) *UniFiConnector {
+	apiPrefix, loginPath := "", "/api/login"
+	if cfg.UniFiOS {
+		apiPrefix, loginPath = "/proxy/network", "/api/auth/login"
+	}
+	token, scheme := strings.TrimSpace(cfg.APIKey), "session_cookie"
+	if token != "" {
+		scheme = "x-api-key"
+	}
+	vendor := NewVendorConnector("unifi", "UniFi", cfg.BaseURL, token, "", scheme)
+	u := &UniFiConnector{VendorConnector: vendor, apiPrefix: apiPrefix, sites: map[string]bool{}}
+	for _, site := range cfg.Sites {
+		if site = strings.TrimSpace(site); site != "" {
+			u.sites[site] = true
+		}
+	}
+	vendor.fetcher = u.fetchUniFiRecords
+	if err := vendor.SetTLS(cfg.CAFile, cfg.InsecureSkipVerify); err != nil {
+		vendor.SetConfigError(fmt.Errorf("unifi tls: %w", err))
+		return u
+	}
+
+	if token == "" && (strings.TrimSpace(cfg.Username) != "" || cfg.Password != "") {
+		auth, err := NewConnectorAuth(ConnectorAuthConfig{
+			Scheme:     "session_cookie",
+			URL:        loginPath,
+			Username:   cfg.Username,
+			Password:   cfg.Password,
+			CSRFHeader: "X-Csrf-Token",
+		}, vendor.baseURL, vendor.client)
+		if err == nil && cfg.Password == "" {
+			err = fmt.Errorf("%w: password is required", ErrConnectorAuthConfig)
+		}
+		if err != nil {
+			vendor.SetConfigError(fmt.Errorf("unifi login: %w", err))
+		} else {
+			vendor.SetAuth(auth)
+		}
+	}
+	return u
+}
+
+func (u *UniFiConnector) fetchUniFiRecords(ctx context.Context, retries int) (pagedFetchResult, error) {
+	auth := u.authProvider()
+	body, _, err := fetchPageBody(ctx, u.client, u.baseURL+u.apiPrefix+"/api/self/sites", retries, u.source, auth, u.guard, validateUniFiEnvelope)
+	if err != nil {
+		return pagedFetchResult{}, err
+	}
+	sites, err := parseUniFiSites(body)
+	if err != nil {
+		return pagedFetchResult{}, err
+	}
+
+	result := pagedFetchResult{Pages: 1}
+	for _, site := range sites {
+		if len(u.sites) > 0 && !u.sites[site.Name] {
+			continue
+		}
+		devicesURL := u.baseURL + u.apiPrefix + "/api/s/" + url.PathEscape(site.Name) + "/stat/device"
+		body, _, err := fetchPageBody(ctx, u.client, devicesURL, retries, u.source, auth, u.guard, validateUniFiEnvelope)
+		if err != nil {
+			return result, fmt.Errorf("site %s: %w", site.Name, err)
+		}
+		result.Pages++
+		records, err := parseUniFiDevices(body, site.Name)
+		if err != nil {
+			return result, fmt.Errorf("site %s: %w", site.Name, err)
+		}
+		result.Records = append(result.Records, records...)
+		if len(result.Records) >= maxSourcePollRecords {
+			result.Records = result.Records[:maxSourcePollRecords]
+			result.Truncated = true
+			break
+		}
+	}
+	return result, nil
+}
+
+type uniFiSite struct {
+	Name string
+}
+
+// validateUniFiEnvelope rejects {"meta":{"rc":"error"}} bodies, which the
+// classic controller returns with a 200 status.
+func validateUniFiEnvelope(body []byte) error {
+	var envelope struct {
+		Meta struct {
+			RC  string `json:"rc"`
+			Msg string `json:"msg"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("unifi invalid json: %w", err)
+	}
+	if rc := strings.ToLower(envelope.Meta.RC); rc != "" && rc != "ok" {
+		return fmt.Errorf("unifi api error: %s", firstNonEmpty(envelope.Meta.Msg, rc))
+	}
+	return nil
+}
+
+func uniFiDataItems(body []byte) ([]map[string]any, error) {
+	var payload struct {
+		Data []map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return payload.Data, nil
+}
+
+func parseUniFiSites(body []byte) ([]uniFiSite, error) {
+	items, err := uniFiDataItems(body)
+	if err != nil {
+		return nil, err
+	}
+	sites := make([]uniFiSite, 0, len(items))
+	for _, item := range items {
+		name := pickString(item, []string{"name"})
+		if name == "" {
+			continue
+		}
+		sites = append(sites, uniFiSite{Name: name})
+	}
+	if len(sites) == 0 {
+		return nil, fmt.Errorf("unifi response had no sites")
+	}
+	return sites, nil
+}
+
+// parseUniFiDevices maps stat/device entries. Devices are keyed by MAC,
+// which survives controller migrations, and carry the uplink as a neighbor
+// so topology can stitch switches and APs to their upstream port.
+func parseUniFiDevices(body []byte, siteName string) ([]uiSPDeviceRecord, error) {
+	items, err := uniFiDataItems(body)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]uiSPDeviceRecord, 0, len(items))
+	for _, item := range items {
+		mac := strings.ToLower(pickString(item, []string{"mac"}))
+		id := firstNonEmpty(mac, pickString(item, []string{"_id"}))
+		if id == "" {
+			continue
+		}
+		online := false
+		if state := pickFloat(item, []string{"state"}); state != nil {
+			online = uniFiOnlineStates[int(*state)]
+		}
+		records = append(records, uiSPDeviceRecord{
+			ID:     id,
+			Name:   firstNonEmpty(pickString(item, []string{"name"}), pickString(item, []string{"hostname"}), mac),
+			Role:   uniFiDeviceRole(pickString(item, []string{"type"})),
+			SiteID: siteName,
+			Host:   pickString(item, []string{"hostname"}),
+			Mac:    mac,
+			Serial: pickString(item, []string{"serial"}),
+			Model:  firstNonEmpty(pickString(item, []string{"model_name"}), pickString(item, []string{"model"})),
+			Vendor: "Ubiquiti",
+			Ifaces: parseUniFiPorts(item),
+			Neighs: parseUniFiUplink(item),
+			Online: online,
+			// system-stats values are strings; offline devices report none.
+			Metrics: pickHealthMetrics(item, healthMetricPaths{
+				cpu:    [][]string{{"system-stats", "cpu"}},
+				mem:    [][]string{{"system-stats", "mem"}},
+				temp:   [][]string{{"general_temperature"}},
+				uptime: [][]string{{"uptime"}},
+			}),
+			ObservedAtMs: pickTimestampMs(item, []string{"last_seen"}),
+		})
+	}
+	return records, nil
+}
+
+func uniFiDeviceRole(deviceType string) string {
+	switch strings.ToLower(strings.TrimSpace(deviceType)) {
+	case "uap":
+		return "ap"
+	case "usw":
+		return "switch"
+	case "ugw", "udm", "uxg":
+		return "gateway"
+	default:
+		return normalizeVendorRole(deviceType)
+	}
+}
+
+func parseUniFiPorts(item map[string]any) []TelemetryInterfaceFact {
+	ports, _ := item["port_table"].([]any)
+	out := make([]TelemetryInterfaceFact, 0, len(ports))
+	for _, raw := range ports {
+		port, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		name := pickString(port, []string{"name"})
+		if name == "" {
+			idx := pickFloat(port, []string{"port_idx"})
+			if idx == nil {
+				continue
+			}
+			name = "Port " + strconv.Itoa(int(*idx))
+		}
+		fact := TelemetryInterfaceFact{
+			Name:    name,
+			AdminUp: pickBool(port, []string{"enable"}),
+			OperUp:  pickBool(port, []string{"up"}),
+		}
+		// UniFi reports byte rates; interface facts are bits per second.
+		if rx := pickFloat(port, []string{"rx_bytes-r"}); rx != nil {
+			bps := *rx * 8
+			fact.RxBps = &bps
+		}
+		if tx := pickFloat(port, []string{"tx_bytes-r"}); tx != nil {
+			bps := *tx * 8
+			fact.TxBps = &bps
+		}
+		out = append(out, fact)
+	}
+	return out
+}
+
+func parseUniFiUplink(item map[string]any) []TelemetryNeighborFact {
+	uplink, ok := item["uplink"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	upstreamMac := strings.ToLower(pickString(uplink, []string{"uplink_mac"}))
+	if upstreamMac == "" {
+		return nil
+	}
+	local := pickString(uplink, []string{"name"})
+	if idx := pickFloat(uplink, []string{"port_idx"}); local == "" && idx != nil {
+		local = "Port " + strconv.Itoa(int(*idx))
+	}
+	remote := ""
+	if idx := pickFloat(uplink, []string{"uplink_remote_port"}); idx != nil {
+		remote = "Port " + strconv.Itoa(int(*idx))
+	}
+	protocol := "unifi_uplink"
+	if pickString(uplink, []string{"type"}) == "wireless" {
+		protocol = "unifi_mesh"
+	}
+	return []TelemetryNeighborFact{{
+		LocalInterface:       local,
+		NeighborIdentityHint: upstreamMac,
+		NeighborDeviceName:   pickString(uplink, []string{"uplink_device_name"}),
+		NeighborInterface:    remote,
+		Protocol:             protocol,
+	}}
+}
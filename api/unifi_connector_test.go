@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newUniFiStandIn serves a UniFi OS console with one session and two sites.
+func newUniFiStandIn(t *testing.T) (*httptest.Server, func() int) {
+	t.Helper()
+	var (
+		mu     sync.Mutex
+		logins int
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if r.Method != http.MethodPost || body["username"] != "noc" || body["password"] != "pw" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		logins++
+		mu.Unlock()
+		w.Header().Set("X-CSRF-Token", "csrf-1")
+		http.SetCookie(w, &http.Cookie{Name: "TOKEN", Value: "session-1"})
+		_, _ = w.Write([]byte(`{}`))
+	})
+	authed := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie("TOKEN")
+			if err != nil || cookie.Value != "session-1" || r.Header.Get("X-Csrf-Token") != "csrf-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("/proxy/network/api/self/sites", authed(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"meta":{"rc":"ok"},"data":[{"_id":"s1","name":"default","desc":"HQ"},{"_id":"s2","name":"branch","desc":"Branch"}]}`))
+	}))
+	mux.HandleFunc("/proxy/network/api/s/default/stat/device", authed(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"meta":{"rc":"ok"},"data":[
+			{"_id":"d1","mac":"F0:9F:C2:00:00:01","serial":"UDM-1","model":"UDMPRO","type":"udm","name":"HQ Gateway","state":1,"ip":"10.0.0.1","last_seen":1767225600,
+			 "system-stats":{"cpu":"12.5","mem":"40.1"},"general_temperature":56,"uptime":86400},
+			{"_id":"d2","mac":"f0:9f:c2:00:00:02","serial":"USW-2","model":"US48","type":"usw","name":"HQ Core Switch","state":1,
+			 "uplink":{"type":"wire","uplink_mac":"F0:9F:C2:00:00:01","uplink_device_name":"HQ Gateway","uplink_remote_port":9,"port_idx":48},
+			 "port_table":[{"port_idx":1,"name":"Port 1","enable":true,"up":true,"rx_bytes-r":1000,"tx_bytes-r":250},{"port_idx":2,"enable":false,"up":false}]},
+			{"_id":"d3","mac":"f0:9f:c2:00:00:03","serial":"UAP-3","model":"U6LR","type":"uap","name":"Lobby AP","state":0,
+			 "uplink":{"type":"wireless","uplink_mac":"f0:9f:c2:00:00:02"}}
+		]}`))
+	}))
+	mux.HandleFunc("/proxy/network/api/s/branch/stat/device", authed(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"meta":{"rc":"ok"},"data":[{"_id":"d4","mac":"f0:9f:c2:00:00:04","serial":"USW-4","type":"usw","name":"Branch Switch","state":6}]}`))
+	}))
+	server := httptest.NewServer(mux)
+	return server, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return logins
+	}
+}
+
+func TestUniFiConnectorPollsSitesAndMapsDevices(t *testing.T) {
+	server, logins := newUniFiStandIn(t)
+	defer server.Close()
+
+	connector := NewUniFiConnector(UniFiConfig{BaseURL: server.URL, Username: "noc", Password: "pw", UniFiOS: true})
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 50, FullSync: true})
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if batch.Response.Demo || batch.Response.Fetched != 4 || batch.Response.Pages != 3 || !batch.Complete {
+		t.Fatalf("unexpected poll summary: %#v complete=%v", batch.Response, batch.Complete)
+	}
+	if logins() != 1 {
+		t.Fatalf("expected a single login, got=%d", logins())
+	}
+
+	byID := map[string]TelemetryIngestRequest{}
+	for _, event := range batch.Events {
+		byID[event.DeviceID] = event
+	}
+	gw := byID["f0:9f:c2:00:00:01"]
+	if gw.Role != "gateway" || gw.SiteID != "default" || gw.Serial != "UDM-1" || gw.Vendor != "Ubiquiti" || !*gw.Online {
+		t.Fatalf("unexpected gateway mapping: %#v", gw)
+	}
+	if m := gw.Metrics; m == nil || *m.CPUPct != 12.5 || *m.MemPct != 40.1 || *m.TempC != 56 || *m.UptimeS != 86400 {
+		t.Fatalf("unexpected gateway health metrics: %#v", m)
+	}
+	sw := byID["f0:9f:c2:00:00:02"]
+	if sw.Role != "switch" || len(sw.Interfaces) != 2 || sw.Interfaces[0].RxBps == nil || *sw.Interfaces[0].RxBps != 8000 {
+		t.Fatalf("unexpected switch ports: %#v", sw.Interfaces)
+	}
+	if sw.Interfaces[1].Name != "Port 2" || sw.Interfaces[1].AdminUp == nil || *sw.Interfaces[1].AdminUp {
+		t.Fatalf("expected unnamed disabled port 2, got=%#v", sw.Interfaces[1])
+	}
+	if len(sw.Neighbors) != 1 || sw.Neighbors[0].NeighborIdentityHint != "f0:9f:c2:00:00:01" || sw.Neighbors[0].LocalInterface != "Port 48" || sw.Neighbors[0].NeighborInterface != "Port 9" {
+		t.Fatalf("unexpected switch uplink: %#v", sw.Neighbors)
+	}
+	ap := byID["f0:9f:c2:00:00:03"]
+	if ap.Role != "ap" || *ap.Online || ap.EventType != "device_down" || ap.Neighbors[0].Protocol != "unifi_mesh" {
+		t.Fatalf("unexpected ap mapping: %#v", ap)
+	}
+	if branch := byID["f0:9f:c2:00:00:04"]; branch.SiteID != "branch" || *branch.Online {
+		t.Fatalf("expected heartbeat-missed branch switch offline, got=%#v", branch)
+	}
+}
+
+func TestUniFiConnectorStitchesUplinkTopology(t *testing.T) {
+	server, _ := newUniFiStandIn(t)
+	defer server.Close()
+
+	store := LoadStore("")
+	connector := NewUniFiConnector(UniFiConfig{BaseURL: server.URL, Username: "noc", Password: "pw", UniFiOS: true, Sites: []string{"default"}})
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 50, FullSync: true})
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if batch.Response.Fetched != 3 {
+		t.Fatalf("expected site filter to skip branch, fetched=%d", batch.Response.Fetched)
+	}
+	ingestSourceEvents(store, batch.Events)
+
+	gw := findIdentityByPrimary(t, store, "f0:9f:c2:00:00:01")
+	sw := findIdentityByPrimary(t, store, "f0:9f:c2:00:00:02")
+	if gw.MacAddress == "" || sw.SerialNumber != "usw-2" {
+		t.Fatalf("expected MAC and serial on identities, gw=%#v sw=%#v", gw, sw)
+	}
+	edges, _, _ := store.ListTopologyEdges(50, sw.IdentityID)
+	for _, edge := range edges {
+		if edge.ToNodeID == topologyNodeIDForIdentity(gw.IdentityID) && edge.Resolved {
+			return
+		}
+	}
+	t.Fatalf("expected switch uplink to resolve to gateway, edges=%#v", edges)
+}
+
+func TestUniFiConnectorDemoWithoutCredentials(t *testing.T) {
+	connector := NewUniFiConnector(UniFiConfig{BaseURL: "https://unifi.local"})
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10})
+	if err != nil || !batch.Response.Demo || connector.Name() != "unifi" {
+		t.Fatalf("expected demo poll without credentials, demo=%v err=%v", batch.Response.Demo, err)
+	}
+
+	// A half-configured login is an error, not a reason to serve demo devices.
+	broken := NewUniFiConnector(UniFiConfig{BaseURL: "https://unifi.local", Username: "noc"})
+	batch, err = broken.Poll(context.Background(), SourcePollRequest{Limit: 10})
+	if !errors.Is(err, ErrConnectorAuthConfig) || batch.Response.Demo || len(batch.Events) != 0 {
+		t.Fatalf("expected misconfigured login to fail the poll, demo=%v events=%d err=%v", batch.Response.Demo, len(batch.Events), err)
+	}
+	if status := broken.Status(); !strings.Contains(status.LastError, "password is required") {
+		t.Fatalf("expected config error in source status, got=%#v", status)
+	}
+	if err := validateUniFiEnvelope([]byte(`{"meta":{"rc":"error","msg":"api.err.NoSiteContext"},"data":[]}`)); err == nil {
+		t.Fatalf("expected controller error envelope to fail validation")
+	}
+}
+
+func TestUniFiConnectorTLSOptions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/proxy/network/api/self/sites":
+			_, _ = w.Write([]byte(`{"meta":{"rc":"ok"},"data":[{"_id":"s1","name":"default"}]}`))
+		case "/proxy/network/api/s/default/stat/device":
+			_, _ = w.Write([]byte(`{"meta":{"rc":"ok"},"data":[{"_id":"d1","mac":"f0:9f:c2:00:00:01","type":"usw","name":"Switch","state":1}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "controller.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatalf("write ca: %v", err)
+	}
+	base := UniFiConfig{BaseURL: server.URL, APIKey: "key-1", UniFiOS: true}
+
+	if _, err := NewUniFiConnector(base).Poll(context.Background(), SourcePollRequest{Limit: 10}); err == nil {
+		t.Fatalf("expected self-signed controller to fail verification without a CA bundle")
+	}
+	trusted := base
+	trusted.CAFile = caFile
+	if batch, err := NewUniFiConnector(trusted).Poll(context.Background(), SourcePollRequest{Limit: 10}); err != nil || batch.Response.Fetched != 1 {
+		t.Fatalf("expected CA bundle to trust the controller, fetched=%d err=%v", batch.Response.Fetched, err)
+	}
+	insecure := base
+	insecure.InsecureSkipVerify = true
+	if _, err := NewUniFiConnector(insecure).Poll(context.Background(), SourcePollRequest{Limit: 10}); err != nil {
+		t.Fatalf("expected insecure skip verify to poll, got=%v", err)
+	}
+	missing := base
+	missing.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if err := NewUniFiConnector(missing).ConfigError(); !errors.Is(err, ErrConnectorTLSConfig) {
+		t.Fatalf("expected unreadable CA bundle to be a config error, got=%v", err)
+	}
+}
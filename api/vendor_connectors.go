@@ -2,15 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
 )
 
+var ErrConnectorTLSConfig = errors.New("invalid_connector_tls")
+
 // VendorConnector provides a generic HTTP-backed source connector used for
 // Cisco/Juniper beta adapters where endpoint/auth details are deployment-configured.
 type VendorConnector struct {
@@ -20,12 +25,22 @@ type VendorConnector struct {
 	token       string
 	devicesPath string
 	authScheme  string
+	mapping     *HTTPJSONMapping
+	pagination  PaginationConfig
+	auth        ConnectorAuth
+	guard       *SourceGuard
 	client      *http.Client
-
-	mu        sync.RWMutex
-	status    SourceStatus
-	lastKnown map[string]bool
-	seen      map[string]int64
+	// fetcher replaces the single devices-path fetch for connectors that
+	// walk several endpoints, such as UniFi sites.
+	fetcher func(ctx context.Context, retries int) (pagedFetchResult, error)
+
+	mu           sync.RWMutex
+	status       SourceStatus
+	configErr    error
+	lastKnown    map[string]bool
+	fingerprints map[string]sourceRecordFingerprint
+	readings     map[string]uiSPDeviceRecord // last emitted record per device
+	seen         map[string]int64
 }
 
 func NewVendorConnector(source, vendorLabel, baseURL, token, devicesPath, authScheme string) *VendorConnector {
@@ -59,9 +74,13 @@ func NewVendorConnector(source, vendorLabel, baseURL, token, devicesPath, authSc
 		client: &http.Client{
 			Timeout: 12 * time.Second,
 		},
-		status:    SourceStatus{Source: source, Stub: true},
-		lastKnown: map[string]bool{},
-		seen:      map[string]int64{},
+		pagination:   normalizePaginationConfig(PaginationConfig{}),
+		guard:        NewSourceGuard(SourceGuardConfig{}),
+		status:       SourceStatus{Source: source, Stub: true},
+		lastKnown:    map[string]bool{},
+		fingerprints: map[string]sourceRecordFingerprint{},
+		readings:     map[string]uiSPDeviceRecord{},
+		seen:         map[string]int64{},
 	}
 }
 
@@ -70,16 +89,131 @@ func (v *VendorConnector) Name() string {
 }
 
 func (v *VendorConnector) Status() SourceStatus {
+	v.mu.RLock()
+	status := v.status
+	v.mu.RUnlock()
+	status.Breaker = v.guard.Snapshot()
+	return status
+}
+
+func (v *VendorConnector) Guard() *SourceGuard {
+	return v.guard
+}
+
+// SetGuard replaces the rate-limit/breaker guard; call before polling starts.
+func (v *VendorConnector) SetGuard(cfg SourceGuardConfig) {
+	v.guard = NewSourceGuard(cfg)
+}
+
+// SetConfigError marks the connector misconfigured: polls fail with err
+// instead of falling back to demo records, and the status reports it.
+func (v *VendorConnector) SetConfigError(err error) {
+	v.mu.Lock()
+	v.configErr = err
+	if err != nil {
+		v.status.LastError = err.Error()
+	}
+	v.mu.Unlock()
+}
+
+func (v *VendorConnector) ConfigError() error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.configErr
+}
+
+// SetTLS trusts the PEM bundle at caFile on top of the system roots, or
+// skips certificate checks, for controllers with self-signed certificates.
+// With neither set the default transport stays in place.
+func (v *VendorConnector) SetTLS(caFile string, insecureSkipVerify bool) error {
+	transport, err := connectorTLSTransport(caFile, insecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	if transport != nil {
+		v.client.Transport = transport
+	}
+	return nil
+}
+
+func connectorTLSTransport(caFile string, insecureSkipVerify bool) (*http.Transport, error) {
+	caFile = strings.TrimSpace(caFile)
+	if caFile == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrConnectorTLSConfig, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in %s", ErrConnectorTLSConfig, caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return transport, nil
+}
+
+// SetTransport swaps the HTTP transport, e.g. for fixture record/replay.
+// Login requests share it because connectorAuthFromEnv reuses the client.
+func (v *VendorConnector) SetTransport(rt http.RoundTripper) {
+	v.client.Transport = rt
+}
+
+// recordEvent builds the telemetry request a poll emits for one record.
+func (v *VendorConnector) recordEvent(rec uiSPDeviceRecord, eventType string, changed []string) TelemetryIngestRequest {
+	online := rec.Online
+	return TelemetryIngestRequest{
+		Source:       v.source,
+		EventType:    eventType,
+		ObservedAtMs: rec.ObservedAtMs,
+		DeviceID:     rec.ID,
+		Device:       rec.Name,
+		Hostname:     rec.Host,
+		Mac:          rec.Mac,
+		Serial:       rec.Serial,
+		Model:        rec.Model,
+		Vendor:       rec.Vendor,
+		Role:         rec.Role,
+		SiteID:       rec.SiteID,
+		Online:       &online,
+		LatencyMs:    rec.Latency,
+		Metrics:      rec.Metrics,
+		Message:      sourceEventMessage(strings.ToUpper(v.source), eventType, rec.Online, changed),
+		Interfaces:   rec.Ifaces,
+		Neighbors:    rec.Neighs,
+	}
+}
+
+// previewRecord classifies rec against the poller's current state the way
+// the next incremental poll would, without recording anything.
+func (v *VendorConnector) previewRecord(rec uiSPDeviceRecord) (string, []string) {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
-	return v.status
+	prev, seen := v.lastKnown[rec.ID]
+	prevFP, hadFP := v.fingerprints[rec.ID]
+	var last *uiSPDeviceRecord
+	if r, ok := v.readings[rec.ID]; ok {
+		last = &r
+	}
+	return classifySourceRecord(prev, seen, rec, prevFP, hadFP, fingerprintSourceRecord(rec), last, false)
 }
 
 func (v *VendorConnector) Poll(ctx context.Context, req SourcePollRequest) (sourcePollBatch, error) {
 	start := time.Now()
-	if req.Limit <= 0 || req.Limit > 500 {
+	if req.Limit <= 0 {
 		req.Limit = 200
 	}
+	if req.Limit > maxSourcePollRecords {
+		req.Limit = maxSourcePollRecords
+	}
 	if req.Retries < 0 {
 		req.Retries = 0
 	}
@@ -89,17 +223,30 @@ func (v *VendorConnector) Poll(ctx context.Context, req SourcePollRequest) (sour
 	}
 	backfill := strings.TrimSpace(req.Cursor) != ""
 
-	// Missing creds should still allow deterministic smoke/demo behavior.
-	demoMode := req.Demo || v.baseURL == "" || v.token == "" || strings.Contains(strings.ToLower(v.baseURL), "example")
+	// Missing creds should still allow deterministic smoke/demo behavior;
+	// broken ones should not.
+	configErr := v.ConfigError()
+	demoMode := configErr == nil && (req.Demo || v.baseURL == "" || (v.token == "" && v.authScheme != "none" && v.requestAuth() == nil) || strings.Contains(strings.ToLower(v.baseURL), "example"))
 
 	var (
-		records []uiSPDeviceRecord
-		err     error
+		records  []uiSPDeviceRecord
+		problems []SourceProblem
+		pages    int
+		complete bool
+		err      error
 	)
 	if demoMode {
 		records = v.demoRecords()
+		pages = 1
 	} else {
-		records, err = v.fetchVendorRecords(ctx, req.Retries)
+		var fetched pagedFetchResult
+		if configErr != nil {
+			err = configErr
+		} else {
+			fetched, err = v.fetchVendorRecords(ctx, req.Retries)
+		}
+		records, pages, complete = fetched.Records, fetched.Pages, !fetched.Truncated
+		problems = fetched.Problems
 		if err != nil {
 			v.setStatus(SourceStatus{
 				Source:     v.source,
@@ -122,8 +269,17 @@ func (v *VendorConnector) Poll(ctx context.Context, req SourcePollRequest) (sour
 			}, err
 		}
 	}
+	fetchedTotal := len(records)
+	seenIDs := make([]string, 0, len(records))
+	for _, rec := range records {
+		if rec.ID != "" {
+			seenIDs = append(seenIDs, rec.ID)
+		}
+	}
+	truncated := false
 	if len(records) > req.Limit {
 		records = records[:req.Limit]
+		truncated = true
 	}
 
 	nowMs := time.Now().UnixMilli()
@@ -131,6 +287,7 @@ func (v *VendorConnector) Poll(ctx context.Context, req SourcePollRequest) (sour
 	normalized := 0
 	deduped := 0
 	emitted := 0
+	updated := 0
 
 	v.mu.Lock()
 	for key, ts := range v.seen {
@@ -147,19 +304,17 @@ func (v *VendorConnector) Poll(ctx context.Context, req SourcePollRequest) (sour
 
 		prev, seen := v.lastKnown[rec.ID]
 		v.lastKnown[rec.ID] = rec.Online
-
-		eventType := ""
-		if !seen {
-			if !rec.Online {
-				eventType = "device_down"
-			}
-		} else if prev != rec.Online {
-			if rec.Online {
-				eventType = "device_up"
-			} else {
-				eventType = "device_down"
-			}
+		fp := fingerprintSourceRecord(rec)
+		prevFP, hadFP := v.fingerprints[rec.ID]
+		v.fingerprints[rec.ID] = fp
+		var last *uiSPDeviceRecord
+		if r, ok := v.readings[rec.ID]; ok {
+			last = &r
+		} else {
+			v.readings[rec.ID] = rec
 		}
+
+		eventType, changed := classifySourceRecord(prev, seen, rec, prevFP, hadFP, fp, last, req.FullSync)
 		if eventType == "" {
 			continue
 		}
@@ -171,38 +326,27 @@ func (v *VendorConnector) Poll(ctx context.Context, req SourcePollRequest) (sour
 		}
 		v.seen[eventKey] = nowMs
 
-		online := rec.Online
-		events = append(events, TelemetryIngestRequest{
-			Source:       v.source,
-			EventType:    eventType,
-			ObservedAtMs: rec.ObservedAtMs,
-			DeviceID:     rec.ID,
-			Device:       rec.Name,
-			Hostname:     rec.Host,
-			Mac:          rec.Mac,
-			Serial:       rec.Serial,
-			Model:        rec.Model,
-			Vendor:       rec.Vendor,
-			Role:         rec.Role,
-			SiteID:       rec.SiteID,
-			Online:       &online,
-			LatencyMs:    rec.Latency,
-			Message:      fmt.Sprintf("%s poll state=%t", strings.ToUpper(v.source), rec.Online),
-			Interfaces:   rec.Ifaces,
-			Neighbors:    rec.Neighs,
-		})
+		events = append(events, v.recordEvent(rec, eventType, changed))
+		v.readings[rec.ID] = rec
 		emitted++
+		if eventType == "device_update" {
+			updated++
+		}
 	}
 	v.mu.Unlock()
 
 	resp := SourcePollResponse{
 		Source:     v.source,
 		Cursor:     cursor,
-		Fetched:    len(records),
+		Fetched:    fetchedTotal,
+		Pages:      pages,
+		Truncated:  truncated,
 		Normalized: normalized,
 		Emitted:    emitted,
+		Updated:    updated,
 		Deduped:    deduped,
 		Backfill:   backfill,
+		FullSync:   req.FullSync,
 		Demo:       demoMode,
 		DurationMs: time.Since(start).Milliseconds(),
 		Stub:       true,
@@ -213,72 +357,83 @@ func (v *VendorConnector) Poll(ctx context.Context, req SourcePollRequest) (sour
 		LastPollAt:     time.Now().UTC().Format(time.RFC3339),
 		LastCursor:     cursor,
 		LastFetched:    resp.Fetched,
+		LastPages:      resp.Pages,
+		LastTruncated:  resp.Truncated,
 		LastNormalized: resp.Normalized,
 		LastEmitted:    resp.Emitted,
 		Demo:           demoMode,
 		Stub:           true,
 	})
 
-	return sourcePollBatch{Response: resp, Events: events}, nil
+	return sourcePollBatch{Response: resp, Events: events, SeenIDs: seenIDs, Complete: complete && !demoMode, Problems: problems, ProblemsFetched: problems != nil}, nil
 }
 
-func (v *VendorConnector) fetchVendorRecords(ctx context.Context, retries int) ([]uiSPDeviceRecord, error) {
-	url := v.baseURL + v.devicesPath
-	var lastErr error
-	for attempt := 0; attempt <= retries; attempt++ {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Accept", "application/json")
-		v.applyAuthHeaders(req)
+func (v *VendorConnector) fetchVendorRecords(ctx context.Context, retries int) (pagedFetchResult, error) {
+	if err := v.guard.Allow(); err != nil {
+		return pagedFetchResult{}, err
+	}
+	var (
+		result pagedFetchResult
+		err    error
+	)
+	if v.fetcher != nil {
+		result, err = v.fetcher(ctx, retries)
+	} else {
+		result, err = v.fetchPagedVendorRecords(ctx, retries)
+	}
+	v.guard.RecordPoll(err)
+	return result, err
+}
 
-		resp, err := v.client.Do(req)
-		if err != nil {
-			lastErr = err
-			if attempt < retries {
-				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-				continue
-			}
-			break
+func (v *VendorConnector) fetchPagedVendorRecords(ctx context.Context, retries int) (pagedFetchResult, error) {
+	parse := func(body []byte) ([]uiSPDeviceRecord, error) {
+		if v.mapping != nil {
+			return parseMappedDevices(body, *v.mapping, v.source, v.vendorLabel)
 		}
-
-		body, readErr := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-		if readErr != nil {
-			lastErr = readErr
-			if attempt < retries {
-				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-				continue
+		return parseVendorDevices(body, v.source, v.vendorLabel)
+	}
+	count := countPageItems
+	if v.mapping != nil {
+		mapping := *v.mapping
+		count = func(body []byte) int {
+			var payload any
+			if err := json.Unmarshal(body, &payload); err != nil {
+				return 0
 			}
-			break
+			return len(extractMappedItems(payload, mapping))
 		}
+	}
+	v.mu.RLock()
+	pagination := v.pagination
+	v.mu.RUnlock()
+	return fetchPagedRecords(ctx, v.client, v.baseURL+v.devicesPath, pagination, retries, v.source, v.authProvider(), v.guard, parse, count)
+}
 
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			lastErr = fmt.Errorf("%s status %d", v.source, resp.StatusCode)
-			if attempt < retries {
-				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-				continue
-			}
-			break
-		}
+func (v *VendorConnector) SetPagination(cfg PaginationConfig) {
+	v.mu.Lock()
+	v.pagination = normalizePaginationConfig(cfg)
+	v.mu.Unlock()
+}
 
-		recs, parseErr := parseVendorDevices(body, v.source, v.vendorLabel)
-		if parseErr != nil {
-			lastErr = parseErr
-			if attempt < retries {
-				time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-				continue
-			}
-			break
-		}
-		return recs, nil
-	}
+// SetAuth installs a login-based auth provider (OAuth2, token exchange,
+// session cookie) in place of the static header schemes.
+func (v *VendorConnector) SetAuth(auth ConnectorAuth) {
+	v.mu.Lock()
+	v.auth = auth
+	v.mu.Unlock()
+}
 
-	if lastErr == nil {
-		lastErr = fmt.Errorf("%s poll failed", v.source)
+func (v *VendorConnector) requestAuth() ConnectorAuth {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.auth
+}
+
+func (v *VendorConnector) authProvider() ConnectorAuth {
+	if auth := v.requestAuth(); auth != nil {
+		return auth
 	}
-	return nil, lastErr
+	return headerAuth(v.applyAuthHeaders)
 }
 
 func (v *VendorConnector) applyAuthHeaders(req *http.Request) {
@@ -290,6 +445,8 @@ func (v *VendorConnector) applyAuthHeaders(req *http.Request) {
 		req.Header.Set("X-Auth-Token", v.token)
 	case "x-cisco-meraki-api-key":
 		req.Header.Set("X-Cisco-Meraki-API-Key", v.token)
+	case "x-api-key":
+		req.Header.Set("X-API-KEY", v.token)
 	case "token":
 		req.Header.Set("Token", v.token)
 	case "authorization":
@@ -381,6 +538,7 @@ func parseVendorDevices(body []byte, source, vendorLabel string) ([]uiSPDeviceRe
 				[]string{"health"},
 				[]string{"connectionState"},
 				[]string{"connectivity"},
+				[]string{"reachabilityStatus"},
 			)))
 			if state != "" {
 				online = parseConnectorOnlineState(state)
@@ -394,6 +552,14 @@ func parseVendorDevices(body []byte, source, vendorLabel string) ([]uiSPDeviceRe
 			[]string{"ping"},
 			[]string{"status", "latencyMs"},
 		)
+		// Memory fields that hold byte counts fail the percent range check
+		// and are dropped.
+		metrics := pickHealthMetrics(item, healthMetricPaths{
+			cpu:    [][]string{{"cpu_pct"}, {"cpuPct"}, {"cpu"}, {"cpuUtilization"}},
+			mem:    [][]string{{"mem_pct"}, {"memPct"}, {"memory"}, {"memoryUtilization"}},
+			temp:   [][]string{{"temp_c"}, {"temperature"}, {"general_temperature"}},
+			uptime: [][]string{{"uptime_s"}, {"uptimeSeconds"}, {"uptime"}},
+		})
 		observedAtMs := pickTimestampMs(item,
 			[]string{"lastSeen"},
 			[]string{"lastSeenMs"},
@@ -439,6 +605,7 @@ func parseVendorDevices(body []byte, source, vendorLabel string) ([]uiSPDeviceRe
 			Neighs:       parseUISPNeighbors(item),
 			Online:       online,
 			Latency:      latency,
+			Metrics:      metrics,
 			ObservedAtMs: observedAtMs,
 		})
 	}
@@ -459,7 +626,7 @@ func extractVendorItems(payload any) []map[string]any {
 			}
 		}
 	case map[string]any:
-		for _, key := range []string{"devices", "items", "data", "results", "nodes"} {
+		for _, key := range []string{"devices", "items", "data", "results", "nodes", "response"} {
 			if arr, ok := v[key].([]any); ok {
 				for _, item := range arr {
 					if m, ok := item.(map[string]any); ok {
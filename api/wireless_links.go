@@ -0,0 +1,592 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	wirelessLinkProtocol       = "wireless"
+	wirelessLinkIncidentType   = "wireless_link_degraded"
+	wirelessLinkIncidentSource = "wireless_link_monitor"
+	maxWirelessLinkSamples     = 20000
+	// Links whose station has not reported for this long are dropped.
+	wirelessLinkStaleMs        = int64(30 * 24 * time.Hour / time.Millisecond)
+	wirelessBaselineWindowMs   = int64(7 * 24 * time.Hour / time.Millisecond)
+	wirelessBaselineBucketMs   = int64(time.Hour / time.Millisecond)
+	wirelessMinSignalDbm       = -75.0
+	wirelessMinSNRDb           = 15.0
+	wirelessMinCCQPct          = 70.0
+	wirelessSignalDropDb       = 8.0
+	wirelessCapacityDropRatio  = 0.5
+	defaultWirelessLinkWindow  = 24 * 60
+	maxWirelessLinkWindow      = 90 * 24 * 60
+	defaultWirelessLinkSamples = 500
+	maxWirelessLinkSamplesPage = 5000
+
+	wirelessLinkStatusOK       = "ok"
+	wirelessLinkStatusDegraded = "degraded"
+	wirelessLinkStatusDown     = "down"
+)
+
+// WirelessLink is one station's radio link to its AP. RF values are the
+// station's latest report; Baseline is the link's own 7-day history.
+type WirelessLink struct {
+	LinkID              string                `json:"link_id"`
+	APDeviceID          string                `json:"ap_device_id"`
+	APName              string                `json:"ap_name,omitempty"`
+	StationDeviceID     string                `json:"station_device_id"`
+	StationName         string                `json:"station_name,omitempty"`
+	SiteID              string                `json:"site_id,omitempty"`
+	Source              string                `json:"source,omitempty"`
+	Technology          string                `json:"technology,omitempty"`
+	SSID                string                `json:"ssid,omitempty"`
+	FrequencyMHz        *float64              `json:"frequency_mhz,omitempty"`
+	SignalDbm           *float64              `json:"signal_dbm,omitempty"`
+	RemoteSignalDbm     *float64              `json:"remote_signal_dbm,omitempty"`
+	NoiseDbm            *float64              `json:"noise_dbm,omitempty"`
+	SNRDb               *float64              `json:"snr_db,omitempty"`
+	CCQPct              *float64              `json:"ccq_pct,omitempty"`
+	DownlinkCapacityBps *float64              `json:"downlink_capacity_bps,omitempty"`
+	UplinkCapacityBps   *float64              `json:"uplink_capacity_bps,omitempty"`
+	DistanceM           *float64              `json:"distance_m,omitempty"`
+	Status              string                `json:"status"`
+	Reasons             []string              `json:"reasons,omitempty"`
+	DegradedSince       int64                 `json:"degraded_since,omitempty"`
+	IncidentID          string                `json:"incident_id,omitempty"`
+	Baseline            *WirelessLinkBaseline `json:"baseline,omitempty"`
+	LastSeen            int64                 `json:"last_seen"`
+	UpdatedAt           string                `json:"updated_at"`
+}
+
+// WirelessLinkBaseline holds means over the link's recent samples. It is
+// only set once minBaselineSamples samples exist.
+type WirelessLinkBaseline struct {
+	SampleCount         int      `json:"sample_count"`
+	SignalDbm           *float64 `json:"signal_dbm,omitempty"`
+	DownlinkCapacityBps *float64 `json:"downlink_capacity_bps,omitempty"`
+	UplinkCapacityBps   *float64 `json:"uplink_capacity_bps,omitempty"`
+}
+
+// WirelessBaselineBucket sums one hour of a link's samples. A link keeps
+// its last 7 days of buckets, so the baseline survives the global sample
+// cap and costs one short pass per sample.
+type WirelessBaselineBucket struct {
+	StartMs       int64   `json:"start_ms"`
+	Samples       int     `json:"samples"`
+	SignalSum     float64 `json:"signal_sum,omitempty"`
+	SignalCount   int     `json:"signal_count,omitempty"`
+	DownlinkSum   float64 `json:"downlink_sum,omitempty"`
+	DownlinkCount int     `json:"downlink_count,omitempty"`
+	UplinkSum     float64 `json:"uplink_sum,omitempty"`
+	UplinkCount   int     `json:"uplink_count,omitempty"`
+}
+
+type WirelessLinkSample struct {
+	LinkID              string   `json:"link_id"`
+	ObservedAt          int64    `json:"observed_at"`
+	SignalDbm           *float64 `json:"signal_dbm,omitempty"`
+	RemoteSignalDbm     *float64 `json:"remote_signal_dbm,omitempty"`
+	NoiseDbm            *float64 `json:"noise_dbm,omitempty"`
+	CCQPct              *float64 `json:"ccq_pct,omitempty"`
+	DownlinkCapacityBps *float64 `json:"downlink_capacity_bps,omitempty"`
+	UplinkCapacityBps   *float64 `json:"uplink_capacity_bps,omitempty"`
+	Status              string   `json:"status"`
+}
+
+type WirelessLinksResponse struct {
+	LastUpdated int64          `json:"last_updated"`
+	Count       int            `json:"count"`
+	Links       []WirelessLink `json:"links"`
+	Truncated   bool           `json:"truncated"`
+	Limit       int            `json:"limit"`
+	Stub        bool           `json:"stub"`
+}
+
+type WirelessLinkHistory struct {
+	Link          WirelessLink         `json:"link"`
+	WindowMinutes int                  `json:"window_minutes"`
+	Count         int                  `json:"count"`
+	Truncated     bool                 `json:"truncated"`
+	Limit         int                  `json:"limit"`
+	Samples       []WirelessLinkSample `json:"samples"`
+	Stub          bool                 `json:"stub"`
+}
+
+func wirelessLinkID(apDeviceID, stationDeviceID string) string {
+	return "wl-" + normalizeKeyToken(apDeviceID+"|"+stationDeviceID)
+}
+
+// normalizeWirelessFact returns a validated copy, or nil when the fact does
+// not describe a station link. Implausible RF readings are dropped.
+func normalizeWirelessFact(f *TelemetryWirelessFact) *TelemetryWirelessFact {
+	if f == nil {
+		return nil
+	}
+	out := &TelemetryWirelessFact{
+		Mode:                normalizeWirelessMode(f.Mode),
+		Technology:          strings.ToLower(strings.TrimSpace(f.Technology)),
+		APDeviceID:          strings.TrimSpace(f.APDeviceID),
+		APName:              strings.TrimSpace(f.APName),
+		SSID:                strings.TrimSpace(f.SSID),
+		FrequencyMHz:        boundedMetric(f.FrequencyMHz, 1, 100000),
+		SignalDbm:           boundedMetric(f.SignalDbm, -120, 0),
+		RemoteSignalDbm:     boundedMetric(f.RemoteSignalDbm, -120, 0),
+		NoiseDbm:            boundedMetric(f.NoiseDbm, -130, 0),
+		CCQPct:              boundedMetric(f.CCQPct, 0, 100),
+		DownlinkCapacityBps: boundedMetric(f.DownlinkCapacityBps, 0, math.MaxFloat64),
+		UplinkCapacityBps:   boundedMetric(f.UplinkCapacityBps, 0, math.MaxFloat64),
+		DistanceM:           boundedMetric(f.DistanceM, 0, math.MaxFloat64),
+	}
+	if out.Mode == "ap" || out.APDeviceID == "" {
+		return nil
+	}
+	return out
+}
+
+// normalizeWirelessMode folds vendor modes ("sta-ptmp", "ap-ptp", ...) to
+// "ap" or "station".
+func normalizeWirelessMode(mode string) string {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch {
+	case mode == "":
+		return ""
+	case strings.HasPrefix(mode, "ap"), mode == "master":
+		return "ap"
+	case strings.HasPrefix(mode, "sta"), mode == "cpe", mode == "client":
+		return "station"
+	}
+	return mode
+}
+
+// updateWirelessLinkLocked folds one accepted station sample into its
+// link. An offline station marks its links down.
+func (s *Store) updateWirelessLinkLocked(deviceID, deviceName, siteID, source string, online bool, fact *TelemetryWirelessFact, observedAtMs, nowMs int64) {
+	nowISO := time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
+	if !online {
+		for i := range s.WirelessLinks {
+			link := &s.WirelessLinks[i]
+			if link.StationDeviceID != deviceID || link.Status == wirelessLinkStatusDown {
+				continue
+			}
+			link.Status, link.Reasons, link.DegradedSince, link.UpdatedAt = wirelessLinkStatusDown, nil, 0, nowISO
+			s.resolveWirelessLinkIncidentLocked(link, "Station offline; the device offline incident covers the outage.", nowISO)
+		}
+		return
+	}
+	fact = normalizeWirelessFact(fact)
+	if fact == nil {
+		return
+	}
+
+	linkID := wirelessLinkID(fact.APDeviceID, deviceID)
+	idx := -1
+	kept := s.WirelessLinks[:0]
+	for i := range s.WirelessLinks {
+		link := s.WirelessLinks[i]
+		if link.StationDeviceID == deviceID && link.LinkID != linkID {
+			// A station has one AP; re-association retires the old link.
+			s.resolveWirelessLinkIncidentLocked(&link, "Station associated with another AP.", nowISO)
+			continue
+		}
+		if link.LinkID == linkID {
+			idx = len(kept)
+		}
+		kept = append(kept, link)
+	}
+	s.WirelessLinks = kept
+	if idx == -1 {
+		s.WirelessLinks = append(s.WirelessLinks, WirelessLink{LinkID: linkID, StationDeviceID: deviceID})
+		idx = len(s.WirelessLinks) - 1
+	}
+
+	link := &s.WirelessLinks[idx]
+	link.APDeviceID = fact.APDeviceID
+	link.APName = firstNonEmpty(fact.APName, link.APName)
+	link.StationName = deviceName
+	link.SiteID = siteID
+	link.Source = source
+	link.Technology = firstNonEmpty(fact.Technology, link.Technology)
+	link.SSID = firstNonEmpty(fact.SSID, link.SSID)
+	link.FrequencyMHz = fact.FrequencyMHz
+	link.SignalDbm = fact.SignalDbm
+	link.RemoteSignalDbm = fact.RemoteSignalDbm
+	link.NoiseDbm = fact.NoiseDbm
+	link.SNRDb = nil
+	if fact.SignalDbm != nil && fact.NoiseDbm != nil {
+		snr := roundMetric(*fact.SignalDbm - *fact.NoiseDbm)
+		link.SNRDb = &snr
+	}
+	link.CCQPct = fact.CCQPct
+	link.DownlinkCapacityBps = fact.DownlinkCapacityBps
+	link.UplinkCapacityBps = fact.UplinkCapacityBps
+	link.DistanceM = fact.DistanceM
+	link.LastSeen = observedAtMs
+	link.UpdatedAt = nowISO
+
+	// The baseline comes from earlier samples so a sudden drop is measured
+	// against what the link used to do, not against itself.
+	link.Baseline = s.wirelessLinkBaselineLocked(linkID, observedAtMs)
+	link.Reasons = wirelessLinkDegradedReasons(*link)
+	if len(link.Reasons) > 0 {
+		if link.Status != wirelessLinkStatusDegraded {
+			link.DegradedSince = observedAtMs
+		}
+		link.Status = wirelessLinkStatusDegraded
+		s.openWirelessLinkIncidentLocked(link, nowISO)
+	} else {
+		link.Status, link.DegradedSince = wirelessLinkStatusOK, 0
+		s.resolveWirelessLinkIncidentLocked(link, "Wireless link back within thresholds.", nowISO)
+	}
+
+	sample := WirelessLinkSample{
+		LinkID:              linkID,
+		ObservedAt:          observedAtMs,
+		SignalDbm:           cloneFloat64Ptr(link.SignalDbm),
+		RemoteSignalDbm:     cloneFloat64Ptr(link.RemoteSignalDbm),
+		NoiseDbm:            cloneFloat64Ptr(link.NoiseDbm),
+		CCQPct:              cloneFloat64Ptr(link.CCQPct),
+		DownlinkCapacityBps: cloneFloat64Ptr(link.DownlinkCapacityBps),
+		UplinkCapacityBps:   cloneFloat64Ptr(link.UplinkCapacityBps),
+		Status:              link.Status,
+	}
+	s.WirelessLinkSamples = append(s.WirelessLinkSamples, sample)
+	s.foldWirelessBaselineLocked(sample)
+	s.pruneWirelessLinksLocked(nowMs)
+}
+
+func (s *Store) pruneWirelessLinksLocked(nowMs int64) {
+	nowISO := time.UnixMilli(nowMs).UTC().Format(time.RFC3339)
+	kept := s.WirelessLinks[:0]
+	for _, link := range s.WirelessLinks {
+		if link.LastSeen > 0 && nowMs-link.LastSeen > wirelessLinkStaleMs {
+			s.resolveWirelessLinkIncidentLocked(&link, "Station stopped reporting the link.", nowISO)
+			continue
+		}
+		kept = append(kept, link)
+	}
+	s.WirelessLinks = kept
+	if len(s.WirelessLinkBaselines) > len(s.WirelessLinks) {
+		live := make(map[string]struct{}, len(s.WirelessLinks))
+		for _, link := range s.WirelessLinks {
+			live[link.LinkID] = struct{}{}
+		}
+		for linkID := range s.WirelessLinkBaselines {
+			if _, ok := live[linkID]; !ok {
+				delete(s.WirelessLinkBaselines, linkID)
+			}
+		}
+	}
+	if len(s.WirelessLinkSamples) > maxWirelessLinkSamples {
+		s.WirelessLinkSamples = append([]WirelessLinkSample(nil), s.WirelessLinkSamples[len(s.WirelessLinkSamples)-maxWirelessLinkSamples:]...)
+	}
+}
+
+// wirelessLinkBaselineLocked averages the link's hourly buckets from the
+// 7 days before beforeMs. The bucket beforeMs falls in only holds earlier
+// samples, since the current one is folded in after the check.
+func (s *Store) wirelessLinkBaselineLocked(linkID string, beforeMs int64) *WirelessLinkBaseline {
+	var total WirelessBaselineBucket
+	for _, b := range s.WirelessLinkBaselines[linkID] {
+		if b.StartMs > beforeMs || beforeMs-(b.StartMs+wirelessBaselineBucketMs) >= wirelessBaselineWindowMs {
+			continue
+		}
+		total.Samples += b.Samples
+		total.SignalSum += b.SignalSum
+		total.SignalCount += b.SignalCount
+		total.DownlinkSum += b.DownlinkSum
+		total.DownlinkCount += b.DownlinkCount
+		total.UplinkSum += b.UplinkSum
+		total.UplinkCount += b.UplinkCount
+	}
+	if total.Samples < minBaselineSamples {
+		return nil
+	}
+	return &WirelessLinkBaseline{
+		SampleCount:         total.Samples,
+		SignalDbm:           wirelessBaselineMean(total.SignalSum, total.SignalCount),
+		DownlinkCapacityBps: wirelessBaselineMean(total.DownlinkSum, total.DownlinkCount),
+		UplinkCapacityBps:   wirelessBaselineMean(total.UplinkSum, total.UplinkCount),
+	}
+}
+
+func wirelessBaselineMean(sum float64, count int) *float64 {
+	if count < minBaselineSamples {
+		return nil
+	}
+	mean := roundMetric(sum / float64(count))
+	return &mean
+}
+
+// foldWirelessBaselineLocked adds a sample to its link's hourly bucket and
+// drops buckets that fell out of the 7-day window.
+func (s *Store) foldWirelessBaselineLocked(sample WirelessLinkSample) {
+	if s.WirelessLinkBaselines == nil {
+		s.WirelessLinkBaselines = map[string][]WirelessBaselineBucket{}
+	}
+	buckets := s.WirelessLinkBaselines[sample.LinkID]
+	if n := len(buckets); n > 0 && buckets[n-1].StartMs-sample.ObservedAt >= wirelessBaselineWindowMs {
+		return
+	}
+	start := sample.ObservedAt - sample.ObservedAt%wirelessBaselineBucketMs
+	i := sort.Search(len(buckets), func(i int) bool { return buckets[i].StartMs >= start })
+	if i == len(buckets) || buckets[i].StartMs != start {
+		buckets = append(buckets, WirelessBaselineBucket{})
+		copy(buckets[i+1:], buckets[i:])
+		buckets[i] = WirelessBaselineBucket{StartMs: start}
+	}
+	b := &buckets[i]
+	b.Samples++
+	if sample.SignalDbm != nil {
+		b.SignalSum += *sample.SignalDbm
+		b.SignalCount++
+	}
+	if sample.DownlinkCapacityBps != nil {
+		b.DownlinkSum += *sample.DownlinkCapacityBps
+		b.DownlinkCount++
+	}
+	if sample.UplinkCapacityBps != nil {
+		b.UplinkSum += *sample.UplinkCapacityBps
+		b.UplinkCount++
+	}
+	cutoff := buckets[len(buckets)-1].StartMs - wirelessBaselineWindowMs
+	drop := 0
+	for drop < len(buckets) && buckets[drop].StartMs < cutoff {
+		drop++
+	}
+	if drop > 0 {
+		buckets = append([]WirelessBaselineBucket(nil), buckets[drop:]...)
+	}
+	s.WirelessLinkBaselines[sample.LinkID] = buckets
+}
+
+func cloneWirelessBaselines(in map[string][]WirelessBaselineBucket) map[string][]WirelessBaselineBucket {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string][]WirelessBaselineBucket, len(in))
+	for linkID, buckets := range in {
+		out[linkID] = append([]WirelessBaselineBucket(nil), buckets...)
+	}
+	return out
+}
+
+// wirelessLinkDegradedReasons checks the link's current RF against fixed
+// thresholds and against its own baseline.
+func wirelessLinkDegradedReasons(link WirelessLink) []string {
+	reasons := make([]string, 0, 2)
+	if link.SignalDbm != nil && *link.SignalDbm < wirelessMinSignalDbm {
+		reasons = append(reasons, "signal_below_threshold")
+	}
+	if link.SNRDb != nil && *link.SNRDb < wirelessMinSNRDb {
+		reasons = append(reasons, "snr_below_threshold")
+	}
+	if link.CCQPct != nil && *link.CCQPct < wirelessMinCCQPct {
+		reasons = append(reasons, "ccq_below_threshold")
+	}
+	if base := link.Baseline; base != nil {
+		if link.SignalDbm != nil && base.SignalDbm != nil && *link.SignalDbm <= *base.SignalDbm-wirelessSignalDropDb {
+			reasons = append(reasons, "signal_below_baseline")
+		}
+		if capacityBelowBaseline(link.DownlinkCapacityBps, base.DownlinkCapacityBps) || capacityBelowBaseline(link.UplinkCapacityBps, base.UplinkCapacityBps) {
+			reasons = append(reasons, "capacity_below_baseline")
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return reasons
+}
+
+func capacityBelowBaseline(current, baseline *float64) bool {
+	return current != nil && baseline != nil && *baseline > 0 && *current < *baseline*wirelessCapacityDropRatio
+}
+
+// Degraded-link incidents carry an ExternalID, so device online/offline
+// handling leaves them alone; only the link's own state opens and resolves
+// them.
+func (s *Store) openWirelessLinkIncidentLocked(link *WirelessLink, nowISO string) {
+	msg := fmt.Sprintf("Wireless link %s -> %s degraded: %s", firstNonEmpty(link.StationName, link.StationDeviceID), firstNonEmpty(link.APName, link.APDeviceID), strings.Join(link.Reasons, ", "))
+	if i := s.openWirelessLinkIncidentIndexLocked(link.LinkID); i >= 0 {
+		s.Incidents[i].Message = msg
+		link.IncidentID = s.Incidents[i].ID
+		return
+	}
+	inc := Incident{
+		ID:         "inc-" + randomID(),
+		DeviceID:   link.StationDeviceID,
+		SiteID:     link.SiteID,
+		Type:       wirelessLinkIncidentType,
+		Severity:   "warning",
+		Started:    nowISO,
+		Message:    msg,
+		Source:     wirelessLinkIncidentSource,
+		ExternalID: "wireless:" + link.LinkID,
+	}
+	s.Incidents = append(s.Incidents, inc)
+	s.appendIncidentTimelineEntryLocked(len(s.Incidents)-1, "opened", "", msg, nowISO)
+	link.IncidentID = inc.ID
+}
+
+func (s *Store) resolveWirelessLinkIncidentLocked(link *WirelessLink, note, nowISO string) {
+	link.IncidentID = ""
+	i := s.openWirelessLinkIncidentIndexLocked(link.LinkID)
+	if i < 0 {
+		return
+	}
+	resolvedAt := nowISO
+	s.Incidents[i].Resolved = &resolvedAt
+	s.appendIncidentTimelineEntryLocked(i, "resolved", "", note, nowISO)
+}
+
+func (s *Store) openWirelessLinkIncidentIndexLocked(linkID string) int {
+	externalID := "wireless:" + linkID
+	for i := range s.Incidents {
+		inc := s.Incidents[i]
+		if inc.Source == wirelessLinkIncidentSource && inc.ExternalID == externalID && inc.Resolved == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// wirelessNeighborLinksLocked turns wireless links into station -> AP
+// neighbor rows so the topology graph draws them as typed edges.
+func (s *Store) wirelessNeighborLinksLocked() []NeighborLink {
+	out := make([]NeighborLink, 0, len(s.WirelessLinks))
+	for _, link := range s.WirelessLinks {
+		identityID := s.identityIndex["device:"+normalizeKeyToken(link.StationDeviceID)]
+		if identityID == "" {
+			continue
+		}
+		out = append(out, NeighborLink{
+			ID:                   link.LinkID,
+			IdentityID:           identityID,
+			NeighborIdentityHint: link.APDeviceID,
+			NeighborDeviceName:   link.APName,
+			Protocol:             wirelessLinkProtocol,
+			Source:               link.Source,
+			UpdatedAt:            link.UpdatedAt,
+		})
+	}
+	return out
+}
+
+func cloneWirelessLinks(in []WirelessLink) []WirelessLink {
+	out := make([]WirelessLink, len(in))
+	for i, link := range in {
+		link.Reasons = append([]string(nil), link.Reasons...)
+		if link.Baseline != nil {
+			base := *link.Baseline
+			link.Baseline = &base
+		}
+		out[i] = link
+	}
+	return out
+}
+
+func wirelessLinkStatusRank(status string) int {
+	switch status {
+	case wirelessLinkStatusDegraded:
+		return 0
+	case wirelessLinkStatusDown:
+		return 1
+	}
+	return 2
+}
+
+// ListWirelessLinks returns links degraded first, then down, then healthy.
+func (s *Store) ListWirelessLinks(limit int, status, siteID, apDeviceID string) ([]WirelessLink, bool, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	statusFilter := strings.ToLower(strings.TrimSpace(status))
+	siteFilter := strings.TrimSpace(siteID)
+	apFilter := strings.TrimSpace(apDeviceID)
+	matched := make([]WirelessLink, 0)
+	for _, link := range s.WirelessLinks {
+		if statusFilter != "" && link.Status != statusFilter {
+			continue
+		}
+		if siteFilter != "" && link.SiteID != siteFilter {
+			continue
+		}
+		if apFilter != "" && link.APDeviceID != apFilter {
+			continue
+		}
+		matched = append(matched, link)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if ri, rj := wirelessLinkStatusRank(matched[i].Status), wirelessLinkStatusRank(matched[j].Status); ri != rj {
+			return ri < rj
+		}
+		if matched[i].APDeviceID != matched[j].APDeviceID {
+			return matched[i].APDeviceID < matched[j].APDeviceID
+		}
+		return matched[i].StationDeviceID < matched[j].StationDeviceID
+	})
+	truncated := len(matched) > limit
+	if truncated {
+		matched = matched[:limit]
+	}
+	return cloneWirelessLinks(matched), truncated, limit
+}
+
+// WirelessLinkHistory returns a link with its RF samples in the window,
+// oldest first.
+func (s *Store) WirelessLinkHistory(linkID string, windowMinutes, limit int) (WirelessLinkHistory, bool) {
+	linkID = strings.TrimSpace(linkID)
+	if windowMinutes <= 0 {
+		windowMinutes = defaultWirelessLinkWindow
+	}
+	if windowMinutes > maxWirelessLinkWindow {
+		windowMinutes = maxWirelessLinkWindow
+	}
+	if limit <= 0 {
+		limit = defaultWirelessLinkSamples
+	}
+	if limit > maxWirelessLinkSamplesPage {
+		limit = maxWirelessLinkSamplesPage
+	}
+	sinceMs := time.Now().UnixMilli() - int64(windowMinutes)*int64(time.Minute/time.Millisecond)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx := -1
+	for i := range s.WirelessLinks {
+		if s.WirelessLinks[i].LinkID == linkID {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return WirelessLinkHistory{}, false
+	}
+	samples := make([]WirelessLinkSample, 0)
+	for _, sample := range s.WirelessLinkSamples {
+		if sample.LinkID == linkID && sample.ObservedAt >= sinceMs {
+			samples = append(samples, sample)
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].ObservedAt < samples[j].ObservedAt })
+	truncated := false
+	if len(samples) > limit {
+		samples = samples[len(samples)-limit:]
+		truncated = true
+	}
+	return WirelessLinkHistory{
+		Link:          cloneWirelessLinks(s.WirelessLinks[idx : idx+1])[0],
+		WindowMinutes: windowMinutes,
+		Count:         len(samples),
+		Truncated:     truncated,
+		Limit:         limit,
+		Samples:       samples,
+		Stub:          true,
+	}, true
+}
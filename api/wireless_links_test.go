@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseUISPWireless(t *testing.T) {
+	body := []byte(`[
+		{"identification":{"id":"ap-1","name":"Tower AP","type":"airMax"},"overview":{"status":"active","wirelessMode":"ap-ptmp","frequency":5180}},
+		{"identification":{"id":"cpe-1","name":"Smith CPE","type":"airMax"},"overview":{"status":"active","wirelessMode":"sta-ptmp","signal":-63,"frequency":5180,"downlinkCapacity":120000000,"uplinkCapacity":80000000,"distance":2400},"airmax":{"noiseFloor":-92,"ccq":96,"remoteSignal":-65},"attributes":{"ssid":"tower-1","apDevice":{"id":"ap-1","name":"Tower AP"}}},
+		{"identification":{"id":"sw-1","name":"Switch"},"overview":{"status":"active"}}
+	]`)
+	records, err := parseUISPDevices(body)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("parse failed: err=%v records=%d", err, len(records))
+	}
+	cpe := records[1].Wireless
+	if cpe == nil || cpe.APDeviceID != "ap-1" || cpe.Technology != "airmax" || *cpe.SignalDbm != -63 || *cpe.NoiseDbm != -92 || *cpe.CCQPct != 96 || *cpe.DownlinkCapacityBps != 120000000 || *cpe.DistanceM != 2400 {
+		t.Fatalf("unexpected station fact: %+v", cpe)
+	}
+	if normalizeWirelessFact(records[0].Wireless) != nil {
+		t.Fatalf("expected AP-side fact to form no link, got=%+v", records[0].Wireless)
+	}
+	if records[2].Wireless != nil {
+		t.Fatalf("expected wired device to carry no wireless fact")
+	}
+
+	moved := records[1]
+	moved.Wireless = &TelemetryWirelessFact{APDeviceID: "ap-2", SignalDbm: cpe.SignalDbm}
+	if fingerprintSourceRecord(records[1]).changedFields(fingerprintSourceRecord(moved))[0] != "wireless_ap" {
+		t.Fatalf("expected re-association to change the fingerprint")
+	}
+	louder := records[1]
+	louder.Wireless = &TelemetryWirelessFact{APDeviceID: "ap-1"}
+	if fingerprintSourceRecord(records[1]).Hash != fingerprintSourceRecord(louder).Hash {
+		t.Fatalf("expected RF values to stay out of the fingerprint")
+	}
+}
+
+func TestUISPPollEmitsMetricsWhenRFMoves(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		signal = -63
+		cpu    = 20
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, `[
+			{"identification":{"id":"ap-1","name":"Tower AP","role":"ap"},"site":{"id":"tower-1"},"overview":{"status":"active","wirelessMode":"ap-ptmp","cpu":%d}},
+			{"identification":{"id":"cpe-1","name":"Smith CPE","role":"station"},"site":{"id":"tower-1"},"overview":{"status":"active","wirelessMode":"sta-ptmp","signal":%d},"attributes":{"apDevice":{"id":"ap-1"}}}
+		]`, cpu, signal)
+	}))
+	defer server.Close()
+	set := func(nextSignal, nextCPU int) {
+		mu.Lock()
+		signal, cpu = nextSignal, nextCPU
+		mu.Unlock()
+	}
+	store := LoadStore("")
+	connector := NewUISPConnector(server.URL, "token", "")
+	polls := 0
+	poll := func(fullSync bool) []TelemetryIngestRequest {
+		t.Helper()
+		polls++
+		batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 10, Cursor: fmt.Sprint(polls), FullSync: fullSync})
+		if err != nil {
+			t.Fatalf("poll: %v", err)
+		}
+		ingestSourceEvents(store, batch.Events)
+		return batch.Events
+	}
+
+	poll(true)
+	set(-64, 22)
+	if events := poll(false); len(events) != 0 {
+		t.Fatalf("expected small moves to stay quiet, got=%#v", events)
+	}
+	set(-70, 22)
+	events := poll(false)
+	if len(events) != 1 || events[0].DeviceID != "cpe-1" || events[0].EventType != "device_metrics" || events[0].Message != "UISP readings moved: wireless" {
+		t.Fatalf("expected device_metrics for the station, got=%#v", events)
+	}
+	links, _, _ := store.ListWirelessLinks(10, "", "", "")
+	if len(links) != 1 || links[0].SignalDbm == nil || *links[0].SignalDbm != -70 {
+		t.Fatalf("expected the new signal to reach the link, got=%#v", links)
+	}
+
+	// Drift is measured from the last emitted value, so slow moves add up.
+	set(-69, 24)
+	if events := poll(false); len(events) != 0 {
+		t.Fatalf("expected small moves to stay quiet, got=%#v", events)
+	}
+	set(-69, 26)
+	if events := poll(false); len(events) != 1 || events[0].DeviceID != "ap-1" || events[0].Message != "UISP readings moved: metrics" {
+		t.Fatalf("expected accumulated CPU drift on the AP, got=%#v", events)
+	}
+	var cpuPct *float64
+	for _, d := range store.ListDevices() {
+		if d.ID == "ap-1" && d.Metrics != nil {
+			cpuPct = d.Metrics.CPUPct
+		}
+	}
+	if cpuPct == nil || *cpuPct != 26 {
+		t.Fatalf("expected the new CPU reading to reach the device, got=%v", cpuPct)
+	}
+}
+
+func TestWirelessLinkDegradedDetectionAndTopology(t *testing.T) {
+	s := LoadStore("")
+	base := time.Now().Add(-2 * time.Hour)
+	online := true
+	if _, _, ok := s.IngestTelemetry(TelemetryIngestRequest{Source: "uisp", DeviceID: "ap-1", Device: "Tower AP", Role: "ap", SiteID: "tower-1", Online: &online}); !ok {
+		t.Fatalf("ap ingest failed")
+	}
+	step := 0
+	ingest := func(signal, capacity float64) WirelessLink {
+		t.Helper()
+		step++
+		noise, ccq := -95.0, 95.0
+		if _, _, ok := s.IngestTelemetry(TelemetryIngestRequest{
+			Source:       "uisp",
+			DeviceID:     "cpe-1",
+			Device:       "Smith CPE",
+			Role:         "station",
+			SiteID:       "tower-1",
+			ObservedAtMs: base.Add(time.Duration(step) * time.Minute).UnixMilli(),
+			Online:       &online,
+			Wireless: &TelemetryWirelessFact{
+				Mode:                "sta-ptmp",
+				APDeviceID:          "ap-1",
+				APName:              "Tower AP",
+				SignalDbm:           &signal,
+				NoiseDbm:            &noise,
+				CCQPct:              &ccq,
+				DownlinkCapacityBps: &capacity,
+			},
+		}); !ok {
+			t.Fatalf("station ingest failed at step=%d", step)
+		}
+		links, _, _ := s.ListWirelessLinks(10, "", "", "")
+		if len(links) != 1 {
+			t.Fatalf("expected one wireless link, got=%#v", links)
+		}
+		return links[0]
+	}
+
+	for i := 0; i < minBaselineSamples; i++ {
+		if link := ingest(-60, 100e6); link.Status != wirelessLinkStatusOK {
+			t.Fatalf("expected healthy link during warm-up, got=%#v", link)
+		}
+	}
+	link := ingest(-61, 30e6)
+	if link.Status != wirelessLinkStatusDegraded || !containsString(link.Reasons, "capacity_below_baseline") || link.Baseline == nil || *link.Baseline.DownlinkCapacityBps != 100e6 || *link.SNRDb != 34 {
+		t.Fatalf("expected capacity drop against baseline, got=%#v", link)
+	}
+	incidentID := link.IncidentID
+
+	// A plain online report must not resolve the link incident.
+	if _, _, ok := s.IngestTelemetry(TelemetryIngestRequest{Source: "uisp", DeviceID: "cpe-1", Role: "station", SiteID: "tower-1", Online: &online}); !ok {
+		t.Fatalf("online ingest failed")
+	}
+	link = ingest(-80, 30e6)
+	if link.IncidentID != incidentID || !containsString(link.Reasons, "signal_below_threshold") || !containsString(link.Reasons, "signal_below_baseline") {
+		t.Fatalf("expected the same incident to follow the link, got=%#v", link)
+	}
+
+	ident := findIdentityByPrimary(t, s, "cpe-1")
+	ap := findIdentityByPrimary(t, s, "ap-1")
+	edges, _, _ := s.ListTopologyEdges(50, ident.IdentityID)
+	found := false
+	for _, edge := range edges {
+		if edge.Protocol == wirelessLinkProtocol {
+			found = true
+			if !edge.Resolved || edge.ToNodeID != topologyNodeIDForIdentity(ap.IdentityID) || edge.LinkStatus != wirelessLinkStatusDegraded {
+				t.Fatalf("unexpected wireless edge: %#v", edge)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected a wireless topology edge, got=%#v", edges)
+	}
+
+	if link = ingest(-60, 100e6); link.Status != wirelessLinkStatusOK || link.IncidentID != "" {
+		t.Fatalf("expected the link to recover, got=%#v", link)
+	}
+	for _, inc := range s.ListIncidents() {
+		if inc.ID == incidentID && (inc.Resolved == nil || inc.Type != wirelessLinkIncidentType || inc.DeviceID != "cpe-1") {
+			t.Fatalf("expected resolved degraded-link incident, got=%#v", inc)
+		}
+	}
+
+	offline := false
+	if _, _, ok := s.IngestTelemetry(TelemetryIngestRequest{Source: "uisp", DeviceID: "cpe-1", Role: "station", SiteID: "tower-1", Online: &offline}); !ok {
+		t.Fatalf("offline ingest failed")
+	}
+	if links, _, _ := s.ListWirelessLinks(10, wirelessLinkStatusDown, "", ""); len(links) != 1 {
+		t.Fatalf("expected offline station to mark its link down, got=%#v", links)
+	}
+
+	history, ok := s.WirelessLinkHistory(link.LinkID, 0, 3)
+	if !ok || history.Count != 3 || !history.Truncated || history.Samples[2].Status != wirelessLinkStatusOK {
+		t.Fatalf("unexpected link history: ok=%v %#v", ok, history)
+	}
+	if _, ok := s.WirelessLinkHistory("wl-missing", 60, 10); ok {
+		t.Fatalf("expected unknown link to be reported missing")
+	}
+}
+
+func TestWirelessLinkBaselineOutlivesSampleCap(t *testing.T) {
+	s := LoadStore("")
+	base := time.Now().Add(-3 * 24 * time.Hour)
+	online := true
+	ingest := func(at time.Time, capacity float64) WirelessLink {
+		t.Helper()
+		if _, _, ok := s.IngestTelemetry(TelemetryIngestRequest{
+			Source:       "uisp",
+			DeviceID:     "cpe-2",
+			Role:         "station",
+			SiteID:       "tower-1",
+			ObservedAtMs: at.UnixMilli(),
+			Online:       &online,
+			Wireless:     &TelemetryWirelessFact{Mode: "sta-ptmp", APDeviceID: "ap-2", DownlinkCapacityBps: &capacity},
+		}); !ok {
+			t.Fatalf("station ingest failed")
+		}
+		links, _, _ := s.ListWirelessLinks(10, "", "", "")
+		for _, link := range links {
+			if link.StationDeviceID == "cpe-2" {
+				return link
+			}
+		}
+		t.Fatalf("expected a link for cpe-2, got=%#v", links)
+		return WirelessLink{}
+	}
+
+	for i := 0; i < minBaselineSamples; i++ {
+		ingest(base.Add(time.Duration(i)*time.Hour), 100e6)
+	}
+	// Other links filling the global sample cap must not erase the baseline.
+	s.mu.Lock()
+	s.WirelessLinkSamples = nil
+	s.mu.Unlock()
+
+	link := ingest(base.Add(24*time.Hour), 30e6)
+	if link.Baseline == nil || link.Baseline.SampleCount != minBaselineSamples || *link.Baseline.DownlinkCapacityBps != 100e6 || !containsString(link.Reasons, "capacity_below_baseline") {
+		t.Fatalf("expected the rolling baseline to flag the capacity drop, got=%#v", link)
+	}
+}
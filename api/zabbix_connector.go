@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Zabbix severities 0-5 (not classified .. disaster) mapped onto incident
+// severities.
+var zabbixSeverities = []string{"info", "info", "warning", "warning", "high", "critical"}
+
+type ZabbixConfig struct {
+	URL      string
+	APIToken string
+	Username string
+	Password string
+	// LegacyAuth sends the token in the JSON-RPC "auth" field and reads host
+	// groups with selectGroups, for Zabbix before 6.4.
+	LegacyAuth bool
+	HostGroups []string
+	SiteID     string
+}
+
+// ZabbixConnector imports host availability and active problems from the
+// Zabbix JSON-RPC API instead of polling the devices again.
+type ZabbixConnector struct {
+	*VendorConnector
+	endpoint   string
+	legacyAuth bool
+	groups     map[string]bool
+	siteID     string
+	session    *zabbixSession
+}
+
+// zabbixSession holds the API token or the user.login session. It also
+// implements ConnectorAuth for the header style so an expired session is
+// re-established once per request.
+type zabbixSession struct {
+	mu     sync.Mutex
+	static string
+	token  string
+	login  func(ctx context.Context) (string, error)
+	header bool
+}
+
+func (z *zabbixSession) Token(ctx context.Context) (string, error) {
+	if z.static != "" {
+		return z.static, nil
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.token != "" {
+		return z.token, nil
+	}
+	token, err := z.login(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrConnectorAuthFailed, err)
+	}
+	z.token = token
+	return token, nil
+}
+
+func (z *zabbixSession) Apply(ctx context.Context, req *http.Request) error {
+	if !z.header {
+		return nil
+	}
+	token, err := z.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (z *zabbixSession) Invalidate() bool {
+	if z.static != "" {
+		return false
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.token = ""
+	return true
+}
+
+func NewZabbixConnector(cfg ZabbixConfig) *ZabbixConnector {
+	endpoint := strings.TrimRight(strings.TrimSpace(cfg.URL), "/")
+	if endpoint != "" && !strings.HasSuffix(endpoint, ".php") {
+		endpoint += "/api_jsonrpc.php"
+	}
+	token := strings.TrimSpace(cfg.APIToken)
+	vendor := NewVendorConnector("zabbix", "Zabbix", endpoint, token, "", "bearer")
+	z := &ZabbixConnector{
+		VendorConnector: vendor,
+		endpoint:        endpoint,
+		legacyAuth:      cfg.LegacyAuth,
+		groups:          map[string]bool{},
+		siteID:          firstNonEmpty(cfg.SiteID, "zabbix"),
+	}
+	for _, group := range cfg.HostGroups {
+		if group = strings.TrimSpace(group); group != "" {
+			z.groups[group] = true
+		}
+	}
+	vendor.fetcher = z.fetchZabbixRecords
+
+	if token != "" || (strings.TrimSpace(cfg.Username) != "" && cfg.Password != "") {
+		username, password := cfg.Username, cfg.Password
+		z.session = &zabbixSession{static: token, header: !cfg.LegacyAuth}
+		z.session.login = func(ctx context.Context) (string, error) {
+			var session string
+			err := z.call(ctx, "user.login", map[string]string{"username": username, "password": password}, 0, false, &session)
+			return session, err
+		}
+		vendor.SetAuth(z.session)
+	}
+	return z
+}
+
+// call issues one JSON-RPC request. A "re-login" error drops the session
+// and retries once, since Zabbix reports expired sessions with HTTP 200.
+func (z *ZabbixConnector) call(ctx context.Context, method string, params any, retries int, authed bool, out any) error {
+	for attempt := 0; ; attempt++ {
+		payload := map[string]any{"jsonrpc": "2.0", "method": method, "params": params, "id": 1}
+		var auth ConnectorAuth
+		if authed {
+			if z.legacyAuth {
+				token, err := z.session.Token(ctx)
+				if err != nil {
+					return err
+				}
+				payload["auth"] = token
+			} else {
+				auth = z.session
+			}
+		}
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body, _, err := postSourceBody(ctx, z.client, z.endpoint, raw, retries, z.source, auth, z.guard, nil)
+		if err != nil {
+			return err
+		}
+		var envelope struct {
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+				Data    string `json:"data"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return fmt.Errorf("zabbix %s invalid json: %w", method, err)
+		}
+		if envelope.Error != nil {
+			detail := strings.TrimSpace(envelope.Error.Message + " " + envelope.Error.Data)
+			if authed && attempt == 0 && isZabbixSessionError(detail) && z.session.Invalidate() {
+				continue
+			}
+			return fmt.Errorf("zabbix %s: %s", method, detail)
+		}
+		return json.Unmarshal(envelope.Result, out)
+	}
+}
+
+func isZabbixSessionError(detail string) bool {
+	detail = strings.ToLower(detail)
+	return strings.Contains(detail, "re-login") || strings.Contains(detail, "not authori")
+}
+
+func (z *ZabbixConnector) fetchZabbixRecords(ctx context.Context, retries int) (pagedFetchResult, error) {
+	if z.session == nil {
+		return pagedFetchResult{}, ErrConnectorAuthFailed
+	}
+	groupsParam := "selectHostGroups"
+	if z.legacyAuth {
+		groupsParam = "selectGroups"
+	}
+	var hosts []map[string]any
+	err := z.call(ctx, "host.get", map[string]any{
+		"output":           []string{"hostid", "host", "name", "status"},
+		"monitored_hosts":  true,
+		"selectInterfaces": []string{"ip", "dns", "available", "main"},
+		"selectInventory":  []string{"serialno_a", "macaddress_a", "model", "vendor", "type"},
+		groupsParam:        []string{"name"},
+	}, retries, true, &hosts)
+	if err != nil {
+		return pagedFetchResult{}, err
+	}
+
+	result := pagedFetchResult{Pages: 1, Problems: []SourceProblem{}}
+	deviceByHostID := map[string]string{}
+	for _, host := range hosts {
+		rec, ok := z.parseHost(host)
+		if !ok {
+			continue
+		}
+		deviceByHostID[pickString(host, []string{"hostid"})] = rec.ID
+		result.Records = append(result.Records, rec)
+	}
+
+	var problems []map[string]any
+	if err := z.call(ctx, "problem.get", map[string]any{
+		"output": []string{"eventid", "objectid", "name", "severity", "clock"},
+		"source": 0,
+		"object": 0,
+		"recent": false,
+	}, retries, true, &problems); err != nil {
+		return result, err
+	}
+	result.Pages++
+	if len(problems) == 0 {
+		return result, nil
+	}
+
+	triggerIDs := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		triggerIDs = append(triggerIDs, pickString(problem, []string{"objectid"}))
+	}
+	var triggers []map[string]any
+	if err := z.call(ctx, "trigger.get", map[string]any{
+		"output":      []string{"triggerid"},
+		"triggerids":  triggerIDs,
+		"selectHosts": []string{"hostid"},
+	}, retries, true, &triggers); err != nil {
+		return result, err
+	}
+	result.Pages++
+	hostsByTrigger := map[string][]string{}
+	for _, trigger := range triggers {
+		triggerID := pickString(trigger, []string{"triggerid"})
+		items, _ := trigger["hosts"].([]any)
+		for _, raw := range items {
+			if host, ok := raw.(map[string]any); ok {
+				hostsByTrigger[triggerID] = append(hostsByTrigger[triggerID], pickString(host, []string{"hostid"}))
+			}
+		}
+	}
+	for _, problem := range problems {
+		eventID := pickString(problem, []string{"eventid"})
+		severity := zabbixSeverities[0]
+		if level := pickFloat(problem, []string{"severity"}); level != nil && int(*level) >= 0 && int(*level) < len(zabbixSeverities) {
+			severity = zabbixSeverities[int(*level)]
+		}
+		for _, hostID := range hostsByTrigger[pickString(problem, []string{"objectid"})] {
+			deviceID, ok := deviceByHostID[hostID]
+			if !ok {
+				continue
+			}
+			result.Problems = append(result.Problems, SourceProblem{
+				ExternalID:  eventID + ":" + hostID,
+				DeviceID:    deviceID,
+				Type:        "zabbix_problem",
+				Severity:    severity,
+				Message:     pickString(problem, []string{"name"}),
+				StartedAtMs: pickTimestampMs(problem, []string{"clock"}),
+			})
+		}
+	}
+	return result, nil
+}
+
+// parseHost maps a monitored host. A host is down when its main interface
+// is unavailable; agent-active hosts report unknown and count as up.
+func (z *ZabbixConnector) parseHost(host map[string]any) (uiSPDeviceRecord, bool) {
+	technical := pickString(host, []string{"host"})
+	if technical == "" {
+		return uiSPDeviceRecord{}, false
+	}
+	siteID := ""
+	for _, key := range []string{"hostgroups", "groups"} {
+		if siteID != "" {
+			break
+		}
+		groups, _ := host[key].([]any)
+		for _, raw := range groups {
+			group, _ := raw.(map[string]any)
+			name := pickString(group, []string{"name"})
+			if name == "" || (len(z.groups) > 0 && !z.groups[name]) {
+				continue
+			}
+			siteID = name
+			break
+		}
+	}
+	if len(z.groups) > 0 && siteID == "" {
+		return uiSPDeviceRecord{}, false
+	}
+
+	online, address := true, ""
+	interfaces, _ := host["interfaces"].([]any)
+	for _, raw := range interfaces {
+		iface, _ := raw.(map[string]any)
+		if pickString(iface, []string{"main"}) != "1" && len(interfaces) > 1 {
+			continue
+		}
+		address = firstNonEmpty(address, pickString(iface, []string{"dns"}), pickString(iface, []string{"ip"}))
+		if pickString(iface, []string{"available"}) == "2" {
+			online = false
+		}
+	}
+	inventory, _ := host["inventory"].(map[string]any)
+	return uiSPDeviceRecord{
+		ID:     technical,
+		Name:   firstNonEmpty(pickString(host, []string{"name"}), technical),
+		Role:   normalizeVendorRole(pickString(inventory, []string{"type"})),
+		SiteID: firstNonEmpty(siteID, z.siteID),
+		Host:   address,
+		Mac:    strings.ToLower(pickString(inventory, []string{"macaddress_a"})),
+		Serial: pickString(inventory, []string{"serialno_a"}),
+		Model:  pickString(inventory, []string{"model"}),
+		Vendor: firstNonEmpty(pickString(inventory, []string{"vendor"}), "Zabbix"),
+		Online: online,
+	}, true
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// zabbixStandIn answers the JSON-RPC methods the connector uses. Problems
+// can be swapped between polls and the session can be expired.
+type zabbixStandIn struct {
+	mu       sync.Mutex
+	legacy   bool
+	session  string
+	logins   int
+	problems string
+}
+
+func (z *zabbixStandIn) serve(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api_jsonrpc.php" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Auth   string          `json:"auth"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		z.mu.Lock()
+		defer z.mu.Unlock()
+		reply := func(result string) {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","result":` + result + `,"id":1}`))
+		}
+		if req.Method == "user.login" {
+			var params map[string]string
+			_ = json.Unmarshal(req.Params, &params)
+			if params["username"] != "noc" || params["password"] != "pw" {
+				_, _ = w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params.","data":"Incorrect user name or password."},"id":1}`))
+				return
+			}
+			z.logins++
+			z.session = "sess-" + strconv.Itoa(z.logins)
+			reply(`"` + z.session + `"`)
+			return
+		}
+		token := req.Auth
+		if !z.legacy {
+			token = r.Header.Get("Authorization")
+			if len(token) > 7 {
+				token = token[7:]
+			}
+		}
+		if token == "" || (token != "api-token" && token != z.session) {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params.","data":"Session terminated, re-login, please."},"id":1}`))
+			return
+		}
+		switch req.Method {
+		case "host.get":
+			groups := "hostgroups"
+			if z.legacy {
+				groups = "groups"
+			}
+			reply(`[
+				{"hostid":"10101","host":"core-sw-1","name":"Core Switch 1","status":"0",
+				 "interfaces":[{"ip":"10.1.0.1","dns":"","available":"1","main":"1"}],
+				 "inventory":{"serialno_a":"FOC123","macaddress_a":"00:11:22:33:44:55","model":"C9300","vendor":"Cisco","type":"switch"},
+				 "` + groups + `":[{"name":"Linux servers"},{"name":"Branch A"}]},
+				{"hostid":"10102","host":"edge-rtr-1","name":"Edge Router 1","status":"0",
+				 "interfaces":[{"ip":"10.1.0.2","dns":"edge-rtr-1.example.net","available":"2","main":"1"},{"ip":"10.9.9.9","available":"1","main":"0"}],
+				 "inventory":[],
+				 "` + groups + `":[{"name":"Branch A"}]},
+				{"hostid":"10103","host":"lab-host","name":"Lab","status":"0","interfaces":[],"` + groups + `":[{"name":"Lab"}]}
+			]`)
+		case "problem.get":
+			reply(z.problems)
+		case "trigger.get":
+			reply(`[{"triggerid":"2001","hosts":[{"hostid":"10101"}]},{"triggerid":"2002","hosts":[{"hostid":"10102"}]},{"triggerid":"2003","hosts":[{"hostid":"10103"}]}]`)
+		default:
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found."},"id":1}`))
+		}
+	}))
+}
+
+func TestZabbixConnectorImportsHostsAndProblems(t *testing.T) {
+	standIn := &zabbixStandIn{problems: `[
+		{"eventid":"501","objectid":"2001","name":"High CPU utilization","severity":"4","clock":"1767225600"},
+		{"eventid":"502","objectid":"2002","name":"Unavailable by ICMP ping","severity":"5","clock":"1767225660"},
+		{"eventid":"503","objectid":"2003","name":"Lab disk full","severity":"2","clock":"1767225660"}
+	]`}
+	server := standIn.serve(t)
+	defer server.Close()
+
+	connector := NewZabbixConnector(ZabbixConfig{URL: server.URL, Username: "noc", Password: "pw", HostGroups: []string{"Branch A"}})
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 50, FullSync: true})
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if batch.Response.Demo || len(batch.Events) != 2 || !batch.ProblemsFetched {
+		t.Fatalf("expected two Branch A hosts with problems, demo=%v events=%#v", batch.Response.Demo, batch.Events)
+	}
+	core, edge := batch.Events[0], batch.Events[1]
+	if core.DeviceID != "core-sw-1" || core.SiteID != "Branch A" || core.Serial != "FOC123" || core.Role != "switch" || !*core.Online {
+		t.Fatalf("unexpected core host mapping: %#v", core)
+	}
+	if edge.Hostname != "edge-rtr-1.example.net" || *edge.Online || edge.EventType != "device_down" {
+		t.Fatalf("expected unavailable main interface to mark edge offline, got=%#v", edge)
+	}
+	if len(batch.Problems) != 2 || batch.Problems[0].Severity != "high" || batch.Problems[1].Severity != "critical" || batch.Problems[1].DeviceID != "edge-rtr-1" {
+		t.Fatalf("expected problems only for Branch A hosts, got=%#v", batch.Problems)
+	}
+
+	store := LoadStore("")
+	ingestSourceEvents(store, batch.Events)
+	sync := syncSourceProblemsBatch(store, connector.Name(), batch)
+	if len(sync.Opened) != 2 {
+		t.Fatalf("expected two problem incidents, got=%#v", sync)
+	}
+
+	// Session expiry forces one re-login; the CPU problem clears.
+	standIn.mu.Lock()
+	standIn.session = "expired"
+	standIn.problems = `[{"eventid":"502","objectid":"2002","name":"Unavailable by ICMP ping","severity":"5","clock":"1767225660"}]`
+	standIn.mu.Unlock()
+	batch, err = connector.Poll(context.Background(), SourcePollRequest{Limit: 50})
+	if err != nil {
+		t.Fatalf("poll after session expiry: %v", err)
+	}
+	if standIn.logins != 2 {
+		t.Fatalf("expected re-login after session expiry, logins=%d", standIn.logins)
+	}
+	sync = syncSourceProblemsBatch(store, connector.Name(), batch)
+	if sync.Active != 1 || len(sync.Resolved) != 1 || len(sync.Opened) != 0 {
+		t.Fatalf("expected CPU problem to resolve, got=%#v", sync)
+	}
+}
+
+func TestZabbixConnectorLegacyTokenAuth(t *testing.T) {
+	standIn := &zabbixStandIn{legacy: true, problems: `[]`}
+	server := standIn.serve(t)
+	defer server.Close()
+
+	connector := NewZabbixConnector(ZabbixConfig{URL: server.URL + "/api_jsonrpc.php", APIToken: "api-token", LegacyAuth: true})
+	batch, err := connector.Poll(context.Background(), SourcePollRequest{Limit: 50, FullSync: true})
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(batch.Events) != 3 || !batch.ProblemsFetched || len(batch.Problems) != 0 {
+		t.Fatalf("expected all hosts and an empty problem list, events=%d problems=%#v", len(batch.Events), batch.Problems)
+	}
+	if batch.Events[0].SiteID != "Linux servers" {
+		t.Fatalf("expected first host group as site without a group filter, got=%q", batch.Events[0].SiteID)
+	}
+
+	demo := NewZabbixConnector(ZabbixConfig{URL: server.URL})
+	if batch, err := demo.Poll(context.Background(), SourcePollRequest{Limit: 10}); err != nil || !batch.Response.Demo || batch.ProblemsFetched {
+		t.Fatalf("expected demo poll without credentials, demo=%v err=%v", batch.Response.Demo, err)
+	}
+}
@@ -2489,12 +2489,15 @@ function renderIncidentWorkspace(){
   const assignedCount = Number(incidentWorkspaceCache.assigned_count || 0);
   const unassignedCount = Number(incidentWorkspaceCache.unassigned_count || Math.max(0, activeCount - assignedCount));
   const recentCount = Number(incidentWorkspaceCache.recent_count || recent.length || 0);
+  const affectedSubscribers = Number(incidentWorkspaceCache.affected_subscribers || 0);
+  const affectedPaying = Number(incidentWorkspaceCache.affected_paying_subscribers || 0);
 
   summaryEl.innerHTML = [
     `<span class="badge ${activeCount > 0 ? "warn" : "good"}">Active Incidents: ${activeCount}</span>`,
     `<span class="badge ${unassignedCount > 0 ? "warn" : "good"}">Unassigned: ${unassignedCount}</span>`,
     `<span class="badge good">Assigned: ${assignedCount}</span>`,
-    `<span class="badge good">Recent: ${recentCount}</span>`
+    `<span class="badge good">Recent: ${recentCount}</span>`,
+    `<span class="badge ${affectedSubscribers > 0 ? "warn" : "good"}">Subscribers Affected: ${affectedSubscribers} (${affectedPaying} paying)</span>`
   ].join(" ");
 
   if(active.length === 0){
@@ -2510,6 +2513,8 @@ function renderIncidentWorkspace(){
       const source = escapeHtml(inc && inc.source || "--");
       const commander = String(inc && inc.commander || "").trim();
       const commanderLabel = commander ? escapeHtml(commander) : "<em>Unassigned</em>";
+      const subscribers = Number(inc && inc.affected_subscribers || 0);
+      const payingSubscribers = Number(inc && inc.affected_paying_subscribers || 0);
       const timeline = Array.isArray(inc && inc.command_timeline) ? inc.command_timeline : [];
       const latest = timeline.length ? timeline[timeline.length - 1] : null;
       const latestText = latest && latest.message ? escapeHtml(latest.message) : "No command timeline entries yet.";
@@ -2521,6 +2526,7 @@ function renderIncidentWorkspace(){
         <div><strong>${deviceID}</strong> <span class="topology-ha-sep">(${type})</span></div>
         <div class="topology-ha-meta">
           <span class="badge ${incidentSeverityBadgeClass(severity)}">${severity}</span>
+          ${subscribers > 0 ? `<span class="badge warn">Subscribers: ${subscribers} (${payingSubscribers} paying)</span>` : ""}
           <span>Commander: ${commanderLabel}</span>
           <span>Started: ${escapeHtml(started)}</span>
           <span>Source: ${source}</span>
@@ -2878,7 +2884,8 @@ function renderTopologyGraph(){
     const edgeId = edge.edge_id || `${edge.from_node_id}->${edge.to_node_id}`;
     const isHighlight = highlightedEdgeSet.has(edgeId);
     const dim = hasTrace && !isHighlight;
-    edgeSvg += `<line class="topo-edge ${state} ${dim ? "dimmed" : ""}" x1="${a.x.toFixed(1)}" y1="${a.y.toFixed(1)}" x2="${b.x.toFixed(1)}" y2="${b.y.toFixed(1)}"></line>`;
+    const wireless = edge.protocol === "wireless" ? `wireless ${edge.link_status === "degraded" ? "degraded" : ""}` : "";
+    edgeSvg += `<line class="topo-edge ${state} ${wireless} ${dim ? "dimmed" : ""}" x1="${a.x.toFixed(1)}" y1="${a.y.toFixed(1)}" x2="${b.x.toFixed(1)}" y2="${b.y.toFixed(1)}"></line>`;
   });
 
   let nodeSvg = "";
@@ -3053,6 +3060,8 @@ async function loadTopology(force){
           assigned_count: Number(workspacePayload.assigned_count || 0),
           unassigned_count: Number(workspacePayload.unassigned_count || 0),
           recent_count: Number(workspacePayload.recent_count || 0),
+          affected_subscribers: Number(workspacePayload.affected_subscribers || 0),
+          affected_paying_subscribers: Number(workspacePayload.affected_paying_subscribers || 0),
           fetched_at: workspacePayload.fetched_at || ""
         };
         setIncidentWorkspaceStatus(`Incident workspace loaded: ${incidentWorkspaceCache.active_count} active (${incidentWorkspaceCache.unassigned_count} unassigned).`, false);